@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/config"
+	"nekobridge/internal/database"
+	"nekobridge/internal/utils"
+)
+
+// 指定配置文件和数据目录的环境变量，优先级低于对应的命令行参数
+const (
+	configPathEnv = "NEKOBRIDGE_CONFIG"
+	dataDirEnv    = "NEKOBRIDGE_DATA_DIR"
+)
+
+// errUsage 命令行参数错误，用法说明已经输出
+var errUsage = errors.New("参数错误")
+
+// options 所有子命令共用的命令行参数
+type options struct {
+	configPath string
+	dataDir    string
+	overrides  config.Overrides
+}
+
+// resolve 未指定的路径依次取环境变量和默认值，并设置数据目录
+func (o *options) resolve() {
+	if o.configPath == "" {
+		o.configPath = os.Getenv(configPathEnv)
+	}
+	if o.configPath == "" {
+		o.configPath = config.FindConfigFile()
+	}
+	if o.dataDir == "" {
+		o.dataDir = os.Getenv(dataDirEnv)
+	}
+	if o.dataDir == "" {
+		o.dataDir = database.DataDir
+	}
+	database.DataDir = o.dataDir
+}
+
+// commandFlags 子命令的参数，包含公共参数 --config、--data-dir、--set
+type commandFlags struct {
+	*flag.FlagSet
+	options options
+}
+
+// newCommandFlags 创建子命令的参数集，args 为位置参数的说明
+func newCommandFlags(name, args string) *commandFlags {
+	flags := &commandFlags{
+		FlagSet: flag.NewFlagSet(name, flag.ContinueOnError),
+		options: options{overrides: config.Overrides{}},
+	}
+	flags.StringVar(&flags.options.configPath, "config", "",
+		"配置文件路径，默认依次查找 config.yaml、configs/config.yaml、/etc/qq-webhook-pro/config.yaml (环境变量 "+configPathEnv+")")
+	flags.StringVar(&flags.options.dataDir, "data-dir", "",
+		"数据目录，保存数据库文件和上传的文件，默认为 data (环境变量 "+dataDirEnv+")")
+	flags.Var(flags.options.overrides, "set", "覆盖配置项，格式为 key=value，可重复指定，优先级高于环境变量，例如 --set websocket.max_message_size=65536")
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "用法: nekobridge %s [参数] %s\n\n参数:\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parse 解析参数，参数和位置参数可以交替出现；位置参数的数量不在 [min, max] 范围内时输出用法并返回 errUsage
+func (f *commandFlags) parse(args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := f.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		args = f.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if len(positional) < min || len(positional) > max {
+		f.Usage()
+		return nil, errUsage
+	}
+	f.options.resolve()
+	return positional, nil
+}
+
+// command 命令行子命令
+type command struct {
+	name        string
+	summary     string
+	run         func(args []string) error
+	subcommands []*command
+}
+
+// commands 所有子命令，不指定子命令时执行 serve
+var commands = []*command{
+	{name: "serve", summary: "启动服务（默认）", run: runServe},
+	{name: "migrate", summary: "升级或回滚数据库表结构", run: runMigrate},
+	{name: "secret", summary: "管理密钥", subcommands: []*command{
+		{name: "add", summary: "添加密钥", run: runSecretAdd},
+		{name: "list", summary: "列出密钥", run: runSecretList},
+		{name: "enable", summary: "启用密钥", run: runSecretEnable},
+		{name: "disable", summary: "禁用密钥", run: runSecretDisable},
+		{name: "delete", summary: "删除密钥及其离线队列", run: runSecretDelete},
+		{name: "rotate", summary: "将密钥替换为新值，保留设置和历史记录", run: runSecretRotate},
+	}},
+	{name: "ban", summary: "管理封禁", subcommands: []*command{
+		{name: "add", summary: "封禁密钥", run: runBanAdd},
+		{name: "remove", summary: "解除封禁", run: runBanRemove},
+		{name: "list", summary: "列出封禁记录", run: runBanList},
+	}},
+	{name: "user", summary: "管理后台用户", subcommands: []*command{
+		{name: "add", summary: "创建用户", run: runUserAdd},
+		{name: "passwd", summary: "重置用户密码", run: runUserPasswd},
+	}},
+	{name: "hash-password", summary: "生成 auth.password 可用的 bcrypt 哈希", run: runHashPassword},
+	{name: "config", summary: "检查配置", subcommands: []*command{
+		{name: "validate", summary: "检查配置文件、环境变量和命令行参数", run: runConfigValidate},
+		{name: "print-effective", summary: "输出合并各层之后的有效配置", run: runConfigPrintEffective},
+	}},
+	{name: "backup", summary: "备份数据库、配置文件和上传的文件", run: runBackup},
+	{name: "restore", summary: "从备份文件恢复", run: runRestore},
+}
+
+// runCommand 执行子命令，返回进程退出码
+// 第一个参数为空或以 - 开头时执行 serve，兼容不带子命令的启动方式
+func runCommand(args []string) int {
+	if len(args) > 0 && isHelp(args[0]) {
+		printUsage(os.Stdout, "", commands)
+		return 0
+	}
+
+	cmd := commands[0]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		path, list := "", commands
+		for {
+			if len(args) > 0 && isHelp(args[0]) {
+				printUsage(os.Stdout, path, list)
+				return 0
+			}
+			if len(args) == 0 || findCommand(list, args[0]) == nil {
+				if len(args) > 0 {
+					fmt.Fprintf(os.Stderr, "未知的命令: %s\n\n", strings.TrimSpace(path+" "+args[0]))
+				}
+				printUsage(os.Stderr, path, list)
+				return 2
+			}
+
+			cmd = findCommand(list, args[0])
+			path = strings.TrimSpace(path + " " + cmd.name)
+			args = args[1:]
+			if cmd.run != nil {
+				break
+			}
+			list = cmd.subcommands
+		}
+	}
+
+	err := cmd.run(args)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+}
+
+// isHelp 检查是否为查看帮助的参数
+func isHelp(arg string) bool {
+	return arg == "help" || arg == "-h" || arg == "--help"
+}
+
+// findCommand 按名称查找子命令
+func findCommand(list []*command, name string) *command {
+	for _, cmd := range list {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// printUsage 输出子命令列表，path 为上级命令
+func printUsage(out io.Writer, path string, list []*command) {
+	if path == "" {
+		fmt.Fprintln(out, "用法: nekobridge [命令] [参数]")
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, "不指定命令时启动服务，等同于 serve。")
+	} else {
+		fmt.Fprintf(out, "用法: nekobridge %s <命令> [参数]\n", path)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "命令:")
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, cmd := range list {
+		name := cmd.name
+		if len(cmd.subcommands) > 0 {
+			names := make([]string, 0, len(cmd.subcommands))
+			for _, sub := range cmd.subcommands {
+				names = append(names, sub.name)
+			}
+			name += " " + strings.Join(names, "|")
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", name, cmd.summary)
+	}
+	w.Flush()
+
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "使用 \"%s <命令> -h\" 查看命令的参数。\n", strings.TrimSpace("nekobridge "+path))
+}
+
+// configureDatabase 按配置文件、环境变量和命令行参数设置数据库连接，不读取数据库中的配置
+func configureDatabase(opts options) error {
+	store := config.NewStore(opts.configPath)
+	store.SetOverrides(opts.overrides)
+	report, err := store.Inspect()
+	if err != nil {
+		return err
+	}
+	database.Configure(report.Config.Database)
+	return nil
+}
+
+// openDatabase 连接数据库并创建或升级表结构
+func openDatabase(opts options) error {
+	if err := configureDatabase(opts); err != nil {
+		return err
+	}
+	return database.InitDatabase()
+}
+
+// newConfigStore 创建与 serve 相同分层的配置存储，数据库存在时读取数据库中的配置，不会创建 SQLite 数据库
+func newConfigStore(opts options) (*config.Store, error) {
+	if err := configureDatabase(opts); err != nil {
+		return nil, err
+	}
+	store := config.NewStore(opts.configPath)
+	store.SetOverrides(opts.overrides)
+
+	if database.Driver() != config.DatabaseSQLite || fileExists(database.Path()) {
+		if err := database.Open(); err != nil {
+			return nil, err
+		}
+		// 尚未执行迁移的空数据库中没有系统配置
+		if database.DB.Migrator().HasTable(&database.SystemConfig{}) {
+			configService := &database.ConfigService{}
+			store.SetDatabaseLayer(configService.GetAllConfigs)
+		}
+	}
+	return store, nil
+}
+
+// runMigrate 升级或回滚数据库表结构，升级到最新版本时同时写入缺少的默认数据
+func runMigrate(args []string) error {
+	flags := newCommandFlags("migrate", "")
+	to := flags.Uint("to", 0, "升级或回滚到指定版本，默认为最新版本")
+	dryRun := flags.Bool("dry-run", false, "只列出需要执行的迁移，不修改数据库")
+	status := flags.Bool("status", false, "列出所有迁移及执行状态")
+	if _, err := flags.parse(args, 0, 0); err != nil {
+		return err
+	}
+	opts := flags.options
+	if err := configureDatabase(opts); err != nil {
+		return err
+	}
+
+	latest := database.SchemaVersion()
+	target := latest
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "to" {
+			target = *to
+		}
+	})
+
+	// 只查看时不创建 SQLite 数据库文件
+	if (*status || *dryRun) && database.Driver() == config.DatabaseSQLite && !fileExists(database.Path()) {
+		return fmt.Errorf("数据库文件不存在: %s", database.Path())
+	}
+	if err := database.Open(); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if *status {
+		return printMigrations()
+	}
+
+	steps, err := database.Migrate(target, *dryRun)
+	for _, step := range steps {
+		printMigrationStep(step, *dryRun)
+	}
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 {
+		fmt.Printf("✅ 数据库已是版本 %d，无需迁移\n", target)
+	} else if !*dryRun {
+		fmt.Printf("✅ 数据库已迁移到版本 %d\n", target)
+	}
+	if *dryRun || target != latest {
+		return nil
+	}
+
+	// 与 serve 启动时相同，检查数据库和配置并写入缺少的默认数据
+	if err := database.Close(); err != nil {
+		return err
+	}
+	initializeDatabase(opts)
+	initializeSystemConfig(opts.configPath)
+	return nil
+}
+
+// printMigrations 输出所有迁移及执行状态
+func printMigrations() error {
+	statuses, err := database.Migrations()
+	if err != nil {
+		return err
+	}
+	current, err := database.CurrentVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("数据库版本: %d，程序支持的最新版本: %d\n\n", current, database.SchemaVersion())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tAPPLIED_AT\tDESCRIPTION")
+	for _, status := range statuses {
+		appliedAt := "-"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format(time.DateTime)
+		}
+		description := status.Description
+		if status.Unknown {
+			description += " (由更新的版本执行)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, appliedAt, description)
+	}
+	return w.Flush()
+}
+
+// printMigrationStep 输出迁移步骤，dryRun 时表示将要执行
+func printMigrationStep(step database.MigrationStep, dryRun bool) {
+	action := "升级到版本"
+	if step.Direction == database.MigrationDown {
+		action = "回滚版本"
+	}
+	if dryRun {
+		action = "将" + action
+	}
+	fmt.Printf("🔄 %s %d: %s\n", action, step.Version, step.Description)
+}
+
+// runHashPassword 输出密码的 bcrypt 哈希，未指定密码时从标准输入读取一行
+func runHashPassword(args []string) error {
+	flags := newCommandFlags("hash-password", "[密码]")
+	positional, err := flags.parse(args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	var password string
+	if len(positional) == 1 {
+		password = positional[0]
+	} else if password, err = readLine(os.Stdin); err != nil {
+		return err
+	}
+	if password == "" {
+		return errors.New("密码不能为空")
+	}
+
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+// runConfigValidate 检查配置，配置文件中有无法识别的配置项或取值无效时返回错误
+func runConfigValidate(args []string) error {
+	flags := newCommandFlags("config validate", "")
+	if _, err := flags.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	store, err := newConfigStore(flags.options)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	report, err := store.Inspect()
+	if err != nil {
+		return err
+	}
+
+	if report.Exists {
+		fmt.Printf("📁 配置文件: %s\n", store.Path())
+	} else {
+		fmt.Printf("⚠️  配置文件不存在，启动时将按默认配置创建: %s\n", store.Path())
+	}
+	for _, key := range report.Unknown {
+		fmt.Printf("⚠️  无法识别的配置项: %s\n", key)
+	}
+	for _, key := range report.Invalid {
+		source := report.Sources[key]
+		fmt.Printf("⚠️  配置项取值无效，将使用默认值: %s (来源: %s)\n", key, describeSource(source))
+	}
+
+	if problems := len(report.Unknown) + len(report.Invalid); problems > 0 {
+		return fmt.Errorf("配置检查发现 %d 个问题", problems)
+	}
+	fmt.Println("✅ 配置检查通过")
+	return nil
+}
+
+// runConfigPrintEffective 以 YAML 格式输出有效配置，默认不输出登录凭据
+func runConfigPrintEffective(args []string) error {
+	flags := newCommandFlags("config print-effective", "")
+	showSources := flags.Bool("sources", false, "按 key = value 逐行输出，并标注每个配置项的来源")
+	showCredentials := flags.Bool("show-credentials", false, "输出登录凭据（auth.password、auth.jwt_secret）")
+	if _, err := flags.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	store, err := newConfigStore(flags.options)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	report, err := store.Inspect()
+	if err != nil {
+		return err
+	}
+
+	settings := config.Settings(report.Config)
+	if !*showCredentials {
+		for _, key := range config.CredentialKeys {
+			settings[key] = audit.Redacted
+		}
+	}
+
+	if !*showSources {
+		data, err := config.EncodeSettings(settings)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(data)
+		return nil
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	config.SortKeys(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, key := range keys {
+		value, err := json.Marshal(settings[key])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s = %s\t# %s\n", key, value, describeSource(report.Sources[key]))
+	}
+	return w.Flush()
+}
+
+// describeSource 配置项来源的说明
+func describeSource(source config.Source) string {
+	if source.Name == "" {
+		return source.Layer
+	}
+	return source.Layer + " " + source.Name
+}
+
+// readLine 读取一行输入，去掉末尾的换行
+func readLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// recordAudit 以命令行身份写入审计记录，写入失败只输出警告
+func recordAudit(action, target string, before, after interface{}, opErr error) {
+	entry := &database.AuditLog{
+		Actor:  audit.ActorCLI,
+		Action: action,
+		Target: target,
+		Result: audit.ResultSuccess,
+	}
+	if opErr != nil {
+		entry.Result = audit.ResultFailure
+		entry.Detail = opErr.Error()
+	}
+
+	if before != nil || after != nil {
+		if changedBefore, changedAfter, err := audit.Diff(before, after); err == nil {
+			entry.Before = encodeAuditFields(changedBefore)
+			entry.After = encodeAuditFields(changedAfter)
+		}
+	}
+
+	auditService := &database.AuditService{}
+	if err := auditService.Record(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  写入审计记录失败: %v\n", err)
+	}
+}
+
+// encodeAuditFields 将变更字段编码为 JSON，没有字段时返回空字符串
+func encodeAuditFields(fields map[string]interface{}) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/database"
+)
+
+// 备份文件（tar.gz）中的条目名称
+const (
+	backupConfigName  = "config.yaml"
+	backupUploadsName = "uploads"
+)
+
+// restoredSuffix 恢复时被覆盖的文件改名保留，加上该后缀
+const restoredSuffix = ".before-restore"
+
+// runBackup 将数据库快照、配置文件和上传的文件打包为 tar.gz，服务运行时也可以执行
+func runBackup(args []string) error {
+	flags := newCommandFlags("backup", "[备份文件]")
+	positional, err := flags.parse(args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	output := fmt.Sprintf("nekobridge-backup-%s.tar.gz", time.Now().Format("20060102-150405"))
+	if len(positional) == 1 {
+		output = positional[0]
+	}
+	if err := configureSQLite(flags.options); err != nil {
+		return err
+	}
+	if _, err := os.Stat(database.Path()); err != nil {
+		return fmt.Errorf("数据库文件不存在: %s", database.Path())
+	}
+
+	if err := database.Open(); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// 先在临时目录中生成数据库快照，避免打包过程中数据库被修改
+	tempDir, err := os.MkdirTemp("", "nekobridge-backup-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+	snapshot := filepath.Join(tempDir, databaseName())
+	if err := database.Backup(snapshot); err != nil {
+		return fmt.Errorf("生成数据库快照失败: %w", err)
+	}
+
+	file, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("创建备份文件失败: %w", err)
+	}
+	uploads, err := writeBackup(file, snapshot, flags.options.configPath)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("写入备份文件失败: %w", err)
+	}
+
+	fmt.Printf("✅ 备份已保存: %s (上传的文件: %d 个)\n", output, uploads)
+	return nil
+}
+
+// writeBackup 写入备份内容，返回打包的上传文件数量；配置文件和上传目录不存在时跳过
+func writeBackup(w io.Writer, snapshot, configPath string) (int, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	if err := addBackupFile(tw, snapshot, databaseName()); err != nil {
+		return 0, err
+	}
+	if _, err := os.Stat(configPath); err == nil {
+		if err := addBackupFile(tw, configPath, backupConfigName); err != nil {
+			return 0, err
+		}
+	}
+
+	uploads := 0
+	uploadsDir := filepath.Join(database.DataDir, backupUploadsName)
+	err := filepath.WalkDir(uploadsDir, func(file string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(uploadsDir, file)
+		if err != nil {
+			return err
+		}
+		uploads++
+		return addBackupFile(tw, file, path.Join(backupUploadsName, filepath.ToSlash(rel)))
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return 0, err
+	}
+	return uploads, gz.Close()
+}
+
+// addBackupFile 将文件写入备份
+func addBackupFile(tw *tar.Writer, file, name string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// runRestore 从备份文件恢复数据库、配置文件和上传的文件，需要先停止服务
+// 数据库文件先检查完整性再替换，被覆盖的文件加上 .before-restore 后缀保留
+func runRestore(args []string) error {
+	flags := newCommandFlags("restore", "<备份文件>")
+	force := flags.Bool("force", false, "覆盖已有的数据库、配置文件和上传的文件")
+	positional, err := flags.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	configPath := flags.options.configPath
+	if err := configureSQLite(flags.options); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(database.DataDir, 0755); err != nil {
+		return fmt.Errorf("创建数据目录失败: %w", err)
+	}
+	// 解压到数据目录下的临时目录，保证之后可以直接改名替换
+	staging, err := os.MkdirTemp(database.DataDir, ".restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := extractBackup(positional[0], staging); err != nil {
+		return fmt.Errorf("读取备份文件失败: %w", err)
+	}
+
+	stagedDatabase := filepath.Join(staging, databaseName())
+	if _, err := os.Stat(stagedDatabase); err != nil {
+		return errors.New("备份文件中没有数据库")
+	}
+	if err := database.CheckIntegrity(stagedDatabase); err != nil {
+		return err
+	}
+	stagedConfig := filepath.Join(staging, backupConfigName)
+	hasConfig := fileExists(stagedConfig)
+	stagedUploads := filepath.Join(staging, backupUploadsName)
+	hasUploads := fileExists(stagedUploads)
+
+	targets := []string{database.Path()}
+	if hasConfig {
+		targets = append(targets, configPath)
+	}
+	if hasUploads {
+		targets = append(targets, filepath.Join(database.DataDir, backupUploadsName))
+	}
+	if !*force {
+		for _, target := range targets {
+			if fileExists(target) {
+				return fmt.Errorf("%s 已存在，确认覆盖请停止服务后加上 --force 重新执行", target)
+			}
+		}
+	}
+
+	if err := replaceWith(stagedDatabase, database.Path()); err != nil {
+		return fmt.Errorf("恢复数据库失败: %w", err)
+	}
+	fmt.Printf("✅ 数据库已恢复: %s\n", database.Path())
+
+	if hasConfig {
+		data, err := os.ReadFile(stagedConfig)
+		if err != nil {
+			return err
+		}
+		if err := setAside(configPath); err != nil {
+			return fmt.Errorf("保留原配置文件失败: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(configPath, data, 0644); err != nil {
+			return fmt.Errorf("恢复配置文件失败: %w", err)
+		}
+		fmt.Printf("✅ 配置文件已恢复: %s\n", configPath)
+	}
+
+	if hasUploads {
+		if err := replaceWith(stagedUploads, filepath.Join(database.DataDir, backupUploadsName)); err != nil {
+			return fmt.Errorf("恢复上传的文件失败: %w", err)
+		}
+		fmt.Println("✅ 上传的文件已恢复")
+	}
+	return nil
+}
+
+// configureSQLite 设置数据库连接，备份和恢复只支持 SQLite
+func configureSQLite(opts options) error {
+	if err := configureDatabase(opts); err != nil {
+		return err
+	}
+	if driver := database.Driver(); driver != config.DatabaseSQLite {
+		return fmt.Errorf("备份和恢复只支持 SQLite 数据库，%s 请使用 pg_dump 或 mysqldump", driver)
+	}
+	return nil
+}
+
+// extractBackup 将备份文件解压到 dir，只接受数据库、配置文件和上传目录中的普通文件
+func extractBackup(file, dir string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		if name != databaseName() && name != backupConfigName && !strings.HasPrefix(name, backupUploadsName+"/") {
+			return fmt.Errorf("无法识别的备份内容: %s", header.Name)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("无效的文件路径: %s", header.Name)
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// replaceWith 将 src 改名为 dst，dst 已存在时先改名保留
+func replaceWith(src, dst string) error {
+	if err := setAside(dst); err != nil {
+		return err
+	}
+	return os.Rename(src, dst)
+}
+
+// setAside 文件或目录存在时加上 .before-restore 后缀保留，覆盖上一次恢复保留的内容
+func setAside(name string) error {
+	if !fileExists(name) {
+		return nil
+	}
+	backup := name + restoredSuffix
+	if err := os.RemoveAll(backup); err != nil {
+		return err
+	}
+	if err := os.Rename(name, backup); err != nil {
+		return err
+	}
+	fmt.Printf("📦 原有的 %s 已改名为 %s\n", name, backup)
+	return nil
+}
+
+// databaseName 数据库文件在备份中的名称
+func databaseName() string {
+	return filepath.Base(database.Path())
+}
+
+// fileExists 检查文件或目录是否存在
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/config"
+	"nekobridge/internal/database"
+	"nekobridge/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// restartNotice 命令行直接修改数据库，运行中的服务重启后才会加载密钥的变化
+const restartNotice = "ℹ️  如果服务正在运行，需要重启服务后生效"
+
+// runSecretAdd 添加密钥
+func runSecretAdd(args []string) error {
+	flags := newCommandFlags("secret add", "<密钥>")
+	name := flags.String("name", "", "名称")
+	description := flags.String("description", "", "描述")
+	appID := flags.String("app-id", "", "机器人 AppID，用于按 AppID 接收 Webhook 和代理 OpenAPI")
+	maxConnections := flags.Int("max-connections", 1, "最大连接数")
+	protocol := flags.String("protocol", "", "连接协议 (raw、qq、bridge)，为空表示使用全局配置")
+	deliveryMode := flags.String("delivery-mode", "", "多客户端投递模式，为空表示使用全局配置")
+	upstreamURL := flags.String("upstream-url", "", "客户端消息转发的上游 HTTP 地址")
+	disabled := flags.Bool("disabled", false, "创建后处于禁用状态")
+	positional, err := flags.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	secret := strings.TrimSpace(positional[0])
+	switch {
+	case secret == "":
+		return errors.New("密钥不能为空")
+	case *protocol != "" && !config.IsValidProtocol(*protocol):
+		return fmt.Errorf("无效的连接协议: %s", *protocol)
+	case *deliveryMode != "" && !config.IsValidDeliveryMode(*deliveryMode):
+		return fmt.Errorf("无效的投递模式: %s", *deliveryMode)
+	case *upstreamURL != "" && !isValidUpstreamURL(*upstreamURL):
+		return fmt.Errorf("无效的上游地址: %s", *upstreamURL)
+	}
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	secretService := &database.SecretService{}
+	if _, err := secretService.GetSecret(secret); err == nil {
+		return errors.New("密钥已存在")
+	}
+	if *appID != "" {
+		secrets, err := secretService.GetSecrets()
+		if err != nil {
+			return err
+		}
+		for _, existing := range secrets {
+			if existing.AppID == *appID {
+				return fmt.Errorf("AppID 已被密钥 %s 使用", existing.Secret)
+			}
+		}
+	}
+
+	record := &database.Secret{
+		Secret:         secret,
+		Name:           *name,
+		Description:    *description,
+		AppID:          *appID,
+		Enabled:        !*disabled,
+		MaxConnections: *maxConnections,
+		DeliveryMode:   *deliveryMode,
+		Protocol:       *protocol,
+		UpstreamURL:    *upstreamURL,
+		CreatedBy:      audit.ActorCLI,
+	}
+	err = secretService.CreateSecret(record)
+	recordAudit(audit.ActionSecretCreate, utils.MaskSecret(secret), nil, record, err)
+	if err != nil {
+		return fmt.Errorf("创建密钥失败: %w", err)
+	}
+
+	fmt.Printf("✅ 密钥已添加: %s\n", secret)
+	fmt.Println(restartNotice)
+	return nil
+}
+
+// runSecretList 列出密钥
+func runSecretList(args []string) error {
+	flags := newCommandFlags("secret list", "")
+	if _, err := flags.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	secretService := &database.SecretService{}
+	secrets, err := secretService.GetSecrets()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SECRET\tNAME\tAPPID\tENABLED\tPROTOCOL\tMAX_CONN\tCREATED")
+	for _, secret := range secrets {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\t%d\t%s\n",
+			secret.Secret,
+			orDash(secret.Name),
+			orDash(secret.AppID),
+			secret.Enabled,
+			orDash(secret.Protocol),
+			secret.MaxConnections,
+			secret.CreatedAt.Format(time.DateTime),
+		)
+	}
+	return w.Flush()
+}
+
+// runSecretEnable 启用密钥，不会解除封禁记录
+func runSecretEnable(args []string) error {
+	return setSecretEnabled("secret enable", args, true)
+}
+
+// runSecretDisable 禁用密钥
+func runSecretDisable(args []string) error {
+	return setSecretEnabled("secret disable", args, false)
+}
+
+// setSecretEnabled 修改密钥的启用状态
+func setSecretEnabled(name string, args []string, enabled bool) error {
+	flags := newCommandFlags(name, "<密钥>")
+	positional, err := flags.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	secret := positional[0]
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	secretService := &database.SecretService{}
+	record, err := secretService.GetSecret(secret)
+	if err != nil {
+		return secretNotFound(err)
+	}
+
+	before := *record
+	record.Enabled = enabled
+	err = secretService.UpdateSecret(record)
+	recordAudit(audit.ActionSecretUpdate, utils.MaskSecret(secret), before, record, err)
+	if err != nil {
+		return fmt.Errorf("更新密钥失败: %w", err)
+	}
+
+	if enabled {
+		fmt.Printf("✅ 密钥已启用: %s\n", secret)
+	} else {
+		fmt.Printf("✅ 密钥已禁用: %s\n", secret)
+	}
+	fmt.Println(restartNotice)
+	return nil
+}
+
+// runSecretDelete 删除密钥并清空离线队列
+func runSecretDelete(args []string) error {
+	flags := newCommandFlags("secret delete", "<密钥>")
+	positional, err := flags.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	secret := positional[0]
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	secretService := &database.SecretService{}
+	before, err := secretService.GetSecret(secret)
+	if err != nil {
+		return secretNotFound(err)
+	}
+
+	err = secretService.DeleteSecret(secret)
+	recordAudit(audit.ActionSecretDelete, utils.MaskSecret(secret), before, nil, err)
+	if err != nil {
+		return fmt.Errorf("删除密钥失败: %w", err)
+	}
+
+	queueService := &database.QueueService{}
+	if err := queueService.ClearQueue(secret); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  清空离线队列失败: %v\n", err)
+	}
+
+	fmt.Printf("✅ 密钥已删除: %s\n", secret)
+	fmt.Println(restartNotice)
+	return nil
+}
+
+// runSecretRotate 将密钥替换为新值，设置、封禁记录、离线队列和流量统计迁移到新密钥
+func runSecretRotate(args []string) error {
+	flags := newCommandFlags("secret rotate", "<原密钥> <新密钥>")
+	positional, err := flags.parse(args, 2, 2)
+	if err != nil {
+		return err
+	}
+	secret, newSecret := positional[0], strings.TrimSpace(positional[1])
+	if newSecret == "" || newSecret == secret {
+		return errors.New("新密钥不能为空，且不能与原密钥相同")
+	}
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	secretService := &database.SecretService{}
+	if _, err := secretService.GetSecret(secret); err != nil {
+		return secretNotFound(err)
+	}
+	if _, err := secretService.GetSecret(newSecret); err == nil {
+		return errors.New("新密钥已存在")
+	}
+
+	err = secretService.RotateSecret(secret, newSecret)
+	recordAudit(audit.ActionSecretRotate, utils.MaskSecret(newSecret), map[string]string{"masked": utils.MaskSecret(secret)}, map[string]string{"masked": utils.MaskSecret(newSecret)}, err)
+	if err != nil {
+		return fmt.Errorf("替换密钥失败: %w", err)
+	}
+
+	fmt.Printf("✅ 密钥已替换: %s -> %s\n", secret, newSecret)
+	fmt.Println(restartNotice)
+	return nil
+}
+
+// runBanAdd 封禁密钥：禁用密钥并创建封禁记录
+func runBanAdd(args []string) error {
+	flags := newCommandFlags("ban add", "<密钥>")
+	reason := flags.String("reason", "", "封禁原因")
+	positional, err := flags.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	secret := positional[0]
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	secretService := &database.SecretService{}
+	record, err := secretService.GetSecret(secret)
+	if err != nil {
+		return secretNotFound(err)
+	}
+
+	banService := &database.BanService{}
+	history, err := banService.GetBanHistory(secret)
+	if err != nil {
+		return err
+	}
+	for _, ban := range history {
+		if ban.IsActive {
+			return fmt.Errorf("密钥已被封禁 (记录 #%d)", ban.ID)
+		}
+	}
+
+	before := map[string]interface{}{"enabled": record.Enabled}
+	after := map[string]interface{}{"enabled": false, "reason": *reason}
+	record.Enabled = false
+	if err := secretService.UpdateSecret(record); err != nil {
+		recordAudit(audit.ActionSecretBlock, utils.MaskSecret(secret), before, after, err)
+		return fmt.Errorf("更新密钥状态失败: %w", err)
+	}
+
+	ban := &database.BanRecord{
+		Secret:   secret,
+		Reason:   *reason,
+		BannedAt: time.Now(),
+		BannedBy: audit.ActorCLI,
+		IsActive: true,
+	}
+	if err := banService.CreateBanRecord(ban); err != nil {
+		// 密钥已经被禁用，封禁记录写入失败只输出警告
+		fmt.Fprintf(os.Stderr, "⚠️  创建封禁记录失败: %v\n", err)
+	}
+	recordAudit(audit.ActionSecretBlock, utils.MaskSecret(secret), before, after, nil)
+
+	fmt.Printf("✅ 密钥已封禁: %s\n", secret)
+	fmt.Println(restartNotice)
+	return nil
+}
+
+// runBanRemove 解除封禁：启用密钥并结束封禁记录
+func runBanRemove(args []string) error {
+	flags := newCommandFlags("ban remove", "<密钥>")
+	positional, err := flags.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	secret := positional[0]
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	secretService := &database.SecretService{}
+	record, err := secretService.GetSecret(secret)
+	if err != nil {
+		return secretNotFound(err)
+	}
+
+	before := map[string]interface{}{"enabled": record.Enabled}
+	after := map[string]interface{}{"enabled": true}
+	record.Enabled = true
+	if err := secretService.UpdateSecret(record); err != nil {
+		recordAudit(audit.ActionSecretUnblock, utils.MaskSecret(secret), before, after, err)
+		return fmt.Errorf("更新密钥状态失败: %w", err)
+	}
+
+	banService := &database.BanService{}
+	if err := banService.UnbanSecret(secret, audit.ActorCLI); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  解除封禁记录失败: %v\n", err)
+	}
+	recordAudit(audit.ActionSecretUnblock, utils.MaskSecret(secret), before, after, nil)
+
+	fmt.Printf("✅ 密钥已解封: %s\n", secret)
+	fmt.Println(restartNotice)
+	return nil
+}
+
+// runBanList 列出封禁记录，默认只列出生效中的封禁
+func runBanList(args []string) error {
+	flags := newCommandFlags("ban list", "")
+	all := flags.Bool("all", false, "包括已解除的封禁记录")
+	if _, err := flags.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	banService := &database.BanService{}
+	var bans []database.BanRecord
+	if *all {
+		records, err := banService.GetBanRecords()
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			bans = append(bans, *record)
+		}
+	} else {
+		records, err := banService.GetActiveBans()
+		if err != nil {
+			return err
+		}
+		bans = records
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSECRET\tACTIVE\tBANNED_AT\tBANNED_BY\tREASON")
+	for _, ban := range bans {
+		fmt.Fprintf(w, "%d\t%s\t%t\t%s\t%s\t%s\n",
+			ban.ID,
+			ban.Secret,
+			ban.IsActive,
+			ban.BannedAt.Format(time.DateTime),
+			orDash(ban.BannedBy),
+			orDash(ban.Reason),
+		)
+	}
+	return w.Flush()
+}
+
+// isValidUpstreamURL 检查上游地址是否为 http 或 https 地址
+func isValidUpstreamURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// secretNotFound 转换读取密钥时的错误
+func secretNotFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("密钥不存在")
+	}
+	return err
+}
+
+// orDash 空字符串在表格中显示为 -
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
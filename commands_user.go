@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/database"
+	"nekobridge/internal/rbac"
+	"nekobridge/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// 与管理接口一致的用户名和密码限制
+const (
+	minPasswordLength = 8
+	maxUsernameLength = 64
+)
+
+// runUserAdd 创建用户，未指定 --password-stdin 时生成随机密码并输出
+func runUserAdd(args []string) error {
+	flags := newCommandFlags("user add", "<用户名>")
+	role := flags.String("role", rbac.RoleAdmin, "角色: "+strings.Join(rbac.Roles(), ", "))
+	passwordStdin := flags.Bool("password-stdin", false, "从标准输入读取密码，否则生成随机密码")
+	disabled := flags.Bool("disabled", false, "创建后处于禁用状态")
+	positional, err := flags.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	username := strings.TrimSpace(positional[0])
+	if username == "" || len(username) > maxUsernameLength {
+		return errors.New("无效的用户名")
+	}
+	if !rbac.IsValidRole(*role) {
+		return fmt.Errorf("无效的角色，可选值: %s", strings.Join(rbac.Roles(), ", "))
+	}
+	password, generated, err := readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	userService := &database.UserService{}
+	if _, err := userService.GetUser(username); err == nil {
+		return errors.New("用户名已存在")
+	}
+
+	passwordHash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	user := &database.User{
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         *role,
+		Enabled:      !*disabled,
+		CreatedBy:    audit.ActorCLI,
+	}
+	err = userService.CreateUser(user)
+	recordAudit(audit.ActionUserCreate, username, nil, user, err)
+	if err != nil {
+		return fmt.Errorf("创建用户失败: %w", err)
+	}
+
+	fmt.Printf("✅ 用户已创建: %s (%s)\n", username, *role)
+	if generated {
+		fmt.Printf("🔑 初始密码: %s\n", password)
+	}
+	return nil
+}
+
+// runUserPasswd 重置用户密码并撤销该用户的所有会话，用于找回忘记密码的账号
+func runUserPasswd(args []string) error {
+	flags := newCommandFlags("user passwd", "<用户名>")
+	passwordStdin := flags.Bool("password-stdin", false, "从标准输入读取新密码，否则生成随机密码")
+	enable := flags.Bool("enable", false, "同时启用被禁用的账号")
+	resetTOTP := flags.Bool("reset-totp", false, "同时关闭两步验证（丢失验证器时使用）")
+	positional, err := flags.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	username := positional[0]
+
+	password, generated, err := readPassword(*passwordStdin)
+	if err != nil {
+		return err
+	}
+
+	if err := openDatabase(flags.options); err != nil {
+		return err
+	}
+	defer database.Close()
+
+	userService := &database.UserService{}
+	user, err := userService.GetUser(username)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("用户不存在")
+	}
+	if err != nil {
+		return err
+	}
+
+	before := *user
+	if user.PasswordHash, err = utils.HashPassword(password); err != nil {
+		return err
+	}
+	if *enable {
+		user.Enabled = true
+	}
+	err = userService.UpdateUser(user)
+	recordAudit(audit.ActionAuthPasswordChange, username, nil, nil, err)
+	if err != nil {
+		return fmt.Errorf("修改密码失败: %w", err)
+	}
+	if user.Enabled != before.Enabled {
+		recordAudit(audit.ActionUserUpdate, username, before, user, nil)
+	}
+
+	if *resetTOTP && user.TOTPEnabled {
+		err := userService.ResetTOTP(user.ID)
+		recordAudit(audit.ActionUserTOTPReset, username, nil, nil, err)
+		if err != nil {
+			return fmt.Errorf("关闭两步验证失败: %w", err)
+		}
+	}
+
+	// 已签发的令牌全部失效，需要用新密码重新登录
+	sessionService := &database.SessionService{}
+	revoked, err := sessionService.RevokeUserSessions(username, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  撤销会话失败: %v\n", err)
+	}
+
+	fmt.Printf("✅ 密码已重置: %s (已撤销 %d 个会话)\n", username, revoked)
+	if generated {
+		fmt.Printf("🔑 新密码: %s\n", password)
+	}
+	return nil
+}
+
+// readPassword 从标准输入读取密码，fromStdin 为 false 时生成随机密码
+func readPassword(fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		token, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			return "", false, err
+		}
+		return token[:20], true, nil
+	}
+
+	password, err = readLine(os.Stdin)
+	if err != nil {
+		return "", false, err
+	}
+	if len(password) < minPasswordLength {
+		return "", false, fmt.Errorf("密码长度不能少于%d位", minPasswordLength)
+	}
+	return password, false, nil
+}
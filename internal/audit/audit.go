@@ -0,0 +1,176 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"nekobridge/internal/utils"
+)
+
+// 审计操作，按 "对象.动作" 命名，查询时可以用对象前缀筛选
+const (
+	ActionConnectionKick = "connection.kick"
+
+	ActionSecretCreate  = "secret.create"
+	ActionSecretUpdate  = "secret.update"
+	ActionSecretDelete  = "secret.delete"
+	ActionSecretRotate  = "secret.rotate"
+	ActionSecretBlock   = "secret.block"
+	ActionSecretUnblock = "secret.unblock"
+	ActionSecretImport  = "secret.import"
+	ActionSecretExport  = "secret.export"
+	ActionSecretBatch   = "secret.batch"
+
+	ActionBanUpdate = "ban.update"
+	ActionBanDelete = "ban.delete"
+
+	ActionConfigUpdate          = "config.update"
+	ActionConfigWebSocketUpdate = "config.websocket.update"
+	ActionConfigSystemUpdate    = "config.system.update"
+	ActionConfigSystemReset     = "config.system.reset"
+	ActionConfigSystemInit      = "config.system.initialize"
+	ActionConfigRollback        = "config.rollback"
+
+	ActionUserCreate        = "user.create"
+	ActionUserUpdate        = "user.update"
+	ActionUserDelete        = "user.delete"
+	ActionUserSessionRevoke = "user.sessions.revoke"
+	ActionUserTOTPReset     = "user.totp.reset"
+
+	ActionSessionRevoke = "session.revoke"
+
+	ActionAPIKeyCreate = "apikey.create"
+	ActionAPIKeyRevoke = "apikey.revoke"
+
+	ActionAuthLogin          = "auth.login"
+	ActionAuthLockout        = "auth.lockout"
+	ActionAuthLockoutClear   = "auth.lockout.clear"
+	ActionAuthPasswordChange = "auth.password.change"
+	ActionAuthTOTPEnable     = "auth.totp.enable"
+	ActionAuthTOTPDisable    = "auth.totp.disable"
+
+	ActionAuditExport = "audit.export"
+)
+
+// 操作结果
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// ActorSystem 非用户发起的操作（例如登录锁定）记录的操作者
+const ActorSystem = "system"
+
+// ActorCLI 通过命令行子命令执行的操作记录的操作者
+const ActorCLI = "cli"
+
+// Redacted 敏感字段在审计记录中的替代值
+const Redacted = "***"
+
+// sensitiveFields 需要脱敏的字段名（小写、去掉下划线后比较）
+var sensitiveFields = map[string]bool{
+	"password":     true,
+	"passwordhash": true,
+	"jwtsecret":    true,
+	"token":        true,
+	"totpsecret":   true,
+	"dsn":          true,
+	"secret":       true,
+	"clientsecret": true,
+}
+
+// secretKeyedFields 以密钥为键的字段，展开时路径中的密钥会被遮盖
+var secretKeyedFields = map[string]bool{
+	"secrets": true,
+}
+
+// ignoredFields 每次保存都会变化、不需要记录的字段
+var ignoredFields = map[string]bool{
+	"updatedat": true,
+}
+
+// Diff 比较操作前后的对象，只返回发生变化的字段（以点号连接的路径为键），敏感字段脱敏
+// before 或 after 为 nil 时表示创建或删除，返回另一方的全部字段
+func Diff(before, after interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	beforeFields, err := flatten(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterFields, err := flatten(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changedBefore := make(map[string]interface{})
+	changedAfter := make(map[string]interface{})
+	for key, value := range beforeFields {
+		if other, exists := afterFields[key]; !exists || !reflect.DeepEqual(value, other) {
+			changedBefore[key] = redact(key, value)
+		}
+	}
+	for key, value := range afterFields {
+		if other, exists := beforeFields[key]; !exists || !reflect.DeepEqual(value, other) {
+			changedAfter[key] = redact(key, value)
+		}
+	}
+	return changedBefore, changedAfter, nil
+}
+
+// flatten 将对象按 JSON 结构展开为 "路径 -> 值"，数组作为整体比较
+func flatten(value interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return fields, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+
+	var walk func(prefix string, node interface{})
+	walk = func(prefix string, node interface{}) {
+		object, ok := node.(map[string]interface{})
+		if !ok {
+			fields[prefix] = node
+			return
+		}
+		secretKeyed := secretKeyedFields[normalizeField(prefix[strings.LastIndex(prefix, ".")+1:])]
+		for key, child := range object {
+			if ignoredFields[normalizeField(key)] {
+				continue
+			}
+			if secretKeyed {
+				key = utils.MaskSecret(key)
+			}
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			walk(path, child)
+		}
+	}
+	walk("", decoded)
+	return fields, nil
+}
+
+// redact 敏感字段的非空值替换为 Redacted
+func redact(path string, value interface{}) interface{} {
+	if !sensitiveFields[normalizeField(path[strings.LastIndex(path, ".")+1:])] {
+		return value
+	}
+	if value == nil || value == "" {
+		return value
+	}
+	return Redacted
+}
+
+// normalizeField 统一字段名的大小写和下划线，兼容 JSON 标签和 Go 字段名
+func normalizeField(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
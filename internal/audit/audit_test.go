@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	type auth struct {
+		Username  string `json:"username"`
+		Password  string `json:"password"`
+		JWTSecret string
+	}
+	type secretConfig struct {
+		Enabled bool `json:"enabled"`
+	}
+	type record struct {
+		Secret       string                  `json:"secret"`
+		ClientSecret string                  `json:"client_secret"`
+		Name         string                  `json:"name"`
+		UpdatedAt    string                  `json:"updatedAt"`
+		Auth         auth                    `json:"auth"`
+		Secrets      map[string]secretConfig `json:"secrets"`
+	}
+
+	tests := []struct {
+		name       string
+		before     interface{}
+		after      interface{}
+		wantBefore map[string]interface{}
+		wantAfter  map[string]interface{}
+	}{
+		{
+			name:       "只返回变化的字段",
+			before:     record{Name: "a", UpdatedAt: "t1", Auth: auth{Username: "admin"}},
+			after:      record{Name: "b", UpdatedAt: "t2", Auth: auth{Username: "admin"}},
+			wantBefore: map[string]interface{}{"name": "a"},
+			wantAfter:  map[string]interface{}{"name": "b"},
+		},
+		{
+			name:       "创建时密钥脱敏",
+			before:     nil,
+			after:      map[string]interface{}{"secret": "abcd12345678wxyz", "client_secret": "s3cr3t", "name": "bot"},
+			wantBefore: map[string]interface{}{},
+			wantAfter:  map[string]interface{}{"secret": Redacted, "client_secret": Redacted, "name": "bot"},
+		},
+		{
+			name:       "嵌套的凭据脱敏",
+			before:     record{Auth: auth{Password: "old", JWTSecret: "k1"}},
+			after:      record{Auth: auth{Password: "new", JWTSecret: "k2"}},
+			wantBefore: map[string]interface{}{"auth.password": Redacted, "auth.JWTSecret": Redacted},
+			wantAfter:  map[string]interface{}{"auth.password": Redacted, "auth.JWTSecret": Redacted},
+		},
+		{
+			name:       "空值不替换",
+			before:     map[string]interface{}{"password": ""},
+			after:      map[string]interface{}{"password": "set"},
+			wantBefore: map[string]interface{}{"password": ""},
+			wantAfter:  map[string]interface{}{"password": Redacted},
+		},
+		{
+			name:       "以密钥为键的路径遮盖密钥",
+			before:     record{Secrets: map[string]secretConfig{"abcd12345678wxyz": {Enabled: true}}},
+			after:      record{Secrets: map[string]secretConfig{"abcd12345678wxyz": {Enabled: false}}},
+			wantBefore: map[string]interface{}{"secrets.abcd********wxyz.enabled": true},
+			wantAfter:  map[string]interface{}{"secrets.abcd********wxyz.enabled": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotBefore, gotAfter, err := Diff(tt.before, tt.after)
+			if err != nil {
+				t.Fatalf("Diff() 失败: %v", err)
+			}
+			if !reflect.DeepEqual(gotBefore, tt.wantBefore) {
+				t.Errorf("before = %v，应为 %v", gotBefore, tt.wantBefore)
+			}
+			if !reflect.DeepEqual(gotAfter, tt.wantAfter) {
+				t.Errorf("after = %v，应为 %v", gotAfter, tt.wantAfter)
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Config 应用配置结构
@@ -17,6 +20,12 @@ type Config struct {
 	UI        UIConfig                `mapstructure:"ui"`
 	Logging   LoggingConfig           `mapstructure:"logging"`
 	WebSocket WebSocketConfig         `mapstructure:"websocket"`
+	Queue     QueueConfig             `mapstructure:"queue"`
+	Upstream  UpstreamConfig          `mapstructure:"upstream"`
+	OpenAPI   OpenAPIConfig           `mapstructure:"openapi"`
+	Metrics   MetricsConfig           `mapstructure:"metrics"`
+	Traffic   TrafficConfig           `mapstructure:"traffic"`
+	Database  DatabaseConfig          `mapstructure:"database"`
 	Secrets   map[string]SecretConfig `mapstructure:"secrets"`
 	mu        sync.RWMutex
 }
@@ -48,18 +57,34 @@ type CORSConfig struct {
 
 // SecurityConfig 安全配置
 type SecurityConfig struct {
-	EnableSignatureValidation  bool `mapstructure:"enable_signature_validation"`
-	DefaultAllowNewConnections bool `mapstructure:"default_allow_new_connections"`
-	MaxConnectionsPerSecret    int  `mapstructure:"max_connections_per_secret"`
-	RequireManualKeyManagement bool `mapstructure:"require_manual_key_management"`
+	EnableSignatureValidation  bool   `mapstructure:"enable_signature_validation"`
+	DefaultAllowNewConnections bool   `mapstructure:"default_allow_new_connections"`
+	MaxConnectionsPerSecret    int    `mapstructure:"max_connections_per_secret"`
+	RequireManualKeyManagement bool   `mapstructure:"require_manual_key_management"`
+	ConnectionLimitPolicy      string `mapstructure:"connection_limit_policy"` // 达到连接数上限时的处理方式: reject, evict_oldest
+	AllowSecretQuery           bool   `mapstructure:"allow_secret_query"`      // 兼容旧版 Webhook 地址中的 ?secret= 查询参数
+	SignatureMaxSkew           int64  `mapstructure:"signature_max_skew"`      // 推送事件时间戳与服务器时间允许的最大偏差（秒），超出时视为重放拒绝
 }
 
 // AuthConfig 认证配置
 type AuthConfig struct {
 	Username       string `mapstructure:"username"`
-	Password       string `mapstructure:"password"`
-	SessionTimeout int64  `mapstructure:"session_timeout"`
-	JWTSecret      string `mapstructure:"jwt_secret"`
+	Password       string `mapstructure:"password" json:"-"`
+	SessionTimeout int64  `mapstructure:"session_timeout"`  // 会话空闲超时（秒），超过该时间未刷新的刷新令牌失效
+	AccessTokenTTL int64  `mapstructure:"access_token_ttl"` // 访问令牌有效期（秒），过期后使用刷新令牌换取新令牌
+	JWTSecret      string `mapstructure:"jwt_secret" json:"-"`
+
+	Lockout LoginLockoutConfig `mapstructure:"lockout"`
+}
+
+// LoginLockoutConfig 登录失败退避和锁定配置，按来源 IP 和用户名分别计数
+type LoginLockoutConfig struct {
+	Enabled         bool  `mapstructure:"enabled"`
+	FreeAttempts    int   `mapstructure:"free_attempts"`    // 不触发退避的连续失败次数
+	BaseDelay       int64 `mapstructure:"base_delay"`       // 首次退避时间（秒），之后每次失败翻倍
+	MaxDelay        int64 `mapstructure:"max_delay"`        // 退避时间上限（秒）
+	MaxFailures     int   `mapstructure:"max_failures"`     // 连续失败达到该次数后锁定
+	LockoutDuration int64 `mapstructure:"lockout_duration"` // 锁定时间（秒）
 }
 
 // UIConfig UI配置
@@ -96,23 +121,157 @@ type WebSocketConfig struct {
 	DefaultFormat           string   `mapstructure:"default_format"`         // 默认消息格式
 	EnableBinaryMessages    bool     `mapstructure:"enable_binary_messages"` // 是否启用二进制消息
 	MaxBinarySize           int      `mapstructure:"max_binary_size"`        // 最大二进制消息大小（字节）
+	DefaultDeliveryMode     string   `mapstructure:"default_delivery_mode"`  // 同一密钥多个客户端时的默认投递模式
+	DefaultProtocol         string   `mapstructure:"default_protocol"`       // 默认连接协议: raw, qq, bridge
+	GatewayHeartbeat        int      `mapstructure:"gateway_heartbeat"`      // QQ 网关协议下发给客户端的心跳间隔（毫秒）
+	SessionTimeout          int      `mapstructure:"session_timeout"`        // 会话断开后允许恢复的时间（秒）
+	SessionBufferSize       int      `mapstructure:"session_buffer_size"`    // 每个会话保留用于恢复的最近事件数
+	SendQueueSize           int      `mapstructure:"send_queue_size"`        // 每个连接发送队列的容量
+	SendQueuePolicy         string   `mapstructure:"send_queue_policy"`      // 发送队列已满时的处理策略
+}
+
+// UpstreamConfig 客户端消息转发到上游 HTTP 服务的配置
+type UpstreamConfig struct {
+	Timeout         int `mapstructure:"timeout"`           // 上游请求超时（毫秒）
+	MaxResponseSize int `mapstructure:"max_response_size"` // 返回给客户端的上游响应体最大字节数
+}
+
+// OpenAPIConfig QQ 机器人 OpenAPI 代理配置
+type OpenAPIConfig struct {
+	BaseURL       string `mapstructure:"base_url"`       // OpenAPI 地址
+	TokenURL      string `mapstructure:"token_url"`      // 获取 AppAccessToken 的地址
+	Timeout       int    `mapstructure:"timeout"`        // 请求超时（毫秒）
+	RefreshBefore int    `mapstructure:"refresh_before"` // AppAccessToken 过期前提前刷新的时间（秒）
+}
+
+// MetricsConfig Prometheus 指标配置
+type MetricsConfig struct {
+	Enabled    bool     `mapstructure:"enabled"`        // 是否开放 /metrics
+	Listen     string   `mapstructure:"listen"`         // 独立监听地址（如 127.0.0.1:9100），为空时挂载在主服务上
+	Token      string   `mapstructure:"token" json:"-"` // 抓取时使用的 Bearer Token
+	AllowedIPs []string `mapstructure:"allowed_ips"`    // 无需 Token 即可抓取的 IP 或网段
+}
+
+// TrafficConfig 流量历史统计配置
+type TrafficConfig struct {
+	Enabled         bool `mapstructure:"enabled"`          // 是否记录流量历史
+	FlushInterval   int  `mapstructure:"flush_interval"`   // 内存中的计数写入数据库的间隔（秒）
+	MinuteRetention int  `mapstructure:"minute_retention"` // 分钟粒度数据保留时间（小时）
+	HourRetention   int  `mapstructure:"hour_retention"`   // 小时粒度数据保留时间（天）
+	DayRetention    int  `mapstructure:"day_retention"`    // 天粒度数据保留时间（天）
+}
+
+// QueueConfig 离线消息队列配置
+type QueueConfig struct {
+	Enabled     bool `mapstructure:"enabled"`      // 是否在客户端离线时持久化 Webhook 消息
+	MaxAge      int  `mapstructure:"max_age"`      // 消息最长保留时间（秒），0 表示不过期
+	MaxMessages int  `mapstructure:"max_messages"` // 每个密钥最多保留的消息数，0 表示不限制
+}
+
+// DatabaseConfig 数据库配置，在连接数据库之前读取，不能保存在数据库中，修改后需要重启服务
+type DatabaseConfig struct {
+	Driver          string `mapstructure:"driver"`             // 数据库类型: sqlite, postgres, mysql
+	DSN             string `mapstructure:"dsn" json:"-"`       // 连接串，sqlite 为数据库文件路径，为空时使用数据目录下的 webhook_pro.db
+	MaxIdleConns    int    `mapstructure:"max_idle_conns"`     // 连接池最大空闲连接数
+	MaxOpenConns    int    `mapstructure:"max_open_conns"`     // 连接池最大连接数，0 表示不限制
+	ConnMaxLifetime int    `mapstructure:"conn_max_lifetime"`  // 连接最长使用时间（秒），0 表示不限制
+	ConnMaxIdleTime int    `mapstructure:"conn_max_idle_time"` // 连接最长空闲时间（秒），0 表示不限制
+	AutoMigrate     bool   `mapstructure:"auto_migrate"`       // 启动时自动执行未完成的数据库迁移，关闭后需要先执行 migrate 命令
 }
 
 // SecretConfig 密钥配置
 type SecretConfig struct {
-	Enabled        bool       `json:"enabled"`
-	Description    string     `json:"description,omitempty"`
-	MaxConnections int        `json:"max_connections,omitempty"`
-	CreatedAt      time.Time  `json:"created_at"`
-	LastUsed       *time.Time `json:"last_used,omitempty"`
+	Enabled          bool       `json:"enabled"`
+	Description      string     `json:"description,omitempty"`
+	AppID            string     `json:"app_id,omitempty"` // 机器人 AppID，用于代理 OpenAPI 时获取 AppAccessToken
+	MaxConnections   int        `json:"max_connections,omitempty"`
+	DeliveryMode     string     `json:"delivery_mode,omitempty"`      // 投递模式: broadcast, round_robin, failover，为空表示使用全局配置
+	Protocol         string     `json:"protocol,omitempty"`           // 连接协议: raw, qq, bridge，为空表示使用全局配置
+	UpstreamURL      string     `json:"upstream_url,omitempty"`       // 客户端消息转发的上游 HTTP 地址，为空表示不转发
+	UpstreamTypes    []string   `json:"upstream_types,omitempty"`     // 需要转发的消息类型，为空表示转发所有 JSON 消息
+	QueueMaxAge      int        `json:"queue_max_age,omitempty"`      // 离线队列最长保留时间（秒），0 表示使用全局配置
+	QueueMaxMessages int        `json:"queue_max_messages,omitempty"` // 离线队列最大消息数，0 表示使用全局配置
+	CreatedAt        time.Time  `json:"created_at"`
+	LastUsed         *time.Time `json:"last_used,omitempty"`
+}
+
+// 多客户端投递模式
+const (
+	DeliveryModeBroadcast  = "broadcast"   // 广播到该密钥下的所有客户端
+	DeliveryModeRoundRobin = "round_robin" // 在客户端之间轮询
+	DeliveryModeFailover   = "failover"    // 仅投递到主客户端（最早连接），主客户端断开后由备用客户端接替
+)
+
+// 连接数达到上限时的处理策略
+const (
+	ConnectionLimitReject      = "reject"       // 拒绝新连接
+	ConnectionLimitEvictOldest = "evict_oldest" // 断开最早的连接，为新连接腾出位置
+)
+
+// 连接发送队列已满时的处理策略
+const (
+	SendQueueDropOldest = "drop_oldest" // 丢弃队列中最旧的消息
+	SendQueueDropNewest = "drop_newest" // 丢弃新消息
+	SendQueueDisconnect = "disconnect"  // 断开消费过慢的连接
+)
+
+// WebSocket 连接协议
+const (
+	ProtocolRaw    = "raw"    // 原样转发 Webhook 请求体
+	ProtocolQQ     = "qq"     // 模拟 QQ 官方网关协议（Hello/Identify/Heartbeat/Dispatch/Resume）
+	ProtocolBridge = "bridge" // 带序号的事件信封，支持客户端确认与会话恢复
+)
+
+// 数据库类型
+const (
+	DatabaseSQLite   = "sqlite"
+	DatabasePostgres = "postgres"
+	DatabaseMySQL    = "mysql"
+)
+
+// IsValidDatabaseDriver 检查数据库类型是否有效
+func IsValidDatabaseDriver(driver string) bool {
+	switch driver {
+	case DatabaseSQLite, DatabasePostgres, DatabaseMySQL:
+		return true
+	}
+	return false
+}
+
+// IsValidProtocol 检查连接协议是否有效
+func IsValidProtocol(protocol string) bool {
+	switch protocol {
+	case ProtocolRaw, ProtocolQQ, ProtocolBridge:
+		return true
+	}
+	return false
+}
+
+// IsValidSendQueuePolicy 检查发送队列策略是否有效
+func IsValidSendQueuePolicy(policy string) bool {
+	switch policy {
+	case SendQueueDropOldest, SendQueueDropNewest, SendQueueDisconnect:
+		return true
+	}
+	return false
+}
+
+// IsValidDeliveryMode 检查投递模式是否有效
+func IsValidDeliveryMode(mode string) bool {
+	switch mode {
+	case DeliveryModeBroadcast, DeliveryModeRoundRobin, DeliveryModeFailover:
+		return true
+	}
+	return false
 }
 
 // 默认配置
 var defaultConfig = Config{
 	Server: ServerConfig{
-		Port: "3000",
-		Host: "0.0.0.0",
-		Mode: "debug",
+		Port:           "3000",
+		Host:           "0.0.0.0",
+		TrustedProxies: []string{"127.0.0.1", "::1"},
+		Mode:           "debug",
 		CORS: CORSConfig{
 			Origins: []string{"*"},
 		},
@@ -122,12 +281,23 @@ var defaultConfig = Config{
 		DefaultAllowNewConnections: true,
 		MaxConnectionsPerSecret:    5,
 		RequireManualKeyManagement: false,
+		ConnectionLimitPolicy:      ConnectionLimitReject,
+		SignatureMaxSkew:           300, // 5分钟
 	},
 	Auth: AuthConfig{
 		Username:       "admin",
 		Password:       "admin123",
 		SessionTimeout: 86400, // 24小时
+		AccessTokenTTL: 900,   // 15分钟
 		JWTSecret:      "",
+		Lockout: LoginLockoutConfig{
+			Enabled:         true,
+			FreeAttempts:    3,
+			BaseDelay:       1,
+			MaxDelay:        60,
+			MaxFailures:     10,
+			LockoutDuration: 900, // 15分钟
+		},
 	},
 	UI: UIConfig{
 		EnableWebConsole: true,
@@ -157,104 +327,161 @@ var defaultConfig = Config{
 		DefaultFormat:           "json",
 		EnableBinaryMessages:    true,
 		MaxBinarySize:           1048576, // 1MB
+		DefaultDeliveryMode:     DeliveryModeBroadcast,
+		DefaultProtocol:         ProtocolRaw,
+		GatewayHeartbeat:        41250,
+		SessionTimeout:          300, // 5分钟
+		SessionBufferSize:       500,
+		SendQueueSize:           1024,
+		SendQueuePolicy:         SendQueueDropOldest,
+	},
+	Queue: QueueConfig{
+		Enabled:     true,
+		MaxAge:      86400, // 24小时
+		MaxMessages: 1000,
+	},
+	Upstream: UpstreamConfig{
+		Timeout:         10000,   // 10秒
+		MaxResponseSize: 1048576, // 1MB
+	},
+	OpenAPI: OpenAPIConfig{
+		BaseURL:       "https://api.sgroup.qq.com",
+		TokenURL:      "https://bots.qq.com/app/getAppAccessToken",
+		Timeout:       10000, // 10秒
+		RefreshBefore: 60,
+	},
+	Metrics: MetricsConfig{
+		Enabled:    true,
+		AllowedIPs: []string{"127.0.0.1", "::1"},
+	},
+	Traffic: TrafficConfig{
+		Enabled:         true,
+		FlushInterval:   10,
+		MinuteRetention: 48,  // 2天
+		HourRetention:   30,  // 30天
+		DayRetention:    365, // 1年
+	},
+	Database: DatabaseConfig{
+		Driver:          DatabaseSQLite,
+		MaxIdleConns:    10,
+		MaxOpenConns:    100,
+		ConnMaxLifetime: 3600,
+		AutoMigrate:     true,
 	},
 	Secrets: make(map[string]SecretConfig),
 }
 
-// Load 加载配置
-func Load() (*Config, error) {
-	// 设置配置文件路径
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("./configs")
-	viper.AddConfigPath("/etc/qq-webhook-pro")
-
-	// 设置环境变量前缀
-	viper.SetEnvPrefix("QQ_WEBHOOK")
-	viper.AutomaticEnv()
-
-	// 设置默认值
-	setDefaults()
-
-	// 读取配置文件
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// 配置文件不存在，使用默认配置
-			fmt.Println("⚠️  配置文件不存在，使用默认配置")
-		} else {
-			return nil, fmt.Errorf("读取配置文件失败: %w", err)
-		}
-	}
-
-	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
-		return nil, fmt.Errorf("解析配置失败: %w", err)
+// setDefaults 按 defaultConfig 设置所有配置键的默认值，环境变量只能覆盖已知的配置键
+func setDefaults(v *viper.Viper) {
+	for key, value := range Settings(&defaultConfig) {
+		v.SetDefault(key, value)
 	}
-
-	// 验证和修复配置
-	if err := validateAndRepairConfig(&config); err != nil {
-		return nil, fmt.Errorf("配置验证失败: %w", err)
-	}
-
-	// 保存配置到文件
-	if err := saveConfigToFile(&config); err != nil {
-		fmt.Printf("⚠️  保存配置文件失败: %v\n", err)
-	}
-
-	fmt.Printf("✅ 配置加载成功\n")
-	fmt.Printf("📊 已加载 %d 个密钥\n", len(config.Secrets))
-
-	return &config, nil
-}
-
-// setDefaults 设置默认值
-func setDefaults() {
-	viper.SetDefault("server.port", defaultConfig.Server.Port)
-	viper.SetDefault("server.host", defaultConfig.Server.Host)
-	viper.SetDefault("server.domain", "")
-	viper.SetDefault("server.enforce_domain", false)
-	viper.SetDefault("server.trusted_proxies", []string{"127.0.0.1", "::1"})
-	viper.SetDefault("server.mode", defaultConfig.Server.Mode)
-	viper.SetDefault("server.cors.origins", defaultConfig.Server.CORS.Origins)
-	viper.SetDefault("server.ssl.enabled", false)
-	viper.SetDefault("server.ssl.cert", "")
-	viper.SetDefault("server.ssl.key", "")
-
-	viper.SetDefault("security.enable_signature_validation", defaultConfig.Security.EnableSignatureValidation)
-	viper.SetDefault("security.default_allow_new_connections", defaultConfig.Security.DefaultAllowNewConnections)
-	viper.SetDefault("security.max_connections_per_secret", defaultConfig.Security.MaxConnectionsPerSecret)
-	viper.SetDefault("security.require_manual_key_management", defaultConfig.Security.RequireManualKeyManagement)
-
-	viper.SetDefault("auth.username", defaultConfig.Auth.Username)
-	viper.SetDefault("auth.password", defaultConfig.Auth.Password)
-	viper.SetDefault("auth.session_timeout", defaultConfig.Auth.SessionTimeout)
-
-	viper.SetDefault("ui.enable_web_console", defaultConfig.UI.EnableWebConsole)
-	viper.SetDefault("ui.theme", defaultConfig.UI.Theme)
-	viper.SetDefault("ui.primary_color", defaultConfig.UI.PrimaryColor)
-	viper.SetDefault("ui.compact_mode", defaultConfig.UI.CompactMode)
-	viper.SetDefault("ui.language", defaultConfig.UI.Language)
-	viper.SetDefault("ui.show_breadcrumb", defaultConfig.UI.ShowBreadcrumb)
-	viper.SetDefault("ui.show_footer", defaultConfig.UI.ShowFooter)
-	viper.SetDefault("ui.enable_animation", defaultConfig.UI.EnableAnimation)
-
-	viper.SetDefault("logging.level", defaultConfig.Logging.Level)
-	viper.SetDefault("logging.max_log_entries", defaultConfig.Logging.MaxLogEntries)
-	viper.SetDefault("logging.enable_file_logging", defaultConfig.Logging.EnableFileLogging)
-	viper.SetDefault("logging.log_file_path", defaultConfig.Logging.LogFilePath)
-
-	viper.SetDefault("websocket.enable_heartbeat", defaultConfig.WebSocket.EnableHeartbeat)
-	viper.SetDefault("websocket.heartbeat_interval", defaultConfig.WebSocket.HeartbeatInterval)
-	viper.SetDefault("websocket.heartbeat_timeout", defaultConfig.WebSocket.HeartbeatTimeout)
-	viper.SetDefault("websocket.client_heartbeat_interval", defaultConfig.WebSocket.ClientHeartbeatInterval)
 }
 
 // validateAndRepairConfig 验证和修复配置
 func validateAndRepairConfig(config *Config) error {
 	// 确保JWT密钥存在
 	if config.Auth.JWTSecret == "" {
-		config.Auth.JWTSecret = generateRandomString(64)
+		secret, err := generateJWTSecret()
+		if err != nil {
+			return fmt.Errorf("生成JWT密钥失败: %w", err)
+		}
+		config.Auth.JWTSecret = secret
+	}
+	if config.Auth.SessionTimeout <= 0 {
+		config.Auth.SessionTimeout = defaultConfig.Auth.SessionTimeout
+	}
+	if config.Auth.AccessTokenTTL <= 0 {
+		config.Auth.AccessTokenTTL = defaultConfig.Auth.AccessTokenTTL
+	}
+	// 明文密码自动迁移为 bcrypt 哈希，随后写回配置文件
+	if config.Auth.Password != "" && !strings.HasPrefix(config.Auth.Password, "$2") {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(config.Auth.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("加密管理员密码失败: %w", err)
+		}
+		config.Auth.Password = string(hashed)
+	}
+	if config.Auth.Lockout.FreeAttempts < 0 {
+		config.Auth.Lockout.FreeAttempts = defaultConfig.Auth.Lockout.FreeAttempts
+	}
+	if config.Auth.Lockout.BaseDelay <= 0 {
+		config.Auth.Lockout.BaseDelay = defaultConfig.Auth.Lockout.BaseDelay
+	}
+	if config.Auth.Lockout.MaxDelay <= 0 {
+		config.Auth.Lockout.MaxDelay = defaultConfig.Auth.Lockout.MaxDelay
+	}
+	if config.Auth.Lockout.MaxFailures <= 0 {
+		config.Auth.Lockout.MaxFailures = defaultConfig.Auth.Lockout.MaxFailures
+	}
+	if config.Auth.Lockout.LockoutDuration <= 0 {
+		config.Auth.Lockout.LockoutDuration = defaultConfig.Auth.Lockout.LockoutDuration
+	}
+
+	if !IsValidDeliveryMode(config.WebSocket.DefaultDeliveryMode) {
+		config.WebSocket.DefaultDeliveryMode = DeliveryModeBroadcast
+	}
+	if !IsValidProtocol(config.WebSocket.DefaultProtocol) {
+		config.WebSocket.DefaultProtocol = ProtocolRaw
+	}
+	if config.WebSocket.SendQueueSize <= 0 {
+		config.WebSocket.SendQueueSize = defaultConfig.WebSocket.SendQueueSize
+	}
+	if !IsValidSendQueuePolicy(config.WebSocket.SendQueuePolicy) {
+		config.WebSocket.SendQueuePolicy = SendQueueDropOldest
+	}
+	if config.Upstream.Timeout <= 0 {
+		config.Upstream.Timeout = defaultConfig.Upstream.Timeout
+	}
+	if config.Upstream.MaxResponseSize <= 0 {
+		config.Upstream.MaxResponseSize = defaultConfig.Upstream.MaxResponseSize
+	}
+	if config.OpenAPI.BaseURL == "" {
+		config.OpenAPI.BaseURL = defaultConfig.OpenAPI.BaseURL
+	}
+	if config.OpenAPI.TokenURL == "" {
+		config.OpenAPI.TokenURL = defaultConfig.OpenAPI.TokenURL
+	}
+	if config.Traffic.FlushInterval <= 0 {
+		config.Traffic.FlushInterval = defaultConfig.Traffic.FlushInterval
+	}
+	if config.Traffic.MinuteRetention <= 0 {
+		config.Traffic.MinuteRetention = defaultConfig.Traffic.MinuteRetention
+	}
+	if config.Traffic.HourRetention <= 0 {
+		config.Traffic.HourRetention = defaultConfig.Traffic.HourRetention
+	}
+	if config.Traffic.DayRetention <= 0 {
+		config.Traffic.DayRetention = defaultConfig.Traffic.DayRetention
+	}
+	if config.Security.SignatureMaxSkew <= 0 {
+		config.Security.SignatureMaxSkew = defaultConfig.Security.SignatureMaxSkew
+	}
+	if config.Security.ConnectionLimitPolicy != ConnectionLimitEvictOldest {
+		config.Security.ConnectionLimitPolicy = ConnectionLimitReject
+	}
+
+	// 数据库类型和连接串无效时不能回退到默认值，否则会在本地创建一个空的 SQLite 数据库
+	if config.Database.Driver == "" {
+		config.Database.Driver = DatabaseSQLite
+	}
+	if !IsValidDatabaseDriver(config.Database.Driver) {
+		return fmt.Errorf("不支持的数据库类型 %q，可选值: %s, %s, %s", config.Database.Driver, DatabaseSQLite, DatabasePostgres, DatabaseMySQL)
+	}
+	if config.Database.Driver != DatabaseSQLite && config.Database.DSN == "" {
+		return fmt.Errorf("数据库类型为 %s 时必须设置 database.dsn", config.Database.Driver)
+	}
+	if config.Database.MaxIdleConns < 0 {
+		config.Database.MaxIdleConns = defaultConfig.Database.MaxIdleConns
+	}
+	if config.Database.MaxOpenConns < 0 {
+		config.Database.MaxOpenConns = defaultConfig.Database.MaxOpenConns
+	}
+	if config.Database.ConnMaxLifetime < 0 {
+		config.Database.ConnMaxLifetime = defaultConfig.Database.ConnMaxLifetime
+	}
+	if config.Database.ConnMaxIdleTime < 0 {
+		config.Database.ConnMaxIdleTime = 0
 	}
 
 	// 确保所有密钥都有必要的字段
@@ -263,56 +490,33 @@ func validateAndRepairConfig(config *Config) error {
 			secretConfig.CreatedAt = time.Now()
 			config.Secrets[secret] = secretConfig
 		}
+		if secretConfig.DeliveryMode != "" && !IsValidDeliveryMode(secretConfig.DeliveryMode) {
+			secretConfig.DeliveryMode = ""
+			config.Secrets[secret] = secretConfig
+		}
+		if secretConfig.Protocol != "" && !IsValidProtocol(secretConfig.Protocol) {
+			secretConfig.Protocol = ""
+			config.Secrets[secret] = secretConfig
+		}
 	}
 
 	return nil
 }
 
-// SaveConfig 保存配置到文件（公开函数）
-func SaveConfig(config *Config) error {
-	return saveConfigToFile(config)
-}
-
-// saveConfigToFile 保存配置到文件
-func saveConfigToFile(config *Config) error {
-	// 创建配置目录
-	if err := os.MkdirAll("configs", 0755); err != nil {
-		return err
-	}
-
-	// 使用 viper 保存为 YAML 格式
-	viper.Set("server", config.Server)
-	viper.Set("security", config.Security)
-	viper.Set("auth", config.Auth)
-	viper.Set("ui", config.UI)
-	viper.Set("logging", config.Logging)
-	viper.Set("websocket", config.WebSocket)
-	viper.Set("secrets", config.Secrets)
-
-	configFile := "configs/config.yaml"
-	if err := viper.WriteConfigAs(configFile); err != nil {
-		return err
-	}
-
-	fmt.Printf("💾 配置已保存: %s\n", configFile)
-	return nil
-}
-
-// generateRandomString 生成随机字符串
-func generateRandomString(length int) string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[time.Now().UnixNano()%int64(len(charset))]
+// generateJWTSecret 生成 256 位随机 JWT 密钥（十六进制编码）
+func generateJWTSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return string(b)
+	return hex.EncodeToString(b), nil
 }
 
 // IsSecretEnabled 检查密钥是否启用
 func (c *Config) IsSecretEnabled(secret string) bool {
 	c.mu.RLock()
+	defer c.mu.RUnlock()
 	secretConfig, exists := c.Secrets[secret]
-	c.mu.RUnlock()
 
 	// 如果密钥已存在，直接返回其启用状态
 	if exists {
@@ -341,6 +545,12 @@ func (c *Config) Clone() *Config {
 		UI:        c.UI,
 		Logging:   c.Logging,
 		WebSocket: c.WebSocket,
+		Queue:     c.Queue,
+		Upstream:  c.Upstream,
+		OpenAPI:   c.OpenAPI,
+		Metrics:   c.Metrics,
+		Traffic:   c.Traffic,
+		Database:  c.Database,
 		Secrets:   make(map[string]SecretConfig, len(c.Secrets)),
 	}
 
@@ -362,6 +572,12 @@ func (c *Config) Restore(other *Config) {
 	c.UI = other.UI
 	c.Logging = other.Logging
 	c.WebSocket = other.WebSocket
+	c.Queue = other.Queue
+	c.Upstream = other.Upstream
+	c.OpenAPI = other.OpenAPI
+	c.Metrics = other.Metrics
+	c.Traffic = other.Traffic
+	c.Database = other.Database
 	c.Secrets = make(map[string]SecretConfig, len(other.Secrets))
 	for k, v := range other.Secrets {
 		c.Secrets[k] = v
@@ -388,6 +604,92 @@ func (c *Config) GetSecrets() map[string]SecretConfig {
 	return secrets
 }
 
+// 配置重新加载时会原地替换各部分配置，并发读取时需要通过以下方法获取副本
+
+// GetServerConfig 获取服务器配置的副本
+func (c *Config) GetServerConfig() ServerConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Server
+}
+
+// GetSecurityConfig 获取安全配置的副本
+func (c *Config) GetSecurityConfig() SecurityConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Security
+}
+
+// GetAuthConfig 获取认证配置的副本
+func (c *Config) GetAuthConfig() AuthConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Auth
+}
+
+// GetUIConfig 获取界面配置的副本
+func (c *Config) GetUIConfig() UIConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.UI
+}
+
+// GetLoggingConfig 获取日志配置的副本
+func (c *Config) GetLoggingConfig() LoggingConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Logging
+}
+
+// GetWebSocketConfig 获取WebSocket 配置的副本
+func (c *Config) GetWebSocketConfig() WebSocketConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.WebSocket
+}
+
+// GetQueueConfig 获取离线队列配置的副本
+func (c *Config) GetQueueConfig() QueueConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Queue
+}
+
+// GetUpstreamConfig 获取上游转发配置的副本
+func (c *Config) GetUpstreamConfig() UpstreamConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Upstream
+}
+
+// GetOpenAPIConfig 获取OpenAPI 代理配置的副本
+func (c *Config) GetOpenAPIConfig() OpenAPIConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.OpenAPI
+}
+
+// GetMetricsConfig 获取指标配置的副本
+func (c *Config) GetMetricsConfig() MetricsConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Metrics
+}
+
+// GetTrafficConfig 获取流量统计配置的副本
+func (c *Config) GetTrafficConfig() TrafficConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Traffic
+}
+
+// GetDatabaseConfig 获取数据库配置的副本
+func (c *Config) GetDatabaseConfig() DatabaseConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.Database
+}
+
 // AddSecret 添加密钥
 func (c *Config) AddSecret(secret string, options SecretConfig) {
 	c.mu.Lock()
@@ -398,10 +700,17 @@ func (c *Config) AddSecret(secret string, options SecretConfig) {
 	}
 
 	c.Secrets[secret] = SecretConfig{
-		Enabled:        options.Enabled,
-		Description:    options.Description,
-		MaxConnections: options.MaxConnections,
-		CreatedAt:      time.Now(),
+		Enabled:          options.Enabled,
+		Description:      options.Description,
+		AppID:            options.AppID,
+		MaxConnections:   options.MaxConnections,
+		DeliveryMode:     options.DeliveryMode,
+		Protocol:         options.Protocol,
+		UpstreamURL:      options.UpstreamURL,
+		UpstreamTypes:    options.UpstreamTypes,
+		QueueMaxAge:      options.QueueMaxAge,
+		QueueMaxMessages: options.QueueMaxMessages,
+		CreatedAt:        time.Now(),
 	}
 }
 
@@ -414,9 +723,30 @@ func (c *Config) UpdateSecret(secret string, updates SecretConfig) {
 		if updates.Description != "" {
 			existing.Description = updates.Description
 		}
+		if updates.AppID != "" {
+			existing.AppID = updates.AppID
+		}
 		if updates.MaxConnections > 0 {
 			existing.MaxConnections = updates.MaxConnections
 		}
+		if updates.DeliveryMode != "" {
+			existing.DeliveryMode = updates.DeliveryMode
+		}
+		if updates.Protocol != "" {
+			existing.Protocol = updates.Protocol
+		}
+		if updates.UpstreamURL != "" {
+			existing.UpstreamURL = updates.UpstreamURL
+		}
+		if updates.UpstreamTypes != nil {
+			existing.UpstreamTypes = updates.UpstreamTypes
+		}
+		if updates.QueueMaxAge > 0 {
+			existing.QueueMaxAge = updates.QueueMaxAge
+		}
+		if updates.QueueMaxMessages > 0 {
+			existing.QueueMaxMessages = updates.QueueMaxMessages
+		}
 		existing.Enabled = updates.Enabled
 		c.Secrets[secret] = existing
 	}
@@ -440,3 +770,89 @@ func (c *Config) MarkSecretUsed(secret string) {
 		c.Secrets[secret] = secretConfig
 	}
 }
+
+// GetQueueLimits 获取密钥的离线队列限制（密钥级配置优先于全局配置）
+func (c *Config) GetQueueLimits(secret string) (maxAge time.Duration, maxMessages int) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	maxAge = time.Duration(c.Queue.MaxAge) * time.Second
+	maxMessages = c.Queue.MaxMessages
+
+	if secretConfig, exists := c.Secrets[secret]; exists {
+		if secretConfig.QueueMaxAge > 0 {
+			maxAge = time.Duration(secretConfig.QueueMaxAge) * time.Second
+		}
+		if secretConfig.QueueMaxMessages > 0 {
+			maxMessages = secretConfig.QueueMaxMessages
+		}
+	}
+	return maxAge, maxMessages
+}
+
+// FindSecretByAppID 根据机器人 AppID 查找对应的密钥
+func (c *Config) FindSecretByAppID(appID string) (string, bool) {
+	if appID == "" {
+		return "", false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for secret, secretConfig := range c.Secrets {
+		if secretConfig.AppID == appID {
+			return secret, true
+		}
+	}
+	return "", false
+}
+
+// GetUpstream 获取密钥的上游转发地址和需要转发的消息类型，地址为空表示不转发
+func (c *Config) GetUpstream(secret string) (url string, types []string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if secretConfig, exists := c.Secrets[secret]; exists {
+		return secretConfig.UpstreamURL, secretConfig.UpstreamTypes
+	}
+	return "", nil
+}
+
+// GetMaxConnections 获取密钥允许的最大同时连接数（密钥级配置优先于全局配置），0 表示不限制
+func (c *Config) GetMaxConnections(secret string) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if secretConfig, exists := c.Secrets[secret]; exists && secretConfig.MaxConnections > 0 {
+		return secretConfig.MaxConnections
+	}
+	return c.Security.MaxConnectionsPerSecret
+}
+
+// GetDeliveryMode 获取密钥的投递模式（密钥级配置优先于全局配置）
+func (c *Config) GetDeliveryMode(secret string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if secretConfig, exists := c.Secrets[secret]; exists && IsValidDeliveryMode(secretConfig.DeliveryMode) {
+		return secretConfig.DeliveryMode
+	}
+	if IsValidDeliveryMode(c.WebSocket.DefaultDeliveryMode) {
+		return c.WebSocket.DefaultDeliveryMode
+	}
+	return DeliveryModeBroadcast
+}
+
+// GetProtocol 获取密钥的连接协议（密钥级配置优先于全局配置）
+func (c *Config) GetProtocol(secret string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if secretConfig, exists := c.Secrets[secret]; exists && IsValidProtocol(secretConfig.Protocol) {
+		return secretConfig.Protocol
+	}
+	if IsValidProtocol(c.WebSocket.DefaultProtocol) {
+		return c.WebSocket.DefaultProtocol
+	}
+	return ProtocolRaw
+}
@@ -0,0 +1,264 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// legacyKeys 旧版本保存配置时写入了去掉下划线的键（如 maxlogentries），读取时按 "上级路径.规范化名称" 找回正确的键名
+var legacyKeys = func() map[string]string {
+	names := make(map[string]string)
+	for key := range settingOrder {
+		parts := strings.Split(key, ".")
+		for i := range parts {
+			prefix := strings.Join(parts[:i], ".")
+			names[joinKey(prefix, normalizeKey(parts[i]))] = parts[i]
+		}
+	}
+	return names
+}()
+
+// readFile 读取配置文件，并修正旧版本写入的配置键；persist 为 false 时只在内存中修正，不写回配置文件
+func (s *Store) readFile(persist bool) ([]byte, bool, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, true, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return data, true, nil
+	}
+
+	if renamed := renameLegacyKeys(doc.Content[0], ""); renamed > 0 {
+		fixed, err := encodeDocument(&doc)
+		if err != nil {
+			return nil, true, err
+		}
+		if !persist {
+			return fixed, true, nil
+		}
+		if err := os.WriteFile(s.path, fixed, 0644); err != nil {
+			fmt.Printf("⚠️  修正配置文件失败: %v\n", err)
+		} else {
+			fmt.Printf("🔧 已修正配置文件中 %d 个旧版本写入的配置键\n", renamed)
+		}
+		data = fixed
+	}
+	return data, true, nil
+}
+
+// writeFile 修改配置文件中的配置项，set 中的配置项写入新值，unset 中的配置项删除
+func (s *Store) writeFile(set map[string]interface{}, unset []string) error {
+	doc := &yaml.Node{Kind: yaml.DocumentNode}
+	data, err := os.ReadFile(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	if len(data) > 0 {
+		if err := yaml.Unmarshal(data, doc); err != nil {
+			return fmt.Errorf("解析配置文件失败: %w", err)
+		}
+	}
+	if len(doc.Content) == 0 {
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("配置文件的顶层必须是键值映射")
+	}
+	for _, key := range sortedKeys(set) {
+		if err := setNode(root, strings.Split(key, "."), set[key]); err != nil {
+			return fmt.Errorf("写入配置项 %s 失败: %w", key, err)
+		}
+	}
+	for _, key := range unset {
+		deleteNode(root, strings.Split(key, "."))
+	}
+
+	out, err := encodeDocument(doc)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.path, out, 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("💾 配置已保存: %s\n", s.path)
+	return nil
+}
+
+// EncodeSettings 将 "配置键 -> 值" 输出为 YAML 格式的配置文件
+func EncodeSettings(settings map[string]interface{}) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, key := range sortedKeys(settings) {
+		if err := setNode(root, strings.Split(key, "."), settings[key]); err != nil {
+			return nil, fmt.Errorf("输出配置项 %s 失败: %w", key, err)
+		}
+	}
+	return encodeDocument(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{root}})
+}
+
+// encodeDocument 以两个空格缩进输出 YAML 文档
+func encodeDocument(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// setNode 设置映射中指定路径的值，路径不存在时追加到末尾，已有的注释保持不变
+func setNode(mapping *yaml.Node, path []string, value interface{}) error {
+	var child *yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == path[0] {
+			child = mapping.Content[i+1]
+			break
+		}
+	}
+	if child == nil {
+		child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: path[0]}, child)
+	}
+
+	if len(path) == 1 {
+		var encoded yaml.Node
+		if err := encoded.Encode(value); err != nil {
+			return err
+		}
+		encoded.HeadComment = child.HeadComment
+		encoded.LineComment = child.LineComment
+		encoded.FootComment = child.FootComment
+		*child = encoded
+		return nil
+	}
+
+	if child.Kind != yaml.MappingNode {
+		child.Kind = yaml.MappingNode
+		child.Tag = "!!map"
+		child.Value = ""
+		child.Style = 0
+		child.Content = nil
+	}
+	return setNode(child, path[1:], value)
+}
+
+// deleteNode 删除映射中指定路径的配置项
+func deleteNode(mapping *yaml.Node, path []string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+		if child := mapping.Content[i+1]; child.Kind == yaml.MappingNode {
+			deleteNode(child, path[1:])
+		}
+		return
+	}
+}
+
+// renameLegacyKeys 将映射中旧版本写入的配置键改回正确的名称，返回修改的数量
+func renameLegacyKeys(mapping *yaml.Node, prefix string) int {
+	if mapping.Kind != yaml.MappingNode {
+		return 0
+	}
+
+	present := make(map[string]bool)
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		present[mapping.Content[i].Value] = true
+	}
+
+	renamed := 0
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		keyNode := mapping.Content[i]
+		if prefix == "" && keyNode.Value == secretsKey {
+			continue
+		}
+		if !knownPath(joinKey(prefix, keyNode.Value)) {
+			name, ok := legacyKeys[joinKey(prefix, normalizeKey(keyNode.Value))]
+			if !ok || present[name] {
+				continue
+			}
+			keyNode.Value = name
+			present[name] = true
+			renamed++
+		}
+		renamed += renameLegacyKeys(mapping.Content[i+1], joinKey(prefix, keyNode.Value))
+	}
+	return renamed
+}
+
+// unknownKeys 返回配置文件中无法识别的配置键，密钥列表不检查
+func unknownKeys(data []byte) ([]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	keys := []string{}
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		keys = collectUnknownKeys(doc.Content[0], "", keys)
+	}
+	return keys, nil
+}
+
+// collectUnknownKeys 递归收集映射中无法识别的配置键
+func collectUnknownKeys(mapping *yaml.Node, prefix string, keys []string) []string {
+	if mapping.Kind != yaml.MappingNode {
+		return keys
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		name := mapping.Content[i].Value
+		if prefix == "" && name == secretsKey {
+			continue
+		}
+		key := joinKey(prefix, name)
+		switch {
+		case !knownPath(key):
+			keys = append(keys, key)
+		case !IsSettingKey(key):
+			keys = collectUnknownKeys(mapping.Content[i+1], key, keys)
+		}
+	}
+	return keys
+}
+
+// knownPath 检查是否为配置键或配置键的上级路径
+func knownPath(path string) bool {
+	for key := range settingOrder {
+		if key == path || strings.HasPrefix(key, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeKey 去掉下划线并转为小写
+func normalizeKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
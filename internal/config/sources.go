@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// 配置项的来源，按优先级从低到高排列
+const (
+	SourceDefault  = "default"  // 内置默认值
+	SourceDatabase = "database" // 数据库中的系统配置
+	SourceFile     = "file"     // 配置文件
+	SourceEnv      = "env"      // 环境变量
+	SourceFlag     = "flag"     // 命令行参数 --set
+)
+
+// EnvPrefix 环境变量前缀，配置键中的点号替换为下划线并转为大写，例如 NEKOBRIDGE_WEBSOCKET_MAX_MESSAGE_SIZE
+const EnvPrefix = "NEKOBRIDGE"
+
+// legacyEnvPrefix 旧版本使用的环境变量前缀，仍然有效，优先级低于 EnvPrefix
+const legacyEnvPrefix = "QQ_WEBHOOK"
+
+// fileEnvSuffix 环境变量名加上该后缀表示从文件读取取值，例如 NEKOBRIDGE_AUTH_JWT_SECRET_FILE=/run/secrets/jwt
+const fileEnvSuffix = "_FILE"
+
+// Source 配置项的来源，Name 为设置该配置项的环境变量名或命令行参数
+type Source struct {
+	Layer string `json:"layer"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Overrides 命令行参数 --set key=value 指定的配置项，优先级最高，实现 flag.Value
+type Overrides map[string]string
+
+// String 实现 flag.Value
+func (o Overrides) String() string {
+	pairs := make([]string, 0, len(o))
+	for key, value := range o {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set 实现 flag.Value，列表类型的配置项用逗号分隔多个值
+func (o Overrides) Set(arg string) error {
+	key, value, ok := strings.Cut(arg, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return fmt.Errorf("格式应为 key=value: %s", arg)
+	}
+	if !IsSettingKey(key) {
+		return fmt.Errorf("未知的配置项: %s", key)
+	}
+	o[key] = value
+	return nil
+}
+
+// EnvName 配置键对应的环境变量名
+func EnvName(key string) string {
+	return envName(EnvPrefix, key)
+}
+
+// envName 按前缀生成配置键对应的环境变量名
+func envName(prefix, key string) string {
+	return prefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// lookupEnv 读取配置键对应的环境变量，返回取值和实际使用的环境变量名，空值视为未设置
+// <名称>_FILE 表示从该文件读取取值（例如 Docker secrets），文件末尾的换行会被去掉；同时设置两者时返回错误
+func lookupEnv(key string) (value, name string, ok bool, err error) {
+	for _, prefix := range []string{EnvPrefix, legacyEnvPrefix} {
+		name := envName(prefix, key)
+		value := os.Getenv(name)
+		path := os.Getenv(name + fileEnvSuffix)
+
+		switch {
+		case value != "" && path != "":
+			return "", "", false, fmt.Errorf("不能同时设置环境变量 %s 和 %s", name, name+fileEnvSuffix)
+		case value != "":
+			return value, name, true, nil
+		case path != "":
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", "", false, fmt.Errorf("读取环境变量 %s 指定的文件失败: %w", name+fileEnvSuffix, err)
+			}
+			return strings.TrimRight(string(data), "\r\n"), name + fileEnvSuffix, true, nil
+		}
+	}
+	return "", "", false, nil
+}
+
+// pinned 检查配置项是否由环境变量或命令行参数设置，返回设置它的环境变量名或命令行参数
+// 这类配置项写入配置文件不会生效
+func (s *Store) pinned(key string) (string, bool) {
+	if _, ok := s.overrides[key]; ok {
+		return "--set " + key, true
+	}
+	if _, name, ok, _ := lookupEnv(key); ok {
+		return name, true
+	}
+	return "", false
+}
+
+// Sources 获取每个配置项当前生效的值来自哪一层
+func (s *Store) Sources() map[string]Source {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sources := make(map[string]Source, len(s.sources))
+	for key, source := range s.sources {
+		sources[key] = source
+	}
+	return sources
+}
@@ -0,0 +1,587 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// DefaultPath 没有找到配置文件时创建的配置文件
+const DefaultPath = "configs/config.yaml"
+
+// reloadDelay 配置文件变化后等待的时间，合并编辑器保存时产生的多次事件
+const reloadDelay = 300 * time.Millisecond
+
+// secretsKey 密钥由数据库管理，不属于配置存储的配置项
+const secretsKey = "secrets"
+
+// searchPaths 按顺序查找配置文件
+var searchPaths = []string{"config.yaml", DefaultPath, "/etc/qq-webhook-pro/config.yaml"}
+
+// databaseIgnoredKeys 不从数据库读取的配置键，数据库中的凭据只是初始化时写入的占位值，数据库连接配置在连接数据库之前就需要确定
+var databaseIgnoredKeys = map[string]bool{
+	"auth.password":               true,
+	"auth.jwt_secret":             true,
+	"database.driver":             true,
+	"database.dsn":                true,
+	"database.max_idle_conns":     true,
+	"database.max_open_conns":     true,
+	"database.conn_max_lifetime":  true,
+	"database.conn_max_idle_time": true,
+	"database.auto_migrate":       true,
+}
+
+// CredentialKeys 登录凭据、指标抓取令牌和数据库连接串（可能包含密码）的配置键，不通过配置接口返回，也不保存到配置版本中
+var CredentialKeys = []string{"auth.password", "auth.jwt_secret", "metrics.token", "database.dsn"}
+
+// ErrOverridden 配置项由环境变量或命令行参数设置，修改配置文件不会生效
+var ErrOverridden = errors.New("配置项由环境变量或命令行参数设置，无法修改")
+
+// decodeHook 解析配置时使用的类型转换
+var decodeHook = mapstructure.ComposeDecodeHookFunc(
+	mapstructure.StringToTimeHookFunc(time.RFC3339),
+	mapstructure.StringToTimeDurationHookFunc(),
+	mapstructure.StringToSliceHookFunc(","),
+)
+
+// DatabaseLayer 读取数据库中保存的配置，键为点号分隔的配置路径
+type DatabaseLayer func() (map[string]interface{}, error)
+
+// Subscriber 配置变化时的回调，old 和 current 为变化前后的配置副本
+// 回调在配置存储的锁内执行，不能再修改配置
+type Subscriber func(old, current *Config)
+
+// Store 配置存储，运行时配置的唯一来源
+// 有效配置由以下几层按优先级从低到高合并: 内置默认值 < 数据库 < 配置文件 < 环境变量 < 命令行参数
+// 通过接口修改配置时只把发生变化的配置项写入配置文件，文件中的其他内容和注释保持不变
+type Store struct {
+	path      string
+	config    *Config // 当前生效的配置，各模块共享同一个实例
+	database  DatabaseLayer
+	overrides Overrides
+	sources   map[string]Source             // 每个配置项当前生效的值来自哪一层
+	repaired  map[string]repairedCredential // 自动修复的登录凭据，配置源中的取值未变化时重新加载沿用修复结果
+
+	mu          sync.Mutex // 串行化加载和修改
+	subscribers []Subscriber
+}
+
+// repairedCredential 自动修复的登录凭据：source 为各层合并后的取值，value 为生成的 JWT 密钥或密码哈希
+type repairedCredential struct {
+	source string
+	value  string
+}
+
+// FindConfigFile 查找配置文件，都不存在时返回 DefaultPath
+func FindConfigFile() string {
+	for _, path := range searchPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return DefaultPath
+}
+
+// NewStore 创建配置存储
+func NewStore(path string) *Store {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return &Store{path: path}
+}
+
+// Path 配置文件路径
+func (s *Store) Path() string {
+	return s.path
+}
+
+// SetDatabaseLayer 设置数据库配置层，需要在 Load 之前调用
+func (s *Store) SetDatabaseLayer(layer DatabaseLayer) {
+	s.database = layer
+}
+
+// SetOverrides 设置命令行参数指定的配置项，需要在 Load 之前调用
+func (s *Store) SetOverrides(overrides Overrides) {
+	s.overrides = overrides
+}
+
+// Config 当前生效的配置，配置变化时原地更新；其他 goroutine 需通过 GetServerConfig 等加锁的方法读取
+func (s *Store) Config() *Config {
+	return s.config
+}
+
+// Subscribe 订阅配置变化，配置文件重新加载或通过接口修改后按订阅顺序调用
+func (s *Store) Subscribe(fn Subscriber) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Load 首次加载配置，配置文件不存在时按当前配置创建
+func (s *Store) Load() (*Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, sources, err := s.build()
+	if err != nil {
+		return nil, err
+	}
+	s.config = cfg
+	s.sources = sources
+
+	fmt.Printf("✅ 配置加载成功: %s\n", s.path)
+	fmt.Printf("📊 已加载 %d 个密钥\n", len(cfg.Secrets))
+	return cfg, nil
+}
+
+// Reload 重新读取数据库和配置文件，配置有变化时通知订阅者，返回变化前后的配置副本
+func (s *Store) Reload() (*Config, *Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reload()
+}
+
+// Update 修改配置并写入配置文件，返回修改前后的配置副本
+// apply 在当前配置的副本上修改，返回错误时配置保持不变
+func (s *Store) Update(apply func(cfg *Config) error) (*Config, *Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := s.config.Clone()
+	candidate := s.config.Clone()
+	if err := apply(candidate); err != nil {
+		return nil, nil, err
+	}
+	if err := validateAndRepairConfig(candidate); err != nil {
+		return nil, nil, err
+	}
+
+	changes := changedSettings(Settings(old), Settings(candidate))
+	if len(changes) == 0 {
+		return old, old, nil
+	}
+	for key := range changes {
+		if name, overridden := s.pinned(key); overridden {
+			return nil, nil, fmt.Errorf("%w: %s (%s)", ErrOverridden, key, name)
+		}
+	}
+
+	if err := s.writeFile(changes, nil); err != nil {
+		return nil, nil, err
+	}
+	return s.reload()
+}
+
+// Reset 从配置文件中删除配置项，使其回退到数据库中的值或默认值
+func (s *Store) Reset(keys ...string) (*Config, *Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writeFile(nil, keys); err != nil {
+		return nil, nil, err
+	}
+	return s.reload()
+}
+
+// Watch 监听配置文件，文件变化后自动重新加载，返回停止监听的函数
+func (s *Store) Watch() (func() error, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// 监听所在目录，编辑器通过重命名临时文件保存时也能收到事件
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != s.path || !event.Has(fsnotify.Write|fsnotify.Create) {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDelay, s.reloadFromFile)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				fmt.Printf("⚠️  监听配置文件失败: %v\n", err)
+			}
+		}
+	}()
+
+	return watcher.Close, nil
+}
+
+// reloadFromFile 配置文件变化后重新加载，加载失败时继续使用当前配置
+func (s *Store) reloadFromFile() {
+	old, current, err := s.Reload()
+	if err != nil {
+		fmt.Printf("⚠️  配置文件已变化，但重新加载失败，继续使用当前配置: %v\n", err)
+		return
+	}
+	if keys := ChangedKeys(old, current); len(keys) > 0 {
+		fmt.Printf("🔄 配置文件已重新加载，变化的配置项: %s\n", strings.Join(keys, ", "))
+	}
+}
+
+// reload 重新合并各层配置并原地更新当前配置，调用方需持有锁
+func (s *Store) reload() (*Config, *Config, error) {
+	next, sources, err := s.build()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.sources = sources
+
+	old := s.config.Clone()
+	// 密钥由数据库管理，重新加载时保留运行中的密钥
+	next.Secrets = s.config.GetSecrets()
+	if len(ChangedKeys(old, next)) == 0 {
+		return old, old, nil
+	}
+
+	s.config.Restore(next)
+	current := s.config.Clone()
+	for _, fn := range s.subscribers {
+		fn(old, current)
+	}
+	return old, current, nil
+}
+
+// build 合并各层配置并验证，返回每个配置项的来源；自动修复的配置项（生成的 JWT 密钥、密码哈希）写回配置文件
+func (s *Store) build() (*Config, map[string]Source, error) {
+	cfg, sources, exists, err := s.merge(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		fmt.Printf("⚠️  配置文件不存在，使用默认配置并创建: %s\n", s.path)
+	}
+
+	loaded := Settings(cfg)
+	// 生成 JWT 密钥和计算密码哈希每次结果都不同，配置源中的取值未变化时沿用上次的结果，
+	// 否则凭据被固定或写回失败时，每次重新加载都会使所有会话失效并通知订阅者
+	credentials := credentialFields(cfg)
+	carried := make(map[string]bool, len(credentials))
+	for key, field := range credentials {
+		if previous, ok := s.repaired[key]; ok && previous.source == *field {
+			*field = previous.value
+			carried[key] = true
+		}
+	}
+	if err := validateAndRepairConfig(cfg); err != nil {
+		return nil, nil, fmt.Errorf("配置验证失败: %w", err)
+	}
+	if !carried["auth.password"] && loaded["auth.password"] != cfg.Auth.Password {
+		fmt.Println("🔒 配置文件中的明文密码已迁移为 bcrypt 哈希")
+	}
+	repaired := make(map[string]repairedCredential, len(credentials))
+	for key, field := range credentials {
+		if source := loaded[key].(string); source != *field {
+			repaired[key] = repairedCredential{source: source, value: *field}
+		}
+	}
+	s.repaired = repaired
+
+	// 配置文件不存在时写入全部配置项，否则只写回自动修复的配置项
+	changes := Settings(cfg)
+	if exists {
+		changes = changedSettings(loaded, changes)
+	}
+	for key := range changes {
+		if _, overridden := s.pinned(key); overridden {
+			delete(changes, key)
+		}
+	}
+	if len(changes) > 0 {
+		if err := s.writeFile(changes, nil); err != nil {
+			fmt.Printf("⚠️  保存配置文件失败: %v\n", err)
+		} else {
+			for key := range changes {
+				sources[key] = Source{Layer: SourceFile, Name: s.path}
+			}
+		}
+	}
+
+	return cfg, sources, nil
+}
+
+// credentialFields 会被自动修复的登录凭据字段
+func credentialFields(cfg *Config) map[string]*string {
+	return map[string]*string{
+		"auth.jwt_secret": &cfg.Auth.JWTSecret,
+		"auth.password":   &cfg.Auth.Password,
+	}
+}
+
+// merge 按优先级合并各层配置，未经验证；persist 为 false 时不修正配置文件中旧版本写入的配置键
+func (s *Store) merge(persist bool) (*Config, map[string]Source, bool, error) {
+	data, exists, err := s.readFile(persist)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+
+	setDefaults(v)
+	sources := make(map[string]Source, len(settingOrder))
+	for key := range settingOrder {
+		sources[key] = Source{Layer: SourceDefault}
+	}
+
+	// 数据库层的优先级高于内置默认值，低于配置文件
+	if s.database != nil {
+		values, err := s.database()
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("读取数据库配置失败: %w", err)
+		}
+		for key, value := range values {
+			if settingOrder[key] > 0 && !databaseIgnoredKeys[key] {
+				v.SetDefault(key, value)
+				sources[key] = Source{Layer: SourceDatabase}
+			}
+		}
+	}
+
+	if exists {
+		if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+			return nil, nil, false, fmt.Errorf("读取配置文件失败: %w", err)
+		}
+		for key := range settingOrder {
+			if v.InConfig(key) {
+				sources[key] = Source{Layer: SourceFile, Name: s.path}
+			}
+		}
+	}
+
+	// 环境变量和命令行参数覆盖以上各层
+	for key := range settingOrder {
+		if value, ok := s.overrides[key]; ok {
+			v.Set(key, value)
+			sources[key] = Source{Layer: SourceFlag, Name: "--set " + key}
+			continue
+		}
+		value, name, ok, err := lookupEnv(key)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if ok {
+			v.Set(key, value)
+			sources[key] = Source{Layer: SourceEnv, Name: name}
+		}
+	}
+
+	var cfg Config
+	if err := v.Unmarshal(&cfg, viper.DecodeHook(decodeHook)); err != nil {
+		return nil, nil, false, fmt.Errorf("解析配置失败: %w", err)
+	}
+	return &cfg, sources, exists, nil
+}
+
+// Report 配置检查结果
+type Report struct {
+	Config  *Config           // 验证后的有效配置
+	Sources map[string]Source // 每个配置项的来源
+	Unknown []string          // 配置文件中无法识别的配置键
+	Invalid []string          // 取值无效、加载时会被替换为默认值的配置项
+	Exists  bool              // 配置文件是否存在
+}
+
+// Inspect 合并各层配置并检查，不创建也不修改配置文件，不影响当前生效的配置
+func (s *Store) Inspect() (*Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, sources, exists, err := s.merge(false)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Sources: sources, Unknown: []string{}, Invalid: []string{}, Exists: exists}
+
+	if exists {
+		data, _, err := s.readFile(false)
+		if err != nil {
+			return nil, err
+		}
+		if report.Unknown, err = unknownKeys(data); err != nil {
+			return nil, err
+		}
+	}
+
+	loaded := Settings(cfg)
+	if err := validateAndRepairConfig(cfg); err != nil {
+		return nil, fmt.Errorf("配置验证失败: %w", err)
+	}
+	// 生成 JWT 密钥和加密明文密码属于正常的自动处理，不算作无效配置
+	repaired := changedSettings(loaded, Settings(cfg))
+	for _, key := range CredentialKeys {
+		delete(repaired, key)
+	}
+	for key := range repaired {
+		report.Invalid = append(report.Invalid, key)
+	}
+	SortKeys(report.Invalid)
+
+	report.Config = cfg
+	return report, nil
+}
+
+// Settings 将配置展开为 "点号分隔的配置键 -> 值"，不包含密钥
+func Settings(cfg *Config) map[string]interface{} {
+	cfg.mu.RLock()
+	defer cfg.mu.RUnlock()
+
+	settings := make(map[string]interface{})
+	walkSettings(reflect.ValueOf(cfg).Elem(), "", func(key string, value interface{}) {
+		settings[key] = value
+	})
+	return settings
+}
+
+// ApplySettings 将 "配置键 -> 值" 写入配置，未知的配置键忽略，列表整体替换
+func ApplySettings(cfg *Config, settings map[string]interface{}) error {
+	nested := make(map[string]interface{})
+	for key, value := range settings {
+		if !IsSettingKey(key) {
+			continue
+		}
+		parts := strings.Split(key, ".")
+		node := nested
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				node[part] = child
+			}
+			node = child
+		}
+		node[parts[len(parts)-1]] = value
+	}
+
+	cfg.mu.Lock()
+	defer cfg.mu.Unlock()
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       decodeHook,
+		WeaklyTypedInput: true,
+		ZeroFields:       true,
+		Result:           cfg,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(nested)
+}
+
+// ChangedKeys 返回两个配置之间取值不同的配置键，按配置结构的顺序排列
+func ChangedKeys(old, current *Config) []string {
+	changes := changedSettings(Settings(old), Settings(current))
+	return sortedKeys(changes)
+}
+
+// IsSettingKey 检查是否为有效的配置键（不包括上级路径）
+func IsSettingKey(key string) bool {
+	return settingOrder[key] > 0
+}
+
+// SortKeys 按配置结构的顺序排列配置键，未知的配置键按名称排在最后
+func SortKeys(keys []string) {
+	sort.Slice(keys, func(i, j int) bool {
+		oi, oj := settingOrder[keys[i]], settingOrder[keys[j]]
+		if oi == 0 || oj == 0 {
+			if oi == oj {
+				return keys[i] < keys[j]
+			}
+			return oj == 0
+		}
+		return oi < oj
+	})
+}
+
+// walkSettings 按结构体字段顺序遍历配置项，键为 mapstructure 标签以点号连接的路径
+func walkSettings(value reflect.Value, prefix string, fn func(key string, value interface{})) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if !field.IsExported() || tag == "" || tag == secretsKey {
+			continue
+		}
+
+		key := joinKey(prefix, tag)
+		if field.Type.Kind() == reflect.Struct {
+			walkSettings(value.Field(i), key, fn)
+			continue
+		}
+		fn(key, value.Field(i).Interface())
+	}
+}
+
+// changedSettings 返回 next 中与 prev 取值不同的配置项
+func changedSettings(prev, next map[string]interface{}) map[string]interface{} {
+	changes := make(map[string]interface{})
+	for key, value := range next {
+		if !settingEqual(prev[key], value) {
+			changes[key] = value
+		}
+	}
+	return changes
+}
+
+// settingEqual 比较配置项的值，空列表和未设置的列表视为相同
+func settingEqual(a, b interface{}) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() == reflect.Slice && vb.Kind() == reflect.Slice && va.Len() == 0 && vb.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// sortedKeys 按配置结构的顺序排列配置键
+func sortedKeys(settings map[string]interface{}) []string {
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return settingOrder[keys[i]] < settingOrder[keys[j]]
+	})
+	return keys
+}
+
+// joinKey 连接配置键
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// settingOrder 所有配置键在配置结构中的顺序（从 1 开始）
+var settingOrder = func() map[string]int {
+	order := make(map[string]int)
+	walkSettings(reflect.ValueOf(&defaultConfig).Elem(), "", func(key string, value interface{}) {
+		order[key] = len(order) + 1
+	})
+	return order
+}()
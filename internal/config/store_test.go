@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestStorePrecedence(t *testing.T) {
+	const key = "ui.theme"
+	tests := []struct {
+		name      string
+		database  string
+		file      string
+		env       string
+		envFile   string // 通过 <名称>_FILE 读取的取值
+		flag      string
+		want      string
+		wantLayer string
+	}{
+		{name: "内置默认值", want: defaultConfig.UI.Theme, wantLayer: SourceDefault},
+		{name: "数据库覆盖默认值", database: "db", want: "db", wantLayer: SourceDatabase},
+		{name: "配置文件覆盖数据库", database: "db", file: "file", want: "file", wantLayer: SourceFile},
+		{name: "环境变量覆盖配置文件", database: "db", file: "file", env: "env", want: "env", wantLayer: SourceEnv},
+		{name: "从文件读取环境变量", file: "file", envFile: "from-file\n", want: "from-file", wantLayer: SourceEnv},
+		{name: "命令行参数优先级最高", file: "file", env: "env", flag: "flag", want: "flag", wantLayer: SourceFlag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store := NewStore(filepath.Join(dir, "config.yaml"))
+			// 配置文件不存在时会写入全部配置项，测试中总是预先创建
+			content := "ui:\n  language: zh-CN\n"
+			if tt.file != "" {
+				content = "ui:\n  theme: " + tt.file + "\n"
+			}
+			if err := os.WriteFile(store.Path(), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.database != "" {
+				store.SetDatabaseLayer(func() (map[string]interface{}, error) {
+					return map[string]interface{}{key: tt.database}, nil
+				})
+			}
+			t.Setenv(EnvName(key), tt.env)
+			if tt.envFile != "" {
+				path := filepath.Join(dir, "theme")
+				if err := os.WriteFile(path, []byte(tt.envFile), 0600); err != nil {
+					t.Fatal(err)
+				}
+				t.Setenv(EnvName(key)+fileEnvSuffix, path)
+			}
+			if tt.flag != "" {
+				store.SetOverrides(Overrides{key: tt.flag})
+			}
+
+			cfg, err := store.Load()
+			if err != nil {
+				t.Fatalf("Load() 失败: %v", err)
+			}
+			if got := cfg.GetUIConfig().Theme; got != tt.want {
+				t.Errorf("%s = %q，应为 %q", key, got, tt.want)
+			}
+			if layer := store.Sources()[key].Layer; layer != tt.wantLayer {
+				t.Errorf("%s 的来源 = %q，应为 %q", key, layer, tt.wantLayer)
+			}
+		})
+	}
+}
+
+func TestStoreDatabaseIgnoredKeys(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "config.yaml"))
+	store.SetDatabaseLayer(func() (map[string]interface{}, error) {
+		return map[string]interface{}{"database.driver": DatabasePostgres, "logging.level": "debug"}, nil
+	})
+	cfg, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() 失败: %v", err)
+	}
+	if driver := cfg.GetDatabaseConfig().Driver; driver == DatabasePostgres {
+		t.Error("数据库连接配置不应从数据库读取")
+	}
+	if level := cfg.GetLoggingConfig().Level; level != "debug" {
+		t.Errorf("logging.level = %q，应使用数据库中的值 debug", level)
+	}
+}
+
+func TestStoreUpdate(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "config.yaml"))
+	store.SetOverrides(Overrides{"server.port": "9000"})
+	if _, err := store.Load(); err != nil {
+		t.Fatalf("Load() 失败: %v", err)
+	}
+
+	var notified int
+	store.Subscribe(func(old, current *Config) { notified++ })
+
+	// 修改写入配置文件，重新加载后通知订阅者
+	old, current, err := store.Update(func(cfg *Config) error {
+		cfg.UI.Theme = "dark-test"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() 失败: %v", err)
+	}
+	if old.UI.Theme == "dark-test" || current.UI.Theme != "dark-test" || notified != 1 {
+		t.Errorf("Update() 前后 = %q/%q，通知 %d 次", old.UI.Theme, current.UI.Theme, notified)
+	}
+	if layer := store.Sources()["ui.theme"].Layer; layer != SourceFile {
+		t.Errorf("修改后 ui.theme 的来源 = %q，应为 %q", layer, SourceFile)
+	}
+
+	// 由命令行参数设置的配置项不能修改
+	_, _, err = store.Update(func(cfg *Config) error {
+		cfg.Server.Port = "9001"
+		return nil
+	})
+	if !errors.Is(err, ErrOverridden) {
+		t.Errorf("修改被覆盖的配置项错误 = %v，应为 %v", err, ErrOverridden)
+	}
+	if port := store.Config().GetServerConfig().Port; port != "9000" {
+		t.Errorf("server.port = %q，应保持 9000", port)
+	}
+
+	// 删除配置文件中的配置项后回退到默认值
+	if _, _, err := store.Reset("ui.theme"); err != nil {
+		t.Fatalf("Reset() 失败: %v", err)
+	}
+	if theme := store.Config().GetUIConfig().Theme; theme != defaultConfig.UI.Theme {
+		t.Errorf("Reset 后 ui.theme = %q，应为默认值 %q", theme, defaultConfig.UI.Theme)
+	}
+}
+
+func TestStoreReloadKeepsRepairedCredentials(t *testing.T) {
+	store := NewStore(filepath.Join(t.TempDir(), "config.yaml"))
+	// 由命令行参数设置的凭据不会写回配置文件，每次加载都要重新修复
+	store.SetOverrides(Overrides{"auth.password": "plain-password", "auth.jwt_secret": ""})
+	cfg, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load() 失败: %v", err)
+	}
+	auth := cfg.GetAuthConfig()
+	if auth.JWTSecret == "" || bcrypt.CompareHashAndPassword([]byte(auth.Password), []byte("plain-password")) != nil {
+		t.Fatalf("加载后 JWT 密钥 = %q，密码哈希 = %q", auth.JWTSecret, auth.Password)
+	}
+
+	var notified int
+	store.Subscribe(func(old, current *Config) { notified++ })
+	for i := 0; i < 2; i++ {
+		old, current, err := store.Reload()
+		if err != nil {
+			t.Fatalf("Reload() 失败: %v", err)
+		}
+		if keys := ChangedKeys(old, current); len(keys) > 0 {
+			t.Errorf("配置源未变化时重新加载，变化的配置项 = %v", keys)
+		}
+	}
+	if current := store.Config().GetAuthConfig(); current.JWTSecret != auth.JWTSecret || current.Password != auth.Password {
+		t.Error("重新加载后 JWT 密钥或密码哈希发生了变化")
+	}
+	if notified != 0 {
+		t.Errorf("订阅者被通知 %d 次，应为 0", notified)
+	}
+}
@@ -3,10 +3,17 @@ package database
 import (
 	"fmt"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"time"
 
+	"nekobridge/internal/config"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -14,32 +21,84 @@ import (
 
 var DB *gorm.DB
 
-// InitDatabase 初始化数据库
-func InitDatabase() error {
-	// 确保数据目录存在
-	dataDir := "./data"
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
-		return fmt.Errorf("创建数据目录失败: %v", err)
+// DataDir 数据目录，保存数据库文件和上传的文件，需要在 InitDatabase 之前设置
+var DataDir = "data"
+
+// settings 数据库连接配置，需要在 InitDatabase 之前通过 Configure 设置
+var settings = config.DatabaseConfig{
+	Driver:          config.DatabaseSQLite,
+	MaxIdleConns:    10,
+	MaxOpenConns:    100,
+	ConnMaxLifetime: 3600,
+	AutoMigrate:     true,
+}
+
+// postgresPassword 匹配 key=value 格式的 PostgreSQL 连接串中的密码
+var postgresPassword = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// Configure 设置数据库类型、连接串和连接池，需要在 InitDatabase 之前调用
+func Configure(cfg config.DatabaseConfig) {
+	settings = cfg
+	if settings.Driver == "" {
+		settings.Driver = config.DatabaseSQLite
 	}
+}
 
-	// 数据库文件路径
-	dbPath := filepath.Join(dataDir, "webhook_pro.db")
+// Driver 数据库类型
+func Driver() string {
+	return settings.Driver
+}
 
-	// 配置GORM - 禁用详细日志输出
-	config := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
+// Path SQLite 数据库文件路径，未设置 database.dsn 时为数据目录下的 webhook_pro.db
+func Path() string {
+	if settings.DSN != "" {
+		return settings.DSN
 	}
+	return filepath.Join(DataDir, "webhook_pro.db")
+}
 
-	// 连接数据库
-	var err error
-	DB, err = gorm.Open(sqlite.Open(dbPath), config)
-	if err != nil {
-		return fmt.Errorf("连接数据库失败: %v", err)
+// Describe 数据库类型和连接地址，连接串中的密码会被隐藏，用于日志输出
+func Describe() string {
+	switch settings.Driver {
+	case config.DatabasePostgres:
+		if u, err := url.Parse(settings.DSN); err == nil && u.Scheme != "" {
+			return "PostgreSQL " + u.Redacted()
+		}
+		return "PostgreSQL " + postgresPassword.ReplaceAllString(settings.DSN, "${1}***")
+	case config.DatabaseMySQL:
+		if cfg, err := mysqldriver.ParseDSN(settings.DSN); err == nil {
+			if cfg.Passwd != "" {
+				cfg.Passwd = "***"
+			}
+			return "MySQL " + cfg.FormatDSN()
+		}
+		return "MySQL"
+	}
+	return "SQLite " + Path()
+}
+
+// InitDatabase 初始化数据库，执行未完成的迁移并写入默认数据
+// 数据库版本高于程序支持的版本，或关闭了自动迁移且有未执行的迁移时返回错误
+func InitDatabase() error {
+	if err := Open(); err != nil {
+		return err
 	}
 
-	// 自动迁移
-	if err := autoMigrate(); err != nil {
-		return fmt.Errorf("数据库迁移失败: %v", err)
+	current, err := CheckSchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current < SchemaVersion() {
+		if !settings.AutoMigrate {
+			return fmt.Errorf("数据库需要从版本 %d 升级到 %d，已关闭自动迁移，请先执行 nekobridge migrate", current, SchemaVersion())
+		}
+		steps, err := Migrate(SchemaVersion(), false)
+		for _, step := range steps {
+			log.Printf("数据库迁移 %d: %s", step.Version, step.Description)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
 	// 初始化默认数据
@@ -47,27 +106,104 @@ func InitDatabase() error {
 		return fmt.Errorf("初始化默认数据失败: %v", err)
 	}
 
+	log.Println("数据库初始化成功")
+	return nil
+}
+
+// Open 连接数据库，不创建或修改表结构，SQLite 数据库文件不存在时会创建空的数据库
+func Open() error {
+	dialector, err := openDialector()
+	if err != nil {
+		return err
+	}
+
+	// 配置GORM - 禁用详细日志输出
+	gormConfig := &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	}
+
+	// 连接数据库，PostgreSQL 和 MySQL 连接失败时立即返回错误
+	DB, err = gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return fmt.Errorf("连接数据库失败 (%s): %v", Describe(), err)
+	}
+
 	// 配置连接池
 	sqlDB, err := DB.DB()
 	if err == nil {
-		sqlDB.SetMaxIdleConns(10)
-		sqlDB.SetMaxOpenConns(100)
-		sqlDB.SetConnMaxLifetime(time.Hour)
+		sqlDB.SetMaxIdleConns(settings.MaxIdleConns)
+		sqlDB.SetMaxOpenConns(settings.MaxOpenConns)
+		sqlDB.SetConnMaxLifetime(time.Duration(settings.ConnMaxLifetime) * time.Second)
+		sqlDB.SetConnMaxIdleTime(time.Duration(settings.ConnMaxIdleTime) * time.Second)
 	}
-
-	log.Println("数据库初始化成功")
 	return nil
 }
 
-// autoMigrate 自动迁移数据库表
-func autoMigrate() error {
-	return DB.AutoMigrate(
-		&Secret{},
-		&BanRecord{},
-		&SystemConfig{},
-		&LogEntry{},
-		&Connection{},
-	)
+// openDialector 按数据库类型创建 GORM 驱动
+func openDialector() (gorm.Dialector, error) {
+	switch settings.Driver {
+	case config.DatabaseSQLite:
+		// 确保数据目录存在
+		if err := os.MkdirAll(filepath.Dir(Path()), 0755); err != nil {
+			return nil, fmt.Errorf("创建数据目录失败: %v", err)
+		}
+		return sqlite.Open(Path()), nil
+
+	case config.DatabasePostgres:
+		return postgres.Open(settings.DSN), nil
+
+	case config.DatabaseMySQL:
+		// 模型中的时间字段需要 parseTime，未指定时自动加上
+		cfg, err := mysqldriver.ParseDSN(settings.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 MySQL 连接串: %v", err)
+		}
+		cfg.ParseTime = true
+		return mysql.Open(cfg.FormatDSN()), nil
+	}
+	return nil, fmt.Errorf("不支持的数据库类型: %s", settings.Driver)
+}
+
+// Close 关闭数据库连接
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// Backup 将 SQLite 数据库的一致性快照写入 path，服务运行时也可以执行，path 必须不存在
+func Backup(path string) error {
+	if settings.Driver != config.DatabaseSQLite {
+		return fmt.Errorf("只支持备份 SQLite 数据库，%s 请使用 pg_dump 或 mysqldump", settings.Driver)
+	}
+	return DB.Exec("VACUUM INTO ?", path).Error
+}
+
+// CheckIntegrity 检查数据库文件是否完整，使用单独的连接，不影响 DB
+func CheckIntegrity(path string) error {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return fmt.Errorf("打开数据库文件失败: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	var result string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return fmt.Errorf("数据库文件无效: %v", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("数据库文件已损坏: %s", result)
+	}
+	return nil
 }
 
 // initDefaultData 初始化默认数据
@@ -0,0 +1,265 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"nekobridge/internal/config"
+
+	"gorm.io/gorm"
+)
+
+// 迁移方向
+const (
+	MigrationUp   = "up"
+	MigrationDown = "down"
+)
+
+// migration 数据库结构的一个版本，up 升级到该版本，down 回滚到上一个版本，down 为 nil 表示无法回滚
+// 每个步骤和对应的 schema_migrations 记录在同一个事务中执行（MySQL 的 DDL 会隐式提交，无法回滚）
+type migration struct {
+	version     uint
+	description string
+	up          func(tx *gorm.DB) error
+	down        func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已执行的数据库迁移，每个版本一条记录
+type SchemaMigration struct {
+	Version     uint      `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Description string    `gorm:"not null" json:"description"`
+	AppliedAt   time.Time `gorm:"not null" json:"appliedAt"`
+}
+
+// 迁移锁，多个实例连接同一个 PostgreSQL 或 MySQL 数据库时依次执行迁移
+const (
+	migrationLockID      = 0x6e656b6f // PostgreSQL advisory lock 的键
+	migrationLockName    = "nekobridge_schema_migrations"
+	migrationLockTimeout = 300 // MySQL GET_LOCK 的等待时间（秒）
+)
+
+// MigrationStep 需要执行（或已经执行）的迁移步骤
+type MigrationStep struct {
+	Version     uint   `json:"version"`
+	Description string `json:"description"`
+	Direction   string `json:"direction"` // up 或 down
+}
+
+// MigrationStatus 迁移的执行状态，AppliedAt 为空表示尚未执行
+type MigrationStatus struct {
+	Version     uint       `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"`
+	Unknown     bool       `json:"unknown,omitempty"` // 数据库中有记录，但当前程序中不存在（由更新的版本执行）
+}
+
+// ErrSchemaTooNew 数据库由更新版本的程序迁移过，当前程序无法安全使用
+var ErrSchemaTooNew = errors.New("数据库版本高于程序支持的版本")
+
+// ErrIrreversible 回滚需要撤销无法回滚的迁移
+var ErrIrreversible = errors.New("数据库迁移无法回滚")
+
+// SchemaVersion 当前程序支持的最新数据库版本
+func SchemaVersion() uint {
+	return migrations[len(migrations)-1].version
+}
+
+// CurrentVersion 数据库已执行的最新迁移版本，从未执行过迁移时为 0
+func CurrentVersion() (uint, error) {
+	return currentVersion(DB)
+}
+
+// currentVersion 使用 db 读取数据库已执行的最新迁移版本
+func currentVersion(db *gorm.DB) (uint, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+	var current uint
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current, nil
+}
+
+// CheckSchemaVersion 检查数据库版本不高于程序支持的版本，返回数据库当前版本
+func CheckSchemaVersion() (uint, error) {
+	return checkSchemaVersion(DB)
+}
+
+// checkSchemaVersion 使用 db 检查数据库版本
+func checkSchemaVersion(db *gorm.DB) (uint, error) {
+	current, err := currentVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if current > SchemaVersion() {
+		return current, fmt.Errorf("%w (%d > %d)，请升级程序，或使用新版本程序的 migrate --to 回滚数据库", ErrSchemaTooNew, current, SchemaVersion())
+	}
+	return current, nil
+}
+
+// Migrations 所有迁移的执行状态，按版本排序
+func Migrations() ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(DB)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.version, Description: m.description}
+		if record, ok := applied[m.version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+			delete(applied, m.version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, record := range applied {
+		appliedAt := record.AppliedAt
+		statuses = append(statuses, MigrationStatus{
+			Version:     record.Version,
+			Description: record.Description,
+			AppliedAt:   &appliedAt,
+			Unknown:     true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Migrate 升级或回滚到 target 版本，返回按顺序执行的步骤；dryRun 时只返回需要执行的步骤，不修改数据库
+// 执行期间持有迁移锁，其他实例同时启动时等待当前实例完成后重新检查
+func Migrate(target uint, dryRun bool) ([]MigrationStep, error) {
+	if target > SchemaVersion() {
+		return nil, fmt.Errorf("数据库版本 %d 不存在，程序支持的最新版本为 %d", target, SchemaVersion())
+	}
+	if dryRun {
+		_, steps, err := planMigrations(DB, target)
+		return steps, err
+	}
+
+	var done []MigrationStep
+	err := withMigrationLock(func(conn *gorm.DB) error {
+		plan, steps, err := planMigrations(conn, target)
+		if err != nil || len(plan) == 0 {
+			return err
+		}
+
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return fmt.Errorf("创建 schema_migrations 表失败: %v", err)
+		}
+		for i, m := range plan {
+			step := steps[i]
+			if err := applyMigration(conn, m, step.Direction); err != nil {
+				return fmt.Errorf("数据库迁移 %d (%s) %s 失败: %v", m.version, m.description, step.Direction, err)
+			}
+			done = append(done, step)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// planMigrations 计算升级或回滚到 target 需要执行的迁移
+// 升级时按版本从低到高执行未执行的迁移，回滚时按版本从高到低撤销；需要撤销无法回滚的迁移时不执行任何步骤
+func planMigrations(db *gorm.DB, target uint) ([]migration, []MigrationStep, error) {
+	if _, err := checkSchemaVersion(db); err != nil {
+		return nil, nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var plan []migration
+	var steps []MigrationStep
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; !ok && m.version <= target {
+			plan = append(plan, m)
+			steps = append(steps, MigrationStep{Version: m.version, Description: m.description, Direction: MigrationUp})
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.version]; ok && m.version > target {
+			if m.down == nil {
+				return nil, nil, fmt.Errorf("%w: %d (%s)，最低只能回滚到版本 %d", ErrIrreversible, m.version, m.description, m.version)
+			}
+			plan = append(plan, m)
+			steps = append(steps, MigrationStep{Version: m.version, Description: m.description, Direction: MigrationDown})
+		}
+	}
+	return plan, steps, nil
+}
+
+// withMigrationLock 在同一个数据库连接上持有迁移锁执行 fn
+// PostgreSQL 使用 advisory lock，MySQL 使用 GET_LOCK，锁随连接释放；SQLite 数据库文件只能由一个实例使用，不需要加锁
+func withMigrationLock(fn func(conn *gorm.DB) error) error {
+	return DB.Connection(func(conn *gorm.DB) error {
+		// Connection 返回的实例会累积查询条件，需要新的会话才能执行多条语句
+		conn = conn.Session(&gorm.Session{})
+		switch settings.Driver {
+		case config.DatabasePostgres:
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+				return fmt.Errorf("获取数据库迁移锁失败: %v", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID)
+
+		case config.DatabaseMySQL:
+			var acquired sql.NullInt64
+			if err := conn.Raw("SELECT GET_LOCK(?, ?)", migrationLockName, migrationLockTimeout).Scan(&acquired).Error; err != nil {
+				return fmt.Errorf("获取数据库迁移锁失败: %v", err)
+			}
+			if acquired.Int64 != 1 {
+				return errors.New("等待数据库迁移锁超时，可能有其他实例正在执行迁移")
+			}
+			defer conn.Exec("SELECT RELEASE_LOCK(?)", migrationLockName)
+		}
+		return fn(conn)
+	})
+}
+
+// applyMigration 在事务中执行一个迁移步骤并更新 schema_migrations
+func applyMigration(db *gorm.DB, m migration, direction string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if direction == MigrationDown {
+			if err := m.down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.version).Error
+		}
+
+		if err := m.up(tx); err != nil {
+			return err
+		}
+		return tx.Create(&SchemaMigration{
+			Version:     m.version,
+			Description: m.description,
+			AppliedAt:   time.Now(),
+		}).Error
+	})
+}
+
+// appliedMigrations 读取已执行的迁移，schema_migrations 表不存在时返回空
+func appliedMigrations(db *gorm.DB) (map[uint]SchemaMigration, error) {
+	applied := make(map[uint]SchemaMigration)
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return applied, nil
+	}
+
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("读取数据库迁移记录失败: %v", err)
+	}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"nekobridge/internal/config"
+
+	"gorm.io/gorm"
+)
+
+// openTestDB 在临时目录中打开空的 SQLite 数据库
+func openTestDB(t *testing.T) {
+	t.Helper()
+	DataDir = t.TempDir()
+	Configure(config.DatabaseConfig{Driver: config.DatabaseSQLite, MaxIdleConns: 1, MaxOpenConns: 1})
+	if err := Open(); err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() { Close() })
+}
+
+// liveModels 当前程序使用的模型，迁移到最新版本后表结构必须包含它们的全部列和索引
+var liveModels = []interface{}{
+	&Secret{},
+	&BanRecord{},
+	&SystemConfig{},
+	&LogEntry{},
+	&Connection{},
+	&QueuedMessage{},
+	&TrafficStat{},
+	&User{},
+	&Session{},
+	&APIKey{},
+	&AuditLog{},
+	&ConfigRevision{},
+}
+
+func TestMigrationsOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != uint(i+1) {
+			t.Errorf("第 %d 个迁移的版本为 %d，应为 %d", i, m.version, i+1)
+		}
+		// 只有初始表结构无法回滚
+		if m.description == "" || m.up == nil || (m.down == nil) != (m.version == 1) {
+			t.Errorf("迁移 %d 缺少说明、up 或 down", m.version)
+		}
+	}
+}
+
+func TestMigratePlan(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(SchemaVersion(), false); err != nil {
+		t.Fatalf("升级到最新版本失败: %v", err)
+	}
+	if _, err := Migrate(1, false); err != nil {
+		t.Fatalf("回滚到版本 1 失败: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		target  uint
+		want    []MigrationStep
+		wantErr error
+	}{
+		{name: "无需执行", target: 1},
+		{name: "升级", target: SchemaVersion(), want: []MigrationStep{{Version: 2, Description: migrations[1].description, Direction: MigrationUp}}},
+		{name: "初始表结构无法回滚", target: 0, wantErr: ErrIrreversible},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := Migrate(tt.target, true)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Migrate(%d, dryRun) 错误 = %v，应为 %v", tt.target, err, tt.wantErr)
+			}
+			if len(steps) != len(tt.want) {
+				t.Fatalf("步骤 = %v，应为 %v", steps, tt.want)
+			}
+			for i := range steps {
+				if steps[i] != tt.want[i] {
+					t.Errorf("步骤 %d = %v，应为 %v", i, steps[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if current, _ := CurrentVersion(); current != 1 {
+		t.Errorf("dry-run 修改了数据库版本: %d", current)
+	}
+	if _, err := Migrate(SchemaVersion()+1, false); err == nil {
+		t.Error("升级到不存在的版本应返回错误")
+	}
+}
+
+func TestMigrateRoundTrip(t *testing.T) {
+	openTestDB(t)
+
+	for round := 0; round < 2; round++ {
+		steps, err := Migrate(SchemaVersion(), false)
+		if err != nil {
+			t.Fatalf("升级失败: %v", err)
+		}
+		if want := len(migrations) - min(round, 1); len(steps) != want {
+			t.Fatalf("第 %d 轮升级执行了 %d 个步骤，应为 %d", round, len(steps), want)
+		}
+		for i, step := range steps {
+			if step.Version != migrations[len(migrations)-len(steps)+i].version || step.Direction != MigrationUp {
+				t.Errorf("升级步骤 %d = %v", i, step)
+			}
+		}
+		checkLiveModels(t, DB)
+
+		steps, err = Migrate(1, false)
+		if err != nil {
+			t.Fatalf("第 %d 轮回滚失败: %v", round, err)
+		}
+		for i, step := range steps {
+			if step.Version != migrations[len(migrations)-1-i].version || step.Direction != MigrationDown {
+				t.Errorf("回滚步骤 %d = %v", i, step)
+			}
+		}
+		if current, _ := CurrentVersion(); current != 1 {
+			t.Errorf("回滚后版本为 %d", current)
+		}
+	}
+
+	// 回滚到版本 0 会删除全部数据，直接拒绝
+	if _, err := Migrate(0, false); !errors.Is(err, ErrIrreversible) {
+		t.Errorf("回滚到版本 0 的错误 = %v，应为 %v", err, ErrIrreversible)
+	}
+	for _, table := range v1Tables {
+		if !DB.Migrator().HasTable(table) {
+			t.Errorf("拒绝回滚后表 %T 不应被删除", table)
+		}
+	}
+	if current, _ := CurrentVersion(); current != 1 {
+		t.Errorf("拒绝回滚后版本为 %d，应为 1", current)
+	}
+}
+
+// checkLiveModels 检查表结构包含模型的全部列和索引，发现模型修改后没有追加迁移的情况
+func checkLiveModels(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	for _, model := range liveModels {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("解析模型 %T 失败: %v", model, err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("表 %s 缺少列 %s，修改模型时需要追加迁移", stmt.Schema.Table, field.DBName)
+			}
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if !db.Migrator().HasIndex(model, index.Name) {
+				t.Errorf("表 %s 缺少索引 %s，修改模型时需要追加迁移", stmt.Schema.Table, index.Name)
+			}
+		}
+	}
+}
+
+func TestMigrateUnbannedBy(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(1, false); err != nil {
+		t.Fatalf("升级到版本 1 失败: %v", err)
+	}
+	if err := DB.Create(&v1BanRecord{Secret: "s", BannedAt: time.Now(), IsActive: true}).Error; err != nil {
+		t.Fatalf("写入封禁记录失败: %v", err)
+	}
+
+	countNull := func() int64 {
+		var n int64
+		DB.Table("ban_records").Where("unbanned_by IS NULL").Count(&n)
+		return n
+	}
+	if _, err := Migrate(2, false); err != nil {
+		t.Fatalf("升级到版本 2 失败: %v", err)
+	}
+	if n := countNull(); n != 0 {
+		t.Errorf("升级后仍有 %d 条 unbanned_by 为 NULL 的记录", n)
+	}
+	if _, err := Migrate(1, false); err != nil {
+		t.Fatalf("回滚到版本 1 失败: %v", err)
+	}
+	if n := countNull(); n != 1 {
+		t.Errorf("回滚后 unbanned_by 为 NULL 的记录数为 %d，应为 1", n)
+	}
+}
+
+func TestSchemaTooNew(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(SchemaVersion(), false); err != nil {
+		t.Fatalf("升级失败: %v", err)
+	}
+	newer := SchemaMigration{Version: SchemaVersion() + 1, Description: "future", AppliedAt: time.Now()}
+	if err := DB.Create(&newer).Error; err != nil {
+		t.Fatalf("写入迁移记录失败: %v", err)
+	}
+
+	if _, err := CheckSchemaVersion(); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("CheckSchemaVersion() 错误 = %v，应为 ErrSchemaTooNew", err)
+	}
+	if _, err := Migrate(SchemaVersion(), false); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Migrate() 错误 = %v，应为 ErrSchemaTooNew", err)
+	}
+
+	statuses, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations() 失败: %v", err)
+	}
+	if last := statuses[len(statuses)-1]; !last.Unknown || last.Version != newer.Version {
+		t.Errorf("最后一条状态 = %+v，应为未知版本 %d", last, newer.Version)
+	}
+}
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrations 按版本排序的数据库迁移，已发布的迁移不能修改，结构或数据的变化需要追加新的版本
+// 迁移只能使用本文件中冻结的表结构或显式的 SQL，不能引用 models.go 中的模型，否则模型修改后旧版本的结果会随之改变
+var migrations = []migration{
+	{
+		// 引入版本化迁移之前的表结构由 AutoMigrate 创建，已有的数据库执行时只补充缺少的表、列和索引
+		// 回滚会删除全部表和数据，因此不提供 down，需要清空数据库时直接删除数据库
+		version:     1,
+		description: "初始表结构",
+		up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(v1Tables...)
+		},
+	},
+	{
+		// 未解封的记录 unbanned_by 为 NULL，统一为空字符串，模型中改用 string
+		version:     2,
+		description: "ban_records.unbanned_by 改为非空字符串",
+		up: func(tx *gorm.DB) error {
+			return tx.Exec("UPDATE ban_records SET unbanned_by = '' WHERE unbanned_by IS NULL").Error
+		},
+		down: func(tx *gorm.DB) error {
+			return tx.Exec("UPDATE ban_records SET unbanned_by = NULL WHERE unbanned_by = ''").Error
+		},
+	},
+}
+
+// v1Tables 版本 1 的表结构
+var v1Tables = []interface{}{
+	&v1Secret{},
+	&v1BanRecord{},
+	&v1SystemConfig{},
+	&v1LogEntry{},
+	&v1Connection{},
+	&v1QueuedMessage{},
+	&v1TrafficStat{},
+	&v1User{},
+	&v1Session{},
+	&v1APIKey{},
+	&v1AuditLog{},
+	&v1ConfigRevision{},
+}
+
+// 版本 1 的表结构快照，与当时的模型定义一致，之后不能修改
+
+type v1Secret struct {
+	ID               uint   `gorm:"primaryKey"`
+	Secret           string `gorm:"uniqueIndex;size:191;not null"`
+	Name             string
+	Description      string
+	AppID            string
+	Enabled          bool `gorm:"default:true"`
+	MaxConnections   int  `gorm:"default:1"`
+	DeliveryMode     string
+	Protocol         string
+	UpstreamURL      string
+	UpstreamTypes    []string `gorm:"serializer:json"`
+	QueueMaxAge      int      `gorm:"default:0"`
+	QueueMaxMessages int      `gorm:"default:0"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	CreatedBy        string
+}
+
+func (v1Secret) TableName() string { return "secrets" }
+
+type v1BanRecord struct {
+	ID         uint   `gorm:"primaryKey"`
+	Secret     string `gorm:"not null;index"`
+	Reason     string
+	BannedAt   time.Time
+	BannedBy   string
+	UnbannedAt *time.Time
+	UnbannedBy *string
+	IsActive   bool `gorm:"default:true"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (v1BanRecord) TableName() string { return "ban_records" }
+
+type v1SystemConfig struct {
+	ID          uint   `gorm:"primaryKey"`
+	Key         string `gorm:"uniqueIndex;size:191;not null"`
+	Value       string
+	Type        string
+	Category    string
+	Description string
+	IsRequired  bool `gorm:"default:false"`
+	IsReadOnly  bool `gorm:"default:false"`
+	MinValue    *string
+	MaxValue    *string
+	Options     *string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (v1SystemConfig) TableName() string { return "system_configs" }
+
+type v1LogEntry struct {
+	ID        uint   `gorm:"primaryKey"`
+	Level     string `gorm:"not null;index"`
+	Message   string `gorm:"not null"`
+	Source    string
+	Timestamp time.Time `gorm:"not null;index"`
+	Data      string
+	CreatedAt time.Time
+}
+
+func (v1LogEntry) TableName() string { return "log_entries" }
+
+type v1Connection struct {
+	ID        uint   `gorm:"primaryKey"`
+	Secret    string `gorm:"not null;index"`
+	ClientIP  string
+	UserAgent string
+	Connected bool `gorm:"default:true"`
+	LastSeen  time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (v1Connection) TableName() string { return "connections" }
+
+type v1QueuedMessage struct {
+	ID        uint   `gorm:"primaryKey"`
+	Secret    string `gorm:"not null;index"`
+	Payload   string `gorm:"not null"`
+	Size      int
+	ExpiresAt *time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (v1QueuedMessage) TableName() string { return "queued_messages" }
+
+type v1TrafficStat struct {
+	ID          uint      `gorm:"primaryKey"`
+	Secret      string    `gorm:"not null;size:191;uniqueIndex:idx_traffic_bucket"`
+	Granularity string    `gorm:"not null;size:191;uniqueIndex:idx_traffic_bucket"`
+	BucketStart time.Time `gorm:"not null;uniqueIndex:idx_traffic_bucket;index"`
+	Received    int64
+	Forwarded   int64
+	Queued      int64
+	Dropped     int64
+	Bytes       int64
+	Connects    int64
+	Disconnects int64
+	Errors      int64
+}
+
+func (v1TrafficStat) TableName() string { return "traffic_stats" }
+
+type v1User struct {
+	ID            uint   `gorm:"primaryKey"`
+	Username      string `gorm:"uniqueIndex;size:191;not null"`
+	PasswordHash  string `gorm:"not null"`
+	Role          string `gorm:"not null"`
+	Enabled       bool   `gorm:"not null"`
+	LastLoginAt   *time.Time
+	CreatedBy     string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	TOTPSecret    string
+	TOTPEnabled   bool     `gorm:"default:false"`
+	TOTPLastStep  int64    `gorm:"default:0"`
+	RecoveryCodes []string `gorm:"serializer:json"`
+}
+
+func (v1User) TableName() string { return "users" }
+
+type v1Session struct {
+	ID                uint   `gorm:"primaryKey"`
+	SessionID         string `gorm:"uniqueIndex;size:191;not null"`
+	Username          string `gorm:"not null;index"`
+	RefreshTokenHash  string `gorm:"uniqueIndex;size:191;not null"`
+	PreviousTokenHash string `gorm:"index"`
+	IP                string
+	UserAgent         string
+	LastActiveAt      time.Time
+	ExpiresAt         time.Time `gorm:"not null;index"`
+	RevokedAt         *time.Time
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
+
+func (v1Session) TableName() string { return "sessions" }
+
+type v1APIKey struct {
+	ID         uint     `gorm:"primaryKey"`
+	Name       string   `gorm:"not null"`
+	Prefix     string   `gorm:"not null"`
+	KeyHash    string   `gorm:"uniqueIndex;size:191;not null"`
+	Scopes     []string `gorm:"serializer:json"`
+	AllowedIPs []string `gorm:"serializer:json"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	LastUsedIP string
+	CreatedBy  string
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (v1APIKey) TableName() string { return "api_keys" }
+
+type v1AuditLog struct {
+	ID        uint   `gorm:"primaryKey"`
+	Actor     string `gorm:"not null;index"`
+	IP        string
+	Action    string `gorm:"not null;index"`
+	Target    string `gorm:"index"`
+	Before    string
+	After     string
+	Result    string `gorm:"not null;index"`
+	Detail    string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (v1AuditLog) TableName() string { return "audit_logs" }
+
+type v1ConfigRevision struct {
+	ID         uint                   `gorm:"primaryKey"`
+	Author     string                 `gorm:"not null;index"`
+	Action     string                 `gorm:"not null"`
+	Changes    []string               `gorm:"serializer:json"`
+	Settings   map[string]interface{} `gorm:"serializer:json"`
+	RollbackOf *uint
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+func (v1ConfigRevision) TableName() string { return "config_revisions" }
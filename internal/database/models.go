@@ -6,15 +6,22 @@ import (
 
 // Secret 密钥模型
 type Secret struct {
-	ID            uint      `gorm:"primaryKey" json:"id"`
-	Secret        string    `gorm:"uniqueIndex;not null" json:"secret"`
-	Name          string    `json:"name"`
-	Description   string    `json:"description"`
-	Enabled       bool      `gorm:"default:true" json:"enabled"`
-	MaxConnections int      `gorm:"default:1" json:"maxConnections"`
-	CreatedAt     time.Time `json:"createdAt"`
-	UpdatedAt     time.Time `json:"updatedAt"`
-	CreatedBy     string    `json:"createdBy"`
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	Secret           string    `gorm:"uniqueIndex;size:191;not null" json:"secret"`
+	Name             string    `json:"name"`
+	Description      string    `json:"description"`
+	AppID            string    `json:"appId"` // 机器人 AppID，用于代理 OpenAPI
+	Enabled          bool      `gorm:"default:true" json:"enabled"`
+	MaxConnections   int       `gorm:"default:1" json:"maxConnections"`
+	DeliveryMode     string    `json:"deliveryMode"`                         // 多客户端投递模式，为空表示使用全局配置
+	Protocol         string    `json:"protocol"`                             // 连接协议，为空表示使用全局配置
+	UpstreamURL      string    `json:"upstreamUrl"`                          // 客户端消息转发的上游 HTTP 地址
+	UpstreamTypes    []string  `gorm:"serializer:json" json:"upstreamTypes"` // 需要转发的消息类型，为空表示全部
+	QueueMaxAge      int       `gorm:"default:0" json:"queueMaxAge"`         // 离线队列最长保留时间（秒），0 表示使用全局配置
+	QueueMaxMessages int       `gorm:"default:0" json:"queueMaxMessages"`    // 离线队列最大消息数，0 表示使用全局配置
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+	CreatedBy        string    `json:"createdBy"`
 }
 
 // BanRecord 封禁记录模型
@@ -25,7 +32,7 @@ type BanRecord struct {
 	BannedAt  time.Time `json:"bannedAt"`
 	BannedBy  string    `json:"bannedBy"`
 	UnbannedAt *time.Time `json:"unbannedAt,omitempty"`
-	UnbannedBy *string   `json:"unbannedBy,omitempty"`
+	UnbannedBy string    `json:"unbannedBy,omitempty"`
 	IsActive  bool      `gorm:"default:true" json:"isActive"`
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
@@ -34,7 +41,7 @@ type BanRecord struct {
 // SystemConfig 系统配置模型
 type SystemConfig struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
-	Key         string    `gorm:"uniqueIndex;not null" json:"key"`
+	Key         string    `gorm:"uniqueIndex;size:191;not null" json:"key"`
 	Value       string    `json:"value"`
 	Type        string    `json:"type"` // json, string, int, bool, float
 	Category    string    `json:"category"` // server, security, auth, ui, logging, websocket
@@ -70,3 +77,105 @@ type Connection struct {
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
+
+// QueuedMessage 离线消息队列模型（客户端未连接时暂存的 Webhook 消息）
+type QueuedMessage struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Secret    string     `gorm:"not null;index" json:"secret"`
+	Payload   string     `gorm:"not null" json:"payload"`
+	Size      int        `json:"size"`
+	ExpiresAt *time.Time `gorm:"index" json:"expiresAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// TrafficStat 流量统计模型，按密钥、粒度（minute、hour、day）和时间段累计
+type TrafficStat struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Secret      string    `gorm:"not null;size:191;uniqueIndex:idx_traffic_bucket" json:"secret"`
+	Granularity string    `gorm:"not null;size:191;uniqueIndex:idx_traffic_bucket" json:"granularity"`
+	BucketStart time.Time `gorm:"not null;uniqueIndex:idx_traffic_bucket;index" json:"bucketStart"` // 时间段起点（UTC）
+	Received    int64     `json:"received"`                                                         // 收到的 Webhook 消息数
+	Forwarded   int64     `json:"forwarded"`                                                        // 实时投递到客户端的消息数
+	Queued      int64     `json:"queued"`                                                           // 写入离线队列的消息数
+	Dropped     int64     `json:"dropped"`                                                          // 无法投递且未入队而丢弃的消息数
+	Bytes       int64     `json:"bytes"`                                                            // 收到的 Webhook 请求体字节数
+	Connects    int64     `json:"connects"`                                                         // 客户端连接次数
+	Disconnects int64     `json:"disconnects"`                                                      // 客户端断开次数
+	Errors      int64     `json:"errors"`                                                           // 签名校验失败、投递失败等错误数
+}
+
+// User 管理后台用户模型
+type User struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	Username     string     `gorm:"uniqueIndex;size:191;not null" json:"username"`
+	PasswordHash string     `gorm:"not null" json:"-"`       // bcrypt 哈希
+	Role         string     `gorm:"not null" json:"role"`    // viewer, operator, admin
+	Enabled      bool       `gorm:"not null" json:"enabled"` // 禁用后无法登录，已签发的令牌立即失效
+	LastLoginAt  *time.Time `json:"lastLoginAt,omitempty"`
+	CreatedBy    string     `json:"createdBy"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+
+	TOTPSecret    string   `json:"-"`                                // Base32 编码的 TOTP 密钥，未启用时为待确认的密钥
+	TOTPEnabled   bool     `gorm:"default:false" json:"totpEnabled"` // 是否已启用两步验证
+	TOTPLastStep  int64    `gorm:"default:0" json:"-"`               // 最近一次使用的验证码时间步，防止重放
+	RecoveryCodes []string `gorm:"serializer:json" json:"-"`         // 未使用的恢复码摘要
+}
+
+// Session 登录会话模型，访问令牌的 jti 即 SessionID，刷新令牌只保存 SHA-256 摘要
+type Session struct {
+	ID                uint       `gorm:"primaryKey" json:"-"`
+	SessionID         string     `gorm:"uniqueIndex;size:191;not null" json:"id"`
+	Username          string     `gorm:"not null;index" json:"username"`
+	RefreshTokenHash  string     `gorm:"uniqueIndex;size:191;not null" json:"-"`
+	PreviousTokenHash string     `gorm:"index" json:"-"` // 上一个刷新令牌，再次使用说明令牌可能已泄露
+	IP                string     `json:"ip"`
+	UserAgent         string     `json:"userAgent"`
+	LastActiveAt      time.Time  `json:"lastActiveAt"`
+	ExpiresAt         time.Time  `gorm:"not null;index" json:"expiresAt"` // 刷新令牌过期时间，每次刷新后顺延
+	RevokedAt         *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	UpdatedAt         time.Time  `json:"updatedAt"`
+}
+
+// AuditLog 管理操作审计记录，只追加，不允许修改或删除
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Actor     string    `gorm:"not null;index" json:"actor"` // 操作者用户名，API Key 为 apikey:<前缀>，系统事件为 system
+	IP        string    `json:"ip"`
+	Action    string    `gorm:"not null;index" json:"action"`
+	Target    string    `gorm:"index" json:"target"`
+	Before    string    `json:"before,omitempty"` // 变更前的字段（JSON），只包含发生变化的字段
+	After     string    `json:"after,omitempty"`  // 变更后的字段（JSON）
+	Result    string    `gorm:"not null;index" json:"result"`
+	Detail    string    `json:"detail,omitempty"` // 失败原因或补充说明
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+}
+
+// ConfigRevision 配置版本，保存通过管理接口修改配置后的完整配置（不含登录凭据），用于查看历史和回滚
+type ConfigRevision struct {
+	ID         uint                   `gorm:"primaryKey" json:"id"`
+	Author     string                 `gorm:"not null;index" json:"author"`
+	Action     string                 `gorm:"not null" json:"action"`                    // 产生该版本的操作，与审计记录的操作名相同
+	Changes    []string               `gorm:"serializer:json" json:"changes"`            // 相对修改前变化的配置键
+	Settings   map[string]interface{} `gorm:"serializer:json" json:"settings,omitempty"` // 配置键 -> 值
+	RollbackOf *uint                  `json:"rollbackOf,omitempty"`                      // 回滚操作恢复的目标版本
+	CreatedAt  time.Time              `gorm:"index" json:"createdAt"`
+}
+
+// APIKey 自动化脚本使用的 API Key，只保存 SHA-256 摘要，通过 X-API-Key 请求头认证
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null" json:"prefix"` // 明文前缀，用于在列表中识别 Key
+	KeyHash    string     `gorm:"uniqueIndex;size:191;not null" json:"-"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"`
+	AllowedIPs []string   `gorm:"serializer:json" json:"allowedIps"` // 允许访问的 IP 或 CIDR，为空表示不限制
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	LastUsedIP string     `json:"lastUsedIp"`
+	CreatedBy  string     `json:"createdBy"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
@@ -6,8 +6,10 @@ import (
 	"time"
 	"errors"
 	"strconv"
-	"strings"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"nekobridge/internal/config"
 )
 
 // SecretService 密钥服务
@@ -55,6 +57,25 @@ func (s *SecretService) DisableSecret(secret string) error {
 	return DB.Model(&Secret{}).Where("secret = ?", secret).Update("enabled", false).Error
 }
 
+// RotateSecret 将密钥替换为新值，密钥的设置、封禁记录、离线队列和流量统计一并迁移
+func (s *SecretService) RotateSecret(secret, newSecret string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Secret{}).Where("secret = ?", secret).Update("secret", newSecret)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		for _, model := range []interface{}{&BanRecord{}, &QueuedMessage{}, &TrafficStat{}} {
+			if err := tx.Model(model).Where("secret = ?", secret).Update("secret", newSecret).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // BanService 封禁服务
 type BanService struct{}
 
@@ -85,7 +106,7 @@ func (s *BanService) UnbanSecret(secret, unbannedBy string) error {
 		Updates(map[string]interface{}{
 			"is_active":    false,
 			"unbanned_at":  &now,
-			"unbanned_by":  &unbannedBy,
+			"unbanned_by":  unbannedBy,
 			"updated_at":   now,
 		}).Error
 }
@@ -120,7 +141,7 @@ type ConfigService struct{}
 // GetConfig 获取配置
 func (s *ConfigService) GetConfig(key string) (*SystemConfig, error) {
 	var config SystemConfig
-	err := DB.Where("key = ?", key).First(&config).Error
+	err := DB.Where(map[string]interface{}{"key": key}).First(&config).Error
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +157,7 @@ func (s *ConfigService) SetConfig(key, value, configType string) error {
 func (s *ConfigService) SetConfigWithCategory(key, value, configType, category, description string) error {
 	// 首先查找是否存在
 	var existingConfig SystemConfig
-	err := DB.Where("key = ?", key).First(&existingConfig).Error
+	err := DB.Where(map[string]interface{}{"key": key}).First(&existingConfig).Error
 	
 	if err != nil {
 		// 不存在，创建新记录
@@ -174,7 +195,7 @@ func (s *ConfigService) SetConfigWithValidation(key, value, configType, category
 	
 	// 首先查找是否存在
 	var existingConfig SystemConfig
-	err := DB.Where("key = ?", key).First(&existingConfig).Error
+	err := DB.Where(map[string]interface{}{"key": key}).First(&existingConfig).Error
 	
 	if err != nil {
 		// 不存在，创建新记录
@@ -224,7 +245,7 @@ func (s *ConfigService) validateConfigValue(key, value, configType string, minVa
 	if value == "" {
 		// 检查是否为必填项
 		var config SystemConfig
-		if err := DB.Where("key = ?", key).First(&config).Error; err == nil && config.IsRequired {
+		if err := DB.Where(map[string]interface{}{"key": key}).First(&config).Error; err == nil && config.IsRequired {
 			return errors.New("必填配置项不能为空")
 		}
 	}
@@ -401,7 +422,7 @@ func (s *ConfigService) GetConfigSchema() (map[string]interface{}, error) {
 
 // DeleteConfig 删除配置
 func (s *ConfigService) DeleteConfig(key string) error {
-	return DB.Where("key = ?", key).Delete(&SystemConfig{}).Error
+	return DB.Where(map[string]interface{}{"key": key}).Delete(&SystemConfig{}).Error
 }
 
 // ResetConfigToDefault 重置配置为默认值
@@ -411,137 +432,27 @@ func (s *ConfigService) ResetConfigToDefault(key string) error {
 	return s.DeleteConfig(key)
 }
 
-// BatchUpdateConfigs 批量更新配置
-func (s *ConfigService) BatchUpdateConfigs(updates map[string]interface{}) error {
-	tx := DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
+// ValidateConfigs 按配置定义校验配置值，数据库中没有定义的配置项不校验
+func (s *ConfigService) ValidateConfigs(updates map[string]interface{}) error {
 	for key, value := range updates {
-		valueStr := fmt.Sprintf("%v", value)
-		
-		// 获取配置类型
-		var config SystemConfig
-		err := tx.Where("key = ?", key).First(&config).Error
-		
+		config, err := s.GetConfig(key)
 		if err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				// 配置不存在，尝试创建默认配置
-				// 根据key推断配置类型和分类
-				configType, category := s.inferConfigTypeAndCategory(key)
-				
-				// 创建新配置
-				config = SystemConfig{
-					Key:         key,
-					Value:       valueStr,
-					Type:        configType,
-					Category:    category,
-					Description: s.getConfigDescription(key),
-					IsRequired:  false,
-					IsReadOnly:  false,
-				}
-				
-				if err := tx.Create(&config).Error; err != nil {
-					tx.Rollback()
-					return fmt.Errorf("创建配置项 %s 失败: %v", key, err)
-				}
-			} else {
-				tx.Rollback()
-				return fmt.Errorf("获取配置项 %s 失败: %v", key, err)
-			}
-		} else {
-			// 验证值
-			if err := s.validateConfigValue(key, valueStr, config.Type, config.MinValue, config.MaxValue, config.Options); err != nil {
-				tx.Rollback()
-				return fmt.Errorf("配置项 %s 验证失败: %v", key, err)
-			}
-			
-			// 更新值
-			if err := tx.Model(&config).Update("value", valueStr).Error; err != nil {
-				tx.Rollback()
-				return err
+				continue
 			}
+			return fmt.Errorf("获取配置项 %s 失败: %v", key, err)
 		}
-	}
 
-	return tx.Commit().Error
-}
-
-// inferConfigTypeAndCategory 根据key推断配置类型和分类
-func (s *ConfigService) inferConfigTypeAndCategory(key string) (string, string) {
-	// 根据key前缀确定分类
-	var category string
-	if strings.HasPrefix(key, "server.") {
-		category = "server"
-	} else if strings.HasPrefix(key, "security.") {
-		category = "security"
-	} else if strings.HasPrefix(key, "auth.") {
-		category = "auth"
-	} else if strings.HasPrefix(key, "ui.") {
-		category = "ui"
-	} else if strings.HasPrefix(key, "logging.") {
-		category = "logging"
-	} else if strings.HasPrefix(key, "websocket.") {
-		category = "websocket"
-	} else {
-		category = "system"
-	}
-	
-	// 根据key确定类型
-	var configType string
-	switch key {
-	case "server.port", "security.max_connections_per_secret", "auth.session_timeout", "logging.max_log_entries", "websocket.heartbeat_interval", "websocket.heartbeat_timeout", "websocket.client_heartbeat_interval", "websocket.max_message_size", "websocket.read_timeout", "websocket.write_timeout":
-		configType = "int"
-	case "security.enable_signature_validation", "security.default_allow_new_connections", "security.require_manual_key_management", "logging.enable_file_logging", "ui.compact_mode", "websocket.enable_heartbeat":
-		configType = "bool"
-	case "server.cors.origins":
-		configType = "json"
-	default:
-		configType = "string"
-	}
-	
-	return configType, category
-}
-
-// getConfigDescription 获取配置描述
-func (s *ConfigService) getConfigDescription(key string) string {
-	descriptions := map[string]string{
-		"server.port": "服务器端口号",
-		"server.host": "服务器监听地址",
-		"server.mode": "服务器运行模式",
-		"server.cors.origins": "CORS允许的源",
-		"security.enable_signature_validation": "启用签名验证",
-		"security.default_allow_new_connections": "默认允许新连接",
-		"security.max_connections_per_secret": "每个密钥的最大连接数",
-		"security.require_manual_key_management": "要求手动管理密钥",
-		"auth.username": "管理员用户名",
-		"auth.password": "管理员密码",
-		"auth.session_timeout": "会话超时时间（秒）",
-		"auth.jwt_secret": "JWT密钥",
-		"ui.theme": "主题模式",
-		"ui.primary_color": "主色调",
-		"ui.compact_mode": "紧凑模式",
-		"ui.language": "界面语言",
-		"logging.level": "日志级别",
-		"logging.max_log_entries": "最大日志条目数",
-		"logging.enable_file_logging": "启用文件日志",
-		"logging.log_file_path": "日志文件路径",
-		"websocket.enable_heartbeat": "启用心跳检测",
-		"websocket.heartbeat_interval": "心跳间隔（毫秒）",
-		"websocket.heartbeat_timeout": "心跳超时（毫秒）",
-		"websocket.client_heartbeat_interval": "客户端心跳间隔（毫秒）",
-		"websocket.max_message_size": "最大消息大小（字节）",
-		"websocket.read_timeout": "读取超时（毫秒）",
-		"websocket.write_timeout": "写入超时（毫秒）",
-	}
-	
-	if desc, exists := descriptions[key]; exists {
-		return desc
+		valueStr := fmt.Sprintf("%v", value)
+		if number, ok := value.(float64); ok {
+			// JSON 数字解码为 float64，较大的整数按 %v 输出为科学计数法
+			valueStr = strconv.FormatFloat(number, 'f', -1, 64)
+		}
+		if err := s.validateConfigValue(key, valueStr, config.Type, config.MinValue, config.MaxValue, config.Options); err != nil {
+			return fmt.Errorf("配置项 %s 验证失败: %v", key, err)
+		}
 	}
-	return "系统配置项"
+	return nil
 }
 
 // LogService 日志服务
@@ -609,3 +520,528 @@ func (s *ConnectionService) DisconnectAll() error {
 			"updated_at": time.Now(),
 		}).Error
 }
+
+// QueueService 离线消息队列服务
+type QueueService struct{}
+
+// Enqueue 将消息加入离线队列，超过 maxMessages 时丢弃最旧的消息，返回被丢弃的数量
+func (s *QueueService) Enqueue(msg *QueuedMessage, maxMessages int) (int64, error) {
+	var dropped int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(msg).Error; err != nil {
+			return err
+		}
+		if maxMessages <= 0 {
+			return nil
+		}
+
+		// 找到第 maxMessages 条最新消息，删除比它更旧的消息
+		var boundary []QueuedMessage
+		if err := tx.Where("secret = ?", msg.Secret).
+			Order("id DESC").
+			Offset(maxMessages - 1).
+			Limit(1).
+			Find(&boundary).Error; err != nil {
+			return err
+		}
+		if len(boundary) == 0 {
+			return nil
+		}
+
+		result := tx.Where("secret = ? AND id < ?", msg.Secret, boundary[0].ID).Delete(&QueuedMessage{})
+		dropped = result.RowsAffected
+		return result.Error
+	})
+	return dropped, err
+}
+
+// Requeue 将消息按给定顺序插入到密钥离线队列的最前面，超过 maxMessages 时丢弃最旧的消息，返回被丢弃的数量
+// 队列按 ID 排序，因此在同一事务中删除已有的消息并按新的顺序重新写入
+func (s *QueueService) Requeue(secret string, msgs []QueuedMessage, maxMessages int) (int64, error) {
+	var dropped int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var pending []QueuedMessage
+		if err := tx.Where("secret = ?", secret).Order("id ASC").Find(&pending).Error; err != nil {
+			return err
+		}
+
+		all := make([]QueuedMessage, 0, len(msgs)+len(pending))
+		all = append(all, msgs...)
+		all = append(all, pending...)
+		if maxMessages > 0 && len(all) > maxMessages {
+			dropped = int64(len(all) - maxMessages)
+			all = all[dropped:]
+		}
+
+		if len(pending) > 0 {
+			if err := tx.Where("secret = ?", secret).Delete(&QueuedMessage{}).Error; err != nil {
+				return err
+			}
+		}
+		// 逐条写入，保证 ID 按顺序递增
+		for i := range all {
+			msg := all[i]
+			msg.ID = 0
+			msg.Secret = secret
+			if err := tx.Create(&msg).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return dropped, err
+}
+
+// GetPending 按入队顺序获取未过期的待补发消息
+func (s *QueueService) GetPending(secret string, limit int) ([]QueuedMessage, error) {
+	var messages []QueuedMessage
+	query := DB.Where("secret = ? AND (expires_at IS NULL OR expires_at > ?)", secret, time.Now()).
+		Order("id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&messages).Error
+	return messages, err
+}
+
+// DeleteMessages 删除已补发的消息
+func (s *QueueService) DeleteMessages(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return DB.Delete(&QueuedMessage{}, ids).Error
+}
+
+// PurgeExpired 清理已过期的消息，返回清理数量
+func (s *QueueService) PurgeExpired(secret string) (int64, error) {
+	result := DB.Where("secret = ? AND expires_at IS NOT NULL AND expires_at <= ?", secret, time.Now()).
+		Delete(&QueuedMessage{})
+	return result.RowsAffected, result.Error
+}
+
+// CountMessages 统计密钥的待补发消息数
+func (s *QueueService) CountMessages(secret string) (int64, error) {
+	var count int64
+	err := DB.Model(&QueuedMessage{}).Where("secret = ?", secret).Count(&count).Error
+	return count, err
+}
+
+// CountBySecret 统计每个密钥的待补发消息数
+func (s *QueueService) CountBySecret() (map[string]int64, error) {
+	var rows []struct {
+		Secret string
+		Count  int64
+	}
+	err := DB.Model(&QueuedMessage{}).Select("secret, COUNT(*) AS count").Group("secret").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Secret] = row.Count
+	}
+	return counts, nil
+}
+
+// ClearQueue 清空密钥的离线队列
+func (s *QueueService) ClearQueue(secret string) error {
+	return DB.Where("secret = ?", secret).Delete(&QueuedMessage{}).Error
+}
+
+// TrafficService 流量统计服务
+type TrafficService struct{}
+
+// trafficCounters 流量统计中需要累加的列
+var trafficCounters = []string{"received", "forwarded", "queued", "dropped", "bytes", "connects", "disconnects", "errors"}
+
+// Add 将统计增量累加到对应时间段，时间段不存在时创建（BucketStart 必须为 UTC）
+// 使用 INSERT ... ON CONFLICT（MySQL 为 ON DUPLICATE KEY UPDATE）在一条语句中完成，多个实例同时写入同一时间段时不会重复创建
+func (s *TrafficService) Add(stats []TrafficStat) error {
+	updates := make(map[string]interface{}, len(trafficCounters))
+	for _, column := range trafficCounters {
+		inserted := "excluded." + column
+		if settings.Driver == config.DatabaseMySQL {
+			inserted = "VALUES(" + column + ")"
+		}
+		updates[column] = gorm.Expr(fmt.Sprintf("traffic_stats.%s + %s", column, inserted))
+	}
+	upsert := clause.OnConflict{
+		Columns:   []clause.Column{{Name: "secret"}, {Name: "granularity"}, {Name: "bucket_start"}},
+		DoUpdates: clause.Assignments(updates),
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for i := range stats {
+			stat := stats[i]
+			stat.ID = 0
+			if err := tx.Clauses(upsert).Create(&stat).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Query 按时间段汇总指定粒度的统计，secrets 为空表示所有密钥，时间范围为 [from, to)
+func (s *TrafficService) Query(granularity string, from, to time.Time, secrets []string) ([]TrafficStat, error) {
+	var stats []TrafficStat
+	query := DB.Model(&TrafficStat{}).
+		Select("bucket_start, SUM(received) AS received, SUM(forwarded) AS forwarded, SUM(queued) AS queued, "+
+			"SUM(dropped) AS dropped, SUM(bytes) AS bytes, SUM(connects) AS connects, "+
+			"SUM(disconnects) AS disconnects, SUM(errors) AS errors").
+		Where("granularity = ? AND bucket_start >= ? AND bucket_start < ?", granularity, from.UTC(), to.UTC())
+	if len(secrets) > 0 {
+		query = query.Where("secret IN ?", secrets)
+	}
+	err := query.Group("bucket_start").Order("bucket_start ASC").Scan(&stats).Error
+	return stats, err
+}
+
+// Purge 删除指定粒度中早于 before 的统计，返回删除数量
+func (s *TrafficService) Purge(granularity string, before time.Time) (int64, error) {
+	result := DB.Where("granularity = ? AND bucket_start < ?", granularity, before.UTC()).Delete(&TrafficStat{})
+	return result.RowsAffected, result.Error
+}
+
+// UserService 用户服务
+type UserService struct{}
+
+// CreateUser 创建用户
+func (s *UserService) CreateUser(user *User) error {
+	return DB.Create(user).Error
+}
+
+// GetUser 根据用户名获取用户
+func (s *UserService) GetUser(username string) (*User, error) {
+	var user User
+	err := DB.Where("username = ?", username).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUserByID 根据ID获取用户
+func (s *UserService) GetUserByID(id uint) (*User, error) {
+	var user User
+	err := DB.First(&user, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetUsers 获取所有用户
+func (s *UserService) GetUsers() ([]User, error) {
+	var users []User
+	err := DB.Order("id ASC").Find(&users).Error
+	return users, err
+}
+
+// UpdateUser 更新用户
+func (s *UserService) UpdateUser(user *User) error {
+	return DB.Save(user).Error
+}
+
+// DeleteUser 删除用户
+func (s *UserService) DeleteUser(id uint) error {
+	return DB.Delete(&User{}, id).Error
+}
+
+// CountUsers 统计用户数
+func (s *UserService) CountUsers() (int64, error) {
+	var count int64
+	err := DB.Model(&User{}).Count(&count).Error
+	return count, err
+}
+
+// CountActiveByRole 统计指定角色中已启用的用户数
+func (s *UserService) CountActiveByRole(role string) (int64, error) {
+	var count int64
+	err := DB.Model(&User{}).Where("role = ? AND enabled = ?", role, true).Count(&count).Error
+	return count, err
+}
+
+// RecordLogin 记录用户最近登录时间
+func (s *UserService) RecordLogin(id uint) error {
+	return DB.Model(&User{}).Where("id = ?", id).Update("last_login_at", time.Now()).Error
+}
+
+// UseTOTPStep 记录已使用的验证码时间步，时间步不大于已记录的值时返回 false，防止同一验证码被并发重放
+func (s *UserService) UseTOTPStep(id uint, step int64) (bool, error) {
+	result := DB.Model(&User{}).Where("id = ? AND totp_last_step < ?", id, step).Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ResetTOTP 清除用户的两步验证密钥和恢复码
+func (s *UserService) ResetTOTP(id uint) error {
+	return DB.Model(&User{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secret":    "",
+		"totp_enabled":   false,
+		"totp_last_step": 0,
+		"recovery_codes": nil,
+	}).Error
+}
+
+// SessionService 会话服务
+type SessionService struct{}
+
+// CreateSession 创建会话
+func (s *SessionService) CreateSession(session *Session) error {
+	return DB.Create(session).Error
+}
+
+// GetActiveSession 获取未撤销且未过期的会话
+func (s *SessionService) GetActiveSession(sessionID string) (*Session, error) {
+	var session Session
+	err := DB.Where("session_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+		First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetByRefreshToken 根据当前或上一个刷新令牌的摘要获取会话
+func (s *SessionService) GetByRefreshToken(tokenHash string) (*Session, error) {
+	var session Session
+	err := DB.Where("refresh_token_hash = ? OR previous_token_hash = ?", tokenHash, tokenHash).
+		First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetActiveSessions 获取活跃会话，username 为空表示所有用户
+func (s *SessionService) GetActiveSessions(username string) ([]Session, error) {
+	var sessions []Session
+	query := DB.Where("revoked_at IS NULL AND expires_at > ?", time.Now())
+	if username != "" {
+		query = query.Where("username = ?", username)
+	}
+	err := query.Order("last_active_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// RotateRefreshToken 轮换刷新令牌并顺延过期时间，旧令牌已被轮换时返回 false
+func (s *SessionService) RotateRefreshToken(session *Session, newHash string, expiresAt time.Time, ip, userAgent string) (bool, error) {
+	now := time.Now()
+	result := DB.Model(&Session{}).
+		Where("id = ? AND refresh_token_hash = ? AND revoked_at IS NULL", session.ID, session.RefreshTokenHash).
+		Updates(map[string]interface{}{
+			"previous_token_hash": session.RefreshTokenHash,
+			"refresh_token_hash":  newHash,
+			"expires_at":          expiresAt,
+			"last_active_at":      now,
+			"ip":                  ip,
+			"user_agent":          userAgent,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Touch 更新会话的最近活动时间和来源 IP
+func (s *SessionService) Touch(sessionID, ip string) error {
+	return DB.Model(&Session{}).Where("session_id = ?", sessionID).
+		Updates(map[string]interface{}{
+			"last_active_at": time.Now(),
+			"ip":             ip,
+		}).Error
+}
+
+// RevokeSession 撤销会话，返回撤销数量
+func (s *SessionService) RevokeSession(sessionID string) (int64, error) {
+	result := DB.Model(&Session{}).Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// RevokeUserSessions 撤销用户的所有会话，exceptSessionID 不为空时保留该会话
+func (s *SessionService) RevokeUserSessions(username, exceptSessionID string) (int64, error) {
+	query := DB.Model(&Session{}).Where("username = ? AND revoked_at IS NULL", username)
+	if exceptSessionID != "" {
+		query = query.Where("session_id <> ?", exceptSessionID)
+	}
+	result := query.Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// RevokeAll 撤销所有会话
+func (s *SessionService) RevokeAll() (int64, error) {
+	result := DB.Model(&Session{}).Where("revoked_at IS NULL").Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// PurgeInactive 删除已过期或已撤销的会话，返回删除数量
+func (s *SessionService) PurgeInactive() (int64, error) {
+	result := DB.Where("expires_at <= ? OR revoked_at IS NOT NULL", time.Now()).Delete(&Session{})
+	return result.RowsAffected, result.Error
+}
+
+// APIKeyService API Key 服务
+type APIKeyService struct{}
+
+// CreateAPIKey 创建 API Key
+func (s *APIKeyService) CreateAPIKey(key *APIKey) error {
+	return DB.Create(key).Error
+}
+
+// GetAPIKeys 获取所有 API Key，包括已撤销的
+func (s *APIKeyService) GetAPIKeys() ([]APIKey, error) {
+	var keys []APIKey
+	err := DB.Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// GetAPIKeyByID 根据ID获取 API Key
+func (s *APIKeyService) GetAPIKeyByID(id uint) (*APIKey, error) {
+	var key APIKey
+	if err := DB.First(&key, id).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// GetByHash 根据摘要获取未撤销的 API Key
+func (s *APIKeyService) GetByHash(keyHash string) (*APIKey, error) {
+	var key APIKey
+	if err := DB.Where("key_hash = ? AND revoked_at IS NULL", keyHash).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RecordUse 更新 API Key 的最近使用时间和来源 IP
+func (s *APIKeyService) RecordUse(id uint, ip string) error {
+	return DB.Model(&APIKey{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"last_used_at": time.Now(),
+			"last_used_ip": ip,
+		}).Error
+}
+
+// RevokeAPIKey 撤销 API Key，返回撤销数量
+func (s *APIKeyService) RevokeAPIKey(id uint) (int64, error) {
+	result := DB.Model(&APIKey{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// ErrAuditLogImmutable 审计记录只允许追加
+var ErrAuditLogImmutable = errors.New("审计记录不允许修改或删除")
+
+// BeforeUpdate 禁止修改审计记录
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// BeforeDelete 禁止删除审计记录
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+// AuditFilter 审计记录查询条件，空值表示不筛选
+type AuditFilter struct {
+	Actor  string     `json:"actor,omitempty"`
+	Action string     `json:"action,omitempty"` // 完全匹配，或匹配以 "Action." 开头的操作，例如 secret 匹配 secret.update
+	Target string     `json:"target,omitempty"`
+	Result string     `json:"result,omitempty"`
+	From   *time.Time `json:"from,omitempty"`
+	To     *time.Time `json:"to,omitempty"`
+}
+
+// apply 将查询条件应用到查询
+func (f AuditFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.Actor != "" {
+		query = query.Where("actor = ?", f.Actor)
+	}
+	if f.Action != "" {
+		query = query.Where("action = ? OR action LIKE ?", f.Action, f.Action+".%")
+	}
+	if f.Target != "" {
+		query = query.Where("target = ?", f.Target)
+	}
+	if f.Result != "" {
+		query = query.Where("result = ?", f.Result)
+	}
+	if f.From != nil {
+		query = query.Where("created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("created_at < ?", *f.To)
+	}
+	return query
+}
+
+// AuditService 审计记录服务
+type AuditService struct{}
+
+// Record 追加一条审计记录
+func (s *AuditService) Record(entry *AuditLog) error {
+	return DB.Create(entry).Error
+}
+
+// Query 按条件分页查询审计记录，按时间倒序排列
+func (s *AuditService) Query(filter AuditFilter, limit, offset int) ([]AuditLog, int64, error) {
+	var total int64
+	if err := filter.apply(DB.Model(&AuditLog{})).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []AuditLog
+	err := filter.apply(DB.Model(&AuditLog{})).Order("id DESC").Limit(limit).Offset(offset).Find(&entries).Error
+	return entries, total, err
+}
+
+// Each 按条件分批读取审计记录，按主键（即时间）顺序排列，用于导出
+func (s *AuditService) Each(filter AuditFilter, batchSize int, fn func([]AuditLog) error) error {
+	var batch []AuditLog
+	return filter.apply(DB.Model(&AuditLog{})).
+		FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+			return fn(batch)
+		}).Error
+}
+
+// ConfigRevisionService 配置版本服务
+type ConfigRevisionService struct{}
+
+// Create 保存配置版本
+func (s *ConfigRevisionService) Create(revision *ConfigRevision) error {
+	return DB.Create(revision).Error
+}
+
+// Get 根据版本号获取配置版本
+func (s *ConfigRevisionService) Get(id uint) (*ConfigRevision, error) {
+	var revision ConfigRevision
+	if err := DB.First(&revision, id).Error; err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// Latest 获取最新的配置版本，还没有任何版本时返回 nil
+func (s *ConfigRevisionService) Latest() (*ConfigRevision, error) {
+	var revisions []ConfigRevision
+	if err := DB.Order("id DESC").Limit(1).Find(&revisions).Error; err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return nil, nil
+	}
+	return &revisions[0], nil
+}
+
+// List 分页获取配置版本（不含完整配置），按版本号倒序排列
+func (s *ConfigRevisionService) List(limit, offset int) ([]ConfigRevision, int64, error) {
+	var total int64
+	if err := DB.Model(&ConfigRevision{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var revisions []ConfigRevision
+	err := DB.Omit("settings").Order("id DESC").Limit(limit).Offset(offset).Find(&revisions).Error
+	return revisions, total, err
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrafficServiceAdd(t *testing.T) {
+	openTestDB(t)
+	if _, err := Migrate(SchemaVersion(), false); err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+
+	service := &TrafficService{}
+	bucket := time.Date(2026, 1, 2, 3, 0, 0, 0, time.UTC)
+	batches := [][]TrafficStat{
+		{
+			{Secret: "a", Granularity: "hour", BucketStart: bucket, Received: 1, Bytes: 10},
+			{Secret: "b", Granularity: "hour", BucketStart: bucket, Received: 2},
+		},
+		{
+			{Secret: "a", Granularity: "hour", BucketStart: bucket, Received: 3, Bytes: 5, Errors: 1},
+			{Secret: "a", Granularity: "day", BucketStart: bucket, Received: 4},
+		},
+	}
+	for _, batch := range batches {
+		if err := service.Add(batch); err != nil {
+			t.Fatalf("Add 失败: %v", err)
+		}
+	}
+
+	tests := []struct {
+		secret      string
+		granularity string
+		received    int64
+		bytes       int64
+		errors      int64
+	}{
+		{"a", "hour", 4, 15, 1},
+		{"b", "hour", 2, 0, 0},
+		{"a", "day", 4, 0, 0},
+	}
+	for _, tt := range tests {
+		var stats []TrafficStat
+		DB.Where("secret = ? AND granularity = ?", tt.secret, tt.granularity).Find(&stats)
+		if len(stats) != 1 {
+			t.Fatalf("%s/%s 有 %d 条记录，应为 1", tt.secret, tt.granularity, len(stats))
+		}
+		if got := stats[0]; got.Received != tt.received || got.Bytes != tt.bytes || got.Errors != tt.errors {
+			t.Errorf("%s/%s = %+v，应为 received=%d bytes=%d errors=%d", tt.secret, tt.granularity, got, tt.received, tt.bytes, tt.errors)
+		}
+	}
+}
@@ -1,15 +1,15 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"io"
+	"nekobridge/internal/audit"
 	"nekobridge/internal/config"
 	"nekobridge/internal/database"
 	"nekobridge/internal/models"
 	"nekobridge/internal/utils"
 	"net/http"
 	"os"
-	"runtime"
 	"strconv"
 	"time"
 
@@ -66,6 +66,9 @@ func (h *Handlers) GetConnections(c *gin.Context) {
 	}
 
 	connections, total := h.wsManager.GetConnections(limit, offset)
+	for i := range connections {
+		connections[i].Secret = visibleSecret(c, connections[i].Secret)
+	}
 
 	h.Success(c, gin.H{
 		"connections": connections,
@@ -73,11 +76,19 @@ func (h *Handlers) GetConnections(c *gin.Context) {
 	})
 }
 
-// KickConnection 踢出连接
+// KickConnection 踢出连接（指定 id 时仅断开该客户端，否则断开密钥下的所有客户端）
 func (h *Handlers) KickConnection(c *gin.Context) {
 	secret := c.Param("secret")
+	clientID := c.Query("id")
 
-	if err := h.wsManager.KickConnection(secret); err != nil {
+	var err error
+	if clientID != "" {
+		err = h.wsManager.KickClient(secret, clientID)
+	} else {
+		err = h.wsManager.KickConnection(secret)
+	}
+	h.audit(c, audit.ActionConnectionKick, utils.MaskSecret(secret), nil, gin.H{"client_id": clientID}, err)
+	if err != nil {
 		h.Error(c, http.StatusNotFound, "连接不存在或已断开")
 		return
 	}
@@ -85,7 +96,7 @@ func (h *Handlers) KickConnection(c *gin.Context) {
 	user, exists := c.Get("user")
 	if exists {
 		claims := user.(*utils.Claims)
-		h.logger.Log("info", "管理员踢出连接", gin.H{"secret": secret, "admin": claims.Username})
+		h.logger.Log("info", "管理员踢出连接", gin.H{"secret": utils.MaskSecret(secret), "client_id": clientID, "admin": claims.Username})
 	}
 
 	h.Success(c, nil, "连接已断开")
@@ -101,17 +112,26 @@ func (h *Handlers) GetSecrets(c *gin.Context) {
 		return
 	}
 
+	sigFailures := h.getSignatureFailures()
 	secrets := make([]models.Secret, 0, len(dbSecrets))
 	for _, dbSecret := range dbSecrets {
 		secretModel := models.Secret{
-			Secret:         dbSecret.Secret,
-			Name:           dbSecret.Name,
-			Enabled:        dbSecret.Enabled,
-			Description:    dbSecret.Description,
-			MaxConnections: dbSecret.MaxConnections,
-			CreatedAt:      dbSecret.CreatedAt,
-			UpdatedAt:      dbSecret.UpdatedAt,
-			CreatedBy:      dbSecret.CreatedBy,
+			Secret:            visibleSecret(c, dbSecret.Secret),
+			Name:              dbSecret.Name,
+			Enabled:           dbSecret.Enabled,
+			Description:       dbSecret.Description,
+			AppID:             dbSecret.AppID,
+			MaxConnections:    dbSecret.MaxConnections,
+			DeliveryMode:      dbSecret.DeliveryMode,
+			Protocol:          dbSecret.Protocol,
+			UpstreamURL:       dbSecret.UpstreamURL,
+			UpstreamTypes:     dbSecret.UpstreamTypes,
+			QueueMaxAge:       dbSecret.QueueMaxAge,
+			QueueMaxMessages:  dbSecret.QueueMaxMessages,
+			SignatureFailures: sigFailures[dbSecret.Secret],
+			CreatedAt:         dbSecret.CreatedAt,
+			UpdatedAt:         dbSecret.UpdatedAt,
+			CreatedBy:         dbSecret.CreatedBy,
 		}
 		secrets = append(secrets, secretModel)
 	}
@@ -132,6 +152,26 @@ func (h *Handlers) AddSecret(c *gin.Context) {
 		return
 	}
 
+	if req.DeliveryMode != "" && !config.IsValidDeliveryMode(req.DeliveryMode) {
+		h.Error(c, http.StatusBadRequest, "无效的投递模式")
+		return
+	}
+
+	if req.Protocol != "" && !config.IsValidProtocol(req.Protocol) {
+		h.Error(c, http.StatusBadRequest, "无效的连接协议")
+		return
+	}
+
+	if req.UpstreamURL != "" && !isValidUpstreamURL(req.UpstreamURL) {
+		h.Error(c, http.StatusBadRequest, "无效的上游地址")
+		return
+	}
+
+	if existing, exists := h.config.FindSecretByAppID(req.AppID); exists && existing != req.Secret {
+		h.Error(c, http.StatusConflict, "AppID 已被其他密钥使用")
+		return
+	}
+
 	// 检查密钥是否已存在
 	secretService := &database.SecretService{}
 	existingSecret, err := secretService.GetSecret(req.Secret)
@@ -149,29 +189,45 @@ func (h *Handlers) AddSecret(c *gin.Context) {
 
 	// 创建数据库记录
 	secretRecord := &database.Secret{
-		Secret:         req.Secret,
-		Name:           req.Name,
-		Description:    req.Description,
-		Enabled:        req.Enabled,
-		MaxConnections: req.MaxConnections,
-		CreatedBy:      adminUser,
+		Secret:           req.Secret,
+		Name:             req.Name,
+		Description:      req.Description,
+		AppID:            req.AppID,
+		Enabled:          req.Enabled,
+		MaxConnections:   req.MaxConnections,
+		DeliveryMode:     req.DeliveryMode,
+		Protocol:         req.Protocol,
+		UpstreamURL:      req.UpstreamURL,
+		UpstreamTypes:    req.UpstreamTypes,
+		QueueMaxAge:      req.QueueMaxAge,
+		QueueMaxMessages: req.QueueMaxMessages,
+		CreatedBy:        adminUser,
 	}
 
 	if err := secretService.CreateSecret(secretRecord); err != nil {
+		h.audit(c, audit.ActionSecretCreate, utils.MaskSecret(req.Secret), nil, secretRecord, err)
 		h.logger.Log("error", "创建密钥失败", gin.H{"error": err.Error()})
 		h.Error(c, http.StatusInternalServerError, "创建密钥失败")
 		return
 	}
+	h.audit(c, audit.ActionSecretCreate, utils.MaskSecret(req.Secret), nil, secretRecord, nil)
 
 	// 添加到内存配置
 	secretConfig := config.SecretConfig{
-		Enabled:        req.Enabled,
-		Description:    req.Description,
-		MaxConnections: req.MaxConnections,
+		Enabled:          req.Enabled,
+		Description:      req.Description,
+		AppID:            req.AppID,
+		MaxConnections:   req.MaxConnections,
+		DeliveryMode:     req.DeliveryMode,
+		Protocol:         req.Protocol,
+		UpstreamURL:      req.UpstreamURL,
+		UpstreamTypes:    req.UpstreamTypes,
+		QueueMaxAge:      req.QueueMaxAge,
+		QueueMaxMessages: req.QueueMaxMessages,
 	}
 
 	h.config.AddSecret(req.Secret, secretConfig)
-	h.logger.Log("info", "新增密钥", gin.H{"secret": req.Secret, "description": req.Description, "admin": adminUser})
+	h.logger.Log("info", "新增密钥", gin.H{"secret": utils.MaskSecret(req.Secret), "description": req.Description, "admin": adminUser})
 
 	h.Success(c, nil, "密钥已添加")
 }
@@ -186,6 +242,26 @@ func (h *Handlers) UpdateSecret(c *gin.Context) {
 		return
 	}
 
+	if updates.DeliveryMode != "" && !config.IsValidDeliveryMode(updates.DeliveryMode) {
+		h.Error(c, http.StatusBadRequest, "无效的投递模式")
+		return
+	}
+
+	if updates.Protocol != "" && !config.IsValidProtocol(updates.Protocol) {
+		h.Error(c, http.StatusBadRequest, "无效的连接协议")
+		return
+	}
+
+	if updates.UpstreamURL != "" && !isValidUpstreamURL(updates.UpstreamURL) {
+		h.Error(c, http.StatusBadRequest, "无效的上游地址")
+		return
+	}
+
+	if existing, exists := h.config.FindSecretByAppID(updates.AppID); exists && existing != secret {
+		h.Error(c, http.StatusConflict, "AppID 已被其他密钥使用")
+		return
+	}
+
 	// 更新数据库记录
 	secretService := &database.SecretService{}
 	secretRecord, err := secretService.GetSecret(secret)
@@ -194,24 +270,49 @@ func (h *Handlers) UpdateSecret(c *gin.Context) {
 		return
 	}
 
+	before := *secretRecord
+
 	// 更新字段
 	if updates.Description != "" {
 		secretRecord.Description = updates.Description
 	}
+	if updates.AppID != "" {
+		secretRecord.AppID = updates.AppID
+	}
 	if updates.MaxConnections > 0 {
 		secretRecord.MaxConnections = updates.MaxConnections
 	}
+	if updates.DeliveryMode != "" {
+		secretRecord.DeliveryMode = updates.DeliveryMode
+	}
+	if updates.Protocol != "" {
+		secretRecord.Protocol = updates.Protocol
+	}
+	if updates.UpstreamURL != "" {
+		secretRecord.UpstreamURL = updates.UpstreamURL
+	}
+	if updates.UpstreamTypes != nil {
+		secretRecord.UpstreamTypes = updates.UpstreamTypes
+	}
+	if updates.QueueMaxAge > 0 {
+		secretRecord.QueueMaxAge = updates.QueueMaxAge
+	}
+	if updates.QueueMaxMessages > 0 {
+		secretRecord.QueueMaxMessages = updates.QueueMaxMessages
+	}
 	secretRecord.Enabled = updates.Enabled
 
 	if err := secretService.UpdateSecret(secretRecord); err != nil {
+		h.audit(c, audit.ActionSecretUpdate, utils.MaskSecret(secret), before, secretRecord, err)
 		h.logger.Log("error", "更新密钥失败", gin.H{"error": err.Error()})
 		h.Error(c, http.StatusInternalServerError, "更新密钥失败")
 		return
 	}
+	h.audit(c, audit.ActionSecretUpdate, utils.MaskSecret(secret), before, secretRecord, nil)
 
 	// 更新内存配置
 	h.config.UpdateSecret(secret, updates)
-	h.logger.Log("info", "更新密钥配置", gin.H{"secret": secret, "updates": updates})
+	h.logger.Log("info", "更新密钥配置", gin.H{"secret": utils.MaskSecret(secret), "updates": updates})
 
 	h.Success(c, nil, "密钥已更新")
 }
@@ -222,7 +323,9 @@ func (h *Handlers) DeleteSecret(c *gin.Context) {
 
 	// 从数据库删除
 	secretService := &database.SecretService{}
+	before, _ := secretService.GetSecret(secret)
 	if err := secretService.DeleteSecret(secret); err != nil {
+		h.audit(c, audit.ActionSecretDelete, utils.MaskSecret(secret), before, nil, err)
 		h.logger.Log("error", "删除密钥失败", gin.H{"error": err.Error()})
 		h.Error(c, http.StatusInternalServerError, "删除密钥失败")
 		return
@@ -234,7 +337,14 @@ func (h *Handlers) DeleteSecret(c *gin.Context) {
 	// 断开对应的WebSocket连接
 	h.wsManager.RemoveConnection(secret)
 
-	h.logger.Log("info", "删除密钥", gin.H{"secret": secret})
+	// 清空离线队列
+	queueService := &database.QueueService{}
+	if err := queueService.ClearQueue(secret); err != nil {
+		h.logger.Log("error", "清空离线队列失败", gin.H{"secret": utils.MaskSecret(secret), "error": err.Error()})
+	}
+
+	h.audit(c, audit.ActionSecretDelete, utils.MaskSecret(secret), before, nil, nil)
+	h.logger.Log("info", "删除密钥", gin.H{"secret": utils.MaskSecret(secret)})
 
 	h.Success(c, nil, "密钥已删除")
 }
@@ -266,8 +376,11 @@ func (h *Handlers) BlockSecret(c *gin.Context) {
 	}
 
 	// 禁用密钥
+	before := gin.H{"enabled": secretRecord.Enabled}
+	after := gin.H{"enabled": false, "reason": req.Reason}
 	secretRecord.Enabled = false
 	if err := secretService.UpdateSecret(secretRecord); err != nil {
+		h.audit(c, audit.ActionSecretBlock, utils.MaskSecret(secret), before, after, err)
 		h.logger.Log("error", "更新密钥状态失败", err)
 		h.Error(c, http.StatusInternalServerError, "更新密钥状态失败")
 		return
@@ -290,8 +403,9 @@ func (h *Handlers) BlockSecret(c *gin.Context) {
 	// 断开现有连接
 	h.wsManager.KickConnection(secret)
 
+	h.audit(c, audit.ActionSecretBlock, utils.MaskSecret(secret), before, after, nil)
 	h.logger.Log("info", "管理员封禁密钥", gin.H{
-		"secret": secret,
+		"secret": utils.MaskSecret(secret),
 		"reason": req.Reason,
 		"admin":  username,
 	})
@@ -321,8 +435,11 @@ func (h *Handlers) UnblockSecret(c *gin.Context) {
 	}
 
 	// 启用密钥
+	before := gin.H{"enabled": secretRecord.Enabled}
+	after := gin.H{"enabled": true}
 	secretRecord.Enabled = true
 	if err := secretService.UpdateSecret(secretRecord); err != nil {
+		h.audit(c, audit.ActionSecretUnblock, utils.MaskSecret(secret), before, after, err)
 		h.logger.Log("error", "更新密钥状态失败", err)
 		h.Error(c, http.StatusInternalServerError, "更新密钥状态失败")
 		return
@@ -334,8 +451,9 @@ func (h *Handlers) UnblockSecret(c *gin.Context) {
 		h.logger.Log("error", "解除封禁记录失败", err)
 	}
 
+	h.audit(c, audit.ActionSecretUnblock, utils.MaskSecret(secret), before, after, nil)
 	h.logger.Log("info", "管理员解除封禁", gin.H{
-		"secret": secret,
+		"secret": utils.MaskSecret(secret),
 		"admin":  username,
 	})
 
@@ -364,19 +482,16 @@ func (h *Handlers) GetBlockedSecrets(c *gin.Context) {
 			continue
 		}
 
-		blockedSecrets = append(blockedSecrets, ban.Secret)
-		unbannedBy := ""
-		if ban.UnbannedBy != nil {
-			unbannedBy = *ban.UnbannedBy
-		}
+		secret := visibleSecret(c, ban.Secret)
+		blockedSecrets = append(blockedSecrets, secret)
 		bans = append(bans, models.BanInfo{
 			ID:         int(ban.ID),
-			Secret:     ban.Secret,
+			Secret:     secret,
 			Reason:     ban.Reason,
 			BannedAt:   ban.BannedAt,
 			BannedBy:   ban.BannedBy,
 			UnbannedAt: ban.UnbannedAt,
-			UnbannedBy: unbannedBy,
+			UnbannedBy: ban.UnbannedBy,
 			IsActive:   ban.IsActive,
 			CreatedAt:  ban.CreatedAt,
 			UpdatedAt:  ban.UpdatedAt,
@@ -416,8 +531,10 @@ func (h *Handlers) UpdateBanRecord(c *gin.Context) {
 		return
 	}
 
+	before := *banRecord
 	banRecord.Reason = req.Reason
 	if err := banService.UpdateBanRecord(banRecord); err != nil {
+		h.audit(c, audit.ActionBanUpdate, idStr, before, banRecord, err)
 		h.logger.Log("error", "更新封禁记录失败", gin.H{"error": err.Error()})
 		h.Error(c, http.StatusInternalServerError, "更新封禁记录失败")
 		return
@@ -425,6 +542,7 @@ func (h *Handlers) UpdateBanRecord(c *gin.Context) {
 
 	user, _ := c.Get("user")
 	claims := user.(*utils.Claims)
+	h.audit(c, audit.ActionBanUpdate, idStr, before, banRecord, nil)
 	h.logger.Log("info", "更新封禁记录", gin.H{
 		"admin":  claims.Username,
 		"id":     id,
@@ -451,6 +569,7 @@ func (h *Handlers) DeleteBanRecord(c *gin.Context) {
 	}
 
 	if err := banService.DeleteBanRecord(uint(id)); err != nil {
+		h.audit(c, audit.ActionBanDelete, idStr, banRecord, nil, err)
 		h.logger.Log("error", "删除封禁记录失败", gin.H{"error": err.Error()})
 		h.Error(c, http.StatusInternalServerError, "删除封禁记录失败")
 		return
@@ -458,10 +577,11 @@ func (h *Handlers) DeleteBanRecord(c *gin.Context) {
 
 	user, _ := c.Get("user")
 	claims := user.(*utils.Claims)
+	h.audit(c, audit.ActionBanDelete, idStr, banRecord, nil, nil)
 	h.logger.Log("info", "删除封禁记录", gin.H{
 		"admin":  claims.Username,
 		"id":     id,
-		"secret": banRecord.Secret,
+		"secret": utils.MaskSecret(banRecord.Secret),
 	})
 
 	h.Success(c, nil, "封禁记录删除成功")
@@ -476,12 +596,19 @@ func (h *Handlers) ExportSecrets(c *gin.Context) {
 	allSecrets := h.config.GetSecrets()
 	for secret, config := range allSecrets {
 		exportData.Secrets[secret] = models.Secret{
-			Secret:         secret,
-			Enabled:        config.Enabled,
-			Description:    config.Description,
-			MaxConnections: config.MaxConnections,
-			CreatedAt:      config.CreatedAt,
-			LastUsed:       config.LastUsed,
+			Secret:           secret,
+			Enabled:          config.Enabled,
+			Description:      config.Description,
+			AppID:            config.AppID,
+			MaxConnections:   config.MaxConnections,
+			DeliveryMode:     config.DeliveryMode,
+			Protocol:         config.Protocol,
+			UpstreamURL:      config.UpstreamURL,
+			UpstreamTypes:    config.UpstreamTypes,
+			QueueMaxAge:      config.QueueMaxAge,
+			QueueMaxMessages: config.QueueMaxMessages,
+			CreatedAt:        config.CreatedAt,
+			LastUsed:         config.LastUsed,
 		}
 	}
 
@@ -491,6 +618,7 @@ func (h *Handlers) ExportSecrets(c *gin.Context) {
 
 	user, _ := c.Get("user")
 	claims := user.(*utils.Claims)
+	h.audit(c, audit.ActionSecretExport, "", nil, gin.H{"count": exportData.Metadata.TotalSecrets}, nil)
 	h.logger.Log("info", "导出密钥数据", gin.H{
 		"admin": claims.Username,
 		"count": exportData.Metadata.TotalSecrets,
@@ -517,6 +645,7 @@ func (h *Handlers) ImportSecrets(c *gin.Context) {
 		Skipped:  0,
 		Errors:   []string{},
 	}
+	imported := make([]string, 0, len(req.Secrets))
 
 	for secret, secretData := range req.Secrets {
 		if _, exists := h.config.GetSecretConfig(secret); exists && !overwriteExisting {
@@ -525,21 +654,34 @@ func (h *Handlers) ImportSecrets(c *gin.Context) {
 		}
 
 		secretConfig := config.SecretConfig{
-			Enabled:        secretData.Enabled,
-			Description:    secretData.Description,
-			MaxConnections: secretData.MaxConnections,
-			CreatedAt:      secretData.CreatedAt,
+			Enabled:          secretData.Enabled,
+			Description:      secretData.Description,
+			AppID:            secretData.AppID,
+			MaxConnections:   secretData.MaxConnections,
+			DeliveryMode:     secretData.DeliveryMode,
+			Protocol:         secretData.Protocol,
+			UpstreamURL:      secretData.UpstreamURL,
+			UpstreamTypes:    secretData.UpstreamTypes,
+			QueueMaxAge:      secretData.QueueMaxAge,
+			QueueMaxMessages: secretData.QueueMaxMessages,
+			CreatedAt:        secretData.CreatedAt,
 		}
 		if secretData.LastUsed != nil {
 			secretConfig.LastUsed = secretData.LastUsed
 		}
 
 		h.config.AddSecret(secret, secretConfig)
+		imported = append(imported, utils.MaskSecret(secret))
 		result.Imported++
 	}
 
 	user, _ := c.Get("user")
 	claims := user.(*utils.Claims)
+	h.audit(c, audit.ActionSecretImport, "", nil, gin.H{
+		"overwrite_existing": overwriteExisting,
+		"imported":           imported,
+		"skipped":            result.Skipped,
+	}, nil)
 	h.logger.Log("info", "导入密钥数据", gin.H{
 		"admin":    claims.Username,
 		"imported": result.Imported,
@@ -556,11 +698,12 @@ func (h *Handlers) ImportSecrets(c *gin.Context) {
 func (h *Handlers) GetSecretStats(c *gin.Context) {
 	allSecrets := h.config.GetSecrets()
 	stats := models.SecretStats{
-		Total:        len(allSecrets),
-		Enabled:      0,
-		Disabled:     0,
-		RecentlyUsed: 0,
-		NeverUsed:    0,
+		Total:             len(allSecrets),
+		Enabled:           0,
+		Disabled:          0,
+		RecentlyUsed:      0,
+		NeverUsed:         0,
+		SignatureFailures: h.getSignatureFailures(),
 	}
 
 	now := time.Now()
@@ -616,10 +759,13 @@ func (h *Handlers) BatchOperateSecrets(c *gin.Context) {
 	}
 
 	for _, secret := range req.Secrets {
+		previous, _ := h.config.GetSecretConfig(secret)
 		switch req.Action {
 		case "enable":
 			// 更新数据库
-			if err := h.updateSecretInDatabase(secret, true); err != nil {
+			err := h.updateSecretInDatabase(secret, true)
+			h.audit(c, audit.ActionSecretUpdate, utils.MaskSecret(secret), gin.H{"enabled": previous.Enabled}, gin.H{"enabled": true, "batch": true}, err)
+			if err != nil {
 				result.Errors = append(result.Errors, "密钥 "+secret+": 启用失败 - "+err.Error())
 				result.Failed++
 			} else {
@@ -628,7 +774,9 @@ func (h *Handlers) BatchOperateSecrets(c *gin.Context) {
 			}
 		case "disable":
 			// 更新数据库
-			if err := h.updateSecretInDatabase(secret, false); err != nil {
+			err := h.updateSecretInDatabase(secret, false)
+			h.audit(c, audit.ActionSecretUpdate, utils.MaskSecret(secret), gin.H{"enabled": previous.Enabled}, gin.H{"enabled": false, "batch": true}, err)
+			if err != nil {
 				result.Errors = append(result.Errors, "密钥 "+secret+": 禁用失败 - "+err.Error())
 				result.Failed++
 			} else {
@@ -637,17 +785,26 @@ func (h *Handlers) BatchOperateSecrets(c *gin.Context) {
 			}
 		case "delete":
 			// 删除数据库记录
-			if err := secretService.DeleteSecret(secret); err != nil {
+			before, _ := secretService.GetSecret(secret)
+			err := secretService.DeleteSecret(secret)
+			h.audit(c, audit.ActionSecretDelete, utils.MaskSecret(secret), before, gin.H{"batch": true}, err)
+			if err != nil {
 				result.Errors = append(result.Errors, "密钥 "+secret+": 删除失败 - "+err.Error())
 				result.Failed++
 			} else {
 				h.config.RemoveSecret(secret)
 				h.wsManager.RemoveConnection(secret)
+				queueService := &database.QueueService{}
+				if err := queueService.ClearQueue(secret); err != nil {
+					h.logger.Log("error", "清空离线队列失败", gin.H{"secret": utils.MaskSecret(secret), "error": err.Error()})
+				}
 				result.Success++
 			}
 		case "block":
 			// 封禁密钥
-			if err := h.blockSecretInBatch(secret, adminUser); err != nil {
+			err := h.blockSecretInBatch(secret, adminUser)
+			h.audit(c, audit.ActionSecretBlock, utils.MaskSecret(secret), gin.H{"enabled": previous.Enabled}, gin.H{"enabled": false, "batch": true}, err)
+			if err != nil {
 				result.Errors = append(result.Errors, "密钥 "+secret+": 封禁失败 - "+err.Error())
 				result.Failed++
 			} else {
@@ -655,7 +812,9 @@ func (h *Handlers) BatchOperateSecrets(c *gin.Context) {
 			}
 		case "unblock":
 			// 解封密钥
-			if err := h.unblockSecretInBatch(secret, adminUser); err != nil {
+			err := h.unblockSecretInBatch(secret, adminUser)
+			h.audit(c, audit.ActionSecretUnblock, utils.MaskSecret(secret), gin.H{"enabled": previous.Enabled}, gin.H{"enabled": true, "batch": true}, err)
+			if err != nil {
 				result.Errors = append(result.Errors, "密钥 "+secret+": 解封失败 - "+err.Error())
 				result.Failed++
 			} else {
@@ -680,9 +839,49 @@ func (h *Handlers) BatchOperateSecrets(c *gin.Context) {
 	}, "批量操作完成")
 }
 
-// GetConfig 获取配置
+// GetConfig 获取配置，密码、JWT 密钥等凭据不会序列化到响应中
 func (h *Handlers) GetConfig(c *gin.Context) {
-	h.Success(c, h.config)
+	cfg := h.config.Clone()
+	secrets := make(map[string]config.SecretConfig, len(cfg.Secrets))
+	for secret, secretConfig := range cfg.Secrets {
+		secrets[visibleSecret(c, secret)] = secretConfig
+	}
+	cfg.Secrets = secrets
+	h.Success(c, cfg)
+}
+
+// GetConfigSources 获取每个配置项当前生效的值及其来源（默认值、数据库、配置文件、环境变量或命令行参数）
+func (h *Handlers) GetConfigSources(c *gin.Context) {
+	settings := config.Settings(h.config)
+	sources := h.store.Sources()
+	for _, key := range config.CredentialKeys {
+		if settings[key] != "" {
+			settings[key] = audit.Redacted
+		}
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	config.SortKeys(keys)
+
+	items := make([]models.ConfigSource, 0, len(keys))
+	for _, key := range keys {
+		source := sources[key]
+		items = append(items, models.ConfigSource{
+			Key:   key,
+			Value: settings[key],
+			Layer: source.Layer,
+			Name:  source.Name,
+		})
+	}
+
+	h.Success(c, gin.H{
+		"config_file": h.store.Path(),
+		"data_dir":    database.DataDir,
+		"settings":    items,
+	})
 }
 
 // UpdateConfig 更新配置
@@ -693,97 +892,129 @@ func (h *Handlers) UpdateConfig(c *gin.Context) {
 		return
 	}
 
-	// 备份当前配置
-	oldConfig := h.config.Clone()
+	oldConfig, newConfig, _, err := h.changeConfig(c, audit.ActionConfigUpdate, nil, func() (*config.Config, *config.Config, error) {
+		return h.store.Update(func(cfg *config.Config) error {
+			applyConfigUpdate(cfg, &updates)
+			return nil
+		})
+	})
+	if err != nil {
+		h.audit(c, audit.ActionConfigUpdate, "config", nil, updates, err)
+		h.configError(c, err, "保存配置失败")
+		return
+	}
+
+	user, _ := c.Get("user")
+	claims := user.(*utils.Claims)
 
-	// 更新配置字段
-	// 建议在整个更新过程中加锁，或者逐个字段更新
-	// 这里我们逐个字段更新，因为 h.config 的字段是导出的且可能被其他地方访问
+	h.audit(c, audit.ActionConfigUpdate, "config", oldConfig, newConfig, nil)
+	h.logger.Log("info", "配置已更新", gin.H{
+		"admin":   claims.Username,
+		"updates": updates,
+	})
+
+	h.Success(c, nil, "配置更新成功")
+}
+
+// applyConfigUpdate 将配置更新请求应用到配置上，未提供的字段保持不变
+func applyConfigUpdate(cfg *config.Config, updates *models.ConfigUpdateRequest) {
 	if updates.Server != nil {
 		if updates.Server.Port != "" {
-			h.config.Server.Port = updates.Server.Port
+			cfg.Server.Port = updates.Server.Port
 		}
 		if updates.Server.Host != "" {
-			h.config.Server.Host = updates.Server.Host
+			cfg.Server.Host = updates.Server.Host
 		}
 		if updates.Server.Mode != "" {
-			h.config.Server.Mode = updates.Server.Mode
+			cfg.Server.Mode = updates.Server.Mode
 		}
 		if updates.Server.CORS != nil && len(updates.Server.CORS.Origins) > 0 {
-			h.config.Server.CORS.Origins = updates.Server.CORS.Origins
+			cfg.Server.CORS.Origins = updates.Server.CORS.Origins
 		}
 	}
 
 	if updates.Security != nil {
-		h.config.Security.EnableSignatureValidation = updates.Security.EnableSignatureValidation
-		h.config.Security.DefaultAllowNewConnections = updates.Security.DefaultAllowNewConnections
+		cfg.Security.EnableSignatureValidation = updates.Security.EnableSignatureValidation
+		cfg.Security.DefaultAllowNewConnections = updates.Security.DefaultAllowNewConnections
 		if updates.Security.MaxConnectionsPerSecret > 0 {
-			h.config.Security.MaxConnectionsPerSecret = updates.Security.MaxConnectionsPerSecret
+			cfg.Security.MaxConnectionsPerSecret = updates.Security.MaxConnectionsPerSecret
+		}
+		cfg.Security.RequireManualKeyManagement = updates.Security.RequireManualKeyManagement
+		switch updates.Security.ConnectionLimitPolicy {
+		case config.ConnectionLimitReject, config.ConnectionLimitEvictOldest:
+			cfg.Security.ConnectionLimitPolicy = updates.Security.ConnectionLimitPolicy
+		}
+		cfg.Security.AllowSecretQuery = updates.Security.AllowSecretQuery
+		if updates.Security.SignatureMaxSkew > 0 {
+			cfg.Security.SignatureMaxSkew = updates.Security.SignatureMaxSkew
 		}
-		h.config.Security.RequireManualKeyManagement = updates.Security.RequireManualKeyManagement
 	}
 
 	if updates.Auth != nil {
 		if updates.Auth.Username != "" {
-			h.config.Auth.Username = updates.Auth.Username
+			cfg.Auth.Username = updates.Auth.Username
 		}
 		if updates.Auth.Password != "" {
-			h.config.Auth.Password = updates.Auth.Password
+			cfg.Auth.Password = updates.Auth.Password
 		}
 		if updates.Auth.SessionTimeout > 0 {
-			h.config.Auth.SessionTimeout = updates.Auth.SessionTimeout
+			cfg.Auth.SessionTimeout = updates.Auth.SessionTimeout
+		}
+		if updates.Auth.AccessTokenTTL > 0 {
+			cfg.Auth.AccessTokenTTL = updates.Auth.AccessTokenTTL
 		}
 		if updates.Auth.JWTSecret != "" {
-			h.config.Auth.JWTSecret = updates.Auth.JWTSecret
+			cfg.Auth.JWTSecret = updates.Auth.JWTSecret
 		}
 	}
 
 	if updates.Logging != nil {
 		if updates.Logging.Level != "" {
-			h.config.Logging.Level = updates.Logging.Level
+			cfg.Logging.Level = updates.Logging.Level
 		}
 		if updates.Logging.MaxLogEntries > 0 {
-			h.config.Logging.MaxLogEntries = updates.Logging.MaxLogEntries
+			cfg.Logging.MaxLogEntries = updates.Logging.MaxLogEntries
 		}
-		h.config.Logging.EnableLogToFile = updates.Logging.EnableLogToFile
+		cfg.Logging.EnableLogToFile = updates.Logging.EnableLogToFile
 		if updates.Logging.LogFilePath != "" {
-			h.config.Logging.LogFilePath = updates.Logging.LogFilePath
+			cfg.Logging.LogFilePath = updates.Logging.LogFilePath
 		}
 	}
 
 	if updates.WebSocket != nil {
-		h.config.WebSocket.EnableHeartbeat = updates.WebSocket.EnableHeartbeat
+		cfg.WebSocket.EnableHeartbeat = updates.WebSocket.EnableHeartbeat
 		if updates.WebSocket.HeartbeatInterval > 0 {
-			h.config.WebSocket.HeartbeatInterval = updates.WebSocket.HeartbeatInterval
+			cfg.WebSocket.HeartbeatInterval = updates.WebSocket.HeartbeatInterval
 		}
 		if updates.WebSocket.MaxMessageSize > 0 {
-			h.config.WebSocket.MaxMessageSize = updates.WebSocket.MaxMessageSize
+			cfg.WebSocket.MaxMessageSize = updates.WebSocket.MaxMessageSize
 		}
 		if updates.WebSocket.ReadTimeout > 0 {
-			h.config.WebSocket.ReadTimeout = updates.WebSocket.ReadTimeout
+			cfg.WebSocket.ReadTimeout = updates.WebSocket.ReadTimeout
 		}
 		if updates.WebSocket.WriteTimeout > 0 {
-			h.config.WebSocket.WriteTimeout = updates.WebSocket.WriteTimeout
+			cfg.WebSocket.WriteTimeout = updates.WebSocket.WriteTimeout
+		}
+		if config.IsValidDeliveryMode(updates.WebSocket.DefaultDeliveryMode) {
+			cfg.WebSocket.DefaultDeliveryMode = updates.WebSocket.DefaultDeliveryMode
+		}
+		if updates.WebSocket.SendQueueSize > 0 {
+			cfg.WebSocket.SendQueueSize = updates.WebSocket.SendQueueSize
+		}
+		if config.IsValidSendQueuePolicy(updates.WebSocket.SendQueuePolicy) {
+			cfg.WebSocket.SendQueuePolicy = updates.WebSocket.SendQueuePolicy
 		}
 	}
+}
 
-	// 保存配置到文件
-	if err := h.saveConfigToFile(); err != nil {
-		// 如果保存失败，恢复旧配置
-		h.config.Restore(oldConfig)
-		h.logger.Log("error", "保存配置失败", err)
-		h.Error(c, http.StatusInternalServerError, "保存配置失败")
+// configError 修改配置失败时的响应，配置项由环境变量设置时返回 409
+func (h *Handlers) configError(c *gin.Context, err error, message string) {
+	if errors.Is(err, config.ErrOverridden) {
+		h.Error(c, http.StatusConflict, err.Error())
 		return
 	}
-
-	user, _ := c.Get("user")
-	claims := user.(*utils.Claims)
-	h.logger.Log("info", "配置已更新", gin.H{
-		"admin":   claims.Username,
-		"updates": updates,
-	})
-
-	h.Success(c, nil, "配置更新成功")
+	h.logger.Log("error", message, gin.H{"error": err.Error()})
+	h.Error(c, http.StatusInternalServerError, message+": "+err.Error())
 }
 
 // GetDashboardStats 获取仪表盘统计
@@ -800,7 +1031,7 @@ func (h *Handlers) GetDashboardStats(c *gin.Context) {
 	activeBans, _ := banService.GetActiveBans()
 	blockedCount = len(activeBans)
 
-	stats.Secrets.Total = len(h.config.Secrets)
+	stats.Secrets.Total = len(h.config.GetSecrets())
 	stats.Secrets.Blocked = blockedCount
 
 	// 日志统计
@@ -809,18 +1040,17 @@ func (h *Handlers) GetDashboardStats(c *gin.Context) {
 	stats.Logs.Warnings = h.logger.GetWarningCount()
 
 	// 系统统计
-	stats.System.Uptime = getUptime()
-
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
+	system := h.system.Snapshot()
+	stats.System.Uptime = system.Uptime
 	// 使用系统实际分配给堆的内存作为内存指标
-	stats.System.Memory = int(m.HeapSys / 1024 / 1024) // MB
-
-	stats.System.CPU = int(h.cpuMonitor.GetCpuUsage())
-	cpuInfo := h.cpuMonitor.GetCpuInfo()
-	stats.System.CPUCores = cpuInfo.Cores
-	stats.System.CPUModel = cpuInfo.Model
-	stats.System.LoadAvg = getLoadAverage()
+	stats.System.Memory = int(system.Memory.HeapSys / 1024 / 1024) // MB
+	stats.System.RSS = int(system.RSS / 1024 / 1024)
+	stats.System.CPU = int(system.CPU.Usage)
+	stats.System.CPUProcess = int(system.CPU.ProcessUsage)
+	stats.System.CPUCores = system.CPU.Cores
+	stats.System.CPUModel = system.CPU.Model
+	stats.System.CPUSpeed = int(system.CPU.Speed)
+	stats.System.LoadAvg = system.LoadAverage
 
 	h.Success(c, stats)
 }
@@ -828,14 +1058,14 @@ func (h *Handlers) GetDashboardStats(c *gin.Context) {
 // GetWebConsoleStatus 获取Web控制台状态
 func (h *Handlers) GetWebConsoleStatus(c *gin.Context) {
 	h.Success(c, gin.H{
-		"enabled": h.config.UI.EnableWebConsole,
+		"enabled": h.config.GetUIConfig().EnableWebConsole,
 	})
 }
 
 // WebConsoleHandler Web控制台处理器
 func (h *Handlers) WebConsoleHandler(c *gin.Context) {
 	// 首先检查是否启用了 Web 控制台
-	if !h.config.UI.EnableWebConsole {
+	if !h.config.GetUIConfig().EnableWebConsole {
 		c.Header("Content-Type", "text/html; charset=utf-8")
 		c.String(http.StatusOK, `
 <!DOCTYPE html>
@@ -909,49 +1139,7 @@ func (h *Handlers) WebConsoleHandler(c *gin.Context) {
 
 // GetHealth 健康检查
 func (h *Handlers) GetHealth(c *gin.Context) {
-	cpuInfo := h.cpuMonitor.GetCpuInfo()
-
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	health := models.HealthResponse{
-		Status:    "healthy",
-		Timestamp: time.Now(),
-		Uptime:    float64(time.Since(h.startTime).Seconds()),
-		Memory: struct {
-			HeapUsed     uint64 `json:"heap_used"`
-			HeapTotal    uint64 `json:"heap_total"`
-			HeapSys      uint64 `json:"heap_sys"`
-			HeapIdle     uint64 `json:"heap_idle"`
-			HeapInuse    uint64 `json:"heap_inuse"`
-			HeapReleased uint64 `json:"heap_released"`
-			HeapObjects  uint64 `json:"heap_objects"`
-		}{
-			HeapUsed:     m.Alloc,
-			HeapTotal:    m.TotalAlloc,
-			HeapSys:      m.Sys,
-			HeapIdle:     m.HeapIdle,
-			HeapInuse:    m.HeapInuse,
-			HeapReleased: m.HeapReleased,
-			HeapObjects:  m.HeapObjects,
-		},
-		CPU: struct {
-			Usage int    `json:"usage"`
-			Cores int    `json:"cores"`
-			Model string `json:"model"`
-			Speed int    `json:"speed"`
-		}{
-			Usage: int(h.cpuMonitor.GetCpuUsage()),
-			Cores: cpuInfo.Cores,
-			Model: cpuInfo.Model,
-			Speed: int(cpuInfo.Speed),
-		},
-		Connections: h.wsManager.GetConnectionCount(),
-		LoadAverage: []float64{0.0, 0.0, 0.0},
-		Version:     "2.0.0",
-	}
-
-	h.Success(c, health)
+	h.Success(c, h.healthResponse())
 }
 
 // updateSecretInDatabase 更新数据库中的密钥状态
@@ -1011,19 +1199,11 @@ func (h *Handlers) unblockSecretInBatch(secret string, admin string) error {
 	return nil
 }
 
-// saveConfigToFile 保存配置到文件
-func (h *Handlers) saveConfigToFile() error {
-	return config.SaveConfig(h.config)
-}
-
 // GetWebSocketConfig 获取WebSocket配置
 func (h *Handlers) GetWebSocketConfig(c *gin.Context) {
-	configService := &database.ConfigService{}
+	settings := config.Settings(h.config)
 
-	// 从数据库获取WebSocket配置
 	wsConfig := make(map[string]interface{})
-
-	// 获取各个配置项
 	configs := []string{
 		"websocket.enable_heartbeat",
 		"websocket.heartbeat_interval",
@@ -1032,45 +1212,13 @@ func (h *Handlers) GetWebSocketConfig(c *gin.Context) {
 		"websocket.max_message_size",
 		"websocket.read_timeout",
 		"websocket.write_timeout",
+		"websocket.default_delivery_mode",
+		"websocket.default_protocol",
+		"websocket.send_queue_size",
+		"websocket.send_queue_policy",
 	}
-
 	for _, key := range configs {
-		if config, err := configService.GetConfig(key); err == nil {
-			// 根据配置类型转换值
-			var value interface{}
-			switch config.Type {
-			case "bool":
-				value = config.Value == "true"
-			case "int":
-				var intVal int
-				if _, err := fmt.Sscanf(config.Value, "%d", &intVal); err == nil {
-					value = intVal
-				} else {
-					value = config.Value
-				}
-			default:
-				value = config.Value
-			}
-			wsConfig[key] = value
-		} else {
-			// 如果数据库中没有，使用内存配置的默认值
-			switch key {
-			case "websocket.enable_heartbeat":
-				wsConfig[key] = h.config.WebSocket.EnableHeartbeat
-			case "websocket.heartbeat_interval":
-				wsConfig[key] = h.config.WebSocket.HeartbeatInterval
-			case "websocket.heartbeat_timeout":
-				wsConfig[key] = h.config.WebSocket.HeartbeatTimeout
-			case "websocket.client_heartbeat_interval":
-				wsConfig[key] = h.config.WebSocket.ClientHeartbeatInterval
-			case "websocket.max_message_size":
-				wsConfig[key] = h.config.WebSocket.MaxMessageSize
-			case "websocket.read_timeout":
-				wsConfig[key] = h.config.WebSocket.ReadTimeout
-			case "websocket.write_timeout":
-				wsConfig[key] = h.config.WebSocket.WriteTimeout
-			}
-		}
+		wsConfig[key] = settings[key]
 	}
 
 	h.Success(c, gin.H{
@@ -1086,31 +1234,18 @@ func (h *Handlers) UpdateWebSocketConfig(c *gin.Context) {
 		return
 	}
 
-	configService := &database.ConfigService{}
-
-	// 保存到数据库
-	for key, value := range updates {
-		configKey := "websocket." + key
-		valueStr := fmt.Sprintf("%v", value)
-
-		// 确定配置类型
-		var configType string
-		switch key {
-		case "enable_heartbeat":
-			configType = "bool"
-		case "heartbeat_interval", "heartbeat_timeout", "client_heartbeat_interval", "max_message_size", "read_timeout", "write_timeout":
-			configType = "int"
-		default:
-			configType = "string"
-		}
-
-		if err := configService.SetConfig(configKey, valueStr, configType); err != nil {
-			h.logger.Log("error", "保存WebSocket配置失败", gin.H{"key": configKey, "error": err})
-		}
+	before, after, _, err := h.changeConfig(c, audit.ActionConfigWebSocketUpdate, nil, func() (*config.Config, *config.Config, error) {
+		return h.store.Update(func(cfg *config.Config) error {
+			applyWebSocketConfig(cfg, updates)
+			return nil
+		})
+	})
+	if err != nil {
+		h.audit(c, audit.ActionConfigWebSocketUpdate, "websocket", nil, updates, err)
+		h.configError(c, err, "保存WebSocket配置失败")
+		return
 	}
-
-	// 更新内存配置
-	h.updateWebSocketConfigInMemory(updates)
+	h.audit(c, audit.ActionConfigWebSocketUpdate, "websocket", before.WebSocket, after.WebSocket, nil)
 
 	user, _ := c.Get("user")
 	claims := user.(*utils.Claims)
@@ -1126,7 +1261,7 @@ func (h *Handlers) UpdateWebSocketConfig(c *gin.Context) {
 func (h *Handlers) GetSystemConfig(c *gin.Context) {
 	configService := &database.ConfigService{}
 
-	// 从数据库获取所有配置
+	// 从数据库获取配置项列表
 	configs, err := configService.GetAllConfigs()
 	if err != nil {
 		h.logger.Log("error", "获取系统配置失败", gin.H{"error": err.Error()})
@@ -1134,6 +1269,20 @@ func (h *Handlers) GetSystemConfig(c *gin.Context) {
 		return
 	}
 
+	// 取值以当前生效的配置为准，数据库中的值可能已被配置文件或环境变量覆盖
+	settings := config.Settings(h.config)
+	for key := range configs {
+		if value, exists := settings[key]; exists {
+			configs[key] = value
+		}
+	}
+	// 不返回凭据，密码为空表示不修改
+	for _, key := range config.CredentialKeys {
+		if _, exists := configs[key]; exists {
+			configs[key] = ""
+		}
+	}
+
 	h.Success(c, configs)
 }
 
@@ -1192,40 +1341,24 @@ func (h *Handlers) UpdateSystemConfig(c *gin.Context) {
 		return
 	}
 
-	// 分离需要更新配置文件的设置和数据库的设置
-	fileUpdates := make(map[string]interface{})
-	dbUpdates := make(map[string]interface{})
-
-	for key, value := range updates {
-		// Web控制台启用状态直接更新配置文件
-		if key == "ui.enable_web_console" {
-			fileUpdates[key] = value
-		} else {
-			dbUpdates[key] = value
-		}
-	}
-
-	// 更新数据库配置（除了Web控制台启用状态）
-	if len(dbUpdates) > 0 {
-		configService := &database.ConfigService{}
-		if err := configService.BatchUpdateConfigs(dbUpdates); err != nil {
-			h.logger.Log("error", "批量更新系统配置失败", gin.H{"error": err.Error()})
-			h.Error(c, http.StatusInternalServerError, "更新系统配置失败: "+err.Error())
-			return
-		}
+	// 按数据库中的配置定义校验类型、取值范围和可选值
+	configService := &database.ConfigService{}
+	if err := configService.ValidateConfigs(updates); err != nil {
+		h.Error(c, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	// 更新配置文件（Web控制台启用状态）
-	if len(fileUpdates) > 0 {
-		if err := h.updateConfigFile(fileUpdates); err != nil {
-			h.logger.Log("error", "更新配置文件失败", gin.H{"error": err.Error()})
-			h.Error(c, http.StatusInternalServerError, "更新配置文件失败: "+err.Error())
-			return
-		}
+	before, after, _, err := h.changeConfig(c, audit.ActionConfigSystemUpdate, nil, func() (*config.Config, *config.Config, error) {
+		return h.store.Update(func(cfg *config.Config) error {
+			return applySystemConfig(cfg, updates)
+		})
+	})
+	if err != nil {
+		h.audit(c, audit.ActionConfigSystemUpdate, "system", nil, updates, err)
+		h.configError(c, err, "更新系统配置失败")
+		return
 	}
-
-	// 更新内存配置
-	h.updateSystemConfigInMemory(updates)
+	h.audit(c, audit.ActionConfigSystemUpdate, "system", before, after, nil)
 
 	user, _ := c.Get("user")
 	claims := user.(*utils.Claims)
@@ -1247,7 +1380,16 @@ func (h *Handlers) ResetSystemConfig(c *gin.Context) {
 
 	configService := &database.ConfigService{}
 
-	if err := configService.ResetConfigToDefault(key); err != nil {
+	// 同时删除数据库和配置文件中的值，配置项回退到默认值
+	var before, after *config.Config
+	err := configService.ResetConfigToDefault(key)
+	if err == nil && config.IsSettingKey(key) {
+		before, after, _, err = h.changeConfig(c, audit.ActionConfigSystemReset, nil, func() (*config.Config, *config.Config, error) {
+			return h.store.Reset(key)
+		})
+	}
+	h.audit(c, audit.ActionConfigSystemReset, key, before, after, err)
+	if err != nil {
 		h.logger.Log("error", "重置配置失败", gin.H{"key": key, "error": err.Error()})
 		h.Error(c, http.StatusInternalServerError, "重置配置失败: "+err.Error())
 		return
@@ -1267,7 +1409,14 @@ func (h *Handlers) ResetSystemConfig(c *gin.Context) {
 func (h *Handlers) InitializeSystemConfig(c *gin.Context) {
 	initializer := database.NewConfigInitializer()
 
-	if err := initializer.InitializeDefaultConfigs(); err != nil {
+	err := initializer.InitializeDefaultConfigs()
+	var before, after *config.Config
+	if err == nil {
+		// 新写入的配置项可能改变配置文件中没有设置的值
+		before, after, _, err = h.changeConfig(c, audit.ActionConfigSystemInit, nil, h.store.Reload)
+	}
+	h.audit(c, audit.ActionConfigSystemInit, "system", before, after, err)
+	if err != nil {
 		h.logger.Log("error", "初始化系统配置失败", gin.H{"error": err.Error()})
 		h.Error(c, http.StatusInternalServerError, "初始化系统配置失败: "+err.Error())
 		return
@@ -1282,154 +1431,168 @@ func (h *Handlers) InitializeSystemConfig(c *gin.Context) {
 	h.Success(c, nil, "系统配置初始化成功")
 }
 
-// updateWebSocketConfigInMemory 更新内存中的WebSocket配置
-func (h *Handlers) updateWebSocketConfigInMemory(updates map[string]interface{}) {
+// applyWebSocketConfig 将WebSocket配置更新应用到配置上，键不带 websocket. 前缀
+func applyWebSocketConfig(cfg *config.Config, updates map[string]interface{}) {
 	for key, value := range updates {
 		switch key {
 		case "enable_heartbeat":
 			if v, ok := value.(bool); ok {
-				h.config.WebSocket.EnableHeartbeat = v
+				cfg.WebSocket.EnableHeartbeat = v
 			}
 		case "heartbeat_interval":
 			if v, ok := value.(float64); ok {
-				h.config.WebSocket.HeartbeatInterval = int(v)
+				cfg.WebSocket.HeartbeatInterval = int(v)
 			}
 		case "heartbeat_timeout":
 			if v, ok := value.(float64); ok {
-				h.config.WebSocket.HeartbeatTimeout = int(v)
+				cfg.WebSocket.HeartbeatTimeout = int(v)
 			}
 		case "client_heartbeat_interval":
 			if v, ok := value.(float64); ok {
-				h.config.WebSocket.ClientHeartbeatInterval = int(v)
+				cfg.WebSocket.ClientHeartbeatInterval = int(v)
 			}
 		case "max_message_size":
 			if v, ok := value.(float64); ok {
-				h.config.WebSocket.MaxMessageSize = int(v)
+				cfg.WebSocket.MaxMessageSize = int(v)
 			}
 		case "read_timeout":
 			if v, ok := value.(float64); ok {
-				h.config.WebSocket.ReadTimeout = int(v)
+				cfg.WebSocket.ReadTimeout = int(v)
 			}
 		case "write_timeout":
 			if v, ok := value.(float64); ok {
-				h.config.WebSocket.WriteTimeout = int(v)
+				cfg.WebSocket.WriteTimeout = int(v)
+			}
+		case "default_delivery_mode":
+			if v, ok := value.(string); ok && config.IsValidDeliveryMode(v) {
+				cfg.WebSocket.DefaultDeliveryMode = v
+			}
+		case "default_protocol":
+			if v, ok := value.(string); ok && config.IsValidProtocol(v) {
+				cfg.WebSocket.DefaultProtocol = v
+			}
+		case "send_queue_size":
+			if v, ok := value.(float64); ok && v > 0 {
+				cfg.WebSocket.SendQueueSize = int(v)
+			}
+		case "send_queue_policy":
+			if v, ok := value.(string); ok && config.IsValidSendQueuePolicy(v) {
+				cfg.WebSocket.SendQueuePolicy = v
 			}
 		}
 	}
 }
 
-// updateSystemConfigInMemory 更新内存中的系统配置
-func (h *Handlers) updateSystemConfigInMemory(updates map[string]interface{}) {
+// applySystemConfig 将系统配置更新应用到配置上，键为点号分隔的配置路径
+func applySystemConfig(cfg *config.Config, updates map[string]interface{}) error {
 	for key, value := range updates {
 		switch key {
 		case "server.port":
 			if v, ok := value.(string); ok {
-				h.config.Server.Port = v
+				cfg.Server.Port = v
 			}
 		case "server.host":
 			if v, ok := value.(string); ok {
-				h.config.Server.Host = v
+				cfg.Server.Host = v
 			}
 		case "server.mode":
 			if v, ok := value.(string); ok {
-				h.config.Server.Mode = v
+				cfg.Server.Mode = v
 			}
 		case "security.enable_signature_validation":
 			if v, ok := value.(bool); ok {
-				h.config.Security.EnableSignatureValidation = v
+				cfg.Security.EnableSignatureValidation = v
 			}
 		case "security.default_allow_new_connections":
 			if v, ok := value.(bool); ok {
-				h.config.Security.DefaultAllowNewConnections = v
+				cfg.Security.DefaultAllowNewConnections = v
 			}
 		case "security.max_connections_per_secret":
 			if v, ok := value.(float64); ok {
-				h.config.Security.MaxConnectionsPerSecret = int(v)
+				cfg.Security.MaxConnectionsPerSecret = int(v)
 			}
 		case "security.require_manual_key_management":
 			if v, ok := value.(bool); ok {
-				h.config.Security.RequireManualKeyManagement = v
+				cfg.Security.RequireManualKeyManagement = v
+			}
+		case "security.connection_limit_policy":
+			if v, ok := value.(string); ok && (v == config.ConnectionLimitReject || v == config.ConnectionLimitEvictOldest) {
+				cfg.Security.ConnectionLimitPolicy = v
+			}
+		case "security.allow_secret_query":
+			if v, ok := value.(bool); ok {
+				cfg.Security.AllowSecretQuery = v
+			}
+		case "security.signature_max_skew":
+			if v, ok := value.(float64); ok && v > 0 {
+				cfg.Security.SignatureMaxSkew = int64(v)
 			}
 		case "auth.username":
 			if v, ok := value.(string); ok {
-				h.config.Auth.Username = v
+				cfg.Auth.Username = v
 			}
 		case "auth.password":
 			if v, ok := value.(string); ok && v != "" {
 				// 只有在密码不为空时才更新（为空表示不修改密码）
 				hashedPassword, err := utils.HashPassword(v)
-				if err == nil {
-					h.config.Auth.Password = hashedPassword
+				if err != nil {
+					return err
 				}
+				cfg.Auth.Password = hashedPassword
 			}
 		case "auth.session_timeout":
 			if v, ok := value.(float64); ok {
-				h.config.Auth.SessionTimeout = int64(v)
+				cfg.Auth.SessionTimeout = int64(v)
 			}
 		case "logging.level":
 			if v, ok := value.(string); ok {
-				h.config.Logging.Level = v
+				cfg.Logging.Level = v
 			}
 		case "logging.max_log_entries":
 			if v, ok := value.(float64); ok {
-				h.config.Logging.MaxLogEntries = int(v)
+				cfg.Logging.MaxLogEntries = int(v)
 			}
 		case "logging.enable_log_to_file":
 			if v, ok := value.(bool); ok {
-				h.config.Logging.EnableLogToFile = v
+				cfg.Logging.EnableLogToFile = v
 			}
 		case "logging.log_file_path":
 			if v, ok := value.(string); ok {
-				h.config.Logging.LogFilePath = v
+				cfg.Logging.LogFilePath = v
 			}
 		case "ui.enable_web_console":
 			if v, ok := value.(bool); ok {
-				h.config.UI.EnableWebConsole = v
+				cfg.UI.EnableWebConsole = v
 			}
 		case "ui.theme":
 			if v, ok := value.(string); ok {
-				h.config.UI.Theme = v
+				cfg.UI.Theme = v
 			}
 		case "ui.primary_color":
 			if v, ok := value.(string); ok {
-				h.config.UI.PrimaryColor = v
+				cfg.UI.PrimaryColor = v
 			}
 		case "ui.compact_mode":
 			if v, ok := value.(bool); ok {
-				h.config.UI.CompactMode = v
+				cfg.UI.CompactMode = v
 			}
 		case "ui.language":
 			if v, ok := value.(string); ok {
-				h.config.UI.Language = v
+				cfg.UI.Language = v
 			}
 		case "ui.show_breadcrumb":
 			if v, ok := value.(bool); ok {
-				h.config.UI.ShowBreadcrumb = v
+				cfg.UI.ShowBreadcrumb = v
 			}
 		case "ui.show_footer":
 			if v, ok := value.(bool); ok {
-				h.config.UI.ShowFooter = v
+				cfg.UI.ShowFooter = v
 			}
 		case "ui.enable_animation":
 			if v, ok := value.(bool); ok {
-				h.config.UI.EnableAnimation = v
+				cfg.UI.EnableAnimation = v
 			}
 		}
 	}
-}
-
-// updateConfigFile 更新配置文件
-func (h *Handlers) updateConfigFile(updates map[string]interface{}) error {
-	// 更新内存中的配置
-	for key, value := range updates {
-		switch key {
-		case "ui.enable_web_console":
-			if v, ok := value.(bool); ok {
-				h.config.UI.EnableWebConsole = v
-			}
-		}
-	}
-
-	// 保存配置到文件
-	return config.SaveConfig(h.config)
+	return nil
 }
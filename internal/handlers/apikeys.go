@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/database"
+	"nekobridge/internal/models"
+	"nekobridge/internal/rbac"
+	"nekobridge/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiKeyHeader        = "X-API-Key" // API Key 认证使用的请求头，与交互式会话的 Authorization 分开
+	apiKeyPrefix        = "nbk_"      // API Key 明文前缀，便于在日志和代码仓库中识别泄露的 Key
+	apiKeyDisplayLength = 12          // 保存在数据库中用于识别 Key 的明文长度
+	maxAPIKeyNameLength = 64
+	apiKeyTouchInterval = time.Minute // 更新最近使用时间的最小间隔
+	apiKeyActorPrefix   = "apikey:"   // 使用 API Key 认证时记录到日志中的操作者前缀
+)
+
+// authenticateAPIKey 使用 X-API-Key 请求头认证，Key 的权限不能超过创建者当前角色的权限
+func (h *Handlers) authenticateAPIKey(c *gin.Context, rawKey string) {
+	keyService := &database.APIKeyService{}
+	key, err := keyService.GetByHash(utils.HashToken(rawKey))
+	if err != nil || (key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now())) {
+		h.Error(c, http.StatusUnauthorized, "Invalid or expired API key")
+		c.Abort()
+		return
+	}
+
+	if !ipAllowed(key.AllowedIPs, c.ClientIP()) {
+		h.logger.Log("warning", "API Key 来源地址不允许", gin.H{
+			"key":  key.Prefix,
+			"name": key.Name,
+			"ip":   c.ClientIP(),
+		})
+		h.Error(c, http.StatusForbidden, "API Key 不允许从该地址访问")
+		c.Abort()
+		return
+	}
+
+	// 创建者被禁用或删除后，其创建的 Key 一并失效
+	userService := &database.UserService{}
+	creator, err := userService.GetUser(key.CreatedBy)
+	if err != nil || !creator.Enabled {
+		h.Error(c, http.StatusUnauthorized, "Invalid or expired API key")
+		c.Abort()
+		return
+	}
+
+	// 只要求登录的路由（会话、两步验证等）属于交互式操作，不接受 API Key
+	permission, registered := requiredPermission(c.Request.Method, c.FullPath())
+	if !registered || permission == "" || !hasScope(key.Scopes, permission) || !rbac.HasPermission(creator.Role, permission) {
+		h.logger.Log("warning", "API Key 权限不足", gin.H{
+			"key":        key.Prefix,
+			"name":       key.Name,
+			"method":     c.Request.Method,
+			"path":       c.FullPath(),
+			"permission": permission,
+		})
+		h.Error(c, http.StatusForbidden, "权限不足")
+		c.Abort()
+		return
+	}
+
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) >= apiKeyTouchInterval || key.LastUsedIP != c.ClientIP() {
+		if err := keyService.RecordUse(key.ID, c.ClientIP()); err != nil {
+			h.logger.Log("warning", "更新 API Key 使用时间失败", gin.H{"key": key.Prefix, "error": err.Error()})
+		}
+	}
+
+	c.Set("user", &utils.Claims{
+		Username: apiKeyActorPrefix + key.Prefix,
+		Role:     creator.Role,
+	})
+	c.Set("api_key", key)
+	c.Next()
+}
+
+// GetAPIKeys 获取所有 API Key 和可申请的权限
+func (h *Handlers) GetAPIKeys(c *gin.Context) {
+	keyService := &database.APIKeyService{}
+	keys, err := keyService.GetAPIKeys()
+	if err != nil {
+		h.logger.Log("error", "获取 API Key 列表失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "获取 API Key 列表失败")
+		return
+	}
+
+	h.Success(c, gin.H{
+		"api_keys": keys,
+		"scopes":   rbac.APIKeyScopes(),
+	})
+}
+
+// CreateAPIKey 创建 API Key，明文 Key 只在创建时返回一次
+func (h *Handlers) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "名称和权限不能为空")
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		h.Error(c, http.StatusBadRequest, "无效的名称")
+		return
+	}
+
+	current, _ := c.Get("user")
+	claims := current.(*utils.Claims)
+
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if !rbac.IsValidAPIKeyScope(scope) {
+			h.Error(c, http.StatusBadRequest, "无效的权限: "+scope+"，可选值: "+strings.Join(rbac.APIKeyScopes(), ", "))
+			return
+		}
+		if !rbac.HasPermission(claims.Role, scope) {
+			h.Error(c, http.StatusForbidden, "不能授予自己没有的权限: "+scope)
+			return
+		}
+		if !hasScope(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		h.Error(c, http.StatusBadRequest, "至少需要一个权限")
+		return
+	}
+
+	allowedIPs := make([]string, 0, len(req.AllowedIPs))
+	for _, entry := range req.AllowedIPs {
+		normalized, ok := normalizeIPRule(entry)
+		if !ok {
+			h.Error(c, http.StatusBadRequest, "无效的 IP 地址或 CIDR: "+entry)
+			return
+		}
+		allowedIPs = append(allowedIPs, normalized)
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		h.Error(c, http.StatusBadRequest, "过期时间必须晚于当前时间")
+		return
+	}
+
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		h.logger.Log("error", "生成 API Key 失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	rawKey := apiKeyPrefix + token
+
+	key := &database.APIKey{
+		Name:       name,
+		Prefix:     rawKey[:apiKeyDisplayLength],
+		KeyHash:    utils.HashToken(rawKey),
+		Scopes:     scopes,
+		AllowedIPs: allowedIPs,
+		ExpiresAt:  req.ExpiresAt,
+		CreatedBy:  claims.Username,
+	}
+	keyService := &database.APIKeyService{}
+	if err := keyService.CreateAPIKey(key); err != nil {
+		h.audit(c, audit.ActionAPIKeyCreate, key.Prefix, nil, key, err)
+		h.logger.Log("error", "创建 API Key 失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "创建 API Key 失败")
+		return
+	}
+
+	h.audit(c, audit.ActionAPIKeyCreate, key.Prefix, nil, key, nil)
+	h.logger.Log("info", "创建 API Key", gin.H{
+		"admin":       claims.Username,
+		"name":        key.Name,
+		"key":         key.Prefix,
+		"scopes":      key.Scopes,
+		"allowed_ips": key.AllowedIPs,
+	})
+
+	h.Success(c, gin.H{
+		"key":     rawKey,
+		"api_key": key,
+	}, "API Key 创建成功，请立即保存，之后将无法再次查看")
+}
+
+// RevokeAPIKey 撤销 API Key，不影响任何交互式会话
+func (h *Handlers) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.Error(c, http.StatusBadRequest, "无效的 API Key ID")
+		return
+	}
+
+	keyService := &database.APIKeyService{}
+	key, err := keyService.GetAPIKeyByID(uint(id))
+	if err != nil {
+		h.Error(c, http.StatusNotFound, "API Key 不存在")
+		return
+	}
+
+	revoked, err := keyService.RevokeAPIKey(key.ID)
+	if err != nil {
+		h.logger.Log("error", "撤销 API Key 失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "撤销 API Key 失败")
+		return
+	}
+	if revoked == 0 {
+		h.Error(c, http.StatusBadRequest, "API Key 已被撤销")
+		return
+	}
+
+	current, _ := c.Get("user")
+	claims := current.(*utils.Claims)
+	h.audit(c, audit.ActionAPIKeyRevoke, key.Prefix, nil, gin.H{"name": key.Name}, nil)
+	h.logger.Log("info", "撤销 API Key", gin.H{
+		"admin": claims.Username,
+		"name":  key.Name,
+		"key":   key.Prefix,
+	})
+
+	h.Success(c, nil, "API Key 已撤销")
+}
+
+// hasScope 检查权限列表中是否包含指定权限
+func hasScope(scopes []string, permission string) bool {
+	for _, scope := range scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeIPRule 校验并规范化 IP 地址或 CIDR
+func normalizeIPRule(entry string) (string, bool) {
+	entry = strings.TrimSpace(entry)
+	if strings.Contains(entry, "/") {
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return "", false
+		}
+		return network.String(), true
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return "", false
+	}
+	return ip.String(), true
+}
+
+// ipAllowed 检查来源 IP 是否在 API Key 的允许列表中，列表为空表示不限制
+func ipAllowed(rules []string, clientIP string) bool {
+	return len(rules) == 0 || ipMatches(rules, clientIP)
+}
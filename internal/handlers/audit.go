@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/database"
+	"nekobridge/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 500
+	auditExportBatchSize = 500
+)
+
+// auditCSVHeader 导出 CSV 的表头
+var auditCSVHeader = []string{"id", "time", "actor", "ip", "action", "target", "result", "before", "after", "detail"}
+
+// audit 记录当前请求的管理操作，操作者取自认证信息
+// before、after 为操作前后的对象，只保存发生变化的字段；opErr 不为空时记录为失败
+func (h *Handlers) audit(c *gin.Context, action, target string, before, after interface{}, opErr error) {
+	h.recordAudit(requestActor(c), c.ClientIP(), action, target, before, after, opErr)
+}
+
+// requestActor 获取当前请求的操作者，未认证的请求视为系统操作
+func requestActor(c *gin.Context) string {
+	if user, exists := c.Get("user"); exists {
+		return user.(*utils.Claims).Username
+	}
+	return audit.ActorSystem
+}
+
+// recordAudit 写入审计记录，写入失败只记录日志，不影响操作本身
+func (h *Handlers) recordAudit(actor, ip, action, target string, before, after interface{}, opErr error) {
+	entry := &database.AuditLog{
+		Actor:  actor,
+		IP:     ip,
+		Action: action,
+		Target: target,
+		Result: audit.ResultSuccess,
+	}
+	if opErr != nil {
+		entry.Result = audit.ResultFailure
+		entry.Detail = opErr.Error()
+	}
+
+	if before != nil || after != nil {
+		changedBefore, changedAfter, err := audit.Diff(before, after)
+		if err != nil {
+			h.logger.Log("warning", "生成审计变更记录失败", gin.H{"action": action, "error": err.Error()})
+		} else {
+			entry.Before = encodeAuditFields(changedBefore)
+			entry.After = encodeAuditFields(changedAfter)
+		}
+	}
+
+	auditService := &database.AuditService{}
+	if err := auditService.Record(entry); err != nil {
+		h.logger.Log("error", "写入审计记录失败", gin.H{
+			"action": action,
+			"target": target,
+			"actor":  actor,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// GetAuditLogs 查询审计记录
+// 查询参数: actor、action（支持前缀，例如 secret）、target、result、from、to（RFC3339 或 Unix 秒）、limit、offset
+func (h *Handlers) GetAuditLogs(c *gin.Context) {
+	filter, ok := h.parseAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAuditPageSize)))
+	if err != nil || limit <= 0 {
+		limit = defaultAuditPageSize
+	}
+	if limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	auditService := &database.AuditService{}
+	entries, total, err := auditService.Query(filter, limit, offset)
+	if err != nil {
+		h.logger.Log("error", "查询审计记录失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "查询审计记录失败")
+		return
+	}
+
+	h.Success(c, gin.H{
+		"entries": entries,
+		"total":   total,
+	})
+}
+
+// ExportAuditLogs 导出审计记录，format 为 csv（默认）或 ndjson，筛选参数与 GetAuditLogs 相同
+func (h *Handlers) ExportAuditLogs(c *gin.Context) {
+	filter, ok := h.parseAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		h.Error(c, http.StatusBadRequest, "无效的导出格式，可选值: csv, ndjson")
+		return
+	}
+
+	// 导出本身也是需要审计的操作，先记录再导出，导出结果中包含这条记录
+	h.audit(c, audit.ActionAuditExport, "", nil, gin.H{"format": format, "filter": filter}, nil)
+
+	filename := "audit-" + strconv.FormatInt(time.Now().Unix(), 10) + "." + format
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+
+	var write func([]database.AuditLog) error
+	var flush func() error
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		writer := csv.NewWriter(c.Writer)
+		writer.Write(auditCSVHeader)
+		write = func(entries []database.AuditLog) error {
+			for _, entry := range entries {
+				if err := writer.Write(auditCSVRecord(entry)); err != nil {
+					return err
+				}
+			}
+			writer.Flush()
+			return writer.Error()
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		encoder := json.NewEncoder(c.Writer)
+		write = func(entries []database.AuditLog) error {
+			for _, entry := range entries {
+				if err := encoder.Encode(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		flush = func() error { return nil }
+	}
+
+	auditService := &database.AuditService{}
+	err := auditService.Each(filter, auditExportBatchSize, write)
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// 响应头已经发出，只能记录日志
+		h.logger.Log("error", "导出审计记录失败", gin.H{"format": format, "error": err.Error()})
+	}
+}
+
+// parseAuditFilter 解析审计记录的筛选参数，参数无效时写入 400 响应
+func (h *Handlers) parseAuditFilter(c *gin.Context) (database.AuditFilter, bool) {
+	filter := database.AuditFilter{
+		Actor:  strings.TrimSpace(c.Query("actor")),
+		Action: strings.TrimSpace(c.Query("action")),
+		Target: strings.TrimSpace(c.Query("target")),
+		Result: strings.TrimSpace(c.Query("result")),
+	}
+	if filter.Result != "" && filter.Result != audit.ResultSuccess && filter.Result != audit.ResultFailure {
+		h.Error(c, http.StatusBadRequest, "无效的结果，可选值: success, failure")
+		return filter, false
+	}
+	if value := c.Query("from"); value != "" {
+		from, err := parseTrafficTime(value)
+		if err != nil {
+			h.Error(c, http.StatusBadRequest, "无效的开始时间")
+			return filter, false
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := parseTrafficTime(value)
+		if err != nil {
+			h.Error(c, http.StatusBadRequest, "无效的结束时间")
+			return filter, false
+		}
+		filter.To = &to
+	}
+	return filter, true
+}
+
+// encodeAuditFields 序列化变更字段，没有变化时返回空字符串
+func encodeAuditFields(fields map[string]interface{}) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// auditCSVRecord 转换为 CSV 行
+func auditCSVRecord(entry database.AuditLog) []string {
+	return []string{
+		strconv.FormatUint(uint64(entry.ID), 10),
+		entry.CreatedAt.Format(time.RFC3339),
+		csvSafe(entry.Actor),
+		entry.IP,
+		entry.Action,
+		csvSafe(entry.Target),
+		entry.Result,
+		entry.Before,
+		entry.After,
+		csvSafe(entry.Detail),
+	}
+}
+
+// csvSafe 防止用户可控的内容在电子表格中被当作公式执行
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
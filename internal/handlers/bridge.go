@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"strconv"
+
+	"nekobridge/internal/utils"
+	"nekobridge/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	gorilla "github.com/gorilla/websocket"
+)
+
+// addBridgeConnection 添加 bridge 协议连接
+// 查询参数 session_id 用于恢复之前的会话，acked_seq 为客户端最后确认的序号（省略时使用服务端记录）
+func (h *Handlers) addBridgeConnection(c *gin.Context, secret string, conn *gorilla.Conn) (*websocket.Client, error) {
+	ackedSeq := int64(-1)
+	if value := c.Query("acked_seq"); value != "" {
+		if seq, err := strconv.ParseInt(value, 10, 64); err == nil && seq >= 0 {
+			ackedSeq = seq
+		}
+	}
+
+	if sessionID := c.Query("session_id"); sessionID != "" {
+		session, err := h.wsManager.FindBridgeSession(secret, sessionID)
+		if err == nil {
+			h.logger.Log("info", "恢复 bridge 会话", gin.H{"secret": utils.MaskSecret(secret), "session_id": sessionID, "acked_seq": ackedSeq})
+			return h.wsManager.AddBridgeConnection(secret, conn, session, true, ackedSeq)
+		}
+		h.logger.Log("warning", "bridge 会话恢复失败，创建新会话", gin.H{"secret": utils.MaskSecret(secret), "session_id": sessionID, "error": err.Error()})
+	}
+
+	session := h.wsManager.NewBridgeSession(secret)
+	return h.wsManager.AddBridgeConnection(secret, conn, session, false, -1)
+}
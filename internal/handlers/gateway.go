@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/metrics"
+	"nekobridge/internal/models"
+	"nekobridge/internal/utils"
+	"nekobridge/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	gorilla "github.com/gorilla/websocket"
+)
+
+// resolveProtocol 获取连接使用的协议，查询参数 protocol 优先于密钥配置
+func (h *Handlers) resolveProtocol(c *gin.Context, secret string) string {
+	if protocol := c.Query("protocol"); config.IsValidProtocol(protocol) {
+		return protocol
+	}
+	return h.config.GetProtocol(secret)
+}
+
+// serveGatewayURL 响应 OpenAPI 代理上的 GET /gateway 和 /gateway/bot，返回该密钥的 QQ 网关协议连接地址
+// 地址中包含密钥，请求路径中已经带有同一个密钥，不会泄露额外的信息
+func (h *Handlers) serveGatewayURL(c *gin.Context, secret string, bot bool) {
+	secretConfig, exists := h.config.GetSecretConfig(secret)
+	if !exists || !secretConfig.Enabled {
+		h.Error(c, http.StatusForbidden, "密钥不存在或已被禁用")
+		return
+	}
+
+	scheme := "ws"
+	if c.Request.TLS != nil || h.config.GetServerConfig().SSL.Enabled || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "wss"
+	}
+	gatewayURL := (&url.URL{
+		Scheme:   scheme,
+		Host:     c.Request.Host,
+		Path:     "/ws/" + secret,
+		RawQuery: "protocol=" + config.ProtocolQQ,
+	}).String()
+
+	if !bot {
+		c.JSON(http.StatusOK, models.GatewayURL{URL: gatewayURL})
+		return
+	}
+	c.JSON(http.StatusOK, models.GatewayBot{
+		URL:    gatewayURL,
+		Shards: 1,
+		SessionStartLimit: models.GatewaySessionStartLimit{
+			Total:          1000,
+			Remaining:      1000,
+			ResetAfter:     86400000,
+			MaxConcurrency: 1,
+		},
+	})
+}
+
+// serveGateway 以 QQ 官方网关协议处理 WebSocket 连接
+// 连接已通过路径中的密钥鉴权，Identify / Resume 中的 token 不再校验
+// settings 用于会话建立之前，建立后由客户端按最新配置维护（读超时已按心跳间隔调整）
+func (h *Handlers) serveGateway(secret string, conn *gorilla.Conn, settings websocket.Settings) {
+	masked := utils.MaskSecret(secret)
+	heartbeatInterval := h.config.GetWebSocketConfig().GatewayHeartbeat
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = 41250
+	}
+
+	var client *websocket.Client
+
+	// write 在会话建立前直接写入连接，建立后通过客户端写入以保证写锁安全
+	write := func(payload models.GatewayPayload) error {
+		if client != nil {
+			return client.WriteJSON(payload)
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		if settings.WriteTimeout > 0 {
+			conn.SetWriteDeadline(time.Now().Add(settings.WriteTimeout))
+		}
+		return conn.WriteMessage(gorilla.TextMessage, data)
+	}
+
+	hello, _ := json.Marshal(models.GatewayHello{HeartbeatInterval: heartbeatInterval})
+	if err := write(models.GatewayPayload{Op: models.GatewayOpHello, D: hello}); err != nil {
+		h.logger.Log("error", "发送网关 Hello 失败", gin.H{"secret": masked, "error": err.Error()})
+		return
+	}
+
+	defer func() {
+		if client != nil {
+			h.logger.Log("info", "正在从管理器移除 WebSocket 连接", gin.H{"secret": masked, "client_id": client.ID})
+			h.wsManager.RemoveClient(client)
+		}
+	}()
+
+	for {
+		if client != nil {
+			client.PrepareRead()
+		} else {
+			conn.SetReadDeadline(time.Now().Add(settings.ReadTimeout))
+		}
+
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if gorilla.IsUnexpectedCloseError(err, gorilla.CloseGoingAway, gorilla.CloseAbnormalClosure) {
+				h.logger.Log("error", "WebSocket读取错误", gin.H{"secret": masked, "error": err.Error()})
+			} else {
+				h.logger.Log("info", "WebSocket 连接正常关闭", gin.H{"secret": masked, "error": err.Error()})
+			}
+			return
+		}
+		metrics.ObserveMessage(secret, metrics.DirectionIn, len(data))
+
+		var payload models.GatewayPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			h.logger.Log("warning", "无效的网关消息", gin.H{"secret": masked, "error": err.Error()})
+			continue
+		}
+
+		switch payload.Op {
+		case models.GatewayOpHeartbeat:
+			if err := write(models.GatewayPayload{Op: models.GatewayOpHeartbeatACK}); err != nil {
+				h.logger.Log("error", "发送心跳确认失败", gin.H{"secret": masked, "error": err.Error()})
+			}
+
+		case models.GatewayOpIdentify:
+			if client != nil {
+				h.logger.Log("warning", "网关会话已建立，忽略重复的 Identify", gin.H{"secret": masked})
+				continue
+			}
+
+			var identify models.GatewayIdentify
+			if len(payload.D) > 0 {
+				json.Unmarshal(payload.D, &identify)
+			}
+
+			client, err = h.identifyGateway(secret, conn, identify)
+			if err != nil {
+				h.rejectGateway(secret, conn, err)
+				return
+			}
+			h.logger.Log("info", "网关会话已建立", gin.H{
+				"secret":     masked,
+				"client_id":  client.ID,
+				"session_id": client.SessionID(),
+				"intents":    identify.Intents,
+			})
+
+		case models.GatewayOpResume:
+			if client != nil {
+				h.logger.Log("warning", "网关会话已建立，忽略重复的 Resume", gin.H{"secret": masked})
+				continue
+			}
+
+			var resume models.GatewayResume
+			if len(payload.D) > 0 {
+				json.Unmarshal(payload.D, &resume)
+			}
+
+			session, err := h.wsManager.ResumeGatewaySession(secret, resume.SessionID, resume.Seq)
+			if err != nil {
+				h.logger.Log("warning", "网关会话恢复失败", gin.H{
+					"secret":     masked,
+					"session_id": resume.SessionID,
+					"seq":        resume.Seq,
+					"error":      err.Error(),
+				})
+				// d 为 false 表示客户端需要重新 Identify
+				write(models.GatewayPayload{Op: models.GatewayOpInvalidSession, D: json.RawMessage("false")})
+				continue
+			}
+
+			// 错过的事件在 welcome 中补发，与实时投递互斥
+			client, err = h.wsManager.AddGatewayConnection(secret, conn, session, func(c *websocket.Client) error {
+				missed, err := session.Replay(c, resume.Seq)
+				if err != nil {
+					return err
+				}
+				if missed > 0 {
+					h.logger.Log("info", "已补发网关会话错过的事件", gin.H{"secret": masked, "session_id": session.ID, "missed": missed})
+				}
+				return session.Dispatch(c, "RESUMED", "", json.RawMessage(`""`))
+			})
+			if err != nil {
+				h.rejectGateway(secret, conn, err)
+				return
+			}
+			h.logger.Log("info", "网关会话已恢复", gin.H{
+				"secret":     masked,
+				"client_id":  client.ID,
+				"session_id": session.ID,
+				"seq":        resume.Seq,
+			})
+
+		default:
+			h.logger.Log("debug", "忽略网关消息", gin.H{"secret": masked, "op": payload.Op})
+		}
+	}
+}
+
+// identifyGateway 创建网关会话并下发 READY 事件
+func (h *Handlers) identifyGateway(secret string, conn *gorilla.Conn, identify models.GatewayIdentify) (*websocket.Client, error) {
+	shard := identify.Shard
+	if len(shard) != 2 {
+		shard = []int{0, 1}
+	}
+
+	username := "NekoBridge"
+	if secretConfig, exists := h.config.GetSecretConfig(secret); exists && secretConfig.Description != "" {
+		username = secretConfig.Description
+	}
+
+	session := h.wsManager.NewGatewaySession(secret)
+	ready, err := json.Marshal(models.GatewayReady{
+		Version:   1,
+		SessionID: session.ID,
+		User: models.GatewayUser{
+			Username: username,
+			Bot:      true,
+		},
+		Shard: shard,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return h.wsManager.AddGatewayConnection(secret, conn, session, func(c *websocket.Client) error {
+		return session.Dispatch(c, "READY", "", ready)
+	})
+}
+
+// rejectGateway 网关会话建立失败时关闭连接
+func (h *Handlers) rejectGateway(secret string, conn *gorilla.Conn, err error) {
+	h.logger.Log("warning", "添加WebSocket连接失败", gin.H{"secret": utils.MaskSecret(secret), "error": err.Error()})
+
+	code, reason := gorilla.CloseInternalServerErr, "会话建立失败"
+	if errors.Is(err, websocket.ErrMaxConnectionsReached) {
+		code, reason = gorilla.CloseTryAgainLater, "已达到该密钥的最大连接数"
+	}
+	conn.WriteControl(gorilla.CloseMessage, gorilla.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestServeGatewayURL(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.AddSecret("enabled-secret", config.SecretConfig{Enabled: true})
+	cfg.AddSecret("disabled-secret", config.SecretConfig{Enabled: false})
+	h := &Handlers{config: cfg}
+
+	tests := []struct {
+		name   string
+		secret string
+		bot    bool
+		header string // X-Forwarded-Proto
+		status int
+		url    string
+	}{
+		{"gateway", "enabled-secret", false, "", http.StatusOK, "ws://bridge.example.com/ws/enabled-secret?protocol=qq"},
+		{"gateway/bot", "enabled-secret", true, "", http.StatusOK, "ws://bridge.example.com/ws/enabled-secret?protocol=qq"},
+		{"反向代理 HTTPS", "enabled-secret", true, "https", http.StatusOK, "wss://bridge.example.com/ws/enabled-secret?protocol=qq"},
+		{"密钥已禁用", "disabled-secret", false, "", http.StatusForbidden, ""},
+		{"密钥不存在", "missing-secret", true, "", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodGet, "http://bridge.example.com/api/openapi/"+tt.secret+"/gateway", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("X-Forwarded-Proto", tt.header)
+			}
+
+			h.serveGatewayURL(c, tt.secret, tt.bot)
+			if recorder.Code != tt.status {
+				t.Fatalf("状态码 = %d，应为 %d", recorder.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var resp models.GatewayBot
+			if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+			if resp.URL != tt.url {
+				t.Errorf("url = %q，应为 %q", resp.URL, tt.url)
+			}
+			if tt.bot && (resp.Shards != 1 || resp.SessionStartLimit.MaxConcurrency != 1) {
+				t.Errorf("gateway/bot 响应 = %+v，应包含 shards 和 session_start_limit", resp)
+			}
+		})
+	}
+}
@@ -3,21 +3,28 @@ package handlers
 import (
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"nekobridge/internal/audit"
 	"nekobridge/internal/config"
 	"nekobridge/internal/database"
+	"nekobridge/internal/lockout"
+	"nekobridge/internal/metrics"
 	"nekobridge/internal/models"
 	"nekobridge/internal/monitor"
+	"nekobridge/internal/openapi"
+	"nekobridge/internal/rbac"
+	"nekobridge/internal/traffic"
 	"nekobridge/internal/utils"
 	"nekobridge/internal/websocket"
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -26,25 +33,39 @@ import (
 
 // Handlers 处理器结构
 type Handlers struct {
+	store      *config.Store
 	config     *config.Config
 	wsManager  *websocket.Manager
 	logger     *utils.Logger
 	jwtManager *utils.JWTManager
 	signer     *utils.Ed25519Signer
-	cpuMonitor *monitor.CpuMonitor
-	startTime  time.Time
+	system     *monitor.SystemMonitor
 	staticFS   *embed.FS
+
+	sigFailures   map[string]int64 // 每个密钥的签名校验失败次数
+	sigFailuresMu sync.RWMutex
+
+	upstreamClient *http.Client    // 转发客户端消息到上游的 HTTP 客户端，超时由每个请求单独控制
+	openapi        *openapi.Client // QQ OpenAPI 代理，负责各机器人 AppAccessToken 的缓存和刷新
+
+	loginGuard *lockout.Guard // 按来源 IP 和用户名统计登录失败次数
+
+	mfaChallenges map[string]*mfaChallenge // 等待两步验证的登录质询，键为质询令牌的摘要
+	totpMu        sync.Mutex               // 保护登录质询，并串行化两步验证码和恢复码的校验
+
+	revisionMu sync.Mutex // 串行化通过接口进行的配置修改和配置版本的写入
 }
 
 // NewHandlers 创建新的处理器
-func NewHandlers(cfg *config.Config, wsManager *websocket.Manager, staticFS ...embed.FS) *Handlers {
+func NewHandlers(store *config.Store, wsManager *websocket.Manager, staticFS ...embed.FS) *Handlers {
+	cfg := store.Config()
 	logger := utils.NewLogger(cfg.Logging.MaxLogEntries, cfg.Logging.Level)
 	jwtManager := utils.NewJWTManager(cfg.Auth.JWTSecret)
 	signer, err := utils.NewEd25519Signer()
 	if err != nil {
 		log.Printf("⚠️  无法初始化 Ed25519 签名器: %v", err)
 	}
-	cpuMonitor := monitor.NewCpuMonitor()
+	system := monitor.NewSystemMonitor()
 
 	var fs *embed.FS
 	if len(staticFS) > 0 {
@@ -52,14 +73,47 @@ func NewHandlers(cfg *config.Config, wsManager *websocket.Manager, staticFS ...e
 	}
 
 	return &Handlers{
+		store:      store,
 		config:     cfg,
 		wsManager:  wsManager,
 		logger:     logger,
 		jwtManager: jwtManager,
 		signer:     signer,
-		cpuMonitor: cpuMonitor,
-		startTime:  time.Now(),
+		system:     system,
 		staticFS:   fs,
+
+		sigFailures: make(map[string]int64),
+
+		upstreamClient: &http.Client{},
+		openapi:        openapi.NewClient(cfg),
+
+		loginGuard: lockout.NewGuard(lockoutPolicy(cfg.Auth.Lockout)),
+
+		mfaChallenges: make(map[string]*mfaChallenge),
+	}
+}
+
+// onConfigChange 配置变化后更新依赖配置的组件，通过接口修改和配置文件重新加载都会触发
+func (h *Handlers) onConfigChange(old, current *config.Config) {
+	if old.Logging.Level != current.Logging.Level {
+		h.logger.SetLevel(current.Logging.Level)
+	}
+	if old.Logging.MaxLogEntries != current.Logging.MaxLogEntries {
+		h.logger.SetMaxSize(current.Logging.MaxLogEntries)
+	}
+	if old.Auth.Lockout != current.Auth.Lockout {
+		h.loginGuard.SetPolicy(lockoutPolicy(current.Auth.Lockout))
+	}
+
+	// 更换 JWT 密钥后旧令牌无法再验证，同时撤销所有会话，让刷新令牌也一并失效
+	if old.Auth.JWTSecret != current.Auth.JWTSecret {
+		h.jwtManager.SetSecretKey(current.Auth.JWTSecret)
+		sessionService := &database.SessionService{}
+		revoked, err := sessionService.RevokeAll()
+		if err != nil {
+			h.logger.Log("error", "撤销会话失败", gin.H{"error": err.Error()})
+		}
+		h.logger.Log("warning", "JWT 密钥已更换，所有会话已失效", gin.H{"revoked": revoked})
 	}
 }
 
@@ -90,9 +144,10 @@ func (h *Handlers) Error(c *gin.Context, status int, err string, message ...stri
 }
 
 // Init 初始化路由
-func Init(r *gin.Engine, cfg *config.Config, wsManager *websocket.Manager, staticFS ...embed.FS) {
-	h := NewHandlers(cfg, wsManager, staticFS...)
-	wsManager.SetConfig(cfg)
+func Init(r *gin.Engine, store *config.Store, wsManager *websocket.Manager, staticFS ...embed.FS) {
+	h := NewHandlers(store, wsManager, staticFS...)
+	wsManager.SetConfig(store.Config())
+	store.Subscribe(h.onConfigChange)
 
 	// 应用域名绑定中间件 (如果启用)
 	r.Use(h.DomainMiddleware())
@@ -177,8 +232,19 @@ func Init(r *gin.Engine, cfg *config.Config, wsManager *websocket.Manager, stati
 		auth := api.Group("/auth")
 		{
 			auth.POST("/login", h.Login)
+			auth.POST("/mfa", h.VerifyMFA)
+			auth.POST("/refresh", h.RefreshToken)
 			auth.POST("/logout", h.AuthMiddleware(), h.Logout)
 			auth.GET("/verify", h.AuthMiddleware(), h.VerifyToken)
+			auth.PUT("/password", h.AuthMiddleware(), h.ChangePassword)
+			auth.GET("/sessions", h.AuthMiddleware(), h.GetMySessions)
+			auth.DELETE("/sessions", h.AuthMiddleware(), h.RevokeMySessions)
+			auth.DELETE("/sessions/:id", h.AuthMiddleware(), h.RevokeMySession)
+			auth.GET("/totp", h.AuthMiddleware(), h.GetTOTPStatus)
+			auth.POST("/totp/setup", h.AuthMiddleware(), h.SetupTOTP)
+			auth.POST("/totp/enable", h.AuthMiddleware(), h.EnableTOTP)
+			auth.POST("/totp/disable", h.AuthMiddleware(), h.DisableTOTP)
+			auth.POST("/totp/recovery-codes", h.AuthMiddleware(), h.RegenerateRecoveryCodes)
 		}
 
 		// 需要认证的路由
@@ -210,6 +276,7 @@ func Init(r *gin.Engine, cfg *config.Config, wsManager *websocket.Manager, stati
 			// 配置管理
 			authenticated.GET("/config", h.GetConfig)
 			authenticated.PUT("/config", h.UpdateConfig)
+			authenticated.GET("/config/sources", h.GetConfigSources)
 			authenticated.GET("/config/websocket", h.GetWebSocketConfig)
 			authenticated.PUT("/config/websocket", h.UpdateWebSocketConfig)
 			authenticated.GET("/config/system", h.GetSystemConfig)
@@ -217,18 +284,55 @@ func Init(r *gin.Engine, cfg *config.Config, wsManager *websocket.Manager, stati
 			authenticated.GET("/config/system/schema", h.GetSystemConfigSchema)
 			authenticated.POST("/config/system/initialize", h.InitializeSystemConfig)
 			authenticated.DELETE("/config/system/:key", h.ResetSystemConfig)
+			authenticated.GET("/config/revisions", h.GetConfigRevisions)
+			authenticated.GET("/config/revisions/:id", h.GetConfigRevision)
+			authenticated.GET("/config/revisions/:id/diff", h.DiffConfigRevisions)
+			authenticated.POST("/config/revisions/:id/rollback", h.RollbackConfig)
 
 			// 仪表盘统计
 			authenticated.GET("/dashboard/stats", h.GetDashboardStats)
+			authenticated.GET("/traffic/history", h.GetTrafficHistory)
+
+			// 用户管理
+			authenticated.GET("/users", h.GetUsers)
+			authenticated.POST("/users", h.CreateUser)
+			authenticated.PUT("/users/:id", h.UpdateUser)
+			authenticated.DELETE("/users/:id", h.DeleteUser)
+			authenticated.DELETE("/users/:id/sessions", h.RevokeUserSessions)
+			authenticated.DELETE("/users/:id/totp", h.ResetUserTOTP)
+
+			// API Key 管理
+			authenticated.GET("/apikeys", h.GetAPIKeys)
+			authenticated.POST("/apikeys", h.CreateAPIKey)
+			authenticated.DELETE("/apikeys/:id", h.RevokeAPIKey)
+
+			// 审计记录
+			authenticated.GET("/audit", h.GetAuditLogs)
+			authenticated.GET("/audit/export", h.ExportAuditLogs)
+
+			// 会话管理
+			authenticated.GET("/sessions", h.GetSessions)
+			authenticated.DELETE("/sessions/:id", h.RevokeSession)
+
+			// 登录锁定管理
+			authenticated.GET("/lockouts", h.GetLockouts)
+			authenticated.DELETE("/lockouts", h.ClearLockout)
 		}
 
-		// Webhook端点（不需要认证）
+		// Webhook端点（不需要认证，通过 AppID 查找密钥）
 		api.POST("/webhook", h.Webhook)
+		api.POST("/webhook/:appid", h.Webhook)
+
+		// QQ OpenAPI 代理（通过路径中的密钥鉴权）
+		api.Any("/openapi/:secret/*path", h.OpenAPIProxy)
 	}
 
 	// 健康检查端点（不需要认证）
 	r.GET("/health", h.GetHealth)
 
+	// Prometheus 指标（按来源 IP 或 Bearer Token 限制访问）
+	h.registerMetrics(r)
+
 	// WebSocket端点
 	r.GET("/ws/:secret", h.WebSocketHandler)
 }
@@ -236,17 +340,18 @@ func Init(r *gin.Engine, cfg *config.Config, wsManager *websocket.Manager, stati
 // DomainMiddleware 域名检查中间件
 func (h *Handlers) DomainMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if h.config.Server.EnforceDomain && h.config.Server.Domain != "" {
+		server := h.config.GetServerConfig()
+		if server.EnforceDomain && server.Domain != "" {
 			host := c.Request.Host
 			// 移除端口号
 			if strings.Contains(host, ":") {
 				host = strings.Split(host, ":")[0]
 			}
 
-			if host != h.config.Server.Domain {
+			if host != server.Domain {
 				h.logger.Log("warning", "非法域名访问被拦截", gin.H{
 					"request_host": host,
-					"bound_domain": h.config.Server.Domain,
+					"bound_domain": server.Domain,
 					"path":         c.Request.URL.Path,
 				})
 				h.Error(c, http.StatusForbidden, "Access denied: domain mismatch")
@@ -261,6 +366,12 @@ func (h *Handlers) DomainMiddleware() gin.HandlerFunc {
 // AuthMiddleware 认证中间件
 func (h *Handlers) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// 自动化脚本使用 API Key 认证，不创建会话
+		if apiKey := c.GetHeader(apiKeyHeader); apiKey != "" {
+			h.authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		token := c.GetHeader("Authorization")
 		if token == "" {
 			h.Error(c, http.StatusUnauthorized, "Access token required")
@@ -280,6 +391,45 @@ func (h *Handlers) AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// 令牌对应的会话必须仍然有效，登出或撤销后立即失效
+		sessionService := &database.SessionService{}
+		session, err := sessionService.GetActiveSession(claims.ID)
+		if err != nil || session.Username != claims.Username {
+			h.Error(c, http.StatusUnauthorized, "Invalid or expired token")
+			c.Abort()
+			return
+		}
+
+		// 每次请求都读取用户的当前状态，禁用用户或调整角色后立即生效
+		userService := &database.UserService{}
+		user, err := userService.GetUser(claims.Username)
+		if err != nil || !user.Enabled {
+			h.Error(c, http.StatusUnauthorized, "Invalid or expired token")
+			c.Abort()
+			return
+		}
+		claims.Role = user.Role
+
+		permission, registered := requiredPermission(c.Request.Method, c.FullPath())
+		if !registered || !rbac.HasPermission(user.Role, permission) {
+			h.logger.Log("warning", "用户权限不足", gin.H{
+				"username":   user.Username,
+				"role":       user.Role,
+				"method":     c.Request.Method,
+				"path":       c.FullPath(),
+				"permission": permission,
+			})
+			h.Error(c, http.StatusForbidden, "权限不足")
+			c.Abort()
+			return
+		}
+
+		if time.Since(session.LastActiveAt) >= sessionTouchInterval || session.IP != c.ClientIP() {
+			if err := sessionService.Touch(session.SessionID, c.ClientIP()); err != nil {
+				h.logger.Log("warning", "更新会话活动时间失败", gin.H{"username": user.Username, "error": err.Error()})
+			}
+		}
+
 		c.Set("user", claims)
 		c.Next()
 	}
@@ -287,14 +437,15 @@ func (h *Handlers) AuthMiddleware() gin.HandlerFunc {
 
 // APIInfo API信息
 func (h *Handlers) APIInfo(c *gin.Context) {
+	security := h.config.GetSecurityConfig()
 	h.Success(c, gin.H{
 		"name":    "QQ Webhook Pro",
 		"msg":     "欢迎使用QQ机器人webhook服务",
 		"status":  "running",
 		"version": "2.0.0",
 		"config": gin.H{
-			"signature_validation": h.config.Security.EnableSignatureValidation,
-			"max_connections":      h.config.Security.MaxConnectionsPerSecret,
+			"signature_validation": security.EnableSignatureValidation,
+			"max_connections":      security.MaxConnectionsPerSecret,
 		},
 	})
 }
@@ -315,53 +466,44 @@ func (h *Handlers) ProxyCheck(c *gin.Context) {
 		"proto":           c.Request.Proto,
 		"request_uri":     c.Request.RequestURI,
 		"headers":         headers,
-		"trusted_proxies": h.config.Server.TrustedProxies,
+		"trusted_proxies": h.config.GetServerConfig().TrustedProxies,
 	})
 }
 
 // HealthCheck 健康检查
 func (h *Handlers) HealthCheck(c *gin.Context) {
-	// 获取系统信息
-	memStats := getMemoryStats()
-	cpuInfo := h.cpuMonitor.GetCpuInfo()
+	h.Success(c, h.healthResponse())
+}
+
+// healthResponse 根据系统监控器的快照生成健康检查响应，/health 与 /api/health 共用
+func (h *Handlers) healthResponse() models.HealthResponse {
+	stats := h.system.Snapshot()
 
 	response := models.HealthResponse{
-		Status:    "healthy",
-		Timestamp: time.Now(),
-		Uptime:    getUptime(),
-		Memory: struct {
-			HeapUsed     uint64 `json:"heap_used"`
-			HeapTotal    uint64 `json:"heap_total"`
-			HeapSys      uint64 `json:"heap_sys"`
-			HeapIdle     uint64 `json:"heap_idle"`
-			HeapInuse    uint64 `json:"heap_inuse"`
-			HeapReleased uint64 `json:"heap_released"`
-			HeapObjects  uint64 `json:"heap_objects"`
-		}{
-			HeapUsed:     memStats.Alloc,
-			HeapTotal:    memStats.TotalAlloc,
-			HeapSys:      memStats.Sys,
-			HeapIdle:     0, // 简化实现
-			HeapInuse:    memStats.Alloc,
-			HeapReleased: 0, // 简化实现
-			HeapObjects:  uint64(memStats.NumGC),
-		},
-		CPU: struct {
-			Usage int    `json:"usage"`
-			Cores int    `json:"cores"`
-			Model string `json:"model"`
-			Speed int    `json:"speed"`
-		}{
-			Usage: int(cpuInfo.Usage),
-			Cores: cpuInfo.Cores,
-			Model: cpuInfo.Model,
-			Speed: int(cpuInfo.Speed),
-		},
+		Status:      "healthy",
+		Timestamp:   time.Now(),
+		Uptime:      stats.Uptime,
 		Connections: h.wsManager.GetConnectionCount(),
-		LoadAverage: getLoadAverage(),
+		LoadAverage: stats.LoadAverage,
+		Version:     "2.0.0",
 	}
 
-	h.Success(c, response)
+	response.Memory.HeapUsed = stats.Memory.Alloc
+	response.Memory.HeapTotal = stats.Memory.TotalAlloc
+	response.Memory.HeapSys = stats.Memory.Sys
+	response.Memory.HeapIdle = stats.Memory.HeapIdle
+	response.Memory.HeapInuse = stats.Memory.HeapInuse
+	response.Memory.HeapReleased = stats.Memory.HeapReleased
+	response.Memory.HeapObjects = stats.Memory.HeapObjects
+	response.Memory.RSS = stats.RSS
+
+	response.CPU.Usage = int(stats.CPU.Usage)
+	response.CPU.ProcessUsage = int(stats.CPU.ProcessUsage)
+	response.CPU.Cores = stats.CPU.Cores
+	response.CPU.Model = stats.CPU.Model
+	response.CPU.Speed = int(stats.CPU.Speed)
+
+	return response
 }
 
 // Login 登录
@@ -375,53 +517,89 @@ func (h *Handlers) Login(c *gin.Context) {
 		return
 	}
 
+	// 失败次数过多时拒绝尝试，不再校验密码
+	keys := loginKeys(c.ClientIP(), req.Username)
+	if !h.checkLoginAllowed(c, keys) {
+		return
+	}
+
 	// 验证用户名和密码
-	if req.Username != h.config.Auth.Username {
-		h.logger.Log("warning", "用户登录失败", gin.H{"username": req.Username, "reason": "invalid_username"})
-		h.Error(c, http.StatusUnauthorized, "用户名或密码错误")
+	userService := &database.UserService{}
+	user, err := userService.GetUser(req.Username)
+	if err != nil {
+		// 用户不存在时同样执行一次哈希比较，避免通过响应时间判断用户名是否存在
+		utils.CheckPasswordHash(req.Password, dummyPasswordHash)
+		h.loginFailed(c, req.Username, "invalid_username", keys)
 		return
 	}
 
-	// 检查密码 - 支持明文和哈希密码
-	var passwordValid bool
-	if strings.HasPrefix(h.config.Auth.Password, "$2") {
-		passwordValid = utils.CheckPasswordHash(req.Password, h.config.Auth.Password)
-	} else {
-		passwordValid = req.Password == h.config.Auth.Password
+	if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+		h.loginFailed(c, req.Username, "invalid_password", keys)
+		return
 	}
 
-	if !passwordValid {
-		h.logger.Log("warning", "用户登录失败", gin.H{"username": req.Username, "reason": "invalid_password"})
-		h.Error(c, http.StatusUnauthorized, "用户名或密码错误")
+	if !user.Enabled {
+		metrics.ObserveLoginFailure("disabled")
+		h.logger.Log("warning", "用户登录失败", gin.H{"username": req.Username, "reason": "disabled"})
+		h.recordAudit(user.Username, c.ClientIP(), audit.ActionAuthLogin, user.Username, nil, nil, errors.New("disabled"))
+		h.Error(c, http.StatusForbidden, "账号已被禁用")
 		return
 	}
 
-	// 生成JWT令牌
-	timeout := time.Duration(h.config.Auth.SessionTimeout) * time.Second
-	if timeout <= 0 {
-		timeout = 24 * time.Hour
+	// 启用两步验证的账号需要再提交验证码，此时不签发令牌
+	if user.TOTPEnabled {
+		mfaToken, err := h.createMFAChallenge(user)
+		if err != nil {
+			h.logger.Log("error", "创建两步验证质询失败", gin.H{"username": user.Username, "error": err.Error()})
+			h.Error(c, http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		h.Success(c, models.LoginResponse{
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			Message:     "请输入两步验证码",
+		})
+		return
 	}
-	token, err := h.jwtManager.GenerateToken(req.Username, timeout)
+
+	h.completeLogin(c, user)
+}
+
+// completeLogin 完成身份验证后创建会话并返回令牌
+func (h *Handlers) completeLogin(c *gin.Context, user *database.User) {
+	h.loginGuard.Reset(lockout.Key{Scope: lockout.ScopeUsername, Value: user.Username})
+
+	// 创建会话并签发访问令牌和刷新令牌
+	response, err := h.issueSession(c, user)
 	if err != nil {
-		h.logger.Log("error", "生成JWT令牌失败", err)
+		h.logger.Log("error", "创建会话失败", gin.H{"username": user.Username, "error": err.Error()})
 		h.Error(c, http.StatusInternalServerError, "服务器错误")
 		return
 	}
 
-	h.logger.Log("info", "用户登录成功", gin.H{"username": req.Username})
+	userService := &database.UserService{}
+	if err := userService.RecordLogin(user.ID); err != nil {
+		h.logger.Log("warning", "记录登录时间失败", gin.H{"username": user.Username, "error": err.Error()})
+	}
 
-	h.Success(c, models.LoginResponse{
-		Success: true,
-		Token:   token,
-		Message: "登录成功",
-	})
+	h.recordAudit(user.Username, c.ClientIP(), audit.ActionAuthLogin, user.Username, nil, nil, nil)
+	h.logger.Log("info", "用户登录成功", gin.H{"username": user.Username, "role": user.Role, "ip": c.ClientIP()})
+
+	response.Message = "登录成功"
+	h.Success(c, response)
 }
 
-// Logout 登出
+// Logout 登出，撤销当前会话
 func (h *Handlers) Logout(c *gin.Context) {
 	user, exists := c.Get("user")
 	if exists {
 		claims := user.(*utils.Claims)
+		sessionService := &database.SessionService{}
+		if _, err := sessionService.RevokeSession(claims.ID); err != nil {
+			h.logger.Log("error", "撤销会话失败", gin.H{"username": claims.Username, "error": err.Error()})
+			h.Error(c, http.StatusInternalServerError, "登出失败")
+			return
+		}
 		h.logger.Log("info", "用户登出", gin.H{"username": claims.Username})
 	}
 
@@ -438,21 +616,62 @@ func (h *Handlers) VerifyToken(c *gin.Context) {
 	claims := user.(*utils.Claims)
 
 	h.Success(c, gin.H{
-		"valid": true,
-		"user":  claims,
+		"valid":       true,
+		"user":        claims,
+		"permissions": rbac.Permissions(claims.Role),
 	})
 }
 
+// resolveWebhookSecret 解析 Webhook 请求对应的密钥
+// 优先根据路径 /api/webhook/:appid 或 X-Bot-Appid 请求头中的 AppID 查找密钥，
+// 启用 security.allow_secret_query 时兼容旧版的 ?secret= 查询参数
+func (h *Handlers) resolveWebhookSecret(c *gin.Context) (secret string, status int, message string) {
+	appID := c.Param("appid")
+	if appID == "" {
+		appID = c.GetHeader("X-Bot-Appid")
+	}
+	if secret, exists := h.config.FindSecretByAppID(appID); exists {
+		return secret, 0, ""
+	}
+
+	if querySecret := c.Query("secret"); querySecret != "" {
+		if !h.config.GetSecurityConfig().AllowSecretQuery {
+			return "", http.StatusBadRequest, "Secret query parameter is disabled, use /api/webhook/:appid or X-Bot-Appid"
+		}
+		return querySecret, 0, ""
+	}
+
+	if appID != "" {
+		return "", http.StatusNotFound, "Unknown AppID"
+	}
+	return "", http.StatusBadRequest, "AppID required"
+}
+
 // Webhook Webhook处理
 func (h *Handlers) Webhook(c *gin.Context) {
-	secret := c.Query("secret")
-	if secret == "" {
-		h.logger.Log("error", "Webhook请求缺少secret参数", nil)
-		c.JSON(http.StatusBadRequest, models.APIResponse{
-			Error: "Secret required",
+	secret, status, message := h.resolveWebhookSecret(c)
+	bodySize := 0
+	defer func() {
+		// 只按已配置的密钥记录，无法确定或不存在的密钥（如查询参数中的任意值）统一记为 unknown，避免产生大量标签
+		observed := ""
+		if _, exists := h.config.GetSecretConfig(secret); exists {
+			observed = secret
+		}
+		metrics.ObserveWebhook(observed, c.Writer.Status(), bodySize)
+	}()
+	if status != 0 {
+		h.logger.Log("error", "Webhook请求无法确定密钥", gin.H{
+			"app_id":    c.Param("appid"),
+			"header":    c.GetHeader("X-Bot-Appid"),
+			"client_ip": c.ClientIP(),
+			"error":     message,
+		})
+		c.JSON(status, models.APIResponse{
+			Error: message,
 		})
 		return
 	}
+	masked := utils.MaskSecret(secret)
 
 	// 读取原始 Body 以实现原样转发
 	bodyBytes, err := io.ReadAll(c.Request.Body)
@@ -463,6 +682,7 @@ func (h *Handlers) Webhook(c *gin.Context) {
 		})
 		return
 	}
+	bodySize = len(bodyBytes)
 
 	// 尝试解析为 JSON 结构以便日志记录和转发
 	var payload interface{}
@@ -471,23 +691,25 @@ func (h *Handlers) Webhook(c *gin.Context) {
 		payload = string(bodyBytes)
 	}
 
+	security := h.config.GetSecurityConfig()
+
 	// 尝试解析为签名校验请求
 	var req models.WebhookRequest
 	if err := json.Unmarshal(bodyBytes, &req); err == nil && req.D.EventTs != "" && req.D.PlainToken != "" {
-		h.logger.Log("info", "收到签名校验请求", gin.H{"secret": secret, "payload": payload})
+		h.logger.Log("info", "收到签名校验请求", gin.H{"secret": masked, "payload": payload})
 
-		if h.config.Security.EnableSignatureValidation {
+		if security.EnableSignatureValidation {
 			result, err := h.signer.GenerateSignature(secret, req.D.EventTs, req.D.PlainToken)
 			if err != nil {
-				h.logger.Log("error", "签名校验失败", gin.H{"secret": secret, "error": err, "payload": payload})
+				h.logger.Log("error", "签名校验失败", gin.H{"secret": masked, "error": err, "payload": payload})
 				h.Error(c, http.StatusBadRequest, "Signature validation failed")
 				return
 			}
 
-			h.logger.Log("info", "签名校验成功", gin.H{"secret": secret})
+			h.logger.Log("info", "签名校验成功", gin.H{"secret": masked})
 
 			// 自动添加密钥（如果启用）
-			if !h.config.Security.RequireManualKeyManagement {
+			if !security.RequireManualKeyManagement {
 				h.autoAddSecret(secret, "自动生成的密钥（签名验证通过）")
 			}
 
@@ -495,10 +717,10 @@ func (h *Handlers) Webhook(c *gin.Context) {
 			c.JSON(http.StatusOK, result)
 			return
 		} else {
-			h.logger.Log("warning", "签名验证已禁用，允许连接", gin.H{"secret": secret})
+			h.logger.Log("warning", "签名验证已禁用，允许连接", gin.H{"secret": masked})
 
 			// 如果启用自动模式且密钥不存在，自动添加
-			if !h.config.Security.RequireManualKeyManagement {
+			if !security.RequireManualKeyManagement {
 				h.autoAddSecret(secret, "自动生成的密钥（签名验证已禁用）")
 			}
 
@@ -512,45 +734,161 @@ func (h *Handlers) Webhook(c *gin.Context) {
 
 	// 检查密钥是否被允许连接
 	if !h.config.IsSecretEnabled(secret) {
-		h.logger.Log("warning", "密钥被禁用或不存在", gin.H{"secret": secret})
+		h.logger.Log("warning", "密钥被禁用或不存在", gin.H{"secret": masked})
 		h.Error(c, http.StatusForbidden, "Secret disabled or not found")
 		return
 	}
 
-	// 处理普通消息
-	h.logger.Log("info", "收到Webhook消息", gin.H{"secret": secret, "payload": payload})
+	// 校验事件签名，防止伪造事件注入
+	if security.EnableSignatureValidation {
+		signature := c.GetHeader("X-Signature-Ed25519")
+		timestamp := c.GetHeader("X-Signature-Timestamp")
+		// 先检查时间戳，截获的推送在时间窗口之外重放时签名虽然有效也会被拒绝
+		maxSkew := time.Duration(security.SignatureMaxSkew) * time.Second
+		if timestamp != "" && !utils.VerifyTimestamp(timestamp, time.Now(), maxSkew) {
+			failures := h.recordSignatureFailure(secret)
+			h.logger.Log("warning", "Webhook时间戳超出允许范围，已拒绝", gin.H{
+				"secret":    masked,
+				"client_ip": c.ClientIP(),
+				"timestamp": timestamp,
+				"max_skew":  security.SignatureMaxSkew,
+				"failures":  failures,
+			})
+			h.Error(c, http.StatusUnauthorized, "Stale or invalid timestamp")
+			return
+		}
+		if !h.signer.VerifyWebhook(secret, timestamp, bodyBytes, signature) {
+			failures := h.recordSignatureFailure(secret)
+			h.logger.Log("warning", "Webhook签名校验失败，已拒绝", gin.H{
+				"secret":        masked,
+				"client_ip":     c.ClientIP(),
+				"has_signature": signature != "",
+				"has_timestamp": timestamp != "",
+				"failures":      failures,
+			})
+			h.Error(c, http.StatusUnauthorized, "Invalid signature")
+			return
+		}
+	}
 
-	// 发送到WebSocket连接
-	err = h.wsManager.SendTextMessage(secret, string(bodyBytes))
+	// 处理普通消息
+	h.logger.Log("info", "收到Webhook消息", gin.H{"secret": masked, "payload": payload})
+	traffic.RecordWebhook(secret, bodySize)
+
+	// 发送到WebSocket连接，连接不可用时写入离线队列
+	start := time.Now()
+	queued, err := h.wsManager.DeliverText(secret, string(bodyBytes))
+	result := forwardResult(queued, err)
+	metrics.ObserveForward(secret, result, time.Since(start))
+	traffic.RecordResult(secret, result)
 	if err != nil {
-		// 即使连接不存在，也要记录并返回成功
-		// 可能客户端稍后会连接，消息可以在连接建立时补发
-		h.logger.Log("warning", "WebSocket连接暂不可用，消息可能未送达", gin.H{
-			"secret": secret,
+		if errors.Is(err, websocket.ErrQueueDisabled) {
+			// 离线队列已禁用，消息只能丢弃
+			h.logger.Log("warning", "WebSocket连接暂不可用且离线队列已禁用，消息已丢弃", gin.H{
+				"secret": masked,
+				"size":   len(bodyBytes),
+			})
+			c.JSON(http.StatusAccepted, models.APIResponse{
+				Success: true,
+				Data: gin.H{
+					"status":  "dropped",
+					"message": "WebSocket连接暂不可用，离线队列未启用",
+					"secret":  masked,
+				},
+				Message: "消息未转发",
+			})
+			return
+		}
+
+		if errors.Is(err, websocket.ErrNotDispatch) {
+			// QQ 网关协议的连接只能下发 Dispatch 事件，重试也无法投递
+			h.logger.Log("warning", "消息不是 Dispatch 事件，QQ 网关协议的连接无法下发，消息已丢弃", gin.H{
+				"secret": masked,
+				"size":   len(bodyBytes),
+			})
+			c.JSON(http.StatusAccepted, models.APIResponse{
+				Success: true,
+				Data: gin.H{
+					"status":  "dropped",
+					"message": "QQ 网关协议的连接只接收 Dispatch 事件",
+					"secret":  masked,
+				},
+				Message: "消息未转发",
+			})
+			return
+		}
+
+		// 写入离线队列失败，返回错误让 QQ 重试
+		h.logger.Log("error", "离线消息写入失败", gin.H{
+			"secret": masked,
 			"error":  err.Error(),
 			"size":   len(bodyBytes),
 		})
+		h.Error(c, http.StatusServiceUnavailable, "Failed to queue message")
+		return
+	}
+
+	if queued {
+		h.logger.Log("warning", "WebSocket连接暂不可用，消息已进入离线队列", gin.H{
+			"secret": masked,
+			"size":   len(bodyBytes),
+		})
 		// 返回202 Accepted 而不是成功，表示已接收但未立即处理
 		c.JSON(http.StatusAccepted, models.APIResponse{
 			Success: true,
 			Data: gin.H{
 				"status":  "queued",
-				"message": "消息已接收，WebSocket连接暂不可用",
-				"secret":  secret,
+				"message": "消息已进入离线队列，将在客户端连接后补发",
+				"secret":  masked,
 			},
 			Message: "消息待转发",
 		})
 		return
 	}
 
-	h.logger.Log("info", "消息推送成功", gin.H{"secret": secret, "payload": payload})
+	h.logger.Log("info", "消息推送成功", gin.H{"secret": masked, "payload": payload})
 	h.config.MarkSecretUsed(secret)
 	h.Success(c, gin.H{
 		"status": "success",
-		"secret": secret,
+		"secret": masked,
 	})
 }
 
+// forwardResult 投递结果，用于投递耗时指标和流量统计
+func forwardResult(queued bool, err error) string {
+	switch {
+	case errors.Is(err, websocket.ErrQueueDisabled), errors.Is(err, websocket.ErrNotDispatch):
+		return traffic.ResultDropped
+	case err != nil:
+		return traffic.ResultFailed
+	case queued:
+		return traffic.ResultQueued
+	}
+	return traffic.ResultDelivered
+}
+
+// recordSignatureFailure 记录签名校验失败，返回该密钥的累计失败次数
+func (h *Handlers) recordSignatureFailure(secret string) int64 {
+	h.sigFailuresMu.Lock()
+	defer h.sigFailuresMu.Unlock()
+	h.sigFailures[secret]++
+	metrics.ObserveSignatureFailure(secret)
+	traffic.RecordError(secret)
+	return h.sigFailures[secret]
+}
+
+// getSignatureFailures 获取各密钥签名校验失败次数的副本
+func (h *Handlers) getSignatureFailures() map[string]int64 {
+	h.sigFailuresMu.RLock()
+	defer h.sigFailuresMu.RUnlock()
+
+	failures := make(map[string]int64, len(h.sigFailures))
+	for secret, count := range h.sigFailures {
+		failures[secret] = count
+	}
+	return failures
+}
+
 // autoAddSecret 自动添加密钥
 func (h *Handlers) autoAddSecret(secret, description string) {
 	// 检查密钥是否已存在于数据库
@@ -563,14 +901,14 @@ func (h *Handlers) autoAddSecret(secret, description string) {
 			Name:           "",
 			Description:    description,
 			Enabled:        true,
-			MaxConnections: h.config.Security.MaxConnectionsPerSecret,
+			MaxConnections: h.config.GetSecurityConfig().MaxConnectionsPerSecret,
 			CreatedBy:      "system",
 		}
 
 		if err := secretService.CreateSecret(secretRecord); err != nil {
-			h.logger.Log("error", "自动添加密钥到数据库失败", gin.H{"secret": secret, "error": err.Error()})
+			h.logger.Log("error", "自动添加密钥到数据库失败", gin.H{"secret": utils.MaskSecret(secret), "error": err.Error()})
 		} else {
-			h.logger.Log("info", "自动添加密钥到数据库成功", gin.H{"secret": secret})
+			h.logger.Log("info", "自动添加密钥到数据库成功", gin.H{"secret": utils.MaskSecret(secret)})
 		}
 	}
 
@@ -578,7 +916,7 @@ func (h *Handlers) autoAddSecret(secret, description string) {
 	h.config.AddSecret(secret, config.SecretConfig{
 		Description:    description,
 		Enabled:        true,
-		MaxConnections: h.config.Security.MaxConnectionsPerSecret,
+		MaxConnections: h.config.GetSecurityConfig().MaxConnectionsPerSecret,
 	})
 
 	// 广播密钥更新事件到管理界面
@@ -592,7 +930,7 @@ func (h *Handlers) broadcastSecretUpdate(eventType, secret string) {
 		Type: "admin_notification",
 		Data: map[string]interface{}{
 			"event_type": eventType,
-			"secret":     secret,
+			"secret":     utils.MaskSecret(secret),
 			"timestamp":  time.Now().Format(time.RFC3339),
 		},
 	}
@@ -601,7 +939,7 @@ func (h *Handlers) broadcastSecretUpdate(eventType, secret string) {
 	// 暂时记录日志和消息，后续可以扩展实现
 	h.logger.Log("info", "密钥更新事件", map[string]interface{}{
 		"event_type": eventType,
-		"secret":     secret,
+		"secret":     utils.MaskSecret(secret),
 		"message":    message,
 	})
 }
@@ -609,7 +947,8 @@ func (h *Handlers) broadcastSecretUpdate(eventType, secret string) {
 // WebSocketHandler WebSocket处理器
 func (h *Handlers) WebSocketHandler(c *gin.Context) {
 	secret := c.Param("secret")
-	h.logger.Log("info", "收到 WebSocket 连接请求", gin.H{"secret": secret})
+	masked := utils.MaskSecret(secret)
+	h.logger.Log("info", "收到 WebSocket 连接请求", gin.H{"secret": masked})
 
 	if secret == "" {
 		h.logger.Log("error", "WebSocket连接缺少密钥", nil)
@@ -619,28 +958,29 @@ func (h *Handlers) WebSocketHandler(c *gin.Context) {
 
 	// 检查密钥是否被允许连接 (包含是否存在和是否启用的逻辑)
 	enabled := h.config.IsSecretEnabled(secret)
-	h.logger.Log("debug", "检查密钥启用状态", gin.H{"secret": secret, "enabled": enabled})
+	h.logger.Log("debug", "检查密钥启用状态", gin.H{"secret": masked, "enabled": enabled})
 
 	if !enabled {
-		h.logger.Log("warning", "WebSocket连接被拒绝：密钥不存在或被禁用", gin.H{"secret": secret})
+		h.logger.Log("warning", "WebSocket连接被拒绝：密钥不存在或被禁用", gin.H{"secret": masked})
 		c.Abort()
 		return
 	}
 
 	// 升级为WebSocket连接
+	ws := h.config.GetWebSocketConfig()
 	h.logger.Log("debug", "正在升级 WebSocket 连接", gin.H{
-		"secret":         secret,
-		"maxMessageSize": h.config.WebSocket.MaxMessageSize,
-		"readTimeout":    h.config.WebSocket.ReadTimeout,
-		"writeTimeout":   h.config.WebSocket.WriteTimeout,
+		"secret":         masked,
+		"maxMessageSize": ws.MaxMessageSize,
+		"readTimeout":    ws.ReadTimeout,
+		"writeTimeout":   ws.WriteTimeout,
 	})
 
 	// 确保缓冲区大小不为 0
-	readBufferSize := h.config.WebSocket.MaxMessageSize
+	readBufferSize := ws.MaxMessageSize
 	if readBufferSize <= 0 {
 		readBufferSize = 4096 // 默认 4KB
 	}
-	writeBufferSize := h.config.WebSocket.MaxMessageSize
+	writeBufferSize := ws.MaxMessageSize
 	if writeBufferSize <= 0 {
 		writeBufferSize = 4096 // 默认 4KB
 	}
@@ -655,77 +995,71 @@ func (h *Handlers) WebSocketHandler(c *gin.Context) {
 
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		h.logger.Log("error", "WebSocket升级失败", gin.H{"secret": secret, "error": err.Error()})
+		h.logger.Log("error", "WebSocket升级失败", gin.H{"secret": masked, "error": err.Error()})
 		return
 	}
-	h.logger.Log("info", "WebSocket 升级成功", gin.H{"secret": secret})
+	h.logger.Log("info", "WebSocket 升级成功", gin.H{"secret": masked})
 	defer conn.Close()
 
-	// 设置读写超时
-	readTimeout := time.Duration(h.config.WebSocket.ReadTimeout) * time.Millisecond
-	if readTimeout <= 0 {
-		readTimeout = 60 * time.Second // 默认 60s
-	}
-
-	// 为了处理心跳，需要调整读超时
-	// 实际读超时应该比心跳间隔更长，以避免在心跳到达之前超时
-	heartbeatInterval := time.Duration(h.config.WebSocket.HeartbeatInterval) * time.Millisecond
-	if heartbeatInterval <= 0 {
-		heartbeatInterval = 30 * time.Second
-	}
+	// 按当前配置设置读超时和消息大小限制，注册到管理器后改由客户端按最新配置维护
+	protocol := h.resolveProtocol(c, secret)
+	settings := h.wsManager.Settings(protocol)
+	h.logger.Log("debug", "WebSocket 连接设置", gin.H{"secret": masked, "protocol": protocol, "settings": settings.Model()})
 
-	// 读超时应该至少是心跳间隔的 2 倍
-	effectiveReadTimeout := readTimeout
-	if h.config.WebSocket.EnableHeartbeat && heartbeatInterval > 0 {
-		minTimeout := heartbeatInterval * 2
-		if effectiveReadTimeout < minTimeout {
-			effectiveReadTimeout = minTimeout
-			h.logger.Log("info", "调整读超时以适应心跳", gin.H{
-				"heartbeat_interval": heartbeatInterval,
-				"effective_timeout":  effectiveReadTimeout,
-			})
-		}
-	}
-
-	conn.SetReadDeadline(time.Now().Add(effectiveReadTimeout))
+	conn.SetReadLimit(settings.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(settings.ReadTimeout))
 
 	// 设置 Pong 处理器，收到 Pong 时重置读超时
 	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(effectiveReadTimeout))
+		conn.SetReadDeadline(time.Now().Add(settings.ReadTimeout))
 		return nil
 	})
 
-	if h.config.WebSocket.WriteTimeout > 0 {
-		conn.SetWriteDeadline(time.Now().Add(time.Duration(h.config.WebSocket.WriteTimeout) * time.Millisecond))
+	// QQ 官方网关协议由网关会话处理
+	if protocol == config.ProtocolQQ {
+		h.serveGateway(secret, conn, settings)
+		return
 	}
 
-	// 添加到连接管理器
-	h.logger.Log("debug", "正在将连接添加到管理器", gin.H{"secret": secret})
-	if err := h.wsManager.AddConnection(secret, conn); err != nil {
-		h.logger.Log("error", "添加WebSocket连接失败", gin.H{"secret": secret, "error": err.Error()})
+	// 添加到连接管理器（写超时由客户端在每次写入时单独设置）
+	h.logger.Log("debug", "正在将连接添加到管理器", gin.H{"secret": masked, "protocol": protocol})
+	var client *websocket.Client
+	if protocol == config.ProtocolBridge {
+		client, err = h.addBridgeConnection(c, secret, conn)
+	} else {
+		client, err = h.wsManager.AddConnection(secret, conn)
+	}
+	if err != nil {
+		h.logger.Log("warning", "添加WebSocket连接失败", gin.H{"secret": masked, "error": err.Error()})
+		if errors.Is(err, websocket.ErrMaxConnectionsReached) {
+			conn.WriteControl(gorilla.CloseMessage,
+				gorilla.FormatCloseMessage(gorilla.CloseTryAgainLater, "已达到该密钥的最大连接数"),
+				time.Now().Add(time.Second))
+		}
 		return
 	}
-	h.logger.Log("info", "WebSocket 连接已成功注册到管理器", gin.H{"secret": secret})
+	h.logger.Log("info", "WebSocket 连接已成功注册到管理器", gin.H{"secret": masked, "client_id": client.ID})
 	defer func() {
-		h.logger.Log("info", "正在从管理器移除 WebSocket 连接", gin.H{"secret": secret})
-		h.wsManager.RemoveConnection(secret)
+		h.logger.Log("info", "正在从管理器移除 WebSocket 连接", gin.H{"secret": masked, "client_id": client.ID})
+		h.wsManager.RemoveClient(client)
 	}()
 
 	// 处理WebSocket消息
 	for {
-		// 读取消息前重置读超时
-		conn.SetReadDeadline(time.Now().Add(effectiveReadTimeout))
+		// 读取消息前按当前配置重置读超时和消息大小限制
+		client.PrepareRead()
 
 		// 读取消息类型
 		messageType, data, err := conn.ReadMessage()
 		if err != nil {
 			if gorilla.IsUnexpectedCloseError(err, gorilla.CloseGoingAway, gorilla.CloseAbnormalClosure) {
-				h.logger.Log("error", "WebSocket读取错误", gin.H{"secret": secret, "error": err.Error()})
+				h.logger.Log("error", "WebSocket读取错误", gin.H{"secret": masked, "error": err.Error()})
 			} else {
-				h.logger.Log("info", "WebSocket 连接正常关闭", gin.H{"secret": secret, "error": err.Error()})
+				h.logger.Log("info", "WebSocket 连接正常关闭", gin.H{"secret": masked, "error": err.Error()})
 			}
 			break
 		}
+		metrics.ObserveMessage(secret, metrics.DirectionIn, len(data))
 
 		// 根据消息类型处理
 		switch messageType {
@@ -739,11 +1073,11 @@ func (h *Handlers) WebSocketHandler(c *gin.Context) {
 					Data:   string(data),
 					Format: models.MessageFormatText,
 				}
-				h.logger.Log("info", "收到文本消息", gin.H{"secret": secret, "text": string(data)})
+				h.logger.Log("info", "收到文本消息", gin.H{"secret": masked, "text": string(data)})
 			} else {
 				// 成功解析为JSON
 				msg.Format = models.MessageFormatJSON
-				h.logger.Log("info", "收到JSON消息", gin.H{"secret": secret, "data": msg})
+				h.logger.Log("info", "收到JSON消息", gin.H{"secret": masked, "data": msg})
 			}
 
 			// 处理心跳消息
@@ -753,24 +1087,45 @@ func (h *Handlers) WebSocketHandler(c *gin.Context) {
 					Data:   gin.H{"timestamp": time.Now().Unix()},
 					Format: models.MessageFormatJSON,
 				}
-				// 使用管理器的方法发送，确保写锁安全
-				h.wsManager.SendMessage(secret, pongMsg)
-				h.logger.Log("debug", "回复客户端心跳", gin.H{"secret": secret})
+				// 仅回复发送心跳的客户端，使用客户端的方法发送，确保写锁安全
+				client.SendMessage(pongMsg)
+				h.logger.Log("debug", "回复客户端心跳", gin.H{"secret": masked})
+			}
+
+			// bridge 协议的事件确认
+			if msg.Type == "ack" {
+				if session := client.BridgeSession(); session != nil {
+					session.Ack(msg.Seq)
+					h.logger.Log("debug", "客户端确认事件", gin.H{"secret": masked, "session_id": session.ID, "seq": msg.Seq})
+				}
+			}
+
+			// 通过连接发起的 OpenAPI 请求
+			if msg.Type == "openapi_request" {
+				go h.handleOpenAPIFrame(client, msg)
+			}
+
+			// 按密钥配置将 JSON 消息转发到上游 HTTP 服务，响应异步返回给该客户端
+			if msg.Format == models.MessageFormatJSON {
+				if target := h.upstreamTarget(secret, msg.Type); target != "" {
+					go h.forwardUpstream(client, target, msg, data)
+				}
 			}
 
 		case gorilla.BinaryMessage:
 			// 检查是否启用二进制消息
-			if !h.config.WebSocket.EnableBinaryMessages {
-				h.logger.Log("warning", "二进制消息被拒绝：未启用", gin.H{"secret": secret})
+			current := h.config.GetWebSocketConfig()
+			if !current.EnableBinaryMessages {
+				h.logger.Log("warning", "二进制消息被拒绝：未启用", gin.H{"secret": masked})
 				continue
 			}
 
 			// 检查二进制消息大小
-			if h.config.WebSocket.MaxBinarySize > 0 && len(data) > h.config.WebSocket.MaxBinarySize {
+			if current.MaxBinarySize > 0 && len(data) > current.MaxBinarySize {
 				h.logger.Log("warning", "二进制消息被拒绝：超过最大大小", gin.H{
-					"secret":  secret,
+					"secret":  masked,
 					"size":    len(data),
-					"maxSize": h.config.WebSocket.MaxBinarySize,
+					"maxSize": current.MaxBinarySize,
 				})
 				continue
 			}
@@ -783,26 +1138,26 @@ func (h *Handlers) WebSocketHandler(c *gin.Context) {
 				Raw:    data,
 			}
 			h.logger.Log("info", "收到二进制消息", gin.H{
-				"secret": secret,
+				"secret": masked,
 				"size":   len(data),
 			})
 
 			// 处理二进制数据的业务逻辑
-			h.handleBinaryMessage(secret, msg, data, conn)
+			h.handleBinaryMessage(secret, msg, data, client)
 
 		case gorilla.PingMessage:
 			// 自动回复Pong
-			if err := conn.WriteMessage(gorilla.PongMessage, nil); err != nil {
+			if err := client.WriteMessage(gorilla.PongMessage, nil); err != nil {
 				h.logger.Log("error", "发送Pong消息失败", err)
 			}
 
 		case gorilla.PongMessage:
 			// 收到Pong响应
-			h.logger.Log("debug", "收到Pong消息", gin.H{"secret": secret})
+			h.logger.Log("debug", "收到Pong消息", gin.H{"secret": masked})
 
 		default:
 			h.logger.Log("warning", "未知的WebSocket消息类型", gin.H{
-				"secret": secret,
+				"secret": masked,
 				"type":   messageType,
 			})
 		}
@@ -810,10 +1165,10 @@ func (h *Handlers) WebSocketHandler(c *gin.Context) {
 }
 
 // handleBinaryMessage 处理二进制消息
-func (h *Handlers) handleBinaryMessage(secret string, msg models.WebSocketMessage, data []byte, conn *gorilla.Conn) {
+func (h *Handlers) handleBinaryMessage(secret string, msg models.WebSocketMessage, data []byte, client *websocket.Client) {
 	// 根据数据内容或协议头判断处理方式
 	if len(data) == 0 {
-		h.logger.Log("warning", "收到空的二进制消息", gin.H{"secret": secret})
+		h.logger.Log("warning", "收到空的二进制消息", gin.H{"secret": utils.MaskSecret(secret)})
 		return
 	}
 
@@ -822,10 +1177,10 @@ func (h *Handlers) handleBinaryMessage(secret string, msg models.WebSocketMessag
 	if len(data) >= 4 && string(data[:4]) == "PING" {
 		// 回复PONG
 		pongData := []byte("PONG")
-		if err := conn.WriteMessage(gorilla.BinaryMessage, pongData); err != nil {
+		if err := client.WriteMessage(gorilla.BinaryMessage, pongData); err != nil {
 			h.logger.Log("error", "发送二进制PONG失败", err)
 		} else {
-			h.logger.Log("debug", "回复二进制心跳", gin.H{"secret": secret})
+			h.logger.Log("debug", "回复二进制心跳", gin.H{"secret": utils.MaskSecret(secret)})
 		}
 		return
 	}
@@ -835,30 +1190,30 @@ func (h *Handlers) handleBinaryMessage(secret string, msg models.WebSocketMessag
 	if len(data) > 4 && string(data[:4]) == "FILE" {
 		// 文件数据从 data[4:] 开始
 		fileData := data[4:]
-		h.handleFileUpload(secret, fileData, conn)
+		h.handleFileUpload(secret, fileData, client)
 		return
 	}
 
 	// 3. 默认：回显二进制数据（用于测试）
 	h.logger.Log("info", "回显二进制数据", gin.H{
-		"secret":      secret,
+		"secret":      utils.MaskSecret(secret),
 		"size":        len(data),
 		"first4bytes": fmt.Sprintf("%x", data[:min(4, len(data))]),
 	})
 
 	// 回显数据
-	if err := conn.WriteMessage(gorilla.BinaryMessage, data); err != nil {
+	if err := client.WriteMessage(gorilla.BinaryMessage, data); err != nil {
 		h.logger.Log("error", "回显二进制数据失败", err)
 	}
 }
 
 // handleFileUpload 处理文件上传
-func (h *Handlers) handleFileUpload(secret string, fileData []byte, conn *gorilla.Conn) {
+func (h *Handlers) handleFileUpload(secret string, fileData []byte, client *websocket.Client) {
 	// 验证文件数据大小
 	const maxUploadSize = 100 * 1024 * 1024 // 100MB 限制
 	if len(fileData) > maxUploadSize {
 		h.logger.Log("warning", "文件上传被拒绝：文件过大", gin.H{
-			"secret":      secret,
+			"secret":      utils.MaskSecret(secret),
 			"size":        len(fileData),
 			"max_allowed": maxUploadSize,
 		})
@@ -866,7 +1221,7 @@ func (h *Handlers) handleFileUpload(secret string, fileData []byte, conn *gorill
 	}
 
 	// 创建data目录，使用更安全的权限
-	dataDir := "./data/uploads"
+	dataDir := filepath.Join(database.DataDir, "uploads")
 	if err := os.MkdirAll(dataDir, 0750); err != nil {
 		h.logger.Log("error", "创建上传目录失败", gin.H{"error": err.Error(), "dir": dataDir})
 		return
@@ -906,7 +1261,7 @@ func (h *Handlers) handleFileUpload(secret string, fileData []byte, conn *gorill
 	}
 
 	h.logger.Log("info", "文件上传成功", gin.H{
-		"secret":   secret,
+		"secret":   utils.MaskSecret(secret),
 		"filename": filename,
 		"size":     len(fileData),
 		"path":     absFilePath,
@@ -923,7 +1278,7 @@ func (h *Handlers) handleFileUpload(secret string, fileData []byte, conn *gorill
 		Format: models.MessageFormatJSON,
 	}
 
-	if err := conn.WriteJSON(response); err != nil {
+	if err := client.SendMessage(response); err != nil {
 		h.logger.Log("error", "发送文件上传响应失败", err)
 	}
 }
@@ -935,27 +1290,3 @@ func min(a, b int) int {
 	}
 	return b
 }
-
-// 辅助函数
-func getMemoryStats() models.MemoryStats {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	return models.MemoryStats{
-		Alloc:      m.Alloc,
-		TotalAlloc: m.TotalAlloc,
-		Sys:        m.Sys,
-		NumGC:      m.NumGC,
-	}
-}
-
-func getUptime() float64 {
-	// 这里应该返回实际的运行时间（秒）
-	// 为了简化，返回一个固定值
-	return 86400.0 // 24小时
-}
-
-func getLoadAverage() []float64 {
-	// 这里应该返回实际的负载平均值
-	// 为了简化，返回模拟值
-	return []float64{0.5, 0.6, 0.7}
-}
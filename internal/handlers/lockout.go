@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/config"
+	"nekobridge/internal/lockout"
+	"nekobridge/internal/metrics"
+	"nekobridge/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dummyPasswordHash 用户不存在时参与比较的哈希，使响应时间与密码错误时一致
+var dummyPasswordHash, _ = utils.HashPassword("nekobridge-dummy-password")
+
+// lockoutPolicy 根据配置生成退避和锁定策略
+func lockoutPolicy(cfg config.LoginLockoutConfig) lockout.Policy {
+	return lockout.Policy{
+		FreeAttempts:    cfg.FreeAttempts,
+		BaseDelay:       time.Duration(cfg.BaseDelay) * time.Second,
+		MaxDelay:        time.Duration(cfg.MaxDelay) * time.Second,
+		MaxFailures:     cfg.MaxFailures,
+		LockoutDuration: time.Duration(cfg.LockoutDuration) * time.Second,
+	}
+}
+
+// loginKeys 登录请求对应的计数键
+func loginKeys(ip, username string) []lockout.Key {
+	return []lockout.Key{
+		{Scope: lockout.ScopeIP, Value: ip},
+		{Scope: lockout.ScopeUsername, Value: username},
+	}
+}
+
+// checkLoginAllowed 检查来源 IP 和用户名是否处于退避或锁定中，被拒绝时写入 429 响应
+func (h *Handlers) checkLoginAllowed(c *gin.Context, keys []lockout.Key) bool {
+	if !h.config.GetAuthConfig().Lockout.Enabled {
+		return true
+	}
+
+	retryAfter, locked := h.loginGuard.Check(keys...)
+	if retryAfter <= 0 {
+		return true
+	}
+
+	metrics.ObserveLoginFailure("throttled")
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	if locked {
+		h.Error(c, http.StatusTooManyRequests, "登录失败次数过多，已被临时锁定，请稍后再试")
+	} else {
+		h.Error(c, http.StatusTooManyRequests, "登录失败次数过多，请稍后再试")
+	}
+	return false
+}
+
+// loginFailed 记录登录失败并返回 401
+func (h *Handlers) loginFailed(c *gin.Context, username, reason string, keys []lockout.Key) {
+	h.recordLoginFailure(c, username, reason, keys)
+	h.Error(c, http.StatusUnauthorized, "用户名或密码错误")
+}
+
+// recordLoginFailure 记录登录失败并累计失败次数，达到失败上限时记录锁定事件
+func (h *Handlers) recordLoginFailure(c *gin.Context, username, reason string, keys []lockout.Key) {
+	metrics.ObserveLoginFailure(reason)
+	h.logger.Log("warning", "用户登录失败", gin.H{"username": username, "ip": c.ClientIP(), "reason": reason})
+	h.recordAudit(username, c.ClientIP(), audit.ActionAuthLogin, username, nil, nil, errors.New(reason))
+
+	if policy := h.config.GetAuthConfig().Lockout; policy.Enabled {
+		for _, key := range h.loginGuard.Fail(keys...) {
+			h.logger.Log("warning", "登录已锁定", gin.H{
+				"event":    "login_lockout",
+				"scope":    key.Scope,
+				"value":    key.Value,
+				"ip":       c.ClientIP(),
+				"username": username,
+				"duration": policy.LockoutDuration,
+			})
+			h.recordAudit(audit.ActorSystem, c.ClientIP(), audit.ActionAuthLockout, key.Scope+":"+key.Value, nil,
+				gin.H{"username": username, "duration": policy.LockoutDuration}, nil)
+		}
+	}
+}
+
+// GetLockouts 获取当前处于退避或锁定中的来源 IP 和用户名
+func (h *Handlers) GetLockouts(c *gin.Context) {
+	h.Success(c, h.loginGuard.Blocked())
+}
+
+// ClearLockout 解除来源 IP 或用户名的登录锁定
+// 查询参数: ip、username，至少提供一个
+func (h *Handlers) ClearLockout(c *gin.Context) {
+	var keys []lockout.Key
+	if ip := c.Query("ip"); ip != "" {
+		keys = append(keys, lockout.Key{Scope: lockout.ScopeIP, Value: ip})
+	}
+	if username := c.Query("username"); username != "" {
+		keys = append(keys, lockout.Key{Scope: lockout.ScopeUsername, Value: username})
+	}
+	if len(keys) == 0 {
+		h.Error(c, http.StatusBadRequest, "请指定要解除锁定的 ip 或 username")
+		return
+	}
+
+	if !h.loginGuard.Reset(keys...) {
+		h.Error(c, http.StatusNotFound, "没有找到对应的登录失败记录")
+		return
+	}
+
+	user, _ := c.Get("user")
+	claims := user.(*utils.Claims)
+	h.audit(c, audit.ActionAuthLockoutClear, "", nil, gin.H{"ip": c.Query("ip"), "username": c.Query("username")}, nil)
+	h.logger.Log("warning", "登录锁定已解除", gin.H{
+		"event":    "login_lockout_cleared",
+		"admin":    claims.Username,
+		"ip":       c.Query("ip"),
+		"username": c.Query("username"),
+	})
+
+	h.Success(c, nil, "登录锁定已解除")
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"nekobridge/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsHandler 以 Prometheus 文本格式输出注册表中的指标
+var metricsHandler = promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
+
+// registerMetrics 注册 /metrics，配置了独立监听地址时单独启动一个 HTTP 服务
+func (h *Handlers) registerMetrics(r *gin.Engine) {
+	cfg := h.config.GetMetricsConfig()
+	if !cfg.Enabled {
+		return
+	}
+	metrics.RegisterConnections(h.wsManager)
+
+	if cfg.Listen == "" {
+		r.GET("/metrics", h.MetricsMiddleware(), h.Metrics)
+		return
+	}
+
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	// 独立服务直接面向抓取方，不信任任何代理头
+	engine.SetTrustedProxies(nil)
+	engine.GET("/metrics", h.MetricsMiddleware(), h.Metrics)
+
+	go func() {
+		log.Printf("📈 Prometheus 指标服务监听: %s", cfg.Listen)
+		if err := http.ListenAndServe(cfg.Listen, engine); err != nil {
+			log.Printf("❌ 指标服务启动失败: %v", err)
+		}
+	}()
+}
+
+// MetricsMiddleware 指标接口访问控制：来源 IP 在 allowed_ips 中，或携带正确的 Bearer Token
+func (h *Handlers) MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.metricsIPAllowed(c.ClientIP()) {
+			c.Next()
+			return
+		}
+
+		token := h.config.GetMetricsConfig().Token
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1 {
+			c.Next()
+			return
+		}
+
+		h.logger.Log("warning", "指标接口访问被拒绝", gin.H{
+			"client_ip": c.ClientIP(),
+			"has_token": provided != "",
+		})
+		status := http.StatusForbidden
+		if token != "" {
+			status = http.StatusUnauthorized
+		}
+		c.AbortWithStatus(status)
+	}
+}
+
+// metricsIPAllowed 检查来源 IP 是否在 allowed_ips 中（支持单个 IP 和 CIDR 网段）
+func (h *Handlers) metricsIPAllowed(clientIP string) bool {
+	return ipMatches(h.config.GetMetricsConfig().AllowedIPs, clientIP)
+}
+
+// ipMatches 检查 IP 是否匹配列表中的单个 IP 或 CIDR 网段
+func ipMatches(rules []string, clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, allowed := range rules {
+		if strings.Contains(allowed, "/") {
+			if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Metrics 以 Prometheus 文本格式输出指标
+func (h *Handlers) Metrics(c *gin.Context) {
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
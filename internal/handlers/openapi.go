@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"nekobridge/internal/models"
+	"nekobridge/internal/openapi"
+	"nekobridge/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPIBodyLimit OpenAPI 代理请求体和响应体的最大字节数
+const openAPIBodyLimit = 1 << 20
+
+// openAPIAppID 获取密钥对应的机器人 AppID，密钥不可用或未配置 AppID 时返回状态码和错误信息
+func (h *Handlers) openAPIAppID(secret string) (appID string, status int, message string) {
+	secretConfig, exists := h.config.GetSecretConfig(secret)
+	if !exists || !secretConfig.Enabled {
+		return "", http.StatusForbidden, "密钥不存在或已被禁用"
+	}
+	if secretConfig.AppID == "" {
+		return "", http.StatusBadRequest, "密钥未配置 AppID"
+	}
+	return secretConfig.AppID, 0, ""
+}
+
+// OpenAPIProxy 以密钥对应的机器人身份代理 QQ OpenAPI 请求，AppAccessToken 由服务端获取、缓存和刷新
+func (h *Handlers) OpenAPIProxy(c *gin.Context) {
+	secret := c.Param("secret")
+	path := c.Param("path")
+
+	// 获取网关地址的请求由 NekoBridge 直接返回自身的网关地址，SDK 无需修改即可连接
+	if c.Request.Method == http.MethodGet && (path == "/gateway" || path == "/gateway/bot") {
+		h.serveGatewayURL(c, secret, path == "/gateway/bot")
+		return
+	}
+
+	appID, status, message := h.openAPIAppID(secret)
+	if status != 0 {
+		h.Error(c, status, message)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, openAPIBodyLimit+1))
+	if err != nil {
+		h.Error(c, http.StatusBadRequest, "读取请求体失败")
+		return
+	}
+	if len(body) > openAPIBodyLimit {
+		h.Error(c, http.StatusRequestEntityTooLarge, "请求体过大")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.openapi.Timeout())
+	defer cancel()
+
+	resp, err := h.openapi.Do(ctx, appID, secret, c.Request.Method, path, c.Request.URL.RawQuery, body, c.GetHeader("Content-Type"))
+	if err != nil {
+		h.logger.Log("error", "OpenAPI 代理请求失败", gin.H{"app_id": appID, "method": c.Request.Method, "path": path, "error": err.Error()})
+		if errors.Is(err, openapi.ErrInvalidPath) {
+			h.Error(c, http.StatusBadRequest, "无效的 OpenAPI 路径")
+			return
+		}
+		h.Error(c, http.StatusBadGateway, "OpenAPI 请求失败")
+		return
+	}
+	defer resp.Body.Close()
+
+	h.logger.Log("debug", "OpenAPI 代理请求完成", gin.H{"app_id": appID, "method": c.Request.Method, "path": path, "status": resp.StatusCode})
+
+	headers := map[string]string{}
+	if traceID := resp.Header.Get("X-Tps-Trace-Id"); traceID != "" {
+		headers["X-Tps-Trace-Id"] = traceID
+	}
+	c.DataFromReader(resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, headers)
+}
+
+// handleOpenAPIFrame 处理客户端通过 WebSocket 发起的 OpenAPI 请求，结果以同一 id 的 openapi_response 消息返回
+func (h *Handlers) handleOpenAPIFrame(client *websocket.Client, msg models.WebSocketMessage) {
+	requestID := msg.ID
+	if requestID == "" {
+		requestID = generateRequestID()
+	}
+
+	var req models.OpenAPIRequest
+	raw, _ := json.Marshal(msg.Data)
+	if err := json.Unmarshal(raw, &req); err != nil || req.Path == "" {
+		sendResponse(client, "openapi", requestID, models.UpstreamResponse{Error: "无效的 OpenAPI 请求"})
+		return
+	}
+	method := strings.ToUpper(req.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	appID, status, message := h.openAPIAppID(client.Secret)
+	if status != 0 {
+		sendResponse(client, "openapi", requestID, models.UpstreamResponse{Error: message})
+		return
+	}
+
+	contentType := ""
+	if len(req.Body) > 0 {
+		contentType = "application/json"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.openapi.Timeout())
+	defer cancel()
+
+	resp, err := h.openapi.Do(ctx, appID, client.Secret, method, req.Path, req.Query, req.Body, contentType)
+	if err != nil {
+		h.logger.Log("error", "OpenAPI 代理请求失败", gin.H{"app_id": appID, "client_id": client.ID, "method": method, "path": req.Path, "error": err.Error()})
+		sendResponse(client, "openapi", requestID, models.UpstreamResponse{Error: "OpenAPI 请求失败: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, openAPIBodyLimit+1))
+	if err != nil {
+		sendResponse(client, "openapi", requestID, models.UpstreamResponse{Status: resp.StatusCode, Error: "读取 OpenAPI 响应失败: " + err.Error()})
+		return
+	}
+	if len(data) > openAPIBodyLimit {
+		sendResponse(client, "openapi", requestID, models.UpstreamResponse{Status: resp.StatusCode, Error: "OpenAPI 响应过大"})
+		return
+	}
+
+	h.logger.Log("debug", "OpenAPI 代理请求完成", gin.H{"app_id": appID, "client_id": client.ID, "method": method, "path": req.Path, "status": resp.StatusCode})
+	sendResponse(client, "openapi", requestID, models.UpstreamResponse{
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        embedBody(data),
+	})
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"nekobridge/internal/database"
+	"nekobridge/internal/rbac"
+	"nekobridge/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routePermissions 需要认证的路由所要求的权限，键为 "方法 路由模板"
+// 空字符串表示只要求登录，未列出的路由一律拒绝访问
+// 只有 secrets:read 权限时，列表中的密钥会被遮盖，导出完整密钥需要 secrets:write 权限
+var routePermissions = map[string]string{
+	"POST /api/auth/logout":  "",
+	"GET /api/auth/verify":   "",
+	"PUT /api/auth/password": "",
+
+	"GET /api/auth/sessions":        "",
+	"DELETE /api/auth/sessions":     "",
+	"DELETE /api/auth/sessions/:id": "",
+
+	"GET /api/auth/totp":                 "",
+	"POST /api/auth/totp/setup":          "",
+	"POST /api/auth/totp/enable":         "",
+	"POST /api/auth/totp/disable":        "",
+	"POST /api/auth/totp/recovery-codes": "",
+
+	"GET /api/logs": rbac.PermLogsRead,
+
+	"GET /api/connections":               rbac.PermConnectionsRead,
+	"POST /api/connections/:secret/kick": rbac.PermConnectionsKick,
+
+	"GET /api/secrets":                  rbac.PermSecretsRead,
+	"POST /api/secrets":                 rbac.PermSecretsWrite,
+	"PUT /api/secrets/:secret":          rbac.PermSecretsWrite,
+	"DELETE /api/secrets/:secret":       rbac.PermSecretsWrite,
+	"POST /api/secrets/:secret/block":   rbac.PermSecretsWrite,
+	"POST /api/secrets/:secret/unblock": rbac.PermSecretsWrite,
+	"GET /api/secrets/blocked":          rbac.PermSecretsRead,
+	"PUT /api/bans/:id":                 rbac.PermSecretsWrite,
+	"DELETE /api/bans/:id":              rbac.PermSecretsWrite,
+	"GET /api/secrets/export":           rbac.PermSecretsWrite,
+	"POST /api/secrets/import":          rbac.PermSecretsWrite,
+	"GET /api/secrets/stats":            rbac.PermSecretsRead,
+	"POST /api/secrets/batch":           rbac.PermSecretsWrite,
+
+	"GET /api/config":                    rbac.PermConfigRead,
+	"PUT /api/config":                    rbac.PermConfigWrite,
+	"GET /api/config/sources":            rbac.PermConfigRead,
+	"GET /api/config/websocket":          rbac.PermConfigRead,
+	"PUT /api/config/websocket":          rbac.PermConfigWrite,
+	"GET /api/config/system":             rbac.PermConfigRead,
+	"PUT /api/config/system":             rbac.PermConfigWrite,
+	"GET /api/config/system/schema":      rbac.PermConfigRead,
+	"POST /api/config/system/initialize": rbac.PermConfigWrite,
+	"DELETE /api/config/system/:key":     rbac.PermConfigWrite,
+
+	"GET /api/config/revisions":               rbac.PermConfigRead,
+	"GET /api/config/revisions/:id":           rbac.PermConfigRead,
+	"GET /api/config/revisions/:id/diff":      rbac.PermConfigRead,
+	"POST /api/config/revisions/:id/rollback": rbac.PermConfigWrite,
+
+	"GET /api/dashboard/stats": rbac.PermDashboardRead,
+	"GET /api/traffic/history": rbac.PermDashboardRead,
+
+	"GET /api/users":        rbac.PermUsersManage,
+	"POST /api/users":       rbac.PermUsersManage,
+	"PUT /api/users/:id":    rbac.PermUsersManage,
+	"DELETE /api/users/:id": rbac.PermUsersManage,
+
+	"DELETE /api/users/:id/sessions": rbac.PermUsersManage,
+	"DELETE /api/users/:id/totp":     rbac.PermUsersManage,
+	"GET /api/sessions":              rbac.PermUsersManage,
+	"DELETE /api/sessions/:id":       rbac.PermUsersManage,
+	"GET /api/lockouts":              rbac.PermUsersManage,
+	"DELETE /api/lockouts":           rbac.PermUsersManage,
+
+	"GET /api/apikeys":        rbac.PermAPIKeysManage,
+	"POST /api/apikeys":       rbac.PermAPIKeysManage,
+	"DELETE /api/apikeys/:id": rbac.PermAPIKeysManage,
+
+	"GET /api/audit":        rbac.PermAuditRead,
+	"GET /api/audit/export": rbac.PermAuditRead,
+}
+
+// requiredPermission 获取路由要求的权限，ok 为 false 表示路由未登记
+func requiredPermission(method, route string) (permission string, ok bool) {
+	permission, ok = routePermissions[method+" "+route]
+	return permission, ok
+}
+
+// hasPermission 当前请求的用户是否拥有 permission，使用 API Key 时还要求 Key 申请了该权限
+func hasPermission(c *gin.Context, permission string) bool {
+	user, exists := c.Get("user")
+	if !exists {
+		return false
+	}
+	if !rbac.HasPermission(user.(*utils.Claims).Role, permission) {
+		return false
+	}
+	if key, exists := c.Get("api_key"); exists {
+		return hasScope(key.(*database.APIKey).Scopes, permission)
+	}
+	return true
+}
+
+// visibleSecret 返回给当前请求的密钥，没有 secrets:write 权限时只返回遮盖后的密钥
+func visibleSecret(c *gin.Context, secret string) string {
+	if hasPermission(c, rbac.PermSecretsWrite) {
+		return secret
+	}
+	return utils.MaskSecret(secret)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"nekobridge/internal/database"
+	"nekobridge/internal/rbac"
+	"nekobridge/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoutePermissions(t *testing.T) {
+	tests := []struct {
+		route string
+		role  string
+		want  bool
+	}{
+		{"GET /api/secrets", rbac.RoleViewer, true},
+		{"GET /api/secrets/export", rbac.RoleViewer, false},
+		{"GET /api/secrets/export", rbac.RoleOperator, true},
+		{"POST /api/secrets", rbac.RoleViewer, false},
+		{"POST /api/secrets", rbac.RoleOperator, true},
+		{"GET /api/config", rbac.RoleOperator, false},
+		{"GET /api/config", rbac.RoleAdmin, true},
+		{"GET /api/users", rbac.RoleOperator, false},
+		{"GET /api/audit", rbac.RoleAdmin, true},
+		{"GET /api/auth/verify", rbac.RoleViewer, true},
+		{"GET /api/unregistered", rbac.RoleAdmin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route+" "+tt.role, func(t *testing.T) {
+			permission, registered := routePermissions[tt.route]
+			got := registered && rbac.HasPermission(tt.role, permission)
+			if got != tt.want {
+				t.Errorf("%s 访问 %s = %v，应为 %v", tt.role, tt.route, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVisibleSecret(t *testing.T) {
+	const secret = "abcd1234567890wxyz"
+	masked := utils.MaskSecret(secret)
+
+	tests := []struct {
+		name   string
+		role   string
+		scopes []string // nil 表示交互式会话
+		want   string
+	}{
+		{"只读用户", rbac.RoleViewer, nil, masked},
+		{"运维用户", rbac.RoleOperator, nil, secret},
+		{"管理员", rbac.RoleAdmin, nil, secret},
+		{"只读 API Key", rbac.RoleAdmin, []string{rbac.PermSecretsRead}, masked},
+		{"可写 API Key", rbac.RoleAdmin, []string{rbac.PermSecretsRead, rbac.PermSecretsWrite}, secret},
+		{"创建者无权限", rbac.RoleViewer, []string{rbac.PermSecretsWrite}, masked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Set("user", &utils.Claims{Username: "test", Role: tt.role})
+			if tt.scopes != nil {
+				c.Set("api_key", &database.APIKey{Scopes: tt.scopes})
+			}
+			if got := visibleSecret(c, secret); got != tt.want {
+				t.Errorf("visibleSecret() = %q，应为 %q", got, tt.want)
+			}
+		})
+	}
+}
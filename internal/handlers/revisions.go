@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/config"
+	"nekobridge/internal/database"
+	"nekobridge/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRevisionPageSize = 50
+	maxRevisionPageSize     = 200
+)
+
+// revisionExternal 管理接口之外的配置修改（编辑配置文件、环境变量变化）产生的版本
+// 下一次通过接口修改配置时发现当前配置与最新版本不一致，先以系统身份补记修改前的配置
+const revisionExternal = "config.external"
+
+// changeConfig 执行配置修改并保存修改后的配置版本，rollbackOf 为回滚操作恢复的目标版本
+// 配置修改和版本写入串行执行，保证版本顺序与修改顺序一致；保存版本失败只记录日志，不影响已生效的修改
+func (h *Handlers) changeConfig(c *gin.Context, action string, rollbackOf *uint, change func() (*config.Config, *config.Config, error)) (*config.Config, *config.Config, *database.ConfigRevision, error) {
+	h.revisionMu.Lock()
+	defer h.revisionMu.Unlock()
+
+	before, after, err := change()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	revision, err := h.recordRevision(requestActor(c), action, before, after, rollbackOf)
+	if err != nil {
+		h.logger.Log("error", "保存配置版本失败", gin.H{"action": action, "error": err.Error()})
+	}
+	return before, after, revision, nil
+}
+
+// recordRevision 保存修改后的配置，配置没有变化时不产生新版本，返回 nil
+// 修改前的配置与最新版本不一致时（例如还没有任何版本，或配置文件被直接编辑过），先补记一个修改前的版本，保证每次修改都可以回滚
+func (h *Handlers) recordRevision(author, action string, before, after *config.Config, rollbackOf *uint) (*database.ConfigRevision, error) {
+	beforeSettings := revisionSettings(before)
+	afterSettings := revisionSettings(after)
+	changes := changedKeys(beforeSettings, afterSettings)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	revisionService := &database.ConfigRevisionService{}
+	latest, err := revisionService.Latest()
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil || len(changedKeys(latest.Settings, beforeSettings)) > 0 {
+		external := &database.ConfigRevision{
+			Author:   audit.ActorSystem,
+			Action:   revisionExternal,
+			Changes:  []string{},
+			Settings: beforeSettings,
+		}
+		if latest != nil {
+			external.Changes = changedKeys(latest.Settings, beforeSettings)
+		}
+		if err := revisionService.Create(external); err != nil {
+			return nil, err
+		}
+	}
+
+	revision := &database.ConfigRevision{
+		Author:     author,
+		Action:     action,
+		Changes:    changes,
+		Settings:   afterSettings,
+		RollbackOf: rollbackOf,
+	}
+	if err := revisionService.Create(revision); err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
+
+// revisionSettings 配置版本中保存的配置项，不含登录凭据
+// 取值经过 JSON 编解码，与从数据库读出的版本可以直接比较
+func revisionSettings(cfg *config.Config) map[string]interface{} {
+	settings := config.Settings(cfg)
+	for _, key := range config.CredentialKeys {
+		delete(settings, key)
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return settings
+	}
+	normalized := make(map[string]interface{})
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return settings
+	}
+	return normalized
+}
+
+// changedKeys 返回两组配置中取值不同的配置键，按配置结构的顺序排列
+func changedKeys(from, to map[string]interface{}) []string {
+	keys := make([]string, 0)
+	for key, value := range to {
+		if other, exists := from[key]; !exists || !reflect.DeepEqual(value, other) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range from {
+		if _, exists := to[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	config.SortKeys(keys)
+	return keys
+}
+
+// GetConfigRevisions 分页获取配置版本列表，不含完整配置
+func (h *Handlers) GetConfigRevisions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultRevisionPageSize)))
+	if err != nil || limit <= 0 {
+		limit = defaultRevisionPageSize
+	}
+	if limit > maxRevisionPageSize {
+		limit = maxRevisionPageSize
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	revisionService := &database.ConfigRevisionService{}
+	revisions, total, err := revisionService.List(limit, offset)
+	if err != nil {
+		h.logger.Log("error", "获取配置版本失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "获取配置版本失败")
+		return
+	}
+
+	h.Success(c, gin.H{
+		"revisions": revisions,
+		"total":     total,
+	})
+}
+
+// GetConfigRevision 获取配置版本的完整配置
+func (h *Handlers) GetConfigRevision(c *gin.Context) {
+	revision, ok := h.loadRevision(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	h.Success(c, revision)
+}
+
+// DiffConfigRevisions 比较两个配置版本，查询参数 to 为空时与当前生效的配置比较
+func (h *Handlers) DiffConfigRevisions(c *gin.Context) {
+	from, ok := h.loadRevision(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var toID interface{} = "current"
+	toSettings := revisionSettings(h.config)
+	if id := c.Query("to"); id != "" {
+		to, ok := h.loadRevision(c, id)
+		if !ok {
+			return
+		}
+		toID = to.ID
+		toSettings = to.Settings
+	}
+
+	keys := changedKeys(from.Settings, toSettings)
+	changes := make([]models.ConfigChange, 0, len(keys))
+	for _, key := range keys {
+		changes = append(changes, models.ConfigChange{Key: key, From: from.Settings[key], To: toSettings[key]})
+	}
+
+	h.Success(c, gin.H{
+		"from":    from.ID,
+		"to":      toID,
+		"changes": changes,
+	})
+}
+
+// RollbackConfig 将配置恢复为指定版本，恢复本身也会产生一个新版本
+// 由环境变量设置的配置项无法恢复，与版本不一致时返回 409
+func (h *Handlers) RollbackConfig(c *gin.Context) {
+	target, ok := h.loadRevision(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	before, after, revision, err := h.changeConfig(c, audit.ActionConfigRollback, &target.ID, func() (*config.Config, *config.Config, error) {
+		return h.store.Update(func(cfg *config.Config) error {
+			return config.ApplySettings(cfg, target.Settings)
+		})
+	})
+
+	targetName := strconv.FormatUint(uint64(target.ID), 10)
+	if err != nil {
+		h.audit(c, audit.ActionConfigRollback, targetName, nil, nil, err)
+		h.configError(c, err, "回滚配置失败")
+		return
+	}
+	h.audit(c, audit.ActionConfigRollback, targetName, before, after, nil)
+
+	changes := config.ChangedKeys(before, after)
+	h.logger.Log("info", "配置已回滚", gin.H{
+		"admin":    requestActor(c),
+		"revision": target.ID,
+		"changes":  changes,
+	})
+
+	if len(changes) == 0 {
+		h.Success(c, gin.H{"changes": changes}, "当前配置与该版本相同，无需回滚")
+		return
+	}
+	data := gin.H{"changes": changes}
+	if revision != nil {
+		data["revision"] = revision.ID
+	}
+	h.Success(c, data, "配置已回滚到版本 "+targetName)
+}
+
+// loadRevision 读取配置版本，失败时直接返回错误响应
+func (h *Handlers) loadRevision(c *gin.Context, param string) (*database.ConfigRevision, bool) {
+	id, err := strconv.ParseUint(param, 10, 64)
+	if err != nil || id == 0 {
+		h.Error(c, http.StatusBadRequest, "无效的版本号")
+		return nil, false
+	}
+
+	revisionService := &database.ConfigRevisionService{}
+	revision, err := revisionService.Get(uint(id))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.Error(c, http.StatusNotFound, "配置版本不存在")
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Log("error", "获取配置版本失败", gin.H{"id": id, "error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "获取配置版本失败")
+		return nil, false
+	}
+	return revision, true
+}
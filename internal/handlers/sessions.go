@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/database"
+	"nekobridge/internal/models"
+	"nekobridge/internal/rbac"
+	"nekobridge/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sessionTouchInterval 更新会话最近活动时间的最小间隔，避免每个请求都写数据库
+const sessionTouchInterval = time.Minute
+
+// maxUserAgentLength 会话中保存的 User-Agent 最大长度
+const maxUserAgentLength = 256
+
+// accessTokenTTL 访问令牌有效期
+func (h *Handlers) accessTokenTTL() time.Duration {
+	ttl := time.Duration(h.config.GetAuthConfig().AccessTokenTTL) * time.Second
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	return ttl
+}
+
+// sessionTimeout 会话空闲超时，即刷新令牌的有效期
+func (h *Handlers) sessionTimeout() time.Duration {
+	timeout := time.Duration(h.config.GetAuthConfig().SessionTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 24 * time.Hour
+	}
+	return timeout
+}
+
+// issueSession 为用户创建会话，签发访问令牌和刷新令牌
+func (h *Handlers) issueSession(c *gin.Context, user *database.User) (models.LoginResponse, error) {
+	sessionService := &database.SessionService{}
+	if removed, err := sessionService.PurgeInactive(); err != nil {
+		h.logger.Log("warning", "清理过期会话失败", gin.H{"error": err.Error()})
+	} else if removed > 0 {
+		h.logger.Log("debug", "已清理过期会话", gin.H{"count": removed})
+	}
+
+	sessionID, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	now := time.Now()
+	session := &database.Session{
+		SessionID:        sessionID,
+		Username:         user.Username,
+		RefreshTokenHash: utils.HashToken(refreshToken),
+		IP:               c.ClientIP(),
+		UserAgent:        truncateUserAgent(c.Request.UserAgent()),
+		LastActiveAt:     now,
+		ExpiresAt:        now.Add(h.sessionTimeout()),
+	}
+	if err := sessionService.CreateSession(session); err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	return h.signSession(session, user, refreshToken)
+}
+
+// signSession 为会话签发访问令牌并组装登录响应
+func (h *Handlers) signSession(session *database.Session, user *database.User, refreshToken string) (models.LoginResponse, error) {
+	ttl := h.accessTokenTTL()
+	token, err := h.jwtManager.GenerateToken(user.Username, user.Role, session.SessionID, session.CreatedAt, ttl)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+
+	return models.LoginResponse{
+		Success:      true,
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(ttl / time.Second),
+		User: &models.UserInfo{
+			Username:    user.Username,
+			Role:        user.Role,
+			Permissions: rbac.Permissions(user.Role),
+		},
+	}, nil
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+// 已被轮换的刷新令牌再次使用时撤销整个会话
+func (h *Handlers) RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "刷新令牌不能为空")
+		return
+	}
+
+	sessionService := &database.SessionService{}
+	tokenHash := utils.HashToken(req.RefreshToken)
+	session, err := sessionService.GetByRefreshToken(tokenHash)
+	if err != nil || session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		h.Error(c, http.StatusUnauthorized, "刷新令牌无效或已过期")
+		return
+	}
+
+	if session.RefreshTokenHash != tokenHash {
+		if _, err := sessionService.RevokeSession(session.SessionID); err != nil {
+			h.logger.Log("error", "撤销会话失败", gin.H{"username": session.Username, "error": err.Error()})
+		}
+		h.logger.Log("warning", "检测到刷新令牌重复使用，已撤销会话", gin.H{
+			"username": session.Username,
+			"ip":       c.ClientIP(),
+		})
+		h.Error(c, http.StatusUnauthorized, "刷新令牌无效或已过期")
+		return
+	}
+
+	userService := &database.UserService{}
+	user, err := userService.GetUser(session.Username)
+	if err != nil || !user.Enabled {
+		if _, err := sessionService.RevokeSession(session.SessionID); err != nil {
+			h.logger.Log("error", "撤销会话失败", gin.H{"username": session.Username, "error": err.Error()})
+		}
+		h.Error(c, http.StatusUnauthorized, "刷新令牌无效或已过期")
+		return
+	}
+
+	refreshToken, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		h.logger.Log("error", "生成刷新令牌失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	rotated, err := sessionService.RotateRefreshToken(session, utils.HashToken(refreshToken), time.Now().Add(h.sessionTimeout()),
+		c.ClientIP(), truncateUserAgent(c.Request.UserAgent()))
+	if err != nil {
+		h.logger.Log("error", "轮换刷新令牌失败", gin.H{"username": session.Username, "error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !rotated {
+		// 同一个刷新令牌被并发使用，已由另一个请求完成轮换
+		h.Error(c, http.StatusUnauthorized, "刷新令牌无效或已过期")
+		return
+	}
+
+	response, err := h.signSession(session, user, refreshToken)
+	if err != nil {
+		h.logger.Log("error", "生成JWT令牌失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+
+	h.Success(c, response)
+}
+
+// GetMySessions 获取当前用户的活跃会话
+func (h *Handlers) GetMySessions(c *gin.Context) {
+	user, _ := c.Get("user")
+	claims := user.(*utils.Claims)
+
+	sessionService := &database.SessionService{}
+	sessions, err := sessionService.GetActiveSessions(claims.Username)
+	if err != nil {
+		h.logger.Log("error", "获取会话列表失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "获取会话列表失败")
+		return
+	}
+
+	h.Success(c, toSessionInfos(sessions, claims.ID))
+}
+
+// RevokeMySession 撤销当前用户的某个会话
+func (h *Handlers) RevokeMySession(c *gin.Context) {
+	user, _ := c.Get("user")
+	claims := user.(*utils.Claims)
+
+	sessionService := &database.SessionService{}
+	session, err := sessionService.GetActiveSession(c.Param("id"))
+	if err != nil || session.Username != claims.Username {
+		h.Error(c, http.StatusNotFound, "会话不存在")
+		return
+	}
+
+	if _, err := sessionService.RevokeSession(session.SessionID); err != nil {
+		h.logger.Log("error", "撤销会话失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "撤销会话失败")
+		return
+	}
+
+	h.logger.Log("info", "用户撤销会话", gin.H{
+		"username": session.Username,
+		"ip":       session.IP,
+	})
+
+	h.Success(c, nil, "会话已撤销")
+}
+
+// RevokeMySessions 撤销当前用户除当前会话以外的所有会话
+func (h *Handlers) RevokeMySessions(c *gin.Context) {
+	user, _ := c.Get("user")
+	claims := user.(*utils.Claims)
+
+	sessionService := &database.SessionService{}
+	revoked, err := sessionService.RevokeUserSessions(claims.Username, claims.ID)
+	if err != nil {
+		h.logger.Log("error", "撤销会话失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "撤销会话失败")
+		return
+	}
+
+	h.logger.Log("info", "撤销其他会话", gin.H{
+		"username": claims.Username,
+		"count":    revoked,
+	})
+
+	h.Success(c, gin.H{"revoked": revoked}, "其他会话已撤销")
+}
+
+// GetSessions 获取所有用户的活跃会话，可按 username 筛选
+func (h *Handlers) GetSessions(c *gin.Context) {
+	user, _ := c.Get("user")
+	claims := user.(*utils.Claims)
+
+	sessionService := &database.SessionService{}
+	sessions, err := sessionService.GetActiveSessions(c.Query("username"))
+	if err != nil {
+		h.logger.Log("error", "获取会话列表失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "获取会话列表失败")
+		return
+	}
+
+	h.Success(c, toSessionInfos(sessions, claims.ID))
+}
+
+// RevokeSession 撤销任意用户的某个会话
+func (h *Handlers) RevokeSession(c *gin.Context) {
+	sessionService := &database.SessionService{}
+	session, err := sessionService.GetActiveSession(c.Param("id"))
+	if err != nil {
+		h.Error(c, http.StatusNotFound, "会话不存在")
+		return
+	}
+
+	if _, err := sessionService.RevokeSession(session.SessionID); err != nil {
+		h.logger.Log("error", "撤销会话失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "撤销会话失败")
+		return
+	}
+
+	user, _ := c.Get("user")
+	claims := user.(*utils.Claims)
+	h.audit(c, audit.ActionSessionRevoke, session.SessionID, nil, gin.H{"username": session.Username, "ip": session.IP}, nil)
+	h.logger.Log("info", "撤销会话", gin.H{
+		"admin":    claims.Username,
+		"username": session.Username,
+		"ip":       session.IP,
+	})
+
+	h.Success(c, nil, "会话已撤销")
+}
+
+// RevokeUserSessions 撤销指定用户的所有会话
+func (h *Handlers) RevokeUserSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.Error(c, http.StatusBadRequest, "无效的用户ID")
+		return
+	}
+
+	userService := &database.UserService{}
+	target, err := userService.GetUserByID(uint(id))
+	if err != nil {
+		h.Error(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+
+	sessionService := &database.SessionService{}
+	revoked, err := sessionService.RevokeUserSessions(target.Username, "")
+	if err != nil {
+		h.logger.Log("error", "撤销会话失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "撤销会话失败")
+		return
+	}
+
+	user, _ := c.Get("user")
+	claims := user.(*utils.Claims)
+	h.audit(c, audit.ActionUserSessionRevoke, target.Username, nil, gin.H{"revoked": revoked}, nil)
+	h.logger.Log("info", "撤销用户的所有会话", gin.H{
+		"admin":    claims.Username,
+		"username": target.Username,
+		"count":    revoked,
+	})
+
+	h.Success(c, gin.H{"revoked": revoked}, "用户的所有会话已撤销")
+}
+
+// revokeSessions 撤销用户的会话并记录日志，用于禁用、删除用户或重置密码后让已签发的令牌失效
+func (h *Handlers) revokeSessions(username, exceptSessionID string) {
+	sessionService := &database.SessionService{}
+	if _, err := sessionService.RevokeUserSessions(username, exceptSessionID); err != nil {
+		h.logger.Log("error", "撤销会话失败", gin.H{"username": username, "error": err.Error()})
+	}
+}
+
+// toSessionInfos 转换会话列表，标记发起请求的会话
+func toSessionInfos(sessions []database.Session, currentID string) []models.SessionInfo {
+	infos := make([]models.SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, models.SessionInfo{
+			ID:           session.SessionID,
+			Username:     session.Username,
+			IP:           session.IP,
+			UserAgent:    session.UserAgent,
+			LastActiveAt: session.LastActiveAt,
+			ExpiresAt:    session.ExpiresAt,
+			CreatedAt:    session.CreatedAt,
+			Current:      session.SessionID == currentID,
+		})
+	}
+	return infos
+}
+
+// truncateUserAgent 截断过长的 User-Agent
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) > maxUserAgentLength {
+		return userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/database"
+	"nekobridge/internal/lockout"
+	"nekobridge/internal/models"
+	"nekobridge/internal/totp"
+	"nekobridge/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute // 密码验证通过后提交两步验证码的时限
+	maxMFAAttempts    = 5               // 每个质询允许的验证码错误次数
+	recoveryCodeCount = 10              // 每次生成的恢复码数量
+	totpIssuer        = "NekoBridge"    // 验证器应用中显示的发行方
+)
+
+// mfaChallenge 密码验证通过、等待两步验证的登录质询
+type mfaChallenge struct {
+	userID    uint
+	username  string
+	expiresAt time.Time
+	attempts  int
+}
+
+// createMFAChallenge 为密码验证通过的用户创建两步验证质询，返回质询令牌
+func (h *Handlers) createMFAChallenge(user *database.User) (string, error) {
+	token, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	h.totpMu.Lock()
+	defer h.totpMu.Unlock()
+
+	now := time.Now()
+	for key, challenge := range h.mfaChallenges {
+		if !now.Before(challenge.expiresAt) {
+			delete(h.mfaChallenges, key)
+		}
+	}
+	h.mfaChallenges[utils.HashToken(token)] = &mfaChallenge{
+		userID:    user.ID,
+		username:  user.Username,
+		expiresAt: now.Add(mfaChallengeTTL),
+	}
+	return token, nil
+}
+
+// VerifyMFA 提交两步验证码完成登录，验证通过后才签发令牌
+func (h *Handlers) VerifyMFA(c *gin.Context) {
+	var req models.MFAVerifyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "验证码不能为空")
+		return
+	}
+
+	h.totpMu.Lock()
+	defer h.totpMu.Unlock()
+
+	key := utils.HashToken(req.MFAToken)
+	challenge, exists := h.mfaChallenges[key]
+	if !exists || !time.Now().Before(challenge.expiresAt) {
+		delete(h.mfaChallenges, key)
+		h.Error(c, http.StatusUnauthorized, "两步验证已过期，请重新登录")
+		return
+	}
+
+	keys := loginKeys(c.ClientIP(), challenge.username)
+	if !h.checkLoginAllowed(c, keys) {
+		return
+	}
+
+	userService := &database.UserService{}
+	user, err := userService.GetUserByID(challenge.userID)
+	if err != nil || !user.Enabled || !user.TOTPEnabled {
+		delete(h.mfaChallenges, key)
+		h.Error(c, http.StatusUnauthorized, "两步验证已过期，请重新登录")
+		return
+	}
+
+	method, ok, err := h.verifySecondFactor(user, req.Code)
+	if err != nil {
+		h.logger.Log("error", "两步验证失败", gin.H{"username": user.Username, "error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !ok {
+		challenge.attempts++
+		if challenge.attempts >= maxMFAAttempts {
+			delete(h.mfaChallenges, key)
+		}
+		h.recordLoginFailure(c, user.Username, "invalid_totp", keys)
+		h.Error(c, http.StatusUnauthorized, "验证码错误")
+		return
+	}
+
+	delete(h.mfaChallenges, key)
+	if method == "recovery_code" {
+		h.logger.Log("warning", "使用恢复码登录", gin.H{
+			"username":  user.Username,
+			"ip":        c.ClientIP(),
+			"remaining": len(user.RecoveryCodes),
+		})
+	}
+	h.completeLogin(c, user)
+}
+
+// verifySecondFactor 校验动态验证码或恢复码，恢复码使用后立即作废
+// 调用方需持有 totpMu
+func (h *Handlers) verifySecondFactor(user *database.User, code string) (method string, ok bool, err error) {
+	code = strings.TrimSpace(code)
+	userService := &database.UserService{}
+
+	if isTOTPCode(code) {
+		step, valid := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+		if !valid {
+			return "totp", false, nil
+		}
+		used, err := userService.UseTOTPStep(user.ID, step)
+		if err != nil {
+			return "totp", false, err
+		}
+		user.TOTPLastStep = step
+		return "totp", used, nil
+	}
+
+	hash := utils.HashToken(totp.NormalizeRecoveryCode(code))
+	for i, stored := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) != 1 {
+			continue
+		}
+		user.RecoveryCodes = append(user.RecoveryCodes[:i:i], user.RecoveryCodes[i+1:]...)
+		if err := userService.UpdateUser(user); err != nil {
+			return "recovery_code", false, err
+		}
+		return "recovery_code", true, nil
+	}
+	return "recovery_code", false, nil
+}
+
+// GetTOTPStatus 获取当前用户的两步验证状态
+func (h *Handlers) GetTOTPStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	h.Success(c, models.TOTPStatus{
+		Enabled:                user.TOTPEnabled,
+		Pending:                !user.TOTPEnabled && user.TOTPSecret != "",
+		RecoveryCodesRemaining: len(user.RecoveryCodes),
+	})
+}
+
+// SetupTOTP 为当前用户生成待确认的两步验证密钥，返回密钥和 otpauth 地址
+func (h *Handlers) SetupTOTP(c *gin.Context) {
+	var req models.TOTPSetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "密码不能为空")
+		return
+	}
+
+	h.totpMu.Lock()
+	defer h.totpMu.Unlock()
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		h.Error(c, http.StatusBadRequest, "两步验证已启用，如需更换设备请先关闭")
+		return
+	}
+	if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+		h.Error(c, http.StatusBadRequest, "密码错误")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.Log("error", "生成两步验证密钥失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	user.TOTPSecret = secret
+	user.TOTPLastStep = 0
+	userService := &database.UserService{}
+	if err := userService.UpdateUser(user); err != nil {
+		h.logger.Log("error", "保存两步验证密钥失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+
+	h.Success(c, models.TOTPSetupResponse{
+		Secret: secret,
+		URI:    totp.URI(totpIssuer, user.Username, secret),
+	}, "请使用验证器应用扫描二维码，并输入验证码完成启用")
+}
+
+// EnableTOTP 校验验证码并启用两步验证，返回一次性恢复码
+func (h *Handlers) EnableTOTP(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "验证码不能为空")
+		return
+	}
+
+	h.totpMu.Lock()
+	defer h.totpMu.Unlock()
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		h.Error(c, http.StatusBadRequest, "两步验证已启用")
+		return
+	}
+	if user.TOTPSecret == "" {
+		h.Error(c, http.StatusBadRequest, "请先生成两步验证密钥")
+		return
+	}
+
+	step, valid := totp.Validate(user.TOTPSecret, req.Code, time.Now(), user.TOTPLastStep)
+	if !valid {
+		h.Error(c, http.StatusBadRequest, "验证码错误")
+		return
+	}
+
+	codes, err := resetRecoveryCodes(user)
+	if err != nil {
+		h.logger.Log("error", "生成恢复码失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	userService := &database.UserService{}
+	if err := userService.UpdateUser(user); err != nil {
+		h.logger.Log("error", "启用两步验证失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "启用两步验证失败")
+		return
+	}
+
+	h.audit(c, audit.ActionAuthTOTPEnable, user.Username, nil, nil, nil)
+	h.logger.Log("info", "启用两步验证", gin.H{"username": user.Username})
+
+	h.Success(c, models.RecoveryCodesResponse{RecoveryCodes: codes}, "两步验证已启用，请妥善保存恢复码")
+}
+
+// DisableTOTP 校验密码和验证码后关闭当前用户的两步验证
+func (h *Handlers) DisableTOTP(c *gin.Context) {
+	var req models.TOTPDisableRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "密码和验证码不能为空")
+		return
+	}
+
+	h.totpMu.Lock()
+	defer h.totpMu.Unlock()
+
+	user, ok := h.currentUser(c)
+	if !ok || !h.checkTOTPEnabled(c, user) {
+		return
+	}
+	keys := loginKeys(c.ClientIP(), user.Username)
+	if !h.checkLoginAllowed(c, keys) {
+		return
+	}
+	if !utils.CheckPasswordHash(req.Password, user.PasswordHash) {
+		h.recordLoginFailure(c, user.Username, "invalid_password", keys)
+		h.Error(c, http.StatusBadRequest, "密码错误")
+		return
+	}
+	if !h.checkSecondFactor(c, user, req.Code, keys) {
+		return
+	}
+
+	userService := &database.UserService{}
+	if err := userService.ResetTOTP(user.ID); err != nil {
+		h.logger.Log("error", "关闭两步验证失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "关闭两步验证失败")
+		return
+	}
+
+	h.audit(c, audit.ActionAuthTOTPDisable, user.Username, nil, nil, nil)
+	h.logger.Log("warning", "关闭两步验证", gin.H{"username": user.Username, "ip": c.ClientIP()})
+
+	h.Success(c, nil, "两步验证已关闭")
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码，旧的恢复码全部作废
+func (h *Handlers) RegenerateRecoveryCodes(c *gin.Context) {
+	var req models.TOTPCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "验证码不能为空")
+		return
+	}
+
+	h.totpMu.Lock()
+	defer h.totpMu.Unlock()
+
+	user, ok := h.currentUser(c)
+	if !ok || !h.checkTOTPEnabled(c, user) {
+		return
+	}
+	keys := loginKeys(c.ClientIP(), user.Username)
+	if !h.checkLoginAllowed(c, keys) || !h.checkSecondFactor(c, user, req.Code, keys) {
+		return
+	}
+
+	codes, err := resetRecoveryCodes(user)
+	if err != nil {
+		h.logger.Log("error", "生成恢复码失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	userService := &database.UserService{}
+	if err := userService.UpdateUser(user); err != nil {
+		h.logger.Log("error", "保存恢复码失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+
+	h.logger.Log("info", "重新生成恢复码", gin.H{"username": user.Username})
+
+	h.Success(c, models.RecoveryCodesResponse{RecoveryCodes: codes}, "恢复码已重新生成，旧的恢复码已失效")
+}
+
+// ResetUserTOTP 管理员强制关闭用户的两步验证，用于用户丢失验证器设备和恢复码的情况
+func (h *Handlers) ResetUserTOTP(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.Error(c, http.StatusBadRequest, "无效的用户ID")
+		return
+	}
+
+	h.totpMu.Lock()
+	defer h.totpMu.Unlock()
+
+	userService := &database.UserService{}
+	user, err := userService.GetUserByID(uint(id))
+	if err != nil {
+		h.Error(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	if !user.TOTPEnabled && user.TOTPSecret == "" {
+		h.Error(c, http.StatusBadRequest, "该用户未启用两步验证")
+		return
+	}
+
+	if err := userService.ResetTOTP(user.ID); err != nil {
+		h.logger.Log("error", "重置两步验证失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "重置两步验证失败")
+		return
+	}
+
+	current, _ := c.Get("user")
+	claims := current.(*utils.Claims)
+	h.audit(c, audit.ActionUserTOTPReset, user.Username, nil, nil, nil)
+	h.logger.Log("warning", "重置用户的两步验证", gin.H{
+		"admin":    claims.Username,
+		"username": user.Username,
+	})
+
+	h.Success(c, nil, "两步验证已重置")
+}
+
+// currentUser 从数据库加载当前登录的用户，不存在时写入 404 响应
+func (h *Handlers) currentUser(c *gin.Context) (*database.User, bool) {
+	current, _ := c.Get("user")
+	claims := current.(*utils.Claims)
+
+	userService := &database.UserService{}
+	user, err := userService.GetUser(claims.Username)
+	if err != nil {
+		h.Error(c, http.StatusNotFound, "用户不存在")
+		return nil, false
+	}
+	return user, true
+}
+
+// checkTOTPEnabled 检查用户是否已启用两步验证，未启用时写入 400 响应
+func (h *Handlers) checkTOTPEnabled(c *gin.Context, user *database.User) bool {
+	if !user.TOTPEnabled {
+		h.Error(c, http.StatusBadRequest, "两步验证未启用")
+		return false
+	}
+	return true
+}
+
+// checkSecondFactor 校验已登录用户提交的验证码或恢复码，失败时计入登录失败次数并写入响应
+func (h *Handlers) checkSecondFactor(c *gin.Context, user *database.User, code string, keys []lockout.Key) bool {
+	_, ok, err := h.verifySecondFactor(user, code)
+	if err != nil {
+		h.logger.Log("error", "两步验证失败", gin.H{"username": user.Username, "error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return false
+	}
+	if !ok {
+		h.recordLoginFailure(c, user.Username, "invalid_totp", keys)
+		h.Error(c, http.StatusBadRequest, "验证码错误")
+		return false
+	}
+	return true
+}
+
+// resetRecoveryCodes 生成新的恢复码并替换用户保存的摘要，返回明文恢复码
+func resetRecoveryCodes(user *database.User) ([]string, error) {
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, utils.HashToken(totp.NormalizeRecoveryCode(code)))
+	}
+	user.RecoveryCodes = hashes
+	return codes, nil
+}
+
+// isTOTPCode 检查输入是否为动态验证码格式（6 位数字），否则按恢复码处理
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"nekobridge/internal/database"
+	"nekobridge/internal/models"
+	"nekobridge/internal/traffic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTrafficPoints 单次查询返回的最大时间段数
+const maxTrafficPoints = 1500
+
+// defaultTrafficSpan 未指定起始时间时各粒度默认查询的时间跨度
+var defaultTrafficSpan = map[string]time.Duration{
+	traffic.GranularityMinute: time.Hour,
+	traffic.GranularityHour:   24 * time.Hour,
+	traffic.GranularityDay:    30 * 24 * time.Hour,
+}
+
+// GetTrafficHistory 获取流量历史
+// 查询参数: granularity (minute, hour, day)、from、to (RFC3339 或 Unix 秒)、secret 和 app_id (可重复或逗号分隔)
+func (h *Handlers) GetTrafficHistory(c *gin.Context) {
+	granularity := c.DefaultQuery("granularity", traffic.GranularityHour)
+	if !traffic.IsValidGranularity(granularity) {
+		h.Error(c, http.StatusBadRequest, "无效的统计粒度，可选值: minute, hour, day")
+		return
+	}
+
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		parsed, err := parseTrafficTime(value)
+		if err != nil {
+			h.Error(c, http.StatusBadRequest, "无效的结束时间")
+			return
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultTrafficSpan[granularity])
+	if value := c.Query("from"); value != "" {
+		parsed, err := parseTrafficTime(value)
+		if err != nil {
+			h.Error(c, http.StatusBadRequest, "无效的开始时间")
+			return
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		h.Error(c, http.StatusBadRequest, "开始时间必须早于结束时间")
+		return
+	}
+
+	// 按时间段对齐，包含 to 所在的时间段
+	start := traffic.BucketStart(from, granularity)
+	end := traffic.NextBucket(traffic.BucketStart(to, granularity), granularity)
+	buckets := make([]time.Time, 0)
+	for bucket := start; bucket.Before(end); bucket = traffic.NextBucket(bucket, granularity) {
+		if len(buckets) >= maxTrafficPoints {
+			h.Error(c, http.StatusBadRequest, "查询范围过大，请缩小时间范围或使用更粗的粒度")
+			return
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	secrets := splitQueryValues(c.QueryArray("secret"))
+	for _, appID := range splitQueryValues(c.QueryArray("app_id")) {
+		secret, exists := h.config.FindSecretByAppID(appID)
+		if !exists {
+			h.Error(c, http.StatusNotFound, "未找到 AppID 对应的密钥: "+appID)
+			return
+		}
+		secrets = append(secrets, secret)
+	}
+
+	// 先写入内存中尚未落库的计数，保证返回最新数据
+	if err := traffic.Flush(); err != nil {
+		h.logger.Log("warning", "写入流量统计失败", gin.H{"error": err.Error()})
+	}
+
+	trafficService := &database.TrafficService{}
+	stats, err := trafficService.Query(granularity, start, end, secrets)
+	if err != nil {
+		h.logger.Log("error", "查询流量历史失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "查询流量历史失败")
+		return
+	}
+
+	byBucket := make(map[int64]database.TrafficStat, len(stats))
+	for _, stat := range stats {
+		byBucket[stat.BucketStart.Unix()] = stat
+	}
+
+	visible := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		visible = append(visible, visibleSecret(c, secret))
+	}
+
+	history := models.TrafficHistory{
+		Granularity: granularity,
+		From:        start,
+		To:          end,
+		Secrets:     visible,
+		Points:      make([]models.TrafficPoint, 0, len(buckets)),
+	}
+	for _, bucket := range buckets {
+		point := models.TrafficPoint{Time: bucket}
+		if stat, exists := byBucket[bucket.Unix()]; exists {
+			point.TrafficCounts = models.TrafficCounts{
+				Received:    stat.Received,
+				Forwarded:   stat.Forwarded,
+				Queued:      stat.Queued,
+				Dropped:     stat.Dropped,
+				Bytes:       stat.Bytes,
+				Connects:    stat.Connects,
+				Disconnects: stat.Disconnects,
+				Errors:      stat.Errors,
+			}
+		}
+		addTrafficCounts(&history.Totals, point.TrafficCounts)
+		history.Points = append(history.Points, point)
+	}
+
+	h.Success(c, history)
+}
+
+// parseTrafficTime 解析 RFC3339 格式或 Unix 秒的时间
+func parseTrafficTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// splitQueryValues 拆分可重复或逗号分隔的查询参数
+func splitQueryValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
+
+// addTrafficCounts 将 src 累加到 dst
+func addTrafficCounts(dst *models.TrafficCounts, src models.TrafficCounts) {
+	dst.Received += src.Received
+	dst.Forwarded += src.Forwarded
+	dst.Queued += src.Queued
+	dst.Dropped += src.Dropped
+	dst.Bytes += src.Bytes
+	dst.Connects += src.Connects
+	dst.Disconnects += src.Disconnects
+	dst.Errors += src.Errors
+}
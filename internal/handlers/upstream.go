@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"nekobridge/internal/models"
+	"nekobridge/internal/utils"
+	"nekobridge/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// internalMessageTypes 由网桥自身处理、不转发到上游的消息类型
+var internalMessageTypes = map[string]bool{
+	"ping":            true,
+	"ack":             true,
+	"openapi_request": true,
+}
+
+// isValidUpstreamURL 检查上游地址是否为 http / https 绝对地址
+func isValidUpstreamURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// upstreamTarget 获取客户端消息需要转发到的上游地址，不需要转发时返回空字符串
+func (h *Handlers) upstreamTarget(secret, messageType string) string {
+	target, types := h.config.GetUpstream(secret)
+	if target == "" || internalMessageTypes[messageType] {
+		return ""
+	}
+	if len(types) == 0 {
+		return target
+	}
+	for _, t := range types {
+		if t == messageType {
+			return target
+		}
+	}
+	return ""
+}
+
+// forwardUpstream 将客户端消息原样 POST 到上游地址，并把响应以 upstream_response 消息返回给同一客户端
+// 响应消息的 id 与客户端消息的 id 相同，客户端未提供 id 时由服务端生成
+func (h *Handlers) forwardUpstream(client *websocket.Client, target string, msg models.WebSocketMessage, body []byte) {
+	requestID := msg.ID
+	if requestID == "" {
+		requestID = generateRequestID()
+	}
+	start := time.Now()
+
+	reply := func(response models.UpstreamResponse) {
+		if response.Error != "" {
+			h.logger.Log("warning", "上游转发失败", gin.H{
+				"secret":     utils.MaskSecret(client.Secret),
+				"client_id":  client.ID,
+				"type":       msg.Type,
+				"request_id": requestID,
+				"error":      response.Error,
+			})
+		}
+		sendResponse(client, "upstream", requestID, response)
+	}
+
+	timeout := time.Duration(h.config.GetUpstreamConfig().Timeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		reply(models.UpstreamResponse{Error: "创建上游请求失败: " + err.Error()})
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", requestID)
+	req.Header.Set("X-Bridge-Client-ID", client.ID)
+	req.Header.Set("X-Bridge-Message-Type", msg.Type)
+
+	resp, err := h.upstreamClient.Do(req)
+	if err != nil {
+		reply(models.UpstreamResponse{Error: "上游请求失败: " + err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	limit := int64(h.config.GetUpstreamConfig().MaxResponseSize)
+	if limit <= 0 {
+		limit = 1048576
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		reply(models.UpstreamResponse{Status: resp.StatusCode, Error: "读取上游响应失败: " + err.Error()})
+		return
+	}
+	if int64(len(data)) > limit {
+		reply(models.UpstreamResponse{Status: resp.StatusCode, Error: "上游响应超过最大大小 " + strconv.FormatInt(limit, 10) + " 字节"})
+		return
+	}
+
+	h.logger.Log("info", "客户端消息已转发到上游", gin.H{
+		"secret":     utils.MaskSecret(client.Secret),
+		"client_id":  client.ID,
+		"type":       msg.Type,
+		"request_id": requestID,
+		"status":     resp.StatusCode,
+		"duration":   time.Since(start).String(),
+	})
+	reply(models.UpstreamResponse{
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        embedBody(data),
+	})
+}
+
+// sendResponse 将转发结果以 <kind>_response 消息返回给客户端，失败时为 <kind>_error
+func sendResponse(client *websocket.Client, kind, requestID string, response models.UpstreamResponse) {
+	messageType := kind + "_response"
+	if response.Error != "" {
+		messageType = kind + "_error"
+	}
+	client.SendMessage(models.WebSocketMessage{
+		Type:   messageType,
+		ID:     requestID,
+		Data:   response,
+		Format: models.MessageFormatJSON,
+	})
+}
+
+// embedBody 响应体是合法 JSON 时原样嵌入消息，否则作为字符串
+func embedBody(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	return string(data)
+}
+
+// generateRequestID 生成上游请求ID
+func generateRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
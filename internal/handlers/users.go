@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"nekobridge/internal/audit"
+	"nekobridge/internal/database"
+	"nekobridge/internal/models"
+	"nekobridge/internal/rbac"
+	"nekobridge/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// minPasswordLength 用户密码的最小长度
+const minPasswordLength = 8
+
+// maxUsernameLength 用户名的最大长度
+const maxUsernameLength = 64
+
+// GetUsers 获取所有用户
+func (h *Handlers) GetUsers(c *gin.Context) {
+	userService := &database.UserService{}
+	users, err := userService.GetUsers()
+	if err != nil {
+		h.logger.Log("error", "获取用户列表失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "获取用户列表失败")
+		return
+	}
+
+	h.Success(c, gin.H{
+		"users": users,
+		"roles": rbac.Roles(),
+	})
+}
+
+// CreateUser 创建用户
+func (h *Handlers) CreateUser(c *gin.Context) {
+	var req models.CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "用户名、密码和角色不能为空")
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if username == "" || len(username) > maxUsernameLength {
+		h.Error(c, http.StatusBadRequest, "无效的用户名")
+		return
+	}
+	if !rbac.IsValidRole(req.Role) {
+		h.Error(c, http.StatusBadRequest, "无效的角色，可选值: viewer, operator, admin")
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		h.Error(c, http.StatusBadRequest, "密码长度不能少于8位")
+		return
+	}
+
+	userService := &database.UserService{}
+	if _, err := userService.GetUser(username); err == nil {
+		h.Error(c, http.StatusConflict, "用户名已存在")
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		h.logger.Log("error", "密码加密失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+
+	current, _ := c.Get("user")
+	claims := current.(*utils.Claims)
+
+	user := &database.User{
+		Username:     username,
+		PasswordHash: passwordHash,
+		Role:         req.Role,
+		Enabled:      req.Enabled == nil || *req.Enabled,
+		CreatedBy:    claims.Username,
+	}
+	if err := userService.CreateUser(user); err != nil {
+		h.audit(c, audit.ActionUserCreate, username, nil, user, err)
+		h.logger.Log("error", "创建用户失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "创建用户失败")
+		return
+	}
+
+	h.audit(c, audit.ActionUserCreate, user.Username, nil, user, nil)
+	h.logger.Log("info", "创建用户", gin.H{
+		"admin":    claims.Username,
+		"username": user.Username,
+		"role":     user.Role,
+	})
+
+	h.Success(c, user, "用户创建成功")
+}
+
+// UpdateUser 更新用户的角色、启用状态或密码
+func (h *Handlers) UpdateUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.Error(c, http.StatusBadRequest, "无效的用户ID")
+		return
+	}
+
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "无效的请求数据")
+		return
+	}
+	if req.Role != "" && !rbac.IsValidRole(req.Role) {
+		h.Error(c, http.StatusBadRequest, "无效的角色，可选值: viewer, operator, admin")
+		return
+	}
+	if req.Password != "" && len(req.Password) < minPasswordLength {
+		h.Error(c, http.StatusBadRequest, "密码长度不能少于8位")
+		return
+	}
+
+	userService := &database.UserService{}
+	user, err := userService.GetUserByID(uint(id))
+	if err != nil {
+		h.Error(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+
+	role := user.Role
+	if req.Role != "" {
+		role = req.Role
+	}
+	enabled := user.Enabled
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	if isActiveAdmin(user) && (role != rbac.RoleAdmin || !enabled) {
+		if err := h.ensureOtherAdmin(); err != nil {
+			h.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// 密码哈希不参与序列化，单独记录是否重置了密码
+	before := gin.H{"role": user.Role, "enabled": user.Enabled, "password_reset": false}
+	user.Role = role
+	user.Enabled = enabled
+	if req.Password != "" {
+		passwordHash, err := utils.HashPassword(req.Password)
+		if err != nil {
+			h.logger.Log("error", "密码加密失败", gin.H{"error": err.Error()})
+			h.Error(c, http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		user.PasswordHash = passwordHash
+	}
+
+	after := gin.H{"role": user.Role, "enabled": user.Enabled, "password_reset": req.Password != ""}
+	if err := userService.UpdateUser(user); err != nil {
+		h.audit(c, audit.ActionUserUpdate, user.Username, before, after, err)
+		h.logger.Log("error", "更新用户失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "更新用户失败")
+		return
+	}
+	if !user.Enabled || req.Password != "" {
+		h.revokeSessions(user.Username, "")
+	}
+
+	current, _ := c.Get("user")
+	claims := current.(*utils.Claims)
+	h.audit(c, audit.ActionUserUpdate, user.Username, before, after, nil)
+	h.logger.Log("info", "更新用户", gin.H{
+		"admin":            claims.Username,
+		"username":         user.Username,
+		"role":             user.Role,
+		"enabled":          user.Enabled,
+		"password_changed": req.Password != "",
+	})
+
+	h.Success(c, user, "用户更新成功")
+}
+
+// DeleteUser 删除用户
+func (h *Handlers) DeleteUser(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		h.Error(c, http.StatusBadRequest, "无效的用户ID")
+		return
+	}
+
+	userService := &database.UserService{}
+	user, err := userService.GetUserByID(uint(id))
+	if err != nil {
+		h.Error(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+
+	current, _ := c.Get("user")
+	claims := current.(*utils.Claims)
+	if user.Username == claims.Username {
+		h.Error(c, http.StatusBadRequest, "不能删除当前登录的用户")
+		return
+	}
+	if isActiveAdmin(user) {
+		if err := h.ensureOtherAdmin(); err != nil {
+			h.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if err := userService.DeleteUser(user.ID); err != nil {
+		h.audit(c, audit.ActionUserDelete, user.Username, user, nil, err)
+		h.logger.Log("error", "删除用户失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "删除用户失败")
+		return
+	}
+	h.revokeSessions(user.Username, "")
+
+	h.audit(c, audit.ActionUserDelete, user.Username, user, nil, nil)
+	h.logger.Log("info", "删除用户", gin.H{
+		"admin":    claims.Username,
+		"username": user.Username,
+	})
+
+	h.Success(c, nil, "用户删除成功")
+}
+
+// ChangePassword 修改当前用户的密码
+func (h *Handlers) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.Error(c, http.StatusBadRequest, "原密码和新密码不能为空")
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		h.Error(c, http.StatusBadRequest, "密码长度不能少于8位")
+		return
+	}
+
+	current, _ := c.Get("user")
+	claims := current.(*utils.Claims)
+
+	userService := &database.UserService{}
+	user, err := userService.GetUser(claims.Username)
+	if err != nil {
+		h.Error(c, http.StatusNotFound, "用户不存在")
+		return
+	}
+	if !utils.CheckPasswordHash(req.OldPassword, user.PasswordHash) {
+		h.Error(c, http.StatusBadRequest, "原密码错误")
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		h.logger.Log("error", "密码加密失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	user.PasswordHash = passwordHash
+	if err := userService.UpdateUser(user); err != nil {
+		h.audit(c, audit.ActionAuthPasswordChange, user.Username, nil, nil, err)
+		h.logger.Log("error", "修改密码失败", gin.H{"error": err.Error()})
+		h.Error(c, http.StatusInternalServerError, "修改密码失败")
+		return
+	}
+	// 保留当前会话，其他设备需要重新登录
+	h.revokeSessions(user.Username, claims.ID)
+
+	h.audit(c, audit.ActionAuthPasswordChange, user.Username, nil, nil, nil)
+	h.logger.Log("info", "用户修改密码", gin.H{"username": user.Username})
+
+	h.Success(c, nil, "密码修改成功")
+}
+
+// isActiveAdmin 检查用户是否为启用的管理员
+func isActiveAdmin(user *database.User) bool {
+	return user.Role == rbac.RoleAdmin && user.Enabled
+}
+
+// ensureOtherAdmin 确保移除一个管理员后仍至少保留一个启用的管理员
+func (h *Handlers) ensureOtherAdmin() error {
+	userService := &database.UserService{}
+	count, err := userService.CountActiveByRole(rbac.RoleAdmin)
+	if err != nil {
+		h.logger.Log("error", "统计管理员数量失败", gin.H{"error": err.Error()})
+		return errors.New("统计管理员数量失败")
+	}
+	if count <= 1 {
+		return errors.New("至少需要保留一个启用的管理员")
+	}
+	return nil
+}
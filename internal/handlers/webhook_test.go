@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/utils"
+	"nekobridge/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWebhookSignatureTimestamp(t *testing.T) {
+	const secret = "webhook-secret-0123456789"
+	cfg := &config.Config{Security: config.SecurityConfig{EnableSignatureValidation: true, SignatureMaxSkew: 300}}
+	cfg.AddSecret(secret, config.SecretConfig{Enabled: true, AppID: "1001"})
+	signer, err := utils.NewEd25519Signer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有连接且离线队列关闭，签名通过的消息返回 202
+	wsManager := websocket.NewManager()
+	wsManager.SetConfig(cfg)
+	h := &Handlers{
+		config:      cfg,
+		wsManager:   wsManager,
+		logger:      utils.NewLogger(100, "info"),
+		signer:      signer,
+		sigFailures: make(map[string]int64),
+	}
+
+	body := []byte(`{"op":0,"t":"AT_MESSAGE_CREATE","d":{}}`)
+	now := time.Now()
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		tamper    bool // 签名与请求体不匹配
+		status    int
+		error     string
+	}{
+		{name: "时间戳在允许范围内", timestamp: now.Add(-4 * time.Minute), status: http.StatusAccepted},
+		{name: "时间戳过旧", timestamp: now.Add(-10 * time.Minute), status: http.StatusUnauthorized, error: "timestamp"},
+		{name: "时间戳超前", timestamp: now.Add(10 * time.Minute), status: http.StatusUnauthorized, error: "timestamp"},
+		{name: "签名不匹配", timestamp: now, tamper: true, status: http.StatusUnauthorized, error: "signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timestamp := strconv.FormatInt(tt.timestamp.Unix(), 10)
+			signed := body
+			if tt.tamper {
+				signed = []byte(`{"op":0}`)
+			}
+			sig, err := signer.GenerateSignature(secret, timestamp, string(signed))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/webhook", bytes.NewReader(body))
+			c.Request.Header.Set("X-Bot-Appid", "1001")
+			c.Request.Header.Set("X-Signature-Timestamp", timestamp)
+			c.Request.Header.Set("X-Signature-Ed25519", sig["signature"])
+
+			h.Webhook(c)
+			if recorder.Code != tt.status {
+				t.Fatalf("状态码 = %d，应为 %d: %s", recorder.Code, tt.status, recorder.Body.String())
+			}
+			if tt.error != "" && !strings.Contains(recorder.Body.String(), tt.error) {
+				t.Errorf("响应 = %s，应包含 %q", recorder.Body.String(), tt.error)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package lockout
+
+import (
+	"container/list"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 计数维度
+const (
+	ScopeIP       = "ip"
+	ScopeUsername = "username"
+)
+
+// maxEntries 内存中保留的最大计数条目数，达到后淘汰最久没有失败、且不在退避或锁定中的条目
+const maxEntries = 10000
+
+// OverflowValue 溢出条目的值，条目数达到上限且都处于退避或锁定中时，新的 IP 或用户名合并到所在维度的溢出条目中计数
+const OverflowValue = "*"
+
+// Policy 退避和锁定策略
+type Policy struct {
+	FreeAttempts    int           // 不触发退避的连续失败次数
+	BaseDelay       time.Duration // 首次退避时间，之后每次失败翻倍
+	MaxDelay        time.Duration // 退避时间上限
+	MaxFailures     int           // 连续失败达到该次数后锁定
+	LockoutDuration time.Duration // 锁定时间，也是失败计数的保留时间
+}
+
+// Key 计数键，按来源 IP 或用户名分别计数
+type Key struct {
+	Scope string `json:"scope"`
+	Value string `json:"value"`
+}
+
+// Status 计数条目的状态
+type Status struct {
+	Key
+	Failures     int       `json:"failures"`
+	LastFailure  time.Time `json:"last_failure"`
+	BlockedUntil time.Time `json:"blocked_until"`
+	Locked       bool      `json:"locked"` // true 表示达到失败上限被锁定，false 表示处于退避中
+}
+
+// entry 计数条目
+type entry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	locked       bool
+	element      *list.Element // 在 Guard.order 中的位置
+}
+
+// Guard 登录失败计数器，按来源 IP 和用户名分别计算指数退避和临时锁定
+type Guard struct {
+	mu      sync.Mutex
+	policy  Policy
+	entries map[Key]*entry
+	order   *list.List // 按最后一次失败的时间排列的键，最久没有失败的在最前
+}
+
+// NewGuard 创建登录失败计数器
+func NewGuard(policy Policy) *Guard {
+	return &Guard{
+		policy:  policy,
+		entries: make(map[Key]*entry),
+		order:   list.New(),
+	}
+}
+
+// SetPolicy 修改退避和锁定策略，已有的计数保留，之后的失败按新策略计算
+func (g *Guard) SetPolicy(policy Policy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = policy
+}
+
+// Check 检查是否允许尝试登录，返回需要等待的时间和是否处于锁定状态
+func (g *Guard) Check(keys ...Key) (retryAfter time.Duration, locked bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		e, exists := g.entries[key]
+		if !exists {
+			// 没有单独计数的键按所在维度的溢出条目检查
+			e, exists = g.entries[overflowKey(key)]
+		}
+		if !exists || !now.Before(e.blockedUntil) {
+			continue
+		}
+		if wait := e.blockedUntil.Sub(now); wait > retryAfter {
+			retryAfter = wait
+		}
+		locked = locked || e.locked
+	}
+	return retryAfter, locked
+}
+
+// Fail 记录一次失败，返回本次失败后新进入锁定状态的键
+func (g *Guard) Fail(keys ...Key) []Key {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var lockedKeys []Key
+	for _, key := range keys {
+		e, exists := g.entries[key]
+		if !exists && len(g.entries) >= maxEntries && !g.evict(now) {
+			key = overflowKey(key)
+			e, exists = g.entries[key]
+		}
+		if exists && g.expired(e, now) {
+			g.remove(key, e)
+			exists = false
+		}
+		if !exists {
+			e = &entry{}
+			e.element = g.order.PushBack(key)
+			g.entries[key] = e
+		}
+		g.order.MoveToBack(e.element)
+		e.failures++
+		e.lastFailure = now
+
+		switch {
+		case g.policy.MaxFailures > 0 && e.failures >= g.policy.MaxFailures:
+			if !e.locked {
+				lockedKeys = append(lockedKeys, key)
+			}
+			e.locked = true
+			e.blockedUntil = now.Add(g.policy.LockoutDuration)
+		case e.failures > g.policy.FreeAttempts:
+			e.blockedUntil = now.Add(g.backoff(e.failures - g.policy.FreeAttempts))
+		}
+	}
+	return lockedKeys
+}
+
+// Reset 清除计数，返回是否存在被清除的条目
+func (g *Guard) Reset(keys ...Key) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	removed := false
+	for _, key := range keys {
+		if e, exists := g.entries[key]; exists {
+			g.remove(key, e)
+			removed = true
+		}
+	}
+	return removed
+}
+
+// Blocked 获取当前处于退避或锁定状态的条目，按解除时间倒序排列
+func (g *Guard) Blocked() []Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]Status, 0)
+	for key, e := range g.entries {
+		if !now.Before(e.blockedUntil) {
+			continue
+		}
+		statuses = append(statuses, Status{
+			Key:          key,
+			Failures:     e.failures,
+			LastFailure:  e.lastFailure,
+			BlockedUntil: e.blockedUntil,
+			Locked:       e.locked,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].BlockedUntil.After(statuses[j].BlockedUntil)
+	})
+	return statuses
+}
+
+// backoff 计算第 n 次退避的等待时间
+func (g *Guard) backoff(n int) time.Duration {
+	delay := float64(g.policy.BaseDelay) * math.Pow(2, float64(n-1))
+	if g.policy.MaxDelay > 0 && delay > float64(g.policy.MaxDelay) {
+		return g.policy.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// expired 检查条目是否已过保留时间，过期的失败计数重新开始
+func (g *Guard) expired(e *entry, now time.Time) bool {
+	return !now.Before(e.blockedUntil) && now.Sub(e.lastFailure) >= g.policy.LockoutDuration
+}
+
+// evict 淘汰最久没有失败、且不在退避或锁定中的条目，腾出一个位置；所有条目都处于退避或锁定中时返回 false
+// 处于退避或锁定中的条目不能淘汰，否则轮换用户名就能清除正在生效的锁定
+func (g *Guard) evict(now time.Time) bool {
+	for element := g.order.Front(); element != nil; element = element.Next() {
+		key := element.Value.(Key)
+		if e := g.entries[key]; !now.Before(e.blockedUntil) {
+			g.remove(key, e)
+			return true
+		}
+	}
+	return false
+}
+
+// overflowKey 获取键所在维度的溢出条目
+func overflowKey(key Key) Key {
+	return Key{Scope: key.Scope, Value: OverflowValue}
+}
+
+// remove 删除条目
+func (g *Guard) remove(key Key, e *entry) {
+	g.order.Remove(e.element)
+	delete(g.entries, key)
+}
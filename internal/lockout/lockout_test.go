@@ -0,0 +1,180 @@
+package lockout
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	g := NewGuard(Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second})
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{10, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := g.backoff(tt.n); got != tt.want {
+			t.Errorf("backoff(%d) = %v，应为 %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFailAndCheck(t *testing.T) {
+	policy := Policy{
+		FreeAttempts:    2,
+		BaseDelay:       time.Minute,
+		MaxDelay:        time.Hour,
+		MaxFailures:     5,
+		LockoutDuration: time.Hour,
+	}
+	ip := Key{Scope: ScopeIP, Value: "10.0.0.1"}
+	user := Key{Scope: ScopeUsername, Value: "admin"}
+
+	tests := []struct {
+		failures   int
+		wantWait   time.Duration // 大致的等待时间，0 表示允许登录
+		wantLocked bool
+	}{
+		{1, 0, false},
+		{2, 0, false},
+		{3, time.Minute, false},
+		{4, 2 * time.Minute, false},
+		{5, time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.failures), func(t *testing.T) {
+			g := NewGuard(policy)
+			var locked []Key
+			for i := 0; i < tt.failures; i++ {
+				locked = g.Fail(ip, user)
+			}
+
+			wait, isLocked := g.Check(ip)
+			if isLocked != tt.wantLocked {
+				t.Errorf("locked = %v，应为 %v", isLocked, tt.wantLocked)
+			}
+			if wait > tt.wantWait || wait < tt.wantWait-time.Second {
+				t.Errorf("等待时间 = %v，应约为 %v", wait, tt.wantWait)
+			}
+			if tt.wantLocked && len(locked) != 2 {
+				t.Errorf("新锁定的键 = %v，应为 IP 和用户名", locked)
+			}
+			if other, _ := g.Check(Key{Scope: ScopeIP, Value: "10.0.0.2"}); other != 0 {
+				t.Errorf("其他 IP 的等待时间 = %v，应为 0", other)
+			}
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	g := NewGuard(Policy{MaxFailures: 2, LockoutDuration: 20 * time.Millisecond})
+	key := Key{Scope: ScopeUsername, Value: "admin"}
+
+	g.Fail(key)
+	if locked := g.Fail(key); len(locked) != 1 {
+		t.Fatalf("第二次失败后应锁定，新锁定的键 = %v", locked)
+	}
+	if _, locked := g.Check(key); !locked {
+		t.Fatal("锁定期间 Check 应返回 locked")
+	}
+	if len(g.Blocked()) != 1 {
+		t.Errorf("Blocked() = %v，应有 1 条", g.Blocked())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if wait, locked := g.Check(key); wait != 0 || locked {
+		t.Errorf("锁定过期后 Check = (%v, %v)，应允许登录", wait, locked)
+	}
+	if len(g.Blocked()) != 0 {
+		t.Errorf("锁定过期后 Blocked() = %v，应为空", g.Blocked())
+	}
+	// 过期后的失败重新计数
+	if locked := g.Fail(key); len(locked) != 0 {
+		t.Errorf("过期后第一次失败不应锁定，新锁定的键 = %v", locked)
+	}
+}
+
+func TestReset(t *testing.T) {
+	g := NewGuard(Policy{MaxFailures: 1, LockoutDuration: time.Hour})
+	key := Key{Scope: ScopeIP, Value: "10.0.0.1"}
+	g.Fail(key)
+
+	if !g.Reset(key) {
+		t.Error("Reset 应返回 true")
+	}
+	if g.Reset(key) {
+		t.Error("重复 Reset 应返回 false")
+	}
+	if wait, _ := g.Check(key); wait != 0 {
+		t.Errorf("Reset 后等待时间 = %v，应为 0", wait)
+	}
+}
+
+func TestEvictOldest(t *testing.T) {
+	g := NewGuard(Policy{FreeAttempts: 1, BaseDelay: time.Second, MaxFailures: 2, LockoutDuration: time.Hour})
+	key := func(i int) Key { return Key{Scope: ScopeIP, Value: strconv.Itoa(i)} }
+
+	// 最久没有失败的条目处于锁定中，不能被淘汰
+	g.Fail(key(0), key(0))
+	for i := 1; i < maxEntries; i++ {
+		g.Fail(key(i))
+	}
+	// 再次失败的条目变为最近使用，不会被淘汰
+	g.Fail(key(1))
+	g.Fail(key(maxEntries))
+
+	if len(g.entries) != maxEntries || g.order.Len() != maxEntries {
+		t.Fatalf("条目数 = %d/%d，应为 %d", len(g.entries), g.order.Len(), maxEntries)
+	}
+	if _, exists := g.entries[key(2)]; exists {
+		t.Error("最久没有失败且未锁定的条目应被淘汰")
+	}
+	for _, i := range []int{0, 1} {
+		if _, locked := g.Check(key(i)); !locked {
+			t.Errorf("条目 %d 应仍处于锁定中", i)
+		}
+	}
+	if _, exists := g.entries[key(maxEntries)]; !exists {
+		t.Error("新条目应单独计数")
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	g := NewGuard(Policy{MaxFailures: 1, LockoutDuration: time.Hour})
+	key := func(i int) Key { return Key{Scope: ScopeUsername, Value: strconv.Itoa(i)} }
+	overflow := Key{Scope: ScopeUsername, Value: OverflowValue}
+
+	for i := 0; i < maxEntries; i++ {
+		g.Fail(key(i))
+	}
+	// 所有条目都处于锁定中，新用户名合并到溢出条目，已有的锁定保持不变
+	if locked := g.Fail(key(maxEntries)); len(locked) != 1 || locked[0] != overflow {
+		t.Fatalf("新锁定的键 = %v，应为溢出条目", locked)
+	}
+	if _, exists := g.entries[key(maxEntries)]; exists {
+		t.Error("条目数达到上限时新用户名不应单独计数")
+	}
+	for _, i := range []int{0, maxEntries - 1} {
+		if _, locked := g.Check(key(i)); !locked {
+			t.Errorf("条目 %d 应仍处于锁定中", i)
+		}
+	}
+	if _, locked := g.Check(key(maxEntries + 1)); !locked {
+		t.Error("没有单独计数的用户名应按溢出条目检查")
+	}
+	if _, locked := g.Check(Key{Scope: ScopeIP, Value: "10.0.0.1"}); locked {
+		t.Error("溢出条目只影响所在的维度")
+	}
+
+	g.Reset(overflow)
+	if wait, _ := g.Check(key(maxEntries + 1)); wait != 0 {
+		t.Errorf("解除溢出条目后等待时间 = %v，应为 0", wait)
+	}
+}
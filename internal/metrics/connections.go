@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SecretConnections 单个密钥的连接和队列状况
+type SecretConnections struct {
+	Clients           int   // 当前客户端数
+	SendQueueDepth    int   // 所有客户端发送队列中等待写入的消息数
+	OfflineQueueDepth int64 // 离线队列中待补发的消息数
+}
+
+// ConnectionSource 连接状况的数据来源，由 WebSocket 管理器实现
+type ConnectionSource interface {
+	GetConnectionCount() int
+	GetTotalConnections() int
+	SecretConnections() map[string]SecretConnections
+}
+
+// connectionCollector 在每次抓取时从 WebSocket 管理器读取连接数和队列长度
+type connectionCollector struct {
+	source ConnectionSource
+
+	active       *prometheus.Desc
+	total        *prometheus.Desc
+	clients      *prometheus.Desc
+	sendQueue    *prometheus.Desc
+	offlineQueue *prometheus.Desc
+}
+
+// RegisterConnections 注册连接状况指标
+func RegisterConnections(source ConnectionSource) {
+	Registry.MustRegister(&connectionCollector{
+		source: source,
+		active: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "websocket", "connections"),
+			"当前 WebSocket 连接数", nil, nil),
+		total: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "websocket", "connections_total"),
+			"累计 WebSocket 连接数", nil, nil),
+		clients: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "websocket", "secret_connections"),
+			"每个密钥当前的 WebSocket 连接数", []string{"secret"}, nil),
+		sendQueue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "websocket", "send_queue_depth"),
+			"每个密钥所有连接发送队列中等待写入的消息数", []string{"secret"}, nil),
+		offlineQueue: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "offline_queue", "depth"),
+			"每个密钥离线队列中待补发的消息数", []string{"secret"}, nil),
+	})
+}
+
+// Describe 实现 prometheus.Collector
+func (c *connectionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.total
+	ch <- c.clients
+	ch <- c.sendQueue
+	ch <- c.offlineQueue
+}
+
+// Collect 实现 prometheus.Collector
+func (c *connectionCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(c.source.GetConnectionCount()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.CounterValue, float64(c.source.GetTotalConnections()))
+
+	// 不同密钥遮盖后可能相同，按标签合并后再输出，避免重复的指标
+	merged := make(map[string]SecretConnections)
+	for secret, stats := range c.source.SecretConnections() {
+		label := secretLabel(secret)
+		total := merged[label]
+		total.Clients += stats.Clients
+		total.SendQueueDepth += stats.SendQueueDepth
+		total.OfflineQueueDepth += stats.OfflineQueueDepth
+		merged[label] = total
+	}
+
+	for label, stats := range merged {
+		ch <- prometheus.MustNewConstMetric(c.clients, prometheus.GaugeValue, float64(stats.Clients), label)
+		ch <- prometheus.MustNewConstMetric(c.sendQueue, prometheus.GaugeValue, float64(stats.SendQueueDepth), label)
+		ch <- prometheus.MustNewConstMetric(c.offlineQueue, prometheus.GaugeValue, float64(stats.OfflineQueueDepth), label)
+	}
+}
@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"nekobridge/internal/utils"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// namespace 所有指标名称的前缀
+const namespace = "nekobridge"
+
+// 消息方向
+const (
+	DirectionIn  = "in"  // 客户端发送到服务端
+	DirectionOut = "out" // 服务端发送到客户端
+)
+
+// Registry 导出到 /metrics 的指标注册表
+var Registry = prometheus.NewRegistry()
+
+var (
+	webhookRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "requests_total",
+		Help:      "Webhook 请求数，按密钥和响应状态码统计",
+	}, []string{"secret", "status"})
+
+	webhookBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "received_bytes_total",
+		Help:      "Webhook 请求体字节数",
+	}, []string{"secret"})
+
+	signatureFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "signature_failures_total",
+		Help:      "Webhook 事件签名校验失败次数",
+	}, []string{"secret"})
+
+	forwardDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "forward_duration_seconds",
+		Help:      "Webhook 消息投递到 WebSocket 客户端（或写入离线队列）的耗时",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"secret", "result"})
+
+	wsMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "messages_total",
+		Help:      "WebSocket 数据帧数，按密钥和方向统计",
+	}, []string{"secret", "direction"})
+
+	wsBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "bytes_total",
+		Help:      "WebSocket 数据帧字节数，按密钥和方向统计",
+	}, []string{"secret", "direction"})
+
+	sendQueueDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "send_queue_dropped_total",
+		Help:      "因连接发送队列已满丢弃的消息数",
+	}, []string{"secret", "policy"})
+
+	offlineQueueDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "offline_queue",
+		Name:      "dropped_total",
+		Help:      "因离线队列达到上限丢弃的消息数",
+	}, []string{"secret"})
+
+	heartbeatFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "websocket",
+		Name:      "heartbeat_failures_total",
+		Help:      "服务端心跳发送失败并移除连接的次数",
+	}, []string{"secret"})
+
+	loginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "login_failures_total",
+		Help:      "管理后台登录失败次数，按原因统计",
+	}, []string{"reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		webhookRequests,
+		webhookBytes,
+		signatureFailures,
+		forwardDuration,
+		wsMessages,
+		wsBytes,
+		sendQueueDropped,
+		offlineQueueDropped,
+		heartbeatFailures,
+		loginFailures,
+	)
+}
+
+// unknownSecret 无法确定密钥时使用的标签
+const unknownSecret = "unknown"
+
+// secretLabel 指标中的密钥标签，与日志一致只保留首尾几个字符，secret 为空时为 unknown
+func secretLabel(secret string) string {
+	if secret == "" {
+		return unknownSecret
+	}
+	return utils.MaskSecret(secret)
+}
+
+// ObserveWebhook 记录一次 Webhook 请求，secret 为空表示未能确定密钥
+func ObserveWebhook(secret string, status int, size int) {
+	label := secretLabel(secret)
+	webhookRequests.WithLabelValues(label, strconv.Itoa(status)).Inc()
+	if size > 0 {
+		webhookBytes.WithLabelValues(label).Add(float64(size))
+	}
+}
+
+// ObserveSignatureFailure 记录一次签名校验失败
+func ObserveSignatureFailure(secret string) {
+	signatureFailures.WithLabelValues(secretLabel(secret)).Inc()
+}
+
+// ObserveForward 记录 Webhook 消息的投递耗时，result 为 delivered、queued、dropped 或 failed
+func ObserveForward(secret, result string, duration time.Duration) {
+	forwardDuration.WithLabelValues(secretLabel(secret), result).Observe(duration.Seconds())
+}
+
+// ObserveMessage 记录一帧 WebSocket 数据
+func ObserveMessage(secret, direction string, size int) {
+	label := secretLabel(secret)
+	wsMessages.WithLabelValues(label, direction).Inc()
+	wsBytes.WithLabelValues(label, direction).Add(float64(size))
+}
+
+// ObserveSendQueueDrop 记录一条因发送队列已满丢弃的消息
+func ObserveSendQueueDrop(secret, policy string) {
+	sendQueueDropped.WithLabelValues(secretLabel(secret), policy).Inc()
+}
+
+// ObserveOfflineQueueDrop 记录因离线队列已满丢弃的消息
+func ObserveOfflineQueueDrop(secret string, count int64) {
+	offlineQueueDropped.WithLabelValues(secretLabel(secret)).Add(float64(count))
+}
+
+// ObserveHeartbeatFailure 记录一次心跳失败
+func ObserveHeartbeatFailure(secret string) {
+	heartbeatFailures.WithLabelValues(secretLabel(secret)).Inc()
+}
+
+// ObserveLoginFailure 记录一次登录失败
+func ObserveLoginFailure(reason string) {
+	loginFailures.WithLabelValues(reason).Inc()
+}
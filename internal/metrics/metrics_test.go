@@ -0,0 +1,18 @@
+package metrics
+
+import "testing"
+
+func TestSecretLabel(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{"", "unknown"},
+		{"abcd12345678wxyz", "abcd********wxyz"},
+	}
+	for _, tt := range tests {
+		if got := secretLabel(tt.secret); got != tt.want {
+			t.Errorf("secretLabel(%q) = %q，应为 %q", tt.secret, got, tt.want)
+		}
+	}
+}
@@ -36,26 +36,59 @@ func (l LogEntry) MarshalJSON() ([]byte, error) {
 
 // Connection 连接信息
 type Connection struct {
-	Secret      string     `json:"secret"`
-	Connected   bool       `json:"connected"`
-	Enabled     bool       `json:"enabled"`
-	Description string     `json:"description,omitempty"`
-	CreatedAt   *time.Time `json:"created_at,omitempty"`
-	LastUsed    *time.Time `json:"last_used,omitempty"`
-	ConnectedAt time.Time  `json:"connected_at"`
+	ID           string     `json:"id"`
+	Secret       string     `json:"secret"`
+	RemoteAddr   string     `json:"remote_addr,omitempty"`
+	Connected    bool       `json:"connected"`
+	Enabled      bool       `json:"enabled"`
+	Description  string     `json:"description,omitempty"`
+	DeliveryMode string     `json:"delivery_mode,omitempty"`
+	Protocol     string     `json:"protocol,omitempty"`
+	SessionID    string     `json:"session_id,omitempty"` // 可恢复会话的ID（qq、bridge 协议）
+	LastSeq      int64      `json:"last_seq,omitempty"`   // bridge 协议最后下发的序号
+	AckedSeq     int64      `json:"acked_seq,omitempty"`  // bridge 协议客户端已确认的序号
+	Primary      bool       `json:"primary,omitempty"`    // failover 模式下当前接收消息的客户端
+	QueueDepth   int        `json:"queue_depth"`          // 发送队列中等待写入的消息数
+	QueueSize    int        `json:"queue_size"`           // 发送队列容量
+	Dropped      uint64     `json:"dropped"`              // 因发送队列已满丢弃的消息数
+	Sent         uint64     `json:"sent"`                 // 已写入连接的消息数
+	CreatedAt    *time.Time `json:"created_at,omitempty"`
+	LastUsed     *time.Time `json:"last_used,omitempty"`
+	ConnectedAt  time.Time  `json:"connected_at"`
+
+	Settings *ConnectionSettings `json:"settings,omitempty"` // 连接当前生效的读写设置
+}
+
+// ConnectionSettings 连接实际生效的读写设置，时间单位为毫秒
+type ConnectionSettings struct {
+	ReadTimeout       int64     `json:"read_timeout"`     // 读超时，开启心跳时至少为两个心跳间隔
+	WriteTimeout      int64     `json:"write_timeout"`    // 0 表示不限制
+	MaxMessageSize    int64     `json:"max_message_size"` // 0 表示不限制
+	Heartbeat         bool      `json:"heartbeat"`
+	HeartbeatInterval int64     `json:"heartbeat_interval"`
+	HeartbeatTimeout  int64     `json:"heartbeat_timeout"`
+	AppliedAt         time.Time `json:"applied_at"` // 设置生效的时间
 }
 
 // Secret 密钥信息
 type Secret struct {
-	Secret        string     `json:"secret"`
-	Name          string     `json:"name,omitempty"`
-	Enabled       bool       `json:"enabled"`
-	Description   string     `json:"description,omitempty"`
-	MaxConnections int       `json:"max_connections,omitempty"`
-	CreatedAt     time.Time  `json:"created_at"`
-	UpdatedAt     time.Time  `json:"updated_at,omitempty"`
-	CreatedBy     string     `json:"created_by,omitempty"`
-	LastUsed      *time.Time `json:"last_used,omitempty"`
+	Secret            string     `json:"secret"`
+	Name              string     `json:"name,omitempty"`
+	Enabled           bool       `json:"enabled"`
+	Description       string     `json:"description,omitempty"`
+	AppID             string     `json:"app_id,omitempty"`
+	MaxConnections    int        `json:"max_connections,omitempty"`
+	DeliveryMode      string     `json:"delivery_mode,omitempty"`
+	Protocol          string     `json:"protocol,omitempty"`
+	UpstreamURL       string     `json:"upstream_url,omitempty"`
+	UpstreamTypes     []string   `json:"upstream_types,omitempty"`
+	QueueMaxAge       int        `json:"queue_max_age,omitempty"`
+	QueueMaxMessages  int        `json:"queue_max_messages,omitempty"`
+	SignatureFailures int64      `json:"signature_failures,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at,omitempty"`
+	CreatedBy         string     `json:"created_by,omitempty"`
+	LastUsed          *time.Time `json:"last_used,omitempty"`
 }
 
 
@@ -71,11 +104,105 @@ const (
 // WebSocketMessage WebSocket消息
 type WebSocketMessage struct {
 	Type   string        `json:"type"`
+	ID     string        `json:"id,omitempty"`  // 请求ID，用于关联上游转发的请求与响应
+	Seq    int64         `json:"seq,omitempty"` // bridge 协议的事件序号，客户端确认时回传
 	Data   any           `json:"data"`
 	Format MessageFormat `json:"format,omitempty"` // 消息格式
 	Raw    []byte        `json:"-"`                // 原始二进制数据（不序列化）
 }
 
+// UpstreamResponse 客户端请求转发到上游 HTTP 服务或 OpenAPI 后返回给客户端的结果
+type UpstreamResponse struct {
+	Status      int    `json:"status,omitempty"`       // 上游 HTTP 状态码
+	ContentType string `json:"content_type,omitempty"` // 上游响应的 Content-Type
+	Body        any    `json:"body,omitempty"`         // 响应体，JSON 原样嵌入，其他内容为字符串
+	Error       string `json:"error,omitempty"`        // 转发失败的原因
+}
+
+// OpenAPIRequest 客户端通过 WebSocket 发起的 OpenAPI 请求（openapi_request 消息的 data）
+type OpenAPIRequest struct {
+	Method string          `json:"method"`          // HTTP 方法，默认 GET
+	Path   string          `json:"path"`            // 以 / 开头的接口路径，如 /v2/groups/{group_openid}/messages
+	Query  string          `json:"query,omitempty"` // 查询字符串（不含 ?）
+	Body   json.RawMessage `json:"body,omitempty"`  // JSON 请求体
+}
+
+// QQ 官方网关操作码
+const (
+	GatewayOpDispatch       = 0  // 服务端推送事件
+	GatewayOpHeartbeat      = 1  // 客户端心跳
+	GatewayOpIdentify       = 2  // 客户端鉴权
+	GatewayOpResume         = 6  // 客户端恢复会话
+	GatewayOpReconnect      = 7  // 服务端要求客户端重连
+	GatewayOpInvalidSession = 9  // 鉴权或恢复会话失败
+	GatewayOpHello          = 10 // 连接建立后服务端下发心跳参数
+	GatewayOpHeartbeatACK   = 11 // 心跳确认
+)
+
+// GatewayPayload QQ 网关协议消息帧
+type GatewayPayload struct {
+	ID string          `json:"id,omitempty"`
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d,omitempty"`
+	S  int64           `json:"s,omitempty"`
+	T  string          `json:"t,omitempty"`
+}
+
+// GatewayHello op 10 Hello 数据
+type GatewayHello struct {
+	HeartbeatInterval int `json:"heartbeat_interval"`
+}
+
+// GatewayIdentify op 2 Identify 数据
+type GatewayIdentify struct {
+	Token      string         `json:"token"`
+	Intents    int64          `json:"intents"`
+	Shard      []int          `json:"shard,omitempty"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// GatewayResume op 6 Resume 数据
+type GatewayResume struct {
+	Token     string `json:"token"`
+	SessionID string `json:"session_id"`
+	Seq       int64  `json:"seq"`
+}
+
+// GatewayReady READY 事件数据
+type GatewayReady struct {
+	Version   int         `json:"version"`
+	SessionID string      `json:"session_id"`
+	User      GatewayUser `json:"user"`
+	Shard     []int       `json:"shard"`
+}
+
+// GatewayUser READY 事件中的机器人信息
+type GatewayUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Bot      bool   `json:"bot"`
+}
+
+// GatewayURL GET /gateway 响应，与 QQ OpenAPI 格式一致
+type GatewayURL struct {
+	URL string `json:"url"`
+}
+
+// GatewayBot GET /gateway/bot 响应，与 QQ OpenAPI 格式一致
+type GatewayBot struct {
+	URL               string                   `json:"url"`
+	Shards            int                      `json:"shards"`
+	SessionStartLimit GatewaySessionStartLimit `json:"session_start_limit"`
+}
+
+// GatewaySessionStartLimit 创建网关会话的次数限制，NekoBridge 不做限制，返回固定值
+type GatewaySessionStartLimit struct {
+	Total          int   `json:"total"`
+	Remaining      int   `json:"remaining"`
+	ResetAfter     int64 `json:"reset_after"` // 毫秒
+	MaxConcurrency int   `json:"max_concurrency"`
+}
+
 // APIResponse API响应
 type APIResponse struct {
 	Success bool   `json:"success,omitempty"`
@@ -92,9 +219,107 @@ type LoginRequest struct {
 
 // LoginResponse 登录响应
 type LoginResponse struct {
-	Success bool   `json:"success"`
-	Token   string `json:"token,omitempty"`
-	Message string `json:"message,omitempty"`
+	Success      bool      `json:"success"`
+	Token        string    `json:"token,omitempty"`         // 访问令牌
+	RefreshToken string    `json:"refresh_token,omitempty"` // 刷新令牌，每次刷新后轮换
+	ExpiresIn    int64     `json:"expires_in,omitempty"`    // 访问令牌有效期（秒）
+	User         *UserInfo `json:"user,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	MFARequired  bool      `json:"mfa_required,omitempty"` // 需要提交两步验证码才能完成登录
+	MFAToken     string    `json:"mfa_token,omitempty"`    // 两步验证质询令牌，提交验证码时使用
+}
+
+// MFAVerifyRequest 两步验证请求，code 为 6 位动态验证码或恢复码
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// RefreshTokenRequest 刷新令牌请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// SessionInfo 活跃会话信息
+type SessionInfo struct {
+	ID           string    `json:"id"`
+	Username     string    `json:"username"`
+	IP           string    `json:"ip"`
+	UserAgent    string    `json:"user_agent"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	Current      bool      `json:"current"` // 是否为发起请求的会话
+}
+
+// UserInfo 当前登录用户的角色和权限
+type UserInfo struct {
+	Username    string   `json:"username"`
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+}
+
+// CreateUserRequest 创建用户请求
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"` // viewer, operator, admin
+	Enabled  *bool  `json:"enabled,omitempty"`       // 默认启用
+}
+
+// UpdateUserRequest 更新用户请求，未提供的字段保持不变
+type UpdateUserRequest struct {
+	Password string `json:"password,omitempty"`
+	Role     string `json:"role,omitempty"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+}
+
+// ChangePasswordRequest 修改当前用户密码请求
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// TOTPStatus 当前用户的两步验证状态
+type TOTPStatus struct {
+	Enabled                bool `json:"enabled"`
+	Pending                bool `json:"pending"` // 已生成密钥但尚未确认启用
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TOTPSetupRequest 生成两步验证密钥请求
+type TOTPSetupRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// TOTPSetupResponse 两步验证密钥，uri 可生成二维码供验证器应用扫描
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// TOTPCodeRequest 提交动态验证码的请求
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TOTPDisableRequest 关闭两步验证请求
+type TOTPDisableRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse 恢复码，仅在生成时返回一次
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// CreateAPIKeyRequest 创建 API Key 请求
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Scopes     []string   `json:"scopes" binding:"required"`
+	AllowedIPs []string   `json:"allowed_ips"` // 允许访问的 IP 或 CIDR，为空表示不限制
+	ExpiresAt  *time.Time `json:"expires_at"`  // 过期时间，为空表示永不过期
 }
 
 // AuthState 认证状态
@@ -119,22 +344,26 @@ type DashboardStats struct {
 		Warnings int `json:"warnings"`
 	} `json:"logs"`
 	System struct {
-		Uptime    float64 `json:"uptime"`
-		Memory    int     `json:"memory"`
-		CPU       int     `json:"cpu"`
-		CPUCores  int     `json:"cpu_cores"`
-		CPUModel  string  `json:"cpu_model"`
-		LoadAvg   []float64 `json:"load_average"`
+		Uptime     float64   `json:"uptime"`
+		Memory     int       `json:"memory"`
+		CPU        int       `json:"cpu"`
+		CPUProcess int       `json:"cpu_process"` // 本进程 CPU 使用率（%）
+		CPUCores   int       `json:"cpu_cores"`
+		CPUModel   string    `json:"cpu_model"`
+		CPUSpeed   int       `json:"cpu_speed"` // 主频（MHz）
+		RSS        int       `json:"rss"`       // 进程常驻内存（MB）
+		LoadAvg    []float64 `json:"load_average"`
 	} `json:"system"`
 }
 
 // SecretStats 密钥统计
 type SecretStats struct {
-	Total        int `json:"total"`
-	Enabled      int `json:"enabled"`
-	Disabled     int `json:"disabled"`
-	RecentlyUsed int `json:"recently_used"`
-	NeverUsed    int `json:"never_used"`
+	Total             int              `json:"total"`
+	Enabled           int              `json:"enabled"`
+	Disabled          int              `json:"disabled"`
+	RecentlyUsed      int              `json:"recently_used"`
+	NeverUsed         int              `json:"never_used"`
+	SignatureFailures map[string]int64 `json:"signature_failures"` // 各密钥的签名校验失败次数
 }
 
 
@@ -203,18 +432,35 @@ type HealthResponse struct {
 		HeapInuse   uint64 `json:"heap_inuse"`
 		HeapReleased uint64 `json:"heap_released"`
 		HeapObjects uint64 `json:"heap_objects"`
+		RSS         uint64 `json:"rss"` // 进程常驻内存（字节）
 	} `json:"memory"`
 	CPU struct {
-		Usage int    `json:"usage"`
-		Cores int    `json:"cores"`
-		Model string `json:"model"`
-		Speed int    `json:"speed"`
+		Usage        int    `json:"usage"`         // 系统 CPU 使用率（%）
+		ProcessUsage int    `json:"process_usage"` // 本进程 CPU 使用率（%）
+		Cores        int    `json:"cores"`
+		Model        string `json:"model"`
+		Speed        int    `json:"speed"` // 主频（MHz）
 	} `json:"cpu"`
 	Connections int       `json:"connections"`
 	LoadAverage []float64 `json:"load_average"`
 	Version     string    `json:"version"`
 }
 
+// ConfigChange 两个配置版本之间一个配置项的变化
+type ConfigChange struct {
+	Key  string      `json:"key"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// ConfigSource 配置项当前生效的值及其来源
+type ConfigSource struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+	Layer string      `json:"layer"`          // default、database、file、env、flag
+	Name  string      `json:"name,omitempty"` // 配置文件路径、环境变量名或命令行参数
+}
+
 // ConfigUpdateRequest 配置更新请求
 type ConfigUpdateRequest struct {
 	Server    *ServerConfigUpdate    `json:"server,omitempty"`
@@ -239,10 +485,13 @@ type CORSConfigUpdate struct {
 
 // SecurityConfigUpdate 安全配置更新
 type SecurityConfigUpdate struct {
-	EnableSignatureValidation    bool `json:"enable_signature_validation"`
-	DefaultAllowNewConnections   bool `json:"default_allow_new_connections"`
-	MaxConnectionsPerSecret      int  `json:"max_connections_per_secret,omitempty"`
-	RequireManualKeyManagement   bool `json:"require_manual_key_management"`
+	EnableSignatureValidation    bool   `json:"enable_signature_validation"`
+	DefaultAllowNewConnections   bool   `json:"default_allow_new_connections"`
+	MaxConnectionsPerSecret      int    `json:"max_connections_per_secret,omitempty"`
+	RequireManualKeyManagement   bool   `json:"require_manual_key_management"`
+	ConnectionLimitPolicy        string `json:"connection_limit_policy,omitempty"`
+	AllowSecretQuery             bool   `json:"allow_secret_query"`
+	SignatureMaxSkew             int64  `json:"signature_max_skew,omitempty"`
 }
 
 // AuthConfigUpdate 认证配置更新
@@ -250,6 +499,7 @@ type AuthConfigUpdate struct {
 	Username       string `json:"username,omitempty"`
 	Password       string `json:"password,omitempty"`
 	SessionTimeout int64  `json:"session_timeout,omitempty"`
+	AccessTokenTTL int64  `json:"access_token_ttl,omitempty"`
 	JWTSecret      string `json:"jwt_secret,omitempty"`
 }
 
@@ -263,9 +513,40 @@ type LoggingConfigUpdate struct {
 
 // WebSocketConfigUpdate WebSocket配置更新
 type WebSocketConfigUpdate struct {
-	EnableHeartbeat   bool `json:"enable_heartbeat"`
-	HeartbeatInterval int  `json:"heartbeat_interval,omitempty"`
-	MaxMessageSize    int  `json:"max_message_size,omitempty"`
-	ReadTimeout       int  `json:"read_timeout,omitempty"`
-	WriteTimeout      int  `json:"write_timeout,omitempty"`
+	EnableHeartbeat     bool   `json:"enable_heartbeat"`
+	HeartbeatInterval   int    `json:"heartbeat_interval,omitempty"`
+	MaxMessageSize      int    `json:"max_message_size,omitempty"`
+	ReadTimeout         int    `json:"read_timeout,omitempty"`
+	WriteTimeout        int    `json:"write_timeout,omitempty"`
+	DefaultDeliveryMode string `json:"default_delivery_mode,omitempty"`
+	SendQueueSize       int    `json:"send_queue_size,omitempty"`
+	SendQueuePolicy     string `json:"send_queue_policy,omitempty"`
+}
+
+// TrafficCounts 流量计数
+type TrafficCounts struct {
+	Received    int64 `json:"received"`    // 收到的 Webhook 消息数
+	Forwarded   int64 `json:"forwarded"`   // 实时投递到客户端的消息数
+	Queued      int64 `json:"queued"`      // 写入离线队列的消息数
+	Dropped     int64 `json:"dropped"`     // 丢弃的消息数
+	Bytes       int64 `json:"bytes"`       // 收到的 Webhook 请求体字节数
+	Connects    int64 `json:"connects"`    // 客户端连接次数
+	Disconnects int64 `json:"disconnects"` // 客户端断开次数
+	Errors      int64 `json:"errors"`      // 签名校验失败、投递失败等错误数
+}
+
+// TrafficPoint 流量历史中的一个时间段
+type TrafficPoint struct {
+	Time time.Time `json:"time"`
+	TrafficCounts
+}
+
+// TrafficHistory 流量历史响应
+type TrafficHistory struct {
+	Granularity string         `json:"granularity"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	Secrets     []string       `json:"secrets,omitempty"` // 为空表示所有密钥
+	Totals      TrafficCounts  `json:"totals"`
+	Points      []TrafficPoint `json:"points"`
 }
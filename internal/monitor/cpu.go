@@ -1,25 +1,42 @@
 package monitor
 
 import (
+	"log"
 	"runtime"
 	"sync"
 	"time"
 )
 
-// CpuMonitor CPU监控器
+// CpuMonitor CPU监控器，定期采样系统和本进程的 CPU 时间并计算使用率
 type CpuMonitor struct {
-	lastUpdateTime time.Time
-	currentUsage   float64
+	lastSystem     cpuTimes
+	lastProcess    uint64
+	systemUsage    float64
+	processUsage   float64
+	info           cpuModel
 	updateInterval time.Duration
 	mutex          sync.RWMutex
 }
 
 // CpuInfo CPU信息
 type CpuInfo struct {
-	Usage float64 `json:"usage"`
-	Cores int     `json:"cores"`
-	Model string  `json:"model"`
-	Speed int64   `json:"speed"`
+	Usage        float64 `json:"usage"`         // 系统 CPU 使用率（%）
+	ProcessUsage float64 `json:"process_usage"` // 本进程占用整机 CPU 的比例（%）
+	Cores        int     `json:"cores"`
+	Model        string  `json:"model"`
+	Speed        int64   `json:"speed"` // 主频（MHz）
+}
+
+// cpuTimes 所有 CPU 累计的时钟节拍数
+type cpuTimes struct {
+	total uint64
+	idle  uint64
+}
+
+// cpuModel CPU 型号和主频
+type cpuModel struct {
+	name string
+	mhz  int64
 }
 
 // NewCpuMonitor 创建CPU监控器
@@ -27,13 +44,20 @@ func NewCpuMonitor() *CpuMonitor {
 	monitor := &CpuMonitor{
 		updateInterval: 1 * time.Second,
 	}
-	
+
+	model, err := readCPUModel()
+	if err != nil {
+		log.Printf("⚠️  无法读取 CPU 型号: %v", err)
+		model.name = "Unknown"
+	}
+	monitor.info = model
+
 	// 初始化
 	monitor.updateCpuUsage()
-	
+
 	// 启动定时更新
 	go monitor.startMonitoring()
-	
+
 	return monitor
 }
 
@@ -41,48 +65,73 @@ func NewCpuMonitor() *CpuMonitor {
 func (c *CpuMonitor) startMonitoring() {
 	ticker := time.NewTicker(c.updateInterval)
 	defer ticker.Stop()
-	
+
 	for range ticker.C {
 		c.updateCpuUsage()
 	}
 }
 
-// updateCpuUsage 更新CPU使用率
+// updateCpuUsage 根据两次采样之间的节拍数差值更新 CPU 使用率
 func (c *CpuMonitor) updateCpuUsage() {
+	system, err := readCPUTimes()
+	if err != nil {
+		return
+	}
+	process, err := readProcessCPUTime()
+	if err != nil {
+		return
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	
-	now := time.Now()
-	
-	// 简化的CPU使用率计算
-	// 在实际应用中，这里应该使用更精确的CPU监控方法
-	// 这里我们使用一个模拟值
-	if now.Sub(c.lastUpdateTime) >= c.updateInterval {
-		// 模拟CPU使用率（实际应用中应该读取真实的CPU使用率）
-		c.currentUsage = 15.0 + float64(now.Unix()%10) // 15-25%之间变化
-		c.lastUpdateTime = now
+
+	if c.lastSystem.total > 0 && system.total > c.lastSystem.total {
+		total := float64(system.total - c.lastSystem.total)
+		idle := float64(system.idle - c.lastSystem.idle)
+		c.systemUsage = clampPercent((total - idle) / total * 100)
+		if process >= c.lastProcess {
+			c.processUsage = clampPercent(float64(process-c.lastProcess) / total * 100)
+		}
+	}
+	c.lastSystem = system
+	c.lastProcess = process
+}
+
+// clampPercent 将百分比限制在 0-100 之间
+func clampPercent(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+	if value > 100 {
+		return 100
 	}
+	return value
 }
 
-// GetCpuUsage 获取CPU使用率
+// GetCpuUsage 获取系统CPU使用率
 func (c *CpuMonitor) GetCpuUsage() float64 {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	return c.currentUsage
+	return c.systemUsage
+}
+
+// GetProcessCpuUsage 获取本进程的CPU使用率
+func (c *CpuMonitor) GetProcessCpuUsage() float64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.processUsage
 }
 
 // GetCpuInfo 获取CPU信息
 func (c *CpuMonitor) GetCpuInfo() CpuInfo {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	
-	// 获取CPU核心数
-	cores := runtime.NumCPU()
-	
+
 	return CpuInfo{
-		Usage: c.currentUsage,
-		Cores: cores,
-		Model: "Unknown", // 在实际应用中应该读取真实的CPU型号
-		Speed: 0, // Go的runtime包不提供CPU频率信息
+		Usage:        c.systemUsage,
+		ProcessUsage: c.processUsage,
+		Cores:        runtime.NumCPU(),
+		Model:        c.info.name,
+		Speed:        c.info.mhz,
 	}
-}
\ No newline at end of file
+}
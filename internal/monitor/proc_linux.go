@@ -0,0 +1,172 @@
+//go:build linux
+
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readCPUTimes 读取 /proc/stat 中所有 CPU 的累计节拍数
+func readCPUTimes() (cpuTimes, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return cpuTimes{}, err
+	}
+
+	line, _, _ := strings.Cut(string(data), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuTimes{}, fmt.Errorf("unexpected /proc/stat format")
+	}
+
+	// user nice system idle iowait irq softirq steal，guest 已计入 user，不重复累加
+	var times cpuTimes
+	for i, field := range fields[1:] {
+		if i >= 8 {
+			break
+		}
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return cpuTimes{}, err
+		}
+		times.total += value
+		if i == 3 || i == 4 {
+			times.idle += value
+		}
+	}
+	return times, nil
+}
+
+// readProcessCPUTime 读取 /proc/self/stat 中本进程的用户态和内核态节拍数之和
+func readProcessCPUTime() (uint64, error) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+
+	// 进程名可能包含空格，从最后一个右括号之后开始解析（第一个字段为 state）
+	end := strings.LastIndexByte(string(data), ')')
+	if end < 0 {
+		return 0, fmt.Errorf("unexpected /proc/self/stat format")
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("unexpected /proc/self/stat format")
+	}
+
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return utime + stime, nil
+}
+
+// readCPUModel 读取 /proc/cpuinfo 中第一个 CPU 的型号和主频
+func readCPUModel() (cpuModel, error) {
+	file, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return cpuModel{}, err
+	}
+	defer file.Close()
+
+	var model cpuModel
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			// 空行表示第一个 CPU 的信息已结束
+			if model.name != "" {
+				break
+			}
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "model name", "Processor", "Hardware":
+			if model.name == "" {
+				model.name = value
+			}
+		case "cpu MHz":
+			if mhz, err := strconv.ParseFloat(value, 64); err == nil {
+				model.mhz = int64(mhz)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cpuModel{}, err
+	}
+
+	// 部分 ARM 平台的 cpuinfo 不提供主频，改为读取 cpufreq（单位 kHz）
+	if model.mhz == 0 {
+		if data, err := os.ReadFile("/sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq"); err == nil {
+			if khz, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64); err == nil {
+				model.mhz = khz / 1000
+			}
+		}
+	}
+	if model.name == "" {
+		model.name = "Unknown"
+	}
+	return model, nil
+}
+
+// readLoadAverage 读取 /proc/loadavg 中 1、5、15 分钟的平均负载
+func readLoadAverage() ([]float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("unexpected /proc/loadavg format")
+	}
+
+	loads := make([]float64, 3)
+	for i := range loads {
+		if loads[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return nil, err
+		}
+	}
+	return loads, nil
+}
+
+// readProcessRSS 读取 /proc/self/status 中本进程的常驻内存（字节）
+func readProcessRSS() (uint64, error) {
+	file, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			break
+		}
+		kb, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("VmRSS not found in /proc/self/status")
+}
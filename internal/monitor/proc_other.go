@@ -0,0 +1,33 @@
+//go:build !linux
+
+package monitor
+
+import "errors"
+
+// errUnsupported 当前平台不提供 /proc 文件系统
+var errUnsupported = errors.New("system metrics are only available on linux")
+
+// readCPUTimes 当前平台不支持
+func readCPUTimes() (cpuTimes, error) {
+	return cpuTimes{}, errUnsupported
+}
+
+// readProcessCPUTime 当前平台不支持
+func readProcessCPUTime() (uint64, error) {
+	return 0, errUnsupported
+}
+
+// readCPUModel 当前平台不支持
+func readCPUModel() (cpuModel, error) {
+	return cpuModel{}, errUnsupported
+}
+
+// readLoadAverage 当前平台不支持
+func readLoadAverage() ([]float64, error) {
+	return nil, errUnsupported
+}
+
+// readProcessRSS 当前平台不支持
+func readProcessRSS() (uint64, error) {
+	return 0, errUnsupported
+}
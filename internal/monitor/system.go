@@ -0,0 +1,52 @@
+package monitor
+
+import (
+	"runtime"
+	"time"
+)
+
+// processStart 进程启动时间
+var processStart = time.Now()
+
+// SystemMonitor 系统监控器，健康检查和仪表盘统一从这里读取系统指标
+type SystemMonitor struct {
+	cpu *CpuMonitor
+}
+
+// SystemStats 系统指标快照
+type SystemStats struct {
+	Uptime      float64          // 进程运行时间（秒）
+	CPU         CpuInfo          // CPU 型号、主频和使用率
+	LoadAverage []float64        // 1、5、15 分钟平均负载，无法读取时为空
+	RSS         uint64           // 进程常驻内存（字节），无法读取时为 0
+	Memory      runtime.MemStats // Go 运行时内存统计
+}
+
+// NewSystemMonitor 创建系统监控器并开始采样 CPU 使用率
+func NewSystemMonitor() *SystemMonitor {
+	return &SystemMonitor{
+		cpu: NewCpuMonitor(),
+	}
+}
+
+// Uptime 获取进程运行时间
+func (m *SystemMonitor) Uptime() time.Duration {
+	return time.Since(processStart)
+}
+
+// Snapshot 获取当前的系统指标
+func (m *SystemMonitor) Snapshot() SystemStats {
+	stats := SystemStats{
+		Uptime:      m.Uptime().Seconds(),
+		CPU:         m.cpu.GetCpuInfo(),
+		LoadAverage: []float64{},
+	}
+	if loads, err := readLoadAverage(); err == nil {
+		stats.LoadAverage = loads
+	}
+	if rss, err := readProcessRSS(); err == nil {
+		stats.RSS = rss
+	}
+	runtime.ReadMemStats(&stats.Memory)
+	return stats
+}
@@ -0,0 +1,189 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"nekobridge/internal/config"
+)
+
+var (
+	// ErrInvalidPath OpenAPI 路径无效
+	ErrInvalidPath = errors.New("invalid openapi path")
+
+	// ErrTokenUnavailable 无法获取 AppAccessToken
+	ErrTokenUnavailable = errors.New("app access token unavailable")
+)
+
+// Client QQ 机器人 OpenAPI 客户端，按 AppID 获取、缓存并提前刷新 AppAccessToken
+type Client struct {
+	config *config.Config
+	http   *http.Client
+	mu     sync.Mutex
+	tokens map[string]*appToken // 按 AppID 缓存的 token
+}
+
+// appToken 单个机器人的 AppAccessToken
+type appToken struct {
+	mu        sync.Mutex // 保证同一机器人同时只有一个刷新请求
+	value     string
+	expiresAt time.Time
+}
+
+// tokenResponse 获取 AppAccessToken 接口的响应，expires_in 为字符串形式的秒数
+type tokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+	Code        int         `json:"code"`
+	Message     string      `json:"message"`
+}
+
+// NewClient 创建 OpenAPI 客户端
+func NewClient(cfg *config.Config) *Client {
+	return &Client{
+		config: cfg,
+		http:   &http.Client{},
+		tokens: make(map[string]*appToken),
+	}
+}
+
+// Timeout 获取请求超时时间
+func (c *Client) Timeout() time.Duration {
+	if timeout := c.config.GetOpenAPIConfig().Timeout; timeout > 0 {
+		return time.Duration(timeout) * time.Millisecond
+	}
+	return 10 * time.Second
+}
+
+// getToken 获取机器人的 token 缓存项
+func (c *Client) getToken(appID string) *appToken {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token, exists := c.tokens[appID]
+	if !exists {
+		token = &appToken{}
+		c.tokens[appID] = token
+	}
+	return token
+}
+
+// Token 获取 AppAccessToken，缓存的 token 即将过期时自动刷新
+func (c *Client) Token(ctx context.Context, appID, clientSecret string) (string, error) {
+	token := c.getToken(appID)
+	token.mu.Lock()
+	defer token.mu.Unlock()
+
+	refreshBefore := time.Duration(c.config.GetOpenAPIConfig().RefreshBefore) * time.Second
+	if token.value != "" && time.Until(token.expiresAt) > refreshBefore {
+		return token.value, nil
+	}
+
+	value, expiresIn, err := c.fetchToken(ctx, appID, clientSecret)
+	if err != nil {
+		return "", err
+	}
+	token.value = value
+	token.expiresAt = time.Now().Add(expiresIn)
+	return value, nil
+}
+
+// invalidate 丢弃已失效的 token，下次调用时重新获取（其他请求已刷新时保留新 token）
+func (c *Client) invalidate(appID, value string) {
+	token := c.getToken(appID)
+	token.mu.Lock()
+	defer token.mu.Unlock()
+
+	if token.value == value {
+		token.value = ""
+	}
+}
+
+// fetchToken 使用 AppID 和 ClientSecret 获取新的 AppAccessToken
+func (c *Client) fetchToken(ctx context.Context, appID, clientSecret string) (string, time.Duration, error) {
+	payload, err := json.Marshal(map[string]string{
+		"appId":        appID,
+		"clientSecret": clientSecret,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.GetOpenAPIConfig().TokenURL, bytes.NewReader(payload))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %v", ErrTokenUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	var result tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return "", 0, fmt.Errorf("%w: HTTP %d: %v", ErrTokenUnavailable, resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", 0, fmt.Errorf("%w: HTTP %d: code=%d %s", ErrTokenUnavailable, resp.StatusCode, result.Code, result.Message)
+	}
+
+	seconds, err := result.ExpiresIn.Int64()
+	if err != nil || seconds <= 0 {
+		seconds = 7200
+	}
+	return result.AccessToken, time.Duration(seconds) * time.Second, nil
+}
+
+// Do 以机器人身份调用 OpenAPI，path 为以 / 开头的接口路径
+// 返回 401 时丢弃缓存的 token 并重试一次；超时由 ctx 控制，调用方负责关闭响应体
+func (c *Client) Do(ctx context.Context, appID, clientSecret, method, path, rawQuery string, body []byte, contentType string) (*http.Response, error) {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") {
+		return nil, ErrInvalidPath
+	}
+
+	target := strings.TrimRight(c.config.GetOpenAPIConfig().BaseURL, "/") + path
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := c.Token(ctx, appID, clientSecret)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "QQBot "+token)
+		req.Header.Set("X-Union-Appid", appID)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			resp.Body.Close()
+			c.invalidate(appID, token)
+			continue
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,105 @@
+package rbac
+
+// 用户角色
+const (
+	RoleViewer   = "viewer"   // 只读：查看仪表盘、日志、连接和遮盖后的密钥
+	RoleOperator = "operator" // 运维：在只读基础上管理密钥和连接
+	RoleAdmin    = "admin"    // 管理员：全部权限，包括配置和用户管理
+)
+
+// 权限
+const (
+	PermDashboardRead   = "dashboard:read"
+	PermLogsRead        = "logs:read"
+	PermConnectionsRead = "connections:read"
+	PermConnectionsKick = "connections:kick"
+	PermSecretsRead     = "secrets:read"
+	PermSecretsWrite    = "secrets:write"
+	PermConfigRead      = "config:read"
+	PermConfigWrite     = "config:write"
+	PermUsersManage     = "users:manage"
+	PermAPIKeysManage   = "apikeys:manage"
+	PermAuditRead       = "audit:read"
+)
+
+// viewerPermissions 只读角色的权限
+var viewerPermissions = []string{
+	PermDashboardRead,
+	PermLogsRead,
+	PermConnectionsRead,
+	PermSecretsRead,
+}
+
+// rolePermissions 各角色拥有的权限
+var rolePermissions = map[string][]string{
+	RoleViewer: viewerPermissions,
+	RoleOperator: append(append([]string{}, viewerPermissions...),
+		PermConnectionsKick,
+		PermSecretsWrite,
+	),
+	RoleAdmin: append(append([]string{}, viewerPermissions...),
+		PermConnectionsKick,
+		PermSecretsWrite,
+		PermConfigRead,
+		PermConfigWrite,
+		PermUsersManage,
+		PermAPIKeysManage,
+		PermAuditRead,
+	),
+}
+
+// apiKeyScopes API Key 可以申请的权限，修改配置和管理用户、API Key 只能在交互式会话中进行
+var apiKeyScopes = []string{
+	PermDashboardRead,
+	PermLogsRead,
+	PermConnectionsRead,
+	PermConnectionsKick,
+	PermSecretsRead,
+	PermSecretsWrite,
+	PermConfigRead,
+	PermAuditRead,
+}
+
+// Roles 所有角色，按权限从低到高排列
+func Roles() []string {
+	return []string{RoleViewer, RoleOperator, RoleAdmin}
+}
+
+// IsValidRole 检查角色是否有效
+func IsValidRole(role string) bool {
+	_, exists := rolePermissions[role]
+	return exists
+}
+
+// Permissions 获取角色拥有的权限，未知角色返回空
+func Permissions(role string) []string {
+	return append([]string{}, rolePermissions[role]...)
+}
+
+// APIKeyScopes 获取 API Key 可以申请的权限
+func APIKeyScopes() []string {
+	return append([]string{}, apiKeyScopes...)
+}
+
+// IsValidAPIKeyScope 检查权限是否可以授予 API Key
+func IsValidAPIKeyScope(scope string) bool {
+	for _, allowed := range apiKeyScopes {
+		if allowed == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission 检查角色是否拥有指定权限，permission 为空表示只要求登录
+func HasPermission(role, permission string) bool {
+	if permission == "" {
+		return IsValidRole(role)
+	}
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret RFC 6238 附录 B 中 SHA1 测试向量使用的密钥 "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 附录 B 的 8 位验证码取后 6 位
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code() 失败: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("T=%d 的验证码 = %s，应为 %s", tt.unix, got, tt.want)
+		}
+	}
+
+	// 密钥忽略大小写和首尾空格
+	if got, _ := Code(" "+strings.ToLower(rfcSecret)+" ", 1); got != "287082" {
+		t.Errorf("小写密钥的验证码 = %s，应为 287082", got)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("无效密钥应返回错误")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		c, _ := Code(rfcSecret, step)
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"当前时间步", code(current), 0, current, true},
+		{"前一个时间步", code(current - 1), 0, current - 1, true},
+		{"后一个时间步", code(current + 1), 0, current + 1, true},
+		{"超出偏差", code(current - 2), 0, 0, false},
+		{"重放已使用的时间步", code(current), current, 0, false},
+		{"首尾空格", " " + code(current) + " ", 0, current, true},
+		{"长度错误", "12345", 0, 0, false},
+		{"验证码错误", "000000", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate() = (%d, %v)，应为 (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes() 失败: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("恢复码数量 = %d，应为 10", len(codes))
+	}
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("恢复码 %q 格式应为 xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("恢复码 %q 重复", code)
+		}
+		seen[code] = true
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"abcde-fghij", "abcdefghij"},
+		{"ABCDE FGHIJ", "abcdefghij"},
+		{" AbCdE-fGhIj ", "abcdefghij"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.input); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q，应为 %q", tt.input, got, tt.want)
+		}
+	}
+}
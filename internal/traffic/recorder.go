@@ -0,0 +1,282 @@
+package traffic
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/database"
+)
+
+// 统计粒度
+const (
+	GranularityMinute = "minute"
+	GranularityHour   = "hour"
+	GranularityDay    = "day"
+)
+
+// 投递结果，与 Webhook 投递耗时指标的 result 标签一致
+const (
+	ResultDelivered = "delivered"
+	ResultQueued    = "queued"
+	ResultDropped   = "dropped"
+	ResultFailed    = "failed"
+)
+
+// purgeInterval 清理过期统计的间隔
+const purgeInterval = time.Hour
+
+// IsValidGranularity 检查统计粒度是否有效
+func IsValidGranularity(granularity string) bool {
+	switch granularity {
+	case GranularityMinute, GranularityHour, GranularityDay:
+		return true
+	}
+	return false
+}
+
+// BucketStart 获取时间所在时间段的起点（UTC），天粒度按服务器本地时区划分
+func BucketStart(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityHour:
+		return t.UTC().Truncate(time.Hour)
+	case GranularityDay:
+		local := t.Local()
+		return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local).UTC()
+	}
+	return t.UTC().Truncate(time.Minute)
+}
+
+// NextBucket 获取下一个时间段的起点
+func NextBucket(start time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityHour:
+		return start.Add(time.Hour)
+	case GranularityDay:
+		return start.Local().AddDate(0, 0, 1).UTC()
+	}
+	return start.Add(time.Minute)
+}
+
+// bucketKey 内存中按密钥和分钟累计的计数
+type bucketKey struct {
+	secret string
+	minute time.Time
+}
+
+// rollupKey 写入数据库的统计行
+type rollupKey struct {
+	secret      string
+	granularity string
+	start       time.Time
+}
+
+// Recorder 流量记录器，先在内存中按分钟累计，定期合并写入分钟、小时、天三种粒度的统计
+type Recorder struct {
+	enabled atomic.Bool
+	config  *config.Config
+	service *database.TrafficService
+
+	mu      sync.Mutex
+	pending map[bucketKey]*database.TrafficStat
+	flushMu sync.Mutex // 保证同一时间只有一次写入
+}
+
+// defaultRecorder 全局流量记录器
+var defaultRecorder = &Recorder{
+	service: &database.TrafficService{},
+	pending: make(map[bucketKey]*database.TrafficStat),
+}
+
+// Start 启用流量记录并启动定期写入和过期清理
+func Start(cfg *config.Config) {
+	defaultRecorder.start(cfg)
+}
+
+// Flush 立即将内存中的计数写入数据库
+func Flush() error {
+	return defaultRecorder.flush()
+}
+
+// RecordWebhook 记录收到的 Webhook 消息
+func RecordWebhook(secret string, size int) {
+	defaultRecorder.add(secret, func(stat *database.TrafficStat) {
+		stat.Received++
+		stat.Bytes += int64(size)
+	})
+}
+
+// RecordResult 记录 Webhook 消息的投递结果
+func RecordResult(secret, result string) {
+	defaultRecorder.add(secret, func(stat *database.TrafficStat) {
+		switch result {
+		case ResultDelivered:
+			stat.Forwarded++
+		case ResultQueued:
+			stat.Queued++
+		case ResultDropped:
+			stat.Dropped++
+		default:
+			stat.Errors++
+		}
+	})
+}
+
+// RecordConnect 记录客户端连接
+func RecordConnect(secret string) {
+	defaultRecorder.add(secret, func(stat *database.TrafficStat) {
+		stat.Connects++
+	})
+}
+
+// RecordDisconnect 记录客户端断开
+func RecordDisconnect(secret string) {
+	defaultRecorder.add(secret, func(stat *database.TrafficStat) {
+		stat.Disconnects++
+	})
+}
+
+// RecordError 记录签名校验失败等错误
+func RecordError(secret string) {
+	defaultRecorder.add(secret, func(stat *database.TrafficStat) {
+		stat.Errors++
+	})
+}
+
+// start 启用记录器
+func (r *Recorder) start(cfg *config.Config) {
+	r.config = cfg
+	settings := cfg.GetTrafficConfig()
+	if !settings.Enabled {
+		log.Println("流量历史统计已禁用")
+		return
+	}
+	r.enabled.Store(true)
+
+	interval := time.Duration(settings.FlushInterval) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		lastPurge := time.Time{}
+		for range ticker.C {
+			if err := r.flush(); err != nil {
+				log.Printf("写入流量统计失败: %v", err)
+			}
+			if time.Since(lastPurge) >= purgeInterval {
+				r.purge()
+				lastPurge = time.Now()
+			}
+		}
+	}()
+}
+
+// add 在当前分钟的计数上累加
+func (r *Recorder) add(secret string, apply func(*database.TrafficStat)) {
+	if !r.enabled.Load() || secret == "" {
+		return
+	}
+
+	key := bucketKey{secret: secret, minute: BucketStart(time.Now(), GranularityMinute)}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stat, exists := r.pending[key]
+	if !exists {
+		stat = &database.TrafficStat{Secret: secret}
+		r.pending[key] = stat
+	}
+	apply(stat)
+}
+
+// flush 将内存中的计数合并到分钟、小时、天三种粒度后写入数据库，失败时放回内存等待下次写入
+func (r *Recorder) flush() error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[bucketKey]*database.TrafficStat)
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	merged := make(map[rollupKey]*database.TrafficStat)
+	for key, stat := range pending {
+		for _, granularity := range []string{GranularityMinute, GranularityHour, GranularityDay} {
+			rollup := rollupKey{secret: key.secret, granularity: granularity, start: BucketStart(key.minute, granularity)}
+			target, exists := merged[rollup]
+			if !exists {
+				target = &database.TrafficStat{Secret: key.secret, Granularity: granularity, BucketStart: rollup.start}
+				merged[rollup] = target
+			}
+			addStat(target, stat)
+		}
+	}
+
+	stats := make([]database.TrafficStat, 0, len(merged))
+	for _, stat := range merged {
+		stats = append(stats, *stat)
+	}
+	if err := r.service.Add(stats); err != nil {
+		r.restore(pending)
+		return err
+	}
+	return nil
+}
+
+// restore 写入失败时把计数放回内存
+func (r *Recorder) restore(pending map[bucketKey]*database.TrafficStat) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, stat := range pending {
+		if current, exists := r.pending[key]; exists {
+			addStat(current, stat)
+			continue
+		}
+		r.pending[key] = stat
+	}
+}
+
+// purge 按各粒度的保留时间清理过期统计
+func (r *Recorder) purge() {
+	now := time.Now()
+	cfg := r.config.GetTrafficConfig()
+	retention := map[string]time.Duration{
+		GranularityMinute: time.Duration(cfg.MinuteRetention) * time.Hour,
+		GranularityHour:   time.Duration(cfg.HourRetention) * 24 * time.Hour,
+		GranularityDay:    time.Duration(cfg.DayRetention) * 24 * time.Hour,
+	}
+	for granularity, keep := range retention {
+		if keep <= 0 {
+			continue
+		}
+		if removed, err := r.service.Purge(granularity, now.Add(-keep)); err != nil {
+			log.Printf("清理过期流量统计失败 [%s]: %v", granularity, err)
+		} else if removed > 0 {
+			log.Printf("已清理过期流量统计 [%s]: %d 条", granularity, removed)
+		}
+	}
+}
+
+// addStat 将 src 的计数累加到 dst
+func addStat(dst, src *database.TrafficStat) {
+	dst.Received += src.Received
+	dst.Forwarded += src.Forwarded
+	dst.Queued += src.Queued
+	dst.Dropped += src.Dropped
+	dst.Bytes += src.Bytes
+	dst.Connects += src.Connects
+	dst.Disconnects += src.Disconnects
+	dst.Errors += src.Errors
+}
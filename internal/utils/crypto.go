@@ -6,7 +6,9 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 	
 	"golang.org/x/crypto/bcrypt"
 )
@@ -91,6 +93,24 @@ func (s *Ed25519Signer) VerifySignature(secret, eventTs, plainToken, signature s
 	return ed25519.Verify(publicKey, msg.Bytes(), sigBytes)
 }
 
+// VerifyWebhook 验证 QQ 推送事件的签名（X-Signature-Ed25519 头），签名内容为 timestamp + body
+func (s *Ed25519Signer) VerifyWebhook(secret, timestamp string, body []byte, signature string) bool {
+	if timestamp == "" || signature == "" {
+		return false
+	}
+	return s.VerifySignature(secret, timestamp, string(body), signature)
+}
+
+// VerifyTimestamp 检查推送事件的时间戳（Unix 秒）与 now 的偏差不超过 maxSkew，签名有效但时间戳过旧的请求视为重放
+func VerifyTimestamp(timestamp string, now time.Time, maxSkew time.Duration) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	skew := now.Sub(time.Unix(seconds, 0))
+	return skew <= maxSkew && skew >= -maxSkew
+}
+
 // GetPublicKey 获取公钥
 func (s *Ed25519Signer) GetPublicKey() string {
 	return hex.EncodeToString(s.publicKey)
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerifyTimestamp(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		timestamp string
+		want      bool
+	}{
+		{strconv.FormatInt(now.Unix(), 10), true},
+		{strconv.FormatInt(now.Add(-5*time.Minute).Unix(), 10), true},
+		{strconv.FormatInt(now.Add(5*time.Minute).Unix(), 10), true},
+		{strconv.FormatInt(now.Add(-5*time.Minute-time.Second).Unix(), 10), false},
+		{strconv.FormatInt(now.Add(5*time.Minute+time.Second).Unix(), 10), false},
+		{"", false},
+		{"not-a-number", false},
+	}
+	for _, tt := range tests {
+		if got := VerifyTimestamp(tt.timestamp, now, 5*time.Minute); got != tt.want {
+			t.Errorf("VerifyTimestamp(%q) = %v，应为 %v", tt.timestamp, got, tt.want)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -10,11 +14,13 @@ import (
 // JWTManager JWT管理器
 type JWTManager struct {
 	secretKey []byte
+	mu        sync.RWMutex
 }
 
-// Claims JWT声明
+// Claims JWT声明，RegisteredClaims.ID (jti) 为令牌所属的会话ID
 type Claims struct {
 	Username  string `json:"username"`
+	Role      string `json:"role"` // 签发时的角色，鉴权时以数据库中的当前角色为准
 	LoginTime int64  `json:"login_time"`
 	jwt.RegisteredClaims
 }
@@ -26,16 +32,32 @@ func NewJWTManager(secretKey string) *JWTManager {
 	}
 }
 
+// SetSecretKey 更换签名密钥，之前签发的令牌全部失效
+func (j *JWTManager) SetSecretKey(secretKey string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.secretKey = []byte(secretKey)
+}
+
+// getSecretKey 获取当前的签名密钥
+func (j *JWTManager) getSecretKey() []byte {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.secretKey
+}
+
 // GenerateToken 生成JWT令牌
-func (j *JWTManager) GenerateToken(username string, duration time.Duration) (string, error) {
+func (j *JWTManager) GenerateToken(username, role, sessionID string, loginTime time.Time, duration time.Duration) (string, error) {
 	if duration <= 0 {
 		duration = 24 * time.Hour
 	}
 
 	claims := &Claims{
 		Username:  username,
-		LoginTime: time.Now().Unix(),
+		Role:      role,
+		LoginTime: loginTime.Unix(),
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
@@ -43,14 +65,15 @@ func (j *JWTManager) GenerateToken(username string, duration time.Duration) (str
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secretKey)
+	return token.SignedString(j.getSecretKey())
 }
 
 // ValidateToken 验证JWT令牌
 func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
+	secretKey := j.getSecretKey()
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return j.secretKey, nil
-	})
+		return secretKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 	if err != nil {
 		return nil, err
@@ -62,3 +85,18 @@ func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// GenerateOpaqueToken 生成随机令牌（用于会话ID和刷新令牌）
+func GenerateOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken 计算令牌的 SHA-256 摘要，数据库中只保存摘要
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -61,6 +61,23 @@ func (l *Logger) Log(level, message string, details interface{}) {
 	l.printToConsole(entry)
 }
 
+// SetLevel 修改日志级别
+func (l *Logger) SetLevel(level string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// SetMaxSize 修改内存中保留的最大日志条数，超出的旧日志立即删除
+func (l *Logger) SetMaxSize(maxSize int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxSize = maxSize
+	if maxSize > 0 && len(l.logs) > maxSize {
+		l.logs = l.logs[len(l.logs)-maxSize:]
+	}
+}
+
 var logLevels = map[string]int{
 	"debug":   0,
 	"info":    1,
@@ -70,7 +87,9 @@ var logLevels = map[string]int{
 
 // shouldLog 检查是否应该记录此级别的日志
 func (l *Logger) shouldLog(level string) bool {
+	l.mu.RLock()
 	currentLevel, exists := logLevels[l.level]
+	l.mu.RUnlock()
 	if !exists {
 		currentLevel = 1 // 默认为info级别
 	}
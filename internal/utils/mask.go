@@ -0,0 +1,27 @@
+package utils
+
+import "strings"
+
+// MaskSecret 遮盖密钥，只保留首尾各 4 个字符，用于日志输出
+func MaskSecret(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", len(secret)-8) + secret[len(secret)-4:]
+}
+
+// MaskSecretPath 遮盖请求路径中紧跟在 prefix 之后的密钥，如 /ws/:secret、/api/openapi/:secret/...
+func MaskSecretPath(path string, prefixes ...string) string {
+	for _, prefix := range prefixes {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		rest := path[len(prefix):]
+		end := strings.IndexByte(rest, '/')
+		if end < 0 {
+			end = len(rest)
+		}
+		return prefix + MaskSecret(rest[:end]) + rest[end:]
+	}
+	return path
+}
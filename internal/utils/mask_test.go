@@ -0,0 +1,37 @@
+package utils
+
+import "testing"
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		want   string
+	}{
+		{"", ""},
+		{"short", "*****"},
+		{"12345678", "********"},
+		{"abcd12345678wxyz", "abcd********wxyz"},
+	}
+	for _, tt := range tests {
+		if got := MaskSecret(tt.secret); got != tt.want {
+			t.Errorf("MaskSecret(%q) = %q，应为 %q", tt.secret, got, tt.want)
+		}
+	}
+}
+
+func TestMaskSecretPath(t *testing.T) {
+	prefixes := []string{"/ws/", "/api/openapi/"}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/ws/abcd12345678wxyz", "/ws/abcd********wxyz"},
+		{"/api/openapi/abcd12345678wxyz/gateway/bot", "/api/openapi/abcd********wxyz/gateway/bot"},
+		{"/api/secrets", "/api/secrets"},
+	}
+	for _, tt := range tests {
+		if got := MaskSecretPath(tt.path, prefixes...); got != tt.want {
+			t.Errorf("MaskSecretPath(%q) = %q，应为 %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package websocket
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// delivery 一次 Webhook 消息投递，bridge 协议的事件序号在同一次投递的所有客户端之间共享
+type delivery struct {
+	m          *Manager
+	secret     string
+	body       []byte
+	event      *streamEvent
+	dispatched map[*GatewaySession]bool // 已下发该事件的网关会话
+}
+
+// markDispatched 记录网关会话已下发本次投递的事件
+func (d *delivery) markDispatched(s *GatewaySession) {
+	if d.dispatched == nil {
+		d.dispatched = make(map[*GatewaySession]bool)
+	}
+	d.dispatched[s] = true
+}
+
+// bridgeEvent 获取本次投递对应的 bridge 事件，首次调用时分配序号
+func (d *delivery) bridgeEvent() (*streamEvent, error) {
+	if d.event != nil {
+		return d.event, nil
+	}
+	event, err := d.m.getStream(d.secret).append(d.body)
+	if err != nil {
+		return nil, err
+	}
+	d.event = event
+	return event, nil
+}
+
+// streamEvent bridge 协议已分配序号的事件
+type streamEvent struct {
+	seq   int64
+	frame []byte
+}
+
+// eventStream 每个密钥的 bridge 事件序列，保留最近的事件用于会话恢复
+type eventStream struct {
+	mu     sync.Mutex
+	seq    int64
+	events []streamEvent // 最近的事件，按序号递增
+	size   int
+}
+
+// append 为事件分配递增序号并写入保留窗口
+func (s *eventStream) append(body []byte) (*streamEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 请求体是合法 JSON 时原样嵌入，否则作为字符串
+	var data any = string(body)
+	if json.Valid(body) {
+		data = json.RawMessage(body)
+	}
+
+	frame, err := json.Marshal(models.WebSocketMessage{
+		Type: "event",
+		Seq:  s.seq + 1,
+		Data: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.seq++
+	event := streamEvent{seq: s.seq, frame: frame}
+	s.events = append(s.events, event)
+	if s.size > 0 && len(s.events) > s.size {
+		s.events = append([]streamEvent(nil), s.events[len(s.events)-s.size:]...)
+	}
+	return &event, nil
+}
+
+// current 获取当前最大序号
+func (s *eventStream) current() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq
+}
+
+// collect 获取指定序号的事件以及大于 after 的事件（after 小于 0 表示不需要），返回值 lost 为已移出保留窗口的事件数
+func (s *eventStream) collect(seqs []int64, after int64) (events []streamEvent, lost int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first := s.seq + 1
+	if len(s.events) > 0 {
+		first = s.events[0].seq
+	}
+
+	wanted := make(map[int64]bool, len(seqs))
+	for _, seq := range seqs {
+		if seq < first {
+			lost++
+			continue
+		}
+		wanted[seq] = true
+	}
+	if after >= 0 && after+1 < first && after < s.seq {
+		lost += int(first - after - 1)
+	}
+
+	for _, event := range s.events {
+		if wanted[event.seq] || (after >= 0 && event.seq > after) {
+			events = append(events, event)
+		}
+	}
+	return events, lost
+}
+
+// getStream 获取密钥的 bridge 事件序列
+func (m *Manager) getStream(secret string) *eventStream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stream, exists := m.streams[secret]
+	if !exists {
+		stream = &eventStream{size: m.sessionBufferSize()}
+		m.streams[secret] = stream
+	}
+	return stream
+}
+
+// BridgeSession bridge 协议会话，记录已下发但未确认的事件，断线后可通过会话ID恢复
+type BridgeSession struct {
+	ID     string
+	Secret string
+
+	sessionState
+	acked   int64   // 客户端确认的最大序号
+	lastSeq int64   // 最后下发给该会话的序号
+	unacked []int64 // 已下发但未确认的序号
+	limit   int
+}
+
+// SessionID 获取会话ID
+func (s *BridgeSession) SessionID() string {
+	return s.ID
+}
+
+// owner 获取会话所属的密钥
+func (s *BridgeSession) owner() string {
+	return s.Secret
+}
+
+// deliver 以带序号的事件信封下发 Webhook 消息
+func (s *BridgeSession) deliver(c *Client, d *delivery) error {
+	event, err := d.bridgeEvent()
+	if err != nil {
+		return err
+	}
+	s.track(event.seq)
+	return c.WriteMessage(websocket.TextMessage, event.frame)
+}
+
+// track 记录已下发的事件序号
+func (s *BridgeSession) track(seq int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq <= s.acked {
+		return
+	}
+	for _, pending := range s.unacked {
+		if pending == seq {
+			return
+		}
+	}
+	if seq > s.lastSeq {
+		s.lastSeq = seq
+	}
+	s.unacked = append(s.unacked, seq)
+	if s.limit > 0 && len(s.unacked) > s.limit {
+		s.unacked = append([]int64(nil), s.unacked[len(s.unacked)-s.limit:]...)
+	}
+}
+
+// Ack 确认序号不大于 seq 的所有事件，超过最后下发序号的部分按最后下发的序号处理，不会确认尚未下发的事件
+func (s *BridgeSession) Ack(seq int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq > s.lastSeq {
+		seq = s.lastSeq
+	}
+	if seq <= s.acked {
+		return
+	}
+	s.acked = seq
+
+	remaining := s.unacked[:0]
+	for _, pending := range s.unacked {
+		if pending > seq {
+			remaining = append(remaining, pending)
+		}
+	}
+	s.unacked = remaining
+}
+
+// Progress 获取最后下发的序号和已确认的序号
+func (s *BridgeSession) Progress() (lastSeq, acked int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastSeq, s.acked
+}
+
+// pending 获取未确认的序号和最后下发的序号
+func (s *BridgeSession) pending() ([]int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.unacked...), s.lastSeq
+}
+
+// NewBridgeSession 创建 bridge 会话
+func (m *Manager) NewBridgeSession(secret string) *BridgeSession {
+	session := &BridgeSession{
+		ID:     generateSessionID(),
+		Secret: secret,
+		limit:  m.sessionBufferSize(),
+	}
+	// 新会话从当前序号开始接收事件
+	session.lastSeq = m.getStream(secret).current()
+	session.acked = session.lastSeq
+	m.registerSession(session)
+	return session
+}
+
+// FindBridgeSession 查找可恢复的 bridge 会话
+func (m *Manager) FindBridgeSession(secret, sessionID string) (*BridgeSession, error) {
+	session, ok := m.findSession(secret, sessionID).(*BridgeSession)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// AddBridgeConnection 添加 bridge 协议连接
+// 恢复会话时先确认 ackedSeq（小于 0 表示使用服务端记录），再补发未确认的事件；
+// broadcast 模式下还会补发断线期间其他客户端收到的事件
+func (m *Manager) AddBridgeConnection(secret string, conn *websocket.Conn, session *BridgeSession, resumed bool, ackedSeq int64) (*Client, error) {
+	if ackedSeq >= 0 {
+		session.Ack(ackedSeq)
+	}
+
+	welcome := func(c *Client) error {
+		unacked, lastSeq := session.pending()
+		after := int64(-1)
+		if resumed && m.config != nil && m.config.GetDeliveryMode(secret) == config.DeliveryModeBroadcast {
+			after = lastSeq
+		}
+
+		stream := m.getStream(secret)
+		var missed []streamEvent
+		lost := 0
+		if resumed {
+			missed, lost = stream.collect(unacked, after)
+		}
+		lastSeq, acked := session.Progress()
+
+		if err := c.SendMessage(models.WebSocketMessage{
+			Type: "connected",
+			Data: map[string]interface{}{
+				"secret":     secret,
+				"client_id":  c.ID,
+				"session_id": session.ID,
+				"resumed":    resumed,
+				"seq":        stream.current(),
+				"last_seq":   lastSeq,
+				"acked_seq":  acked,
+				"missed":     len(missed),
+				"lost":       lost,
+				"timestamp":  time.Now().Format(time.RFC3339),
+			},
+		}); err != nil {
+			return err
+		}
+
+		for _, event := range missed {
+			session.track(event.seq)
+			if err := c.WriteMessage(websocket.TextMessage, event.frame); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return m.addSessionClient(secret, conn, session, welcome)
+}
@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"nekobridge/internal/models"
+)
+
+func TestEventStreamAppend(t *testing.T) {
+	stream := &eventStream{size: 2}
+	tests := []struct {
+		body string
+		want interface{} // 事件信封中的 data
+	}{
+		{`{"op":0}`, map[string]interface{}{"op": float64(0)}},
+		{"plain text", "plain text"},
+		{`[1,2]`, []interface{}{float64(1), float64(2)}},
+	}
+	for i, tt := range tests {
+		event, err := stream.append([]byte(tt.body))
+		if err != nil {
+			t.Fatalf("append() 失败: %v", err)
+		}
+		var msg models.WebSocketMessage
+		if err := json.Unmarshal(event.frame, &msg); err != nil {
+			t.Fatalf("解析事件信封失败: %v", err)
+		}
+		if event.seq != int64(i+1) || msg.Seq != event.seq || msg.Type != "event" {
+			t.Errorf("第 %d 个事件的序号 = %d，信封 = %+v", i+1, event.seq, msg)
+		}
+		if !reflect.DeepEqual(msg.Data, tt.want) {
+			t.Errorf("事件 data = %#v，应为 %#v", msg.Data, tt.want)
+		}
+	}
+	if len(stream.events) != 2 || stream.events[0].seq != 2 || stream.current() != 3 {
+		t.Errorf("保留窗口 = %v，应只保留最近 2 个事件", stream.events)
+	}
+}
+
+func TestEventStreamCollect(t *testing.T) {
+	// 下发 5 个事件，保留窗口为 3..5
+	stream := &eventStream{size: 3}
+	for i := 0; i < 5; i++ {
+		stream.append([]byte("e"))
+	}
+
+	tests := []struct {
+		name     string
+		seqs     []int64
+		after    int64
+		want     []int64
+		wantLost int
+	}{
+		{"补发未确认的事件", []int64{3, 5}, -1, []int64{3, 5}, 0},
+		{"未确认的事件已移出窗口", []int64{1, 4}, -1, []int64{4}, 1},
+		{"补发断线期间的事件", nil, 3, []int64{4, 5}, 0},
+		{"断线期间的事件部分丢失", nil, 0, []int64{3, 4, 5}, 2},
+		{"未确认与断线期间的事件合并", []int64{3}, 4, []int64{3, 5}, 0},
+		{"已是最新", nil, 5, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, lost := stream.collect(tt.seqs, tt.after)
+			var got []int64
+			for _, event := range events {
+				got = append(got, event.seq)
+			}
+			if !reflect.DeepEqual(got, tt.want) || lost != tt.wantLost {
+				t.Errorf("collect() = (%v, %d)，应为 (%v, %d)", got, lost, tt.want, tt.wantLost)
+			}
+		})
+	}
+}
+
+func TestBridgeSessionAck(t *testing.T) {
+	session := &BridgeSession{limit: 3}
+	for _, seq := range []int64{1, 2, 2, 3} {
+		session.track(seq)
+	}
+	if unacked, lastSeq := session.pending(); !reflect.DeepEqual(unacked, []int64{1, 2, 3}) || lastSeq != 3 {
+		t.Fatalf("pending() = (%v, %d)，重复的序号只应记录一次", unacked, lastSeq)
+	}
+
+	session.Ack(2)
+	session.Ack(1) // 确认序号不回退
+	session.track(2)
+	if unacked, _ := session.pending(); !reflect.DeepEqual(unacked, []int64{3}) {
+		t.Errorf("确认后未确认的序号 = %v，应为 [3]", unacked)
+	}
+	if lastSeq, acked := session.Progress(); lastSeq != 3 || acked != 2 {
+		t.Errorf("Progress() = (%d, %d)，应为 (3, 2)", lastSeq, acked)
+	}
+
+	// 超过最后下发序号的确认不会提前确认之后的事件
+	session.Ack(10)
+	session.track(4)
+	if unacked, _ := session.pending(); !reflect.DeepEqual(unacked, []int64{4}) {
+		t.Errorf("超前确认后未确认的序号 = %v，应为 [4]", unacked)
+	}
+	if _, acked := session.Progress(); acked != 3 {
+		t.Errorf("超前确认后 acked = %d，应为 3", acked)
+	}
+
+	for seq := int64(5); seq <= 7; seq++ {
+		session.track(seq)
+	}
+	if unacked, _ := session.pending(); !reflect.DeepEqual(unacked, []int64{5, 6, 7}) {
+		t.Errorf("未确认的序号 = %v，超过上限时应只保留最近 3 个", unacked)
+	}
+}
@@ -0,0 +1,336 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/metrics"
+	"nekobridge/internal/models"
+	"nekobridge/internal/traffic"
+	"nekobridge/internal/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// outboundMessage 等待写入连接的一帧消息
+type outboundMessage struct {
+	messageType int
+	data        []byte
+	webhook     bool // 原样转发的 Webhook 请求体，连接断开时未写入的会重新写入离线队列
+}
+
+// Client 单个WebSocket客户端会话（同一密钥下可以同时存在多个）
+// 所有数据帧先进入有界的发送队列，由独立的写协程按顺序写入连接，调用方不会等待网络
+type Client struct {
+	ID          string
+	Secret      string
+	RemoteAddr  string
+	ConnectedAt time.Time
+
+	conn       *websocket.Conn
+	session    clientSession // 可恢复的会话（QQ 网关协议、bridge 协议），原样转发的连接为 nil
+	settings   Settings      // 当前生效的读写设置，配置修改后由管理器更新
+	settingsMu sync.RWMutex
+
+	send      chan outboundMessage // 发送队列
+	sendMu    sync.Mutex           // 保护入队与丢弃操作
+	policy    string               // 发送队列已满时的处理策略
+	done      chan struct{}        // 连接关闭后停止写协程
+	closeOnce sync.Once
+	dropped   atomic.Uint64 // 因发送队列已满丢弃的消息数
+	sent      atomic.Uint64 // 已写入连接的消息数
+
+	// undelivered 连接关闭后接收发送队列中未写入的 Webhook 消息，为 nil 时直接丢弃
+	undelivered func(c *Client, bodies [][]byte)
+}
+
+// newClient 创建客户端会话，必须在连接的读协程中调用（会替换连接的 Pong 处理器）
+func newClient(secret string, conn *websocket.Conn, queueSize int, policy string) *Client {
+	if queueSize <= 0 {
+		queueSize = 1024
+	}
+	c := &Client{
+		ID:          generateClientID(),
+		Secret:      secret,
+		RemoteAddr:  conn.RemoteAddr().String(),
+		ConnectedAt: time.Now(),
+		conn:        conn,
+		send:        make(chan outboundMessage, queueSize),
+		policy:      policy,
+		done:        make(chan struct{}),
+	}
+	// 收到 Pong 时按当前设置重置读超时
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(c.Settings().ReadTimeout))
+	})
+	return c
+}
+
+// Settings 获取连接当前生效的读写设置
+func (c *Client) Settings() Settings {
+	c.settingsMu.RLock()
+	defer c.settingsMu.RUnlock()
+	return c.settings
+}
+
+// applySettings 更新连接的读写设置，读超时立即按新设置重新计时，返回设置是否发生变化
+// 消息大小限制只能在读协程中修改，由 PrepareRead 在读取下一条消息前应用
+func (c *Client) applySettings(settings Settings) bool {
+	c.settingsMu.Lock()
+	if c.settings.sameAs(settings) {
+		c.settingsMu.Unlock()
+		return false
+	}
+	c.settings = settings
+	c.settingsMu.Unlock()
+
+	c.conn.SetReadDeadline(time.Now().Add(settings.ReadTimeout))
+	return true
+}
+
+// PrepareRead 读取下一条消息前调用（必须在读协程中），按当前设置重置读超时和消息大小限制
+func (c *Client) PrepareRead() {
+	settings := c.Settings()
+	c.conn.SetReadLimit(settings.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(settings.ReadTimeout))
+}
+
+// Conn 获取底层连接
+func (c *Client) Conn() *websocket.Conn {
+	return c.conn
+}
+
+// SessionID 获取会话ID，原样转发的连接返回空字符串
+func (c *Client) SessionID() string {
+	if c.session == nil {
+		return ""
+	}
+	return c.session.SessionID()
+}
+
+// BridgeSession 获取 bridge 协议会话
+func (c *Client) BridgeSession() *BridgeSession {
+	session, _ := c.session.(*BridgeSession)
+	return session
+}
+
+// Protocol 获取连接协议
+func (c *Client) Protocol() string {
+	switch c.session.(type) {
+	case *GatewaySession:
+		return config.ProtocolQQ
+	case *BridgeSession:
+		return config.ProtocolBridge
+	}
+	return config.ProtocolRaw
+}
+
+// deliver 投递 Webhook 消息，会话连接按各自协议转换消息格式
+func (c *Client) deliver(d *delivery) error {
+	if c.session != nil {
+		return c.session.deliver(c, d)
+	}
+	return c.push(outboundMessage{messageType: websocket.TextMessage, data: d.body, webhook: true})
+}
+
+// WriteJSON 以文本帧写入 JSON
+func (c *Client) WriteJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, data)
+}
+
+// WriteMessage 将一帧消息放入发送队列，不等待实际写入
+// 队列已满时按策略处理：drop_oldest 丢弃最旧的消息，drop_newest 丢弃本条消息并返回 ErrSendQueueFull，
+// disconnect 断开连接并返回 ErrConnectionClosed
+func (c *Client) WriteMessage(messageType int, data []byte) error {
+	return c.push(outboundMessage{messageType: messageType, data: data})
+}
+
+// push 将一帧消息放入发送队列，队列已满时按策略处理
+func (c *Client) push(msg outboundMessage) error {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	select {
+	case <-c.done:
+		return ErrConnectionClosed
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return nil
+	default:
+	}
+
+	switch c.policy {
+	case config.SendQueueDropNewest:
+		c.recordDrop()
+		return ErrSendQueueFull
+
+	case config.SendQueueDisconnect:
+		c.recordDrop()
+		log.Printf("发送队列已满 [%s/%s]，断开消费过慢的连接", utils.MaskSecret(c.Secret), c.ID)
+		go c.close(websocket.ClosePolicyViolation, "发送队列已满")
+		return ErrConnectionClosed
+
+	default:
+		// 写协程可能已经取走了消息，此时无需丢弃；入队方都持有 sendMu，腾出的位置不会被抢占
+		select {
+		case <-c.send:
+			c.recordDrop()
+		default:
+		}
+		c.send <- msg
+		return nil
+	}
+}
+
+// recordDrop 记录一次因发送队列已满丢弃的消息，首次丢弃时输出日志
+func (c *Client) recordDrop() {
+	metrics.ObserveSendQueueDrop(c.Secret, c.policy)
+	if c.dropped.Add(1) == 1 {
+		log.Printf("发送队列已满 [%s/%s] (容量: %d, 策略: %s)，开始丢弃消息", utils.MaskSecret(c.Secret), c.ID, cap(c.send), c.policy)
+	}
+}
+
+// QueueStats 获取发送队列当前长度、容量以及累计丢弃和已发送的消息数
+func (c *Client) QueueStats() (depth, capacity int, dropped, sent uint64) {
+	return len(c.send), cap(c.send), c.dropped.Load(), c.sent.Load()
+}
+
+// queueFree 获取发送队列的剩余空间
+func (c *Client) queueFree() int {
+	return cap(c.send) - len(c.send)
+}
+
+// writePump 写协程，按顺序将发送队列中的消息写入连接，每次写入单独设置写超时，写入失败时关闭连接
+// 退出时交还发送队列中未写入的 Webhook 消息
+func (c *Client) writePump() {
+	for {
+		select {
+		case <-c.done:
+			c.returnUndelivered(nil)
+			return
+		case msg := <-c.send:
+			if writeTimeout := c.Settings().WriteTimeout; writeTimeout > 0 {
+				c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			} else {
+				c.conn.SetWriteDeadline(time.Time{})
+			}
+			if err := c.conn.WriteMessage(msg.messageType, msg.data); err != nil {
+				log.Printf("消息写入失败 [%s/%s]: %v，关闭连接", utils.MaskSecret(c.Secret), c.ID, err)
+				c.shutdown()
+				c.conn.Close()
+				c.returnUndelivered(&msg)
+				return
+			}
+			c.sent.Add(1)
+			metrics.ObserveMessage(c.Secret, metrics.DirectionOut, len(msg.data))
+		}
+	}
+}
+
+// returnUndelivered 取出发送队列中剩余的消息，将其中的 Webhook 消息（以及写入失败的 failed）交给 undelivered
+// 必须在 shutdown 之后由写协程调用，此时不会再有消息入队
+func (c *Client) returnUndelivered(failed *outboundMessage) {
+	var bodies [][]byte
+	if failed != nil && failed.webhook {
+		bodies = append(bodies, failed.data)
+	}
+	for {
+		select {
+		case msg := <-c.send:
+			if msg.webhook {
+				bodies = append(bodies, msg.data)
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if len(bodies) > 0 && c.undelivered != nil {
+		c.undelivered(c, bodies)
+	}
+}
+
+// shutdown 停止写协程，之后的写入都会返回 ErrConnectionClosed
+// 持有 sendMu 关闭，保证写协程退出后发送队列中不会再有新消息
+func (c *Client) shutdown() {
+	c.closeOnce.Do(func() {
+		c.sendMu.Lock()
+		close(c.done)
+		c.sendMu.Unlock()
+		traffic.RecordDisconnect(c.Secret)
+	})
+}
+
+// SendMessage 按消息格式发送结构化消息
+func (c *Client) SendMessage(message models.WebSocketMessage) error {
+	var err error
+	// 根据消息格式选择发送方式
+	switch message.Format {
+	case models.MessageFormatBinary:
+		// 发送二进制数据
+		if message.Raw != nil {
+			err = c.WriteMessage(websocket.BinaryMessage, message.Raw)
+		} else {
+			err = c.WriteMessage(websocket.BinaryMessage, []byte{})
+		}
+
+	case models.MessageFormatText:
+		// 发送纯文本数据
+		text, _ := message.Data.(string)
+		err = c.WriteMessage(websocket.TextMessage, []byte(text))
+
+	case models.MessageFormatJSON:
+		fallthrough
+	default:
+		// 默认使用JSON格式
+		data, errMarshal := json.Marshal(message)
+		if errMarshal != nil {
+			log.Printf("JSON序列化失败 [%s/%s]: %v", utils.MaskSecret(c.Secret), c.ID, errMarshal)
+			return errMarshal
+		}
+		err = c.WriteMessage(websocket.TextMessage, data)
+	}
+
+	if err != nil {
+		log.Printf("消息发送失败 [%s/%s] (类型: %s, 格式: %s): %v", utils.MaskSecret(c.Secret), c.ID, message.Type, message.Format, err)
+	}
+	return err
+}
+
+// ping 发送心跳帧（控制帧可以与写协程并发写入）
+func (c *Client) ping(timeout time.Duration) error {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	return c.conn.WriteControl(websocket.PingMessage, nil, deadline)
+}
+
+// close 停止写协程，发送关闭帧并关闭连接，队列中未写入的 Webhook 消息由写协程交还
+func (c *Client) close(code int, reason string) {
+	c.shutdown()
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	c.conn.Close()
+}
+
+// generateClientID 生成客户端会话ID
+func generateClientID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format("150405.000000")))[:16]
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,65 @@
+package websocket
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"nekobridge/internal/config"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSendQueuePolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr error
+		want    []string // 队列中剩余的消息
+		closed  bool
+	}{
+		{config.SendQueueDropOldest, nil, []string{"m2", "m3"}, false},
+		{config.SendQueueDropNewest, ErrSendQueueFull, []string{"m1", "m2"}, false},
+		{config.SendQueueDisconnect, ErrConnectionClosed, []string{"m1", "m2"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			// 不启动写协程，消息停留在发送队列中
+			var client *Client
+			dial(t, func(conn *websocket.Conn) (*Client, error) {
+				client = newClient(testSecret, conn, 2, tt.policy)
+				return client, nil
+			})
+
+			for _, text := range []string{"m1", "m2"} {
+				if err := client.WriteMessage(websocket.TextMessage, []byte(text)); err != nil {
+					t.Fatalf("队列未满时写入失败: %v", err)
+				}
+			}
+			if err := client.WriteMessage(websocket.TextMessage, []byte("m3")); !errors.Is(err, tt.wantErr) {
+				t.Errorf("队列已满时写入错误 = %v，应为 %v", err, tt.wantErr)
+			}
+
+			if _, _, dropped, _ := client.QueueStats(); dropped != 1 {
+				t.Errorf("丢弃的消息数 = %d，应为 1", dropped)
+			}
+			var got []string
+			for len(client.send) > 0 {
+				got = append(got, string((<-client.send).data))
+			}
+			if len(got) != len(tt.want) || got[0] != tt.want[0] || got[1] != tt.want[1] {
+				t.Errorf("队列中的消息 = %v，应为 %v", got, tt.want)
+			}
+
+			if tt.closed {
+				select {
+				case <-client.done:
+				case <-time.After(2 * time.Second):
+					t.Fatal("队列已满时应断开连接")
+				}
+				if err := client.WriteMessage(websocket.TextMessage, []byte("m4")); !errors.Is(err, ErrConnectionClosed) {
+					t.Errorf("断开后写入错误 = %v，应为 %v", err, ErrConnectionClosed)
+				}
+			}
+		})
+	}
+}
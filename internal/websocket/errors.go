@@ -14,4 +14,19 @@ var (
 	
 	// ErrInvalidMessage 无效消息
 	ErrInvalidMessage = errors.New("invalid message")
+
+	// ErrQueueDisabled 离线队列未启用
+	ErrQueueDisabled = errors.New("offline queue disabled")
+
+	// ErrSessionNotFound 会话不存在或已过期
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrSessionResumeFailed 会话保留的事件不足以恢复
+	ErrSessionResumeFailed = errors.New("session cannot be resumed")
+
+	// ErrSendQueueFull 发送队列已满，消息被丢弃
+	ErrSendQueueFull = errors.New("send queue full")
+
+	// ErrNotDispatch 消息不是 Dispatch 事件，QQ 网关协议的连接无法下发
+	ErrNotDispatch = errors.New("not a dispatch event")
 )
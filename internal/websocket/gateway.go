@@ -0,0 +1,207 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+
+	"nekobridge/internal/models"
+	"nekobridge/internal/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// gatewayEvent 会话中保留用于恢复的已下发事件
+type gatewayEvent struct {
+	seq   int64
+	frame []byte
+}
+
+// GatewaySession QQ 网关协议会话，客户端断开后在超时时间内可以通过 Resume 恢复
+type GatewaySession struct {
+	ID     string
+	Secret string
+
+	sessionState
+	seq        int64
+	events     []gatewayEvent // 最近下发的事件，按序号递增
+	bufferSize int
+}
+
+// Seq 获取会话当前的事件序号
+func (s *GatewaySession) Seq() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq
+}
+
+// Dispatch 以 op 0 下发事件，分配会话内递增的序号并保留用于恢复
+func (s *GatewaySession) Dispatch(c *Client, eventType, eventID string, data json.RawMessage) error {
+	frame, err := s.record(eventType, eventID, data)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, frame)
+}
+
+// record 为事件分配序号并写入保留窗口，返回事件帧
+func (s *GatewaySession) record(eventType, eventID string, data json.RawMessage) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frame, err := json.Marshal(models.GatewayPayload{
+		ID: eventID,
+		Op: models.GatewayOpDispatch,
+		D:  data,
+		S:  s.seq + 1,
+		T:  eventType,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.seq++
+	s.events = append(s.events, gatewayEvent{seq: s.seq, frame: frame})
+	if s.bufferSize > 0 && len(s.events) > s.bufferSize {
+		s.events = append([]gatewayEvent(nil), s.events[len(s.events)-s.bufferSize:]...)
+	}
+	return frame, nil
+}
+
+// buffer 会话未在本次投递中下发该事件时，将它写入保留窗口，等待客户端恢复会话后补发
+// 尚未下发 READY 的新会话不保留事件
+func (s *GatewaySession) buffer(d *delivery) {
+	if d.dispatched[s] {
+		return
+	}
+	payload, ok := dispatchPayload(d.body)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	ready := s.seq > 0
+	s.mu.Unlock()
+	if !ready {
+		return
+	}
+	if _, err := s.record(payload.T, payload.ID, payload.D); err != nil {
+		log.Printf("保留网关事件失败 [%s/%s]: %v", utils.MaskSecret(s.Secret), s.ID, err)
+	}
+}
+
+// Replay 补发序号大于 seq 的事件，返回补发的事件数，保留窗口无法覆盖时返回 ErrSessionResumeFailed
+// 需要在 AddGatewayConnection 的 welcome 中调用，与实时投递互斥，补发期间不会遗漏或重复事件
+func (s *GatewaySession) Replay(c *Client, seq int64) (int, error) {
+	frames, ok := s.since(seq)
+	if !ok {
+		return 0, ErrSessionResumeFailed
+	}
+	for _, frame := range frames {
+		if err := c.WriteMessage(websocket.TextMessage, frame); err != nil {
+			return 0, err
+		}
+	}
+	return len(frames), nil
+}
+
+// SessionID 获取会话ID
+func (s *GatewaySession) SessionID() string {
+	return s.ID
+}
+
+// owner 获取会话所属的密钥
+func (s *GatewaySession) owner() string {
+	return s.Secret
+}
+
+// deliver 将 Webhook 请求体转换为网关事件下发，非 Dispatch 类型的请求体返回 ErrNotDispatch
+func (s *GatewaySession) deliver(c *Client, d *delivery) error {
+	payload, ok := dispatchPayload(d.body)
+	if !ok {
+		log.Printf("非 Dispatch 事件，网关会话不下发 [%s/%s] (op=%d)", utils.MaskSecret(s.Secret), s.ID, payload.Op)
+		return ErrNotDispatch
+	}
+	d.markDispatched(s)
+	return s.Dispatch(c, payload.T, payload.ID, payload.D)
+}
+
+// dispatchPayload 解析 Webhook 请求体，只有带事件类型的 op 0 请求体可以作为网关事件下发
+func dispatchPayload(body []byte) (models.GatewayPayload, bool) {
+	var payload models.GatewayPayload
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Op != models.GatewayOpDispatch || payload.T == "" {
+		return payload, false
+	}
+	return payload, true
+}
+
+// since 获取序号大于 seq 的已下发事件，保留窗口无法覆盖时返回 false
+func (s *GatewaySession) since(seq int64) ([][]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq > s.seq {
+		return nil, false
+	}
+	if seq == s.seq {
+		return nil, true
+	}
+	if len(s.events) == 0 || s.events[0].seq > seq+1 {
+		return nil, false
+	}
+
+	frames := make([][]byte, 0, s.seq-seq)
+	for _, event := range s.events {
+		if event.seq > seq {
+			frames = append(frames, event.frame)
+		}
+	}
+	return frames, true
+}
+
+// NewGatewaySession 创建 QQ 网关会话
+func (m *Manager) NewGatewaySession(secret string) *GatewaySession {
+	session := &GatewaySession{
+		ID:         generateSessionID(),
+		Secret:     secret,
+		bufferSize: m.sessionBufferSize(),
+	}
+	m.registerSession(session)
+	return session
+}
+
+// ResumeGatewaySession 查找可恢复的 QQ 网关会话，保留窗口已无法覆盖 seq 时返回 ErrSessionResumeFailed
+// 错过的事件由 welcome 中调用 Replay 补发
+func (m *Manager) ResumeGatewaySession(secret, sessionID string, seq int64) (*GatewaySession, error) {
+	session, ok := m.findSession(secret, sessionID).(*GatewaySession)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if _, ok := session.since(seq); !ok {
+		return nil, ErrSessionResumeFailed
+	}
+	return session, nil
+}
+
+// bufferGatewayEvents broadcast 模式下将其他客户端收到的事件写入断线的网关会话，恢复会话时补发
+// 调用方必须持有该密钥的投递锁
+func (m *Manager) bufferGatewayEvents(secret string, d *delivery) {
+	timeout := m.sessionTimeout()
+
+	m.mu.RLock()
+	var sessions []*GatewaySession
+	for _, session := range m.sessions {
+		if gateway, ok := session.(*GatewaySession); ok && gateway.Secret == secret && !gateway.expired(timeout) {
+			sessions = append(sessions, gateway)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, session := range sessions {
+		session.buffer(d)
+	}
+}
+
+// AddGatewayConnection 添加 QQ 网关协议连接，welcome 负责下发 READY 或补发错过的事件
+func (m *Manager) AddGatewayConnection(secret string, conn *websocket.Conn, session *GatewaySession, welcome func(*Client) error) (*Client, error) {
+	return m.addSessionClient(secret, conn, session, welcome)
+}
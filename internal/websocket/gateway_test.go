@@ -0,0 +1,177 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// dispatchBody 构造 op 0 的 Webhook 请求体
+func dispatchBody(eventType string) string {
+	return `{"op":0,"id":"e-` + eventType + `","t":"` + eventType + `","d":{}}`
+}
+
+// dialGateway 建立 QQ 网关协议的测试连接，欢迎消息为 op 10 Hello
+func dialGateway(t *testing.T, m *Manager) (*websocket.Conn, *GatewaySession) {
+	t.Helper()
+	session := m.NewGatewaySession(testSecret)
+	conn := dial(t, func(conn *websocket.Conn) (*Client, error) {
+		return m.AddGatewayConnection(testSecret, conn, session, func(c *Client) error {
+			return c.WriteJSON(models.GatewayPayload{Op: models.GatewayOpHello})
+		})
+	})
+	readText(t, conn)
+	return conn, session
+}
+
+// readDispatch 读取一条 Dispatch 事件
+func readDispatch(t *testing.T, conn *websocket.Conn) models.GatewayPayload {
+	t.Helper()
+	var payload models.GatewayPayload
+	if err := json.Unmarshal([]byte(readText(t, conn)), &payload); err != nil {
+		t.Fatalf("解析网关事件失败: %v", err)
+	}
+	if payload.Op != models.GatewayOpDispatch {
+		t.Fatalf("网关事件 op = %d，应为 %d", payload.Op, models.GatewayOpDispatch)
+	}
+	return payload
+}
+
+func TestGatewayDeliver(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{"Dispatch 事件", dispatchBody("AT_MESSAGE_CREATE"), nil},
+		{"回调验证", `{"op":13,"d":{"plain_token":"x","event_ts":"1"}}`, ErrNotDispatch},
+		{"缺少事件类型", `{"op":0,"d":{}}`, ErrNotDispatch},
+		{"非 JSON", "plain text", ErrNotDispatch},
+	}
+	openTestQueue(t)
+	m := newTestManager(t, config.QueueConfig{Enabled: true})
+	conn, session := dialGateway(t, m)
+	waitReplayed(t, m, testSecret)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queued, err := m.DeliverText(testSecret, tt.body)
+			if !errors.Is(err, tt.wantErr) || queued {
+				t.Fatalf("DeliverText() = (%v, %v)，应为 (false, %v)", queued, err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				// 消息不适用于该协议时保留连接
+				if !m.IsConnected(testSecret) {
+					t.Fatal("连接不应被移除")
+				}
+				return
+			}
+			if payload := readDispatch(t, conn); payload.S != session.Seq() || payload.T != "AT_MESSAGE_CREATE" {
+				t.Errorf("下发的事件 = %+v，序号应为 %d", payload, session.Seq())
+			}
+		})
+	}
+	waitQueueEmpty(t, testSecret)
+}
+
+func TestGatewayReplaySkipsNotDispatch(t *testing.T) {
+	openTestQueue(t)
+	m := newTestManager(t, config.QueueConfig{Enabled: true})
+	for _, body := range []string{dispatchBody("A"), `{"op":13}`, dispatchBody("B")} {
+		if queued, err := m.DeliverText(testSecret, body); err != nil || !queued {
+			t.Fatalf("离线时 DeliverText() = (%v, %v)，应写入离线队列", queued, err)
+		}
+	}
+
+	conn, _ := dialGateway(t, m)
+	for i, want := range []string{"A", "B"} {
+		payload := readDispatch(t, conn)
+		if payload.T != want || payload.S != int64(i+1) {
+			t.Errorf("补发的事件 = %s#%d，应为 %s#%d", payload.T, payload.S, want, i+1)
+		}
+	}
+	waitQueueEmpty(t, testSecret)
+}
+
+func TestGatewaySince(t *testing.T) {
+	session := &GatewaySession{bufferSize: 3}
+	for i := 0; i < 5; i++ {
+		session.seq++
+		session.events = append(session.events, gatewayEvent{seq: session.seq})
+	}
+	session.events = session.events[2:] // 保留窗口为 3..5
+
+	tests := []struct {
+		seq    int64
+		want   int
+		wantOK bool
+	}{
+		{5, 0, true},
+		{4, 1, true},
+		{2, 3, true},
+		{1, 0, false}, // 事件 2 已移出保留窗口
+		{6, 0, false}, // 序号超前
+	}
+	for _, tt := range tests {
+		frames, ok := session.since(tt.seq)
+		if ok != tt.wantOK || len(frames) != tt.want {
+			t.Errorf("since(%d) = (%d 条, %v)，应为 (%d 条, %v)", tt.seq, len(frames), ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestGatewayResumeReplaysEventsWhileDetached(t *testing.T) {
+	openTestQueue(t)
+	m := newTestManager(t, config.QueueConfig{Enabled: true})
+	m.config.AddSecret(testSecret, config.SecretConfig{Enabled: true, DeliveryMode: config.DeliveryModeBroadcast})
+
+	session := m.NewGatewaySession(testSecret)
+	var gateway *Client
+	conn := dial(t, func(conn *websocket.Conn) (*Client, error) {
+		client, err := m.AddGatewayConnection(testSecret, conn, session, func(c *Client) error {
+			return session.Dispatch(c, "READY", "", json.RawMessage(`{}`))
+		})
+		gateway = client
+		return client, err
+	})
+	if payload := readDispatch(t, conn); payload.T != "READY" || payload.S != 1 {
+		t.Fatalf("第一条事件 = %s#%d，应为 READY#1", payload.T, payload.S)
+	}
+	raw := dial(t, func(conn *websocket.Conn) (*Client, error) {
+		return m.AddConnection(testSecret, conn)
+	})
+	readText(t, raw)
+	waitReplayed(t, m, testSecret)
+
+	// 网关客户端断开期间，其他客户端收到的事件保留在会话中
+	m.RemoveClient(gateway)
+	for _, eventType := range []string{"A", "B"} {
+		if queued, err := m.DeliverText(testSecret, dispatchBody(eventType)); err != nil || queued {
+			t.Fatalf("DeliverText() = (%v, %v)，应直接下发", queued, err)
+		}
+		readText(t, raw)
+	}
+
+	resumed, err := m.ResumeGatewaySession(testSecret, session.ID, 1)
+	if err != nil {
+		t.Fatalf("ResumeGatewaySession() 失败: %v", err)
+	}
+	conn = dial(t, func(conn *websocket.Conn) (*Client, error) {
+		return m.AddGatewayConnection(testSecret, conn, resumed, func(c *Client) error {
+			if _, err := resumed.Replay(c, 1); err != nil {
+				return err
+			}
+			return resumed.Dispatch(c, "RESUMED", "", json.RawMessage(`""`))
+		})
+	})
+	for i, want := range []string{"A", "B", "RESUMED"} {
+		if payload := readDispatch(t, conn); payload.T != want || payload.S != int64(i+2) {
+			t.Errorf("恢复后收到的事件 = %s#%d，应为 %s#%d", payload.T, payload.S, want, i+2)
+		}
+	}
+}
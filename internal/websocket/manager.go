@@ -1,32 +1,60 @@
 package websocket
 
 import (
-	"encoding/json"
+	"errors"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"nekobridge/internal/config"
+	"nekobridge/internal/database"
+	"nekobridge/internal/metrics"
 	"nekobridge/internal/models"
+	"nekobridge/internal/traffic"
+	"nekobridge/internal/utils"
 
 	"github.com/gorilla/websocket"
 )
 
 // Manager WebSocket连接管理器
 type Manager struct {
-	connections      map[string]*websocket.Conn
+	clients          map[string][]*Client // 每个密钥下的客户端，按连接时间排序（最早的在前）
+	rrIndex          map[string]int       // round_robin 模式下每个密钥的轮询位置
+	sessions         map[string]clientSession
+	streams          map[string]*eventStream // bridge 协议每个密钥的事件序列
 	mu               sync.RWMutex
-	writeMus         map[string]*sync.Mutex // 每个连接独立的写锁，防止并发写导致连接关闭或消息丢失
 	config           *config.Config
 	totalConnections int64 // 累计连接总数
+
+	deliverMus map[string]*sync.Mutex // 每个密钥的投递锁，保证离线补发与实时消息的先后顺序
+	backlog    map[string]bool        // 可能存在待补发离线消息的密钥
+	replays    map[string]bool        // 正在补发离线消息的密钥，值为补发过程中是否又有新的补发请求
+	queue      *database.QueueService
+
+	heartbeatMu   sync.Mutex
+	heartbeatStop chan struct{} // 关闭后停止当前的心跳循环，为 nil 表示心跳未运行
+	heartbeat     Settings      // 当前心跳循环使用的心跳设置
 }
 
+// replayBatchSize 每批补发的离线消息数量
+const replayBatchSize = 100
+
+// replayWaitInterval 补发离线消息时等待客户端发送队列腾出空间的检查间隔
+const replayWaitInterval = 100 * time.Millisecond
+
 // NewManager 创建新的WebSocket管理器
 func NewManager() *Manager {
 	m := &Manager{
-		connections:      make(map[string]*websocket.Conn),
-		writeMus:         make(map[string]*sync.Mutex),
+		clients:          make(map[string][]*Client),
+		rrIndex:          make(map[string]int),
+		sessions:         make(map[string]clientSession),
+		streams:          make(map[string]*eventStream),
 		totalConnections: 0,
+		deliverMus:       make(map[string]*sync.Mutex),
+		backlog:          make(map[string]bool),
+		replays:          make(map[string]bool),
+		queue:            &database.QueueService{},
 	}
 	return m
 }
@@ -37,212 +65,601 @@ func (m *Manager) SetConfig(cfg *config.Config) {
 }
 
 // AddConnection 添加连接
-func (m *Manager) AddConnection(secret string, conn *websocket.Conn) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	// 检查连接数限制 - 注意：这里检查的是 map 中的当前连接数
-	// 因为只有一个 secret 可以连接一次（被新连接替代），所以不需要额外的全局限制
-
-	// 关闭旧连接（如果存在）
-	if oldConn, exists := m.connections[secret]; exists {
-		log.Printf("WebSocket连接 [%s] 已存在，正在关闭旧连接", secret)
-		// 发送关闭通知（不阻塞，使用 goroutine）
-		go func() {
-			oldConn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseServiceRestart, "新连接已建立，关闭旧连接"))
-			oldConn.Close()
-		}()
-		// 删除旧的写锁
-		delete(m.writeMus, secret)
-	}
+// 同一密钥可以同时存在多个客户端，数量受密钥的 MaxConnections（或全局 MaxConnectionsPerSecret）限制
+func (m *Manager) AddConnection(secret string, conn *websocket.Conn) (*Client, error) {
+	client := m.newClient(secret, conn, nil)
 
-	// 添加新连接和对应的写锁
-	m.connections[secret] = conn
-	m.writeMus[secret] = &sync.Mutex{}
-	m.totalConnections++ // 增加累计连接数
-	log.Printf("WebSocket连接已建立: %s (当前总连接数: %d, 累计连接数: %d)", secret, len(m.connections), m.totalConnections)
-
-	// 发送连接确认（不阻塞，防止卡住 AddConnection）
-	go func() {
-		message := models.WebSocketMessage{
+	// 发送连接确认
+	welcome := func(c *Client) error {
+		return c.SendMessage(models.WebSocketMessage{
 			Type: "connected",
 			Data: map[string]interface{}{
 				"secret":    secret,
+				"client_id": c.ID,
 				"timestamp": time.Now().Format(time.RFC3339),
 			},
+		})
+	}
+
+	if err := m.addClient(client, welcome); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// newClient 按当前配置创建客户端会话，session 为 nil 表示原样转发的连接
+func (m *Manager) newClient(secret string, conn *websocket.Conn, session clientSession) *Client {
+	queueSize, policy := 0, config.SendQueueDropOldest
+	if m.config != nil {
+		ws := m.config.GetWebSocketConfig()
+		queueSize = ws.SendQueueSize
+		if config.IsValidSendQueuePolicy(ws.SendQueuePolicy) {
+			policy = ws.SendQueuePolicy
 		}
-		if err := m.sendMessage(secret, message); err != nil {
-			log.Printf("发送连接确认消息失败 [%s]: %v", secret, err)
+	}
+	client := newClient(secret, conn, queueSize, policy)
+	client.session = session
+	if session == nil {
+		// 会话连接保留已下发的事件用于恢复，只有原样转发的连接需要交还未写入的消息
+		client.undelivered = m.requeueUndelivered
+	}
+	client.applySettings(m.Settings(client.Protocol()))
+	return client
+}
+
+// addClient 注册客户端，发送欢迎消息后补发离线消息
+func (m *Manager) addClient(client *Client, welcome func(*Client) error) error {
+	secret := client.Secret
+
+	// 在管理器锁之外读取配置，避免与配置锁交叉持有
+	maxConnections := 0
+	evictOldest := false
+	if m.config != nil {
+		maxConnections = m.config.GetMaxConnections(secret)
+		evictOldest = m.config.GetSecurityConfig().ConnectionLimitPolicy == config.ConnectionLimitEvictOldest
+	}
+
+	m.mu.Lock()
+	existing := m.clients[secret]
+	if maxConnections > 0 && len(existing) >= maxConnections {
+		if !evictOldest {
+			m.mu.Unlock()
+			log.Printf("WebSocket连接 [%s] 已达到最大连接数 %d，拒绝新连接", utils.MaskSecret(secret), maxConnections)
+			return ErrMaxConnectionsReached
+		}
+
+		// 断开最早的连接，为新连接腾出位置
+		evictCount := len(existing) - maxConnections + 1
+		evicted := existing[:evictCount]
+		existing = append([]*Client(nil), existing[evictCount:]...)
+		for _, old := range evicted {
+			log.Printf("WebSocket连接 [%s] 已达到最大连接数 %d，正在关闭最早的客户端 %s", utils.MaskSecret(secret), maxConnections, old.ID)
+			// 发送关闭通知（不阻塞，使用 goroutine）
+			go old.close(websocket.CloseServiceRestart, "新连接已建立，关闭旧连接")
 		}
+	}
+
+	m.clients[secret] = append(existing, client)
+	m.totalConnections++ // 增加累计连接数
+	// 新连接建立后先补发离线消息，补发完成前的实时消息同样进入队列以保证顺序
+	m.backlog[secret] = true
+	log.Printf("WebSocket连接已建立: %s/%s (该密钥客户端数: %d, 当前总连接数: %d, 累计连接数: %d)",
+		utils.MaskSecret(secret), client.ID, len(m.clients[secret]), m.countLocked(), m.totalConnections)
+	m.mu.Unlock()
+
+	traffic.RecordConnect(secret)
+	go client.writePump()
+
+	// 发送欢迎消息并补发离线消息（不阻塞，防止卡住 AddConnection）
+	// 欢迎消息在投递锁内发送，保证它先于其他任何消息到达新客户端
+	go func() {
+		deliverMu := m.getDeliverMu(secret)
+		deliverMu.Lock()
+		err := welcome(client)
+		deliverMu.Unlock()
+		if err != nil {
+			log.Printf("发送连接确认消息失败 [%s/%s]: %v", utils.MaskSecret(secret), client.ID, err)
+			m.RemoveClient(client)
+			return
+		}
+		m.startReplay(secret)
 	}()
 
 	return nil
 }
 
-// RemoveConnection 移除连接
+// RemoveClient 移除单个客户端
+func (m *Manager) RemoveClient(client *Client) {
+	if client == nil {
+		return
+	}
+
+	m.mu.Lock()
+	removed := m.detachLocked(client)
+	remaining := len(m.clients[client.Secret])
+	m.mu.Unlock()
+
+	client.shutdown()
+	client.conn.Close()
+	if client.session != nil {
+		client.session.detach(client)
+	}
+	if removed {
+		log.Printf("WebSocket连接已从管理器移除: %s/%s (该密钥剩余客户端数: %d)", utils.MaskSecret(client.Secret), client.ID, remaining)
+	}
+}
+
+// RemoveConnection 移除密钥下的所有连接
 func (m *Manager) RemoveConnection(secret string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	clients := m.clients[secret]
+	delete(m.clients, secret)
+	delete(m.rrIndex, secret)
+	m.removeSessionsLocked(secret)
+	total := m.countLocked()
+	m.mu.Unlock()
+
+	if len(clients) == 0 {
+		log.Printf("尝试移除不存在的WebSocket连接: %s", utils.MaskSecret(secret))
+		return
+	}
 
-	if conn, exists := m.connections[secret]; exists {
-		conn.Close()
-		delete(m.connections, secret)
-		delete(m.writeMus, secret)
-		log.Printf("WebSocket连接已从管理器移除: %s (剩余连接数: %d)", secret, len(m.connections))
-	} else {
-		log.Printf("尝试移除不存在的WebSocket连接: %s", secret)
+	for _, client := range clients {
+		client.shutdown()
+		client.conn.Close()
 	}
+	log.Printf("WebSocket连接已从管理器移除: %s (%d 个客户端, 剩余连接数: %d)", utils.MaskSecret(secret), len(clients), total)
 }
 
-// SendMessage 发送消息到指定连接
-func (m *Manager) SendMessage(secret string, message models.WebSocketMessage) error {
+// detachLocked 从客户端列表中移除指定客户端，调用方必须持有管理器写锁
+func (m *Manager) detachLocked(client *Client) bool {
+	clients := m.clients[client.Secret]
+	for i, c := range clients {
+		if c != client {
+			continue
+		}
+		rest := make([]*Client, 0, len(clients)-1)
+		rest = append(rest, clients[:i]...)
+		rest = append(rest, clients[i+1:]...)
+		if len(rest) == 0 {
+			delete(m.clients, client.Secret)
+			delete(m.rrIndex, client.Secret)
+		} else {
+			m.clients[client.Secret] = rest
+		}
+		return true
+	}
+	return false
+}
+
+// countLocked 统计当前客户端总数，调用方必须持有管理器锁
+func (m *Manager) countLocked() int {
+	count := 0
+	for _, clients := range m.clients {
+		count += len(clients)
+	}
+	return count
+}
+
+// getClients 获取密钥下客户端列表的快照（按连接时间排序）
+func (m *Manager) getClients(secret string) []*Client {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	_, exists := m.connections[secret]
-	if !exists {
+	clients := m.clients[secret]
+	if len(clients) == 0 {
+		return nil
+	}
+	return append([]*Client(nil), clients...)
+}
+
+// GetClients 获取密钥下的所有客户端
+func (m *Manager) GetClients(secret string) []*Client {
+	return m.getClients(secret)
+}
+
+// SendMessage 发送消息到密钥下的所有客户端
+func (m *Manager) SendMessage(secret string, message models.WebSocketMessage) error {
+	clients := m.getClients(secret)
+	if len(clients) == 0 {
 		return ErrConnectionNotFound
 	}
 
-	return m.sendMessage(secret, message)
+	var lastErr error
+	sent := 0
+	for _, client := range clients {
+		if err := client.SendMessage(message); err != nil {
+			lastErr = err
+			// 发送失败，移除失效连接
+			go m.dropFailedClient(client, err)
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		return lastErr
+	}
+	return nil
 }
 
 // Broadcast 广播消息到所有连接
 func (m *Manager) Broadcast(message models.WebSocketMessage) {
-	m.mu.RLock()
-	// 复制所有 secret 列表以避免在遍历时 map 被修改
-	secrets := make([]string, 0, len(m.connections))
-	for secret := range m.connections {
-		secrets = append(secrets, secret)
-	}
-	m.mu.RUnlock()
-
 	// 在持有锁之外进行实际的消息发送（异步）
-	for _, secret := range secrets {
+	for _, secret := range m.connectedSecrets() {
 		go func(s string) {
 			if err := m.SendMessage(s, message); err != nil {
-				log.Printf("广播消息失败 [%s]: %v", s, err)
+				log.Printf("广播消息失败 [%s]: %v", utils.MaskSecret(s), err)
 			}
 		}(secret)
 	}
 }
 
-// sendMessage 发送消息的内部方法
-// 注意: 必须在持有管理器锁的情况下调用，或者在 RLock 后立即调用，但不能在 RUnlock 后访问 conn
-func (m *Manager) sendMessage(secret string, message models.WebSocketMessage) error {
-	// 这个方法在持有读锁的情况下被调用，但我们需要重新检查并获取写锁
-	// 为了避免竞态条件，我们需要一个机制
-
-	// 尝试获取写锁（如果不存在则返回错误）
+// connectedSecrets 复制所有存在连接的密钥列表，避免在遍历时 map 被修改
+func (m *Manager) connectedSecrets() []string {
 	m.mu.RLock()
-	conn, connExists := m.connections[secret]
-	writeMu, muExists := m.writeMus[secret]
-	m.mu.RUnlock()
+	defer m.mu.RUnlock()
+
+	secrets := make([]string, 0, len(m.clients))
+	for secret := range m.clients {
+		secrets = append(secrets, secret)
+	}
+	return secrets
+}
 
-	if !connExists || !muExists {
+// SendBinaryMessage 发送二进制消息到密钥下的所有客户端
+func (m *Manager) SendBinaryMessage(secret string, data []byte) error {
+	return m.SendMessage(secret, models.WebSocketMessage{
+		Type:   "binary",
+		Format: models.MessageFormatBinary,
+		Raw:    data,
+	})
+}
+
+// SendTextMessage 按密钥的投递模式发送文本消息
+//   - broadcast: 发送到所有客户端，至少一个成功即视为投递成功
+//   - round_robin: 依次轮询客户端，发送失败时尝试下一个
+//   - failover: 发送到最早连接的客户端，失败时由下一个客户端接替
+func (m *Manager) SendTextMessage(secret string, text string) error {
+	clients := m.getClients(secret)
+	if len(clients) == 0 {
 		return ErrConnectionNotFound
 	}
 
-	// 使用连接专用的写锁，确保同一连接的消息按顺序发送且不发生并发写冲突
-	writeMu.Lock()
-	defer writeMu.Unlock()
+	mode := config.DeliveryModeBroadcast
+	if m.config != nil {
+		mode = m.config.GetDeliveryMode(secret)
+	}
+
+	d := &delivery{m: m, secret: secret, body: []byte(text)}
+	switch mode {
+	case config.DeliveryModeRoundRobin:
+		m.mu.Lock()
+		start := m.rrIndex[secret] % len(clients)
+		m.rrIndex[secret] = (start + 1) % len(clients)
+		m.mu.Unlock()
+
+		ordered := make([]*Client, 0, len(clients))
+		ordered = append(ordered, clients[start:]...)
+		ordered = append(ordered, clients[:start]...)
+		return m.sendFirstAvailable(secret, ordered, d)
+
+	case config.DeliveryModeFailover:
+		return m.sendFirstAvailable(secret, clients, d)
+
+	default:
+		var lastErr error
+		sent := 0
+		for _, client := range clients {
+			if err := client.deliver(d); err != nil {
+				log.Printf("消息发送失败 [%s/%s]: %v", utils.MaskSecret(secret), client.ID, err)
+				lastErr = err
+				m.dropFailedClient(client, err)
+				continue
+			}
+			sent++
+		}
+		if sent == 0 {
+			return lastErr
+		}
+		// 断线的网关会话保留其他客户端收到的事件，恢复后补发
+		m.bufferGatewayEvents(secret, d)
+		return nil
+	}
+}
+
+// sendFirstAvailable 按顺序尝试客户端，直到有一个放入发送队列成功，发送失败的客户端会被移除
+func (m *Manager) sendFirstAvailable(secret string, clients []*Client, d *delivery) error {
+	var lastErr error
+	for _, client := range clients {
+		err := client.deliver(d)
+		if err == nil {
+			return nil
+		}
+		log.Printf("消息发送失败 [%s/%s]，尝试下一个客户端: %v", utils.MaskSecret(secret), client.ID, err)
+		lastErr = err
+		m.dropFailedClient(client, err)
+	}
+	return lastErr
+}
+
+// dropFailedClient 移除发送失败的客户端，发送队列已满而丢弃消息（drop_newest）或消息不适用于该连接的协议时保留连接
+func (m *Manager) dropFailedClient(client *Client, err error) {
+	if errors.Is(err, ErrSendQueueFull) || errors.Is(err, ErrNotDispatch) {
+		return
+	}
+	m.RemoveClient(client)
+}
+
+// DeliverText 投递 Webhook 消息：连接可用时直接发送，否则写入离线队列
+// 返回值 queued 表示消息已进入离线队列，等待客户端连接后补发
+func (m *Manager) DeliverText(secret string, text string) (queued bool, err error) {
+	deliverMu := m.getDeliverMu(secret)
+	deliverMu.Lock()
+	defer deliverMu.Unlock()
 
-	// 在持有写锁后再次检查连接是否仍然存在（防止被其他 goroutine 删除）
 	m.mu.RLock()
-	currentConn, stillExists := m.connections[secret]
+	pending := m.backlog[secret]
 	m.mu.RUnlock()
 
-	if !stillExists || currentConn != conn {
-		return ErrConnectionNotFound
+	// 队列中还有未补发的消息时，新消息必须排在它们之后；离线队列关闭后无法排队，只能直接发送
+	if !pending || m.config == nil || !m.config.GetQueueConfig().Enabled {
+		sendErr := m.SendTextMessage(secret, text)
+		if sendErr == nil {
+			return false, nil
+		}
+		// 所有连接都无法下发该消息，写入离线队列后也无法补发
+		if errors.Is(sendErr, ErrNotDispatch) {
+			return false, sendErr
+		}
+		if !errors.Is(sendErr, ErrConnectionNotFound) {
+			log.Printf("消息发送失败，转入离线队列 [%s]: %v", utils.MaskSecret(secret), sendErr)
+		}
 	}
 
-	var err error
-	// 根据消息格式选择发送方式
-	switch message.Format {
-	case models.MessageFormatBinary:
-		// 发送二进制数据
-		if message.Raw != nil {
-			err = conn.WriteMessage(websocket.BinaryMessage, message.Raw)
-		} else {
-			err = conn.WriteMessage(websocket.BinaryMessage, []byte{})
+	if err := m.enqueue(secret, text); err != nil {
+		return false, err
+	}
+	// 客户端仍在线（发送队列已满、补发被中断）时立即补发，不必等到下次连接
+	if len(m.getClients(secret)) > 0 {
+		m.startReplay(secret)
+	}
+	return true, nil
+}
+
+// requeueUndelivered 连接关闭时发送队列中尚未写入的 Webhook 消息重新写入离线队列，排在已有的离线消息之前
+// 这些消息早于队列中的消息被取出或投递，插入到队首才能保持原有的投递顺序
+// broadcast 模式下其他在线客户端已经收到同样的消息，不再重复写入
+func (m *Manager) requeueUndelivered(client *Client, bodies [][]byte) {
+	secret := client.Secret
+	others := 0
+	for _, c := range m.getClients(secret) {
+		if c != client {
+			others++
 		}
+	}
+	mode := config.DeliveryModeBroadcast
+	if m.config != nil {
+		// 密钥已被删除时不再保留它的消息
+		if _, exists := m.config.GetSecretConfig(secret); !exists {
+			return
+		}
+		mode = m.config.GetDeliveryMode(secret)
+	}
+	if others > 0 && mode == config.DeliveryModeBroadcast {
+		return
+	}
+
+	texts := make([]string, len(bodies))
+	for i, body := range bodies {
+		texts[i] = string(body)
+	}
+	deliverMu := m.getDeliverMu(secret)
+	deliverMu.Lock()
+	err := m.requeue(secret, texts)
+	deliverMu.Unlock()
+	if err != nil {
+		log.Printf("连接关闭，%d 条未发送的消息无法写入离线队列 [%s/%s]: %v", len(bodies), utils.MaskSecret(secret), client.ID, err)
+		return
+	}
+
+	log.Printf("连接关闭，%d 条未发送的消息已重新写入离线队列 [%s/%s]", len(bodies), utils.MaskSecret(secret), client.ID)
+	if others > 0 {
+		m.startReplay(secret)
+	}
+}
 
-	case models.MessageFormatText:
-		// 发送纯文本数据
-		if message.Data != nil {
-			if text, ok := message.Data.(string); ok {
-				err = conn.WriteMessage(websocket.TextMessage, []byte(text))
-			} else {
-				err = conn.WriteMessage(websocket.TextMessage, []byte{})
+// startReplay 在后台补发离线消息，同一密钥同时只有一个补发任务
+// 补发进行中再次请求时，当前任务结束后重新检查队列，避免刚写入队列的消息错过本轮补发
+func (m *Manager) startReplay(secret string) {
+	m.mu.Lock()
+	if _, running := m.replays[secret]; running {
+		m.replays[secret] = true
+		m.mu.Unlock()
+		return
+	}
+	m.replays[secret] = false
+	m.mu.Unlock()
+
+	go func() {
+		for {
+			m.replayQueue(secret)
+
+			m.mu.Lock()
+			if !m.replays[secret] {
+				delete(m.replays, secret)
+				m.mu.Unlock()
+				return
 			}
-		} else {
-			err = conn.WriteMessage(websocket.TextMessage, []byte{})
+			m.replays[secret] = false
+			m.mu.Unlock()
 		}
+	}()
+}
 
-	case models.MessageFormatJSON:
-		fallthrough
-	default:
-		// 默认使用JSON格式
-		data, errMarshal := json.Marshal(message)
-		if errMarshal != nil {
-			log.Printf("JSON序列化失败 [%s]: %v", secret, errMarshal)
-			return errMarshal
+// enqueue 将消息写入离线队列，调用方必须持有该密钥的投递锁
+func (m *Manager) enqueue(secret string, text string) error {
+	return m.store(secret, []string{text}, false)
+}
+
+// requeue 将消息按顺序插入到离线队列的最前面，调用方必须持有该密钥的投递锁
+func (m *Manager) requeue(secret string, texts []string) error {
+	return m.store(secret, texts, true)
+}
+
+// store 将消息写入离线队列，prepend 为 true 时插入到已有消息之前，写入后标记该密钥有待补发消息
+func (m *Manager) store(secret string, texts []string, prepend bool) error {
+	if m.config == nil || !m.config.GetQueueConfig().Enabled {
+		return ErrQueueDisabled
+	}
+
+	maxAge, maxMessages := m.config.GetQueueLimits(secret)
+	msgs := make([]database.QueuedMessage, len(texts))
+	for i, text := range texts {
+		msgs[i] = database.QueuedMessage{
+			Secret:  secret,
+			Payload: text,
+			Size:    len(text),
+		}
+		if maxAge > 0 {
+			expiresAt := time.Now().Add(maxAge)
+			msgs[i].ExpiresAt = &expiresAt
 		}
-		err = conn.WriteMessage(websocket.TextMessage, data)
 	}
 
-	if err != nil {
-		log.Printf("消息发送失败 [%s] (类型: %s, 格式: %s): %v", secret, message.Type, message.Format, err)
-		// 如果发送失败，尝试移除失效连接
-		go m.RemoveConnection(secret)
-		return err
+	if expired, err := m.queue.PurgeExpired(secret); err != nil {
+		log.Printf("清理过期离线消息失败 [%s]: %v", utils.MaskSecret(secret), err)
+	} else if expired > 0 {
+		log.Printf("已清理过期离线消息 [%s]: %d 条", utils.MaskSecret(secret), expired)
+	}
+
+	var dropped int64
+	if prepend {
+		n, err := m.queue.Requeue(secret, msgs, maxMessages)
+		if err != nil {
+			return err
+		}
+		dropped = n
+	} else {
+		for i := range msgs {
+			n, err := m.queue.Enqueue(&msgs[i], maxMessages)
+			if err != nil {
+				return err
+			}
+			dropped += n
+		}
+	}
+	if dropped > 0 {
+		metrics.ObserveOfflineQueueDrop(secret, dropped)
+		log.Printf("离线队列已满 [%s]，丢弃最旧的 %d 条消息", utils.MaskSecret(secret), dropped)
 	}
 
+	m.mu.Lock()
+	m.backlog[secret] = true
+	m.mu.Unlock()
 	return nil
 }
 
-// SendBinaryMessage 发送二进制消息
-func (m *Manager) SendBinaryMessage(secret string, data []byte) error {
-	m.mu.RLock()
-	conn, exists := m.connections[secret]
-	writeMu, muExists := m.writeMus[secret]
-	m.mu.RUnlock()
+// replayQueue 按入队顺序补发离线消息，直到队列清空或连接失效，队列清空后清除 backlog 标记
+// 只能由 startReplay 调用，保证同一密钥不会并发补发
+func (m *Manager) replayQueue(secret string) {
+	deliverMu := m.getDeliverMu(secret)
+	replayed := 0
+
+	for {
+		// 在投递锁之外等待发送队列腾出空间，避免补发挤掉队列中的消息，也不阻塞实时 Webhook
+		batchSize := m.replayCapacity(secret)
+		if batchSize == 0 {
+			log.Printf("离线消息补发中断 [%s] (已补发 %d 条): %v", utils.MaskSecret(secret), replayed, ErrConnectionNotFound)
+			return
+		}
 
-	if !exists || !muExists {
-		return ErrConnectionNotFound
-	}
+		deliverMu.Lock()
 
-	writeMu.Lock()
-	defer writeMu.Unlock()
-	return conn.WriteMessage(websocket.BinaryMessage, data)
-}
+		if _, err := m.queue.PurgeExpired(secret); err != nil {
+			log.Printf("清理过期离线消息失败 [%s]: %v", utils.MaskSecret(secret), err)
+		}
 
-// SendTextMessage 发送文本消息
-func (m *Manager) SendTextMessage(secret string, text string) error {
-	m.mu.RLock()
-	conn, exists := m.connections[secret]
-	writeMu, muExists := m.writeMus[secret]
-	m.mu.RUnlock()
+		messages, err := m.queue.GetPending(secret, batchSize)
+		if err != nil {
+			deliverMu.Unlock()
+			log.Printf("读取离线消息失败 [%s]: %v", utils.MaskSecret(secret), err)
+			return
+		}
 
-	if !exists || !muExists {
-		return ErrConnectionNotFound
+		if len(messages) == 0 {
+			m.mu.Lock()
+			delete(m.backlog, secret)
+			m.mu.Unlock()
+			deliverMu.Unlock()
+			if replayed > 0 {
+				log.Printf("离线消息补发完成 [%s]: %d 条", utils.MaskSecret(secret), replayed)
+			}
+			return
+		}
+
+		sent := make([]uint, 0, len(messages))
+		var sendErr error
+		for _, msg := range messages {
+			if sendErr = m.SendTextMessage(secret, msg.Payload); sendErr != nil {
+				if !errors.Is(sendErr, ErrNotDispatch) {
+					break
+				}
+				// 当前的连接都无法下发该消息，从队列中移除，避免阻塞后面的消息
+				log.Printf("离线消息无法下发，已丢弃 [%s] #%d: %v", utils.MaskSecret(secret), msg.ID, sendErr)
+				sendErr = nil
+			}
+			sent = append(sent, msg.ID)
+		}
+
+		if err := m.queue.DeleteMessages(sent); err != nil {
+			log.Printf("删除已补发的离线消息失败 [%s]: %v", utils.MaskSecret(secret), err)
+		}
+		replayed += len(sent)
+		deliverMu.Unlock()
+
+		if sendErr != nil {
+			// 连接已失效，剩余消息留在队列中等待下次连接
+			log.Printf("离线消息补发中断 [%s] (已补发 %d 条): %v", utils.MaskSecret(secret), replayed, sendErr)
+			return
+		}
 	}
+}
+
+// replayCapacity 等待密钥下所有客户端的发送队列都有空闲位置，返回本批可补发的消息数，客户端全部断开时返回 0
+func (m *Manager) replayCapacity(secret string) int {
+	for {
+		clients := m.getClients(secret)
+		if len(clients) == 0 {
+			return 0
+		}
 
-	writeMu.Lock()
-	defer writeMu.Unlock()
-	return conn.WriteMessage(websocket.TextMessage, []byte(text))
+		free := replayBatchSize
+		for _, client := range clients {
+			if n := client.queueFree(); n < free {
+				free = n
+			}
+		}
+		if free > 0 {
+			return free
+		}
+		time.Sleep(replayWaitInterval)
+	}
 }
 
-// GetConnection 获取连接
-func (m *Manager) GetConnection(secret string) (*websocket.Conn, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+// getDeliverMu 获取密钥的投递锁
+func (m *Manager) getDeliverMu(secret string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	conn, exists := m.connections[secret]
-	return conn, exists
+	deliverMu, exists := m.deliverMus[secret]
+	if !exists {
+		deliverMu = &sync.Mutex{}
+		m.deliverMus[secret] = deliverMu
+	}
+	return deliverMu
 }
 
-// GetConnections 获取所有连接信息 (优化版本)
+// GetConnections 获取所有连接信息，每个客户端一条记录，按密钥和连接时间排序
 func (m *Manager) GetConnections(limit, offset int) ([]models.Connection, int) {
 	// 输入验证和限制
 	if limit <= 0 || limit > 200 {
@@ -253,28 +670,29 @@ func (m *Manager) GetConnections(limit, offset int) ([]models.Connection, int) {
 	}
 
 	m.mu.RLock()
-	total := len(m.connections)
-
-	// 如果没有连接，直接返回
-	if total == 0 {
-		m.mu.RUnlock()
-		return []models.Connection{}, 0
+	secrets := make([]string, 0, len(m.clients))
+	for secret := range m.clients {
+		secrets = append(secrets, secret)
 	}
+	sort.Strings(secrets)
 
-	// 快速路径：只提取需要的部分秘密（避免提取所有秘密）
-	secrets := make([]string, 0, limit)
-	idx := 0
-	for secret := range m.connections {
-		if idx >= offset && idx < offset+limit {
-			secrets = append(secrets, secret)
-		}
-		idx++
-		if idx >= offset+limit {
-			break
-		}
+	all := make([]*Client, 0, len(secrets))
+	for _, secret := range secrets {
+		all = append(all, m.clients[secret]...)
 	}
 	m.mu.RUnlock()
 
+	total := len(all)
+	// 如果没有连接或超出范围，直接返回
+	if offset >= total {
+		return []models.Connection{}, total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	page := all[offset:end]
+
 	// 获取配置快照（在管理器锁之外获取配置锁，避免死锁）
 	var secretConfigs map[string]config.SecretConfig
 	if m.config != nil {
@@ -282,24 +700,45 @@ func (m *Manager) GetConnections(limit, offset int) ([]models.Connection, int) {
 	}
 
 	// 构建连接对象列表
-	connections := make([]models.Connection, 0, len(secrets))
-	now := time.Now()
+	connections := make([]models.Connection, 0, len(page))
+	modes := make(map[string]string)
+	primaries := make(map[string]string)
+	for _, client := range all {
+		if _, exists := primaries[client.Secret]; !exists {
+			primaries[client.Secret] = client.ID
+		}
+	}
 
-	m.mu.RLock()
-	for _, secret := range secrets {
-		conn, exists := m.connections[secret]
+	for _, client := range page {
+		mode, exists := modes[client.Secret]
 		if !exists {
-			continue
+			mode = config.DeliveryModeBroadcast
+			if m.config != nil {
+				mode = m.config.GetDeliveryMode(client.Secret)
+			}
+			modes[client.Secret] = mode
 		}
 
 		connection := models.Connection{
-			Secret:      secret,
-			Connected:   conn != nil,
-			ConnectedAt: now,
+			ID:           client.ID,
+			Secret:       client.Secret,
+			RemoteAddr:   client.RemoteAddr,
+			Connected:    true,
+			DeliveryMode: mode,
+			Protocol:     client.Protocol(),
+			Primary:      mode == config.DeliveryModeFailover && primaries[client.Secret] == client.ID,
+			ConnectedAt:  client.ConnectedAt,
+		}
+
+		connection.QueueDepth, connection.QueueSize, connection.Dropped, connection.Sent = client.QueueStats()
+		connection.SessionID = client.SessionID()
+		connection.Settings = client.Settings().Model()
+		if session := client.BridgeSession(); session != nil {
+			connection.LastSeq, connection.AckedSeq = session.Progress()
 		}
 
 		// 从预加载的配置中获取更多信息
-		if secretCfg, exists := secretConfigs[secret]; exists {
+		if secretCfg, exists := secretConfigs[client.Secret]; exists {
 			connection.Enabled = secretCfg.Enabled
 			connection.Description = secretCfg.Description
 			connection.CreatedAt = &secretCfg.CreatedAt
@@ -308,26 +747,17 @@ func (m *Manager) GetConnections(limit, offset int) ([]models.Connection, int) {
 
 		connections = append(connections, connection)
 	}
-	m.mu.RUnlock()
 
 	return connections, total
 }
 
 // BroadcastBinary 广播二进制消息到所有连接
 func (m *Manager) BroadcastBinary(data []byte) {
-	m.mu.RLock()
-	// 复制所有 secret 列表以避免在遍历时 map 被修改
-	secrets := make([]string, 0, len(m.connections))
-	for secret := range m.connections {
-		secrets = append(secrets, secret)
-	}
-	m.mu.RUnlock()
-
 	// 在持有锁之外进行实际的消息发送
-	for _, secret := range secrets {
+	for _, secret := range m.connectedSecrets() {
 		go func(s string) {
 			if err := m.SendBinaryMessage(s, data); err != nil {
-				log.Printf("广播二进制消息失败 [%s]: %v", s, err)
+				log.Printf("广播二进制消息失败 [%s]: %v", utils.MaskSecret(s), err)
 			}
 		}(secret)
 	}
@@ -335,30 +765,30 @@ func (m *Manager) BroadcastBinary(data []byte) {
 
 // BroadcastText 广播文本消息到所有连接
 func (m *Manager) BroadcastText(text string) {
-	m.mu.RLock()
-	// 复制所有 secret 列表以避免在遍历时 map 被修改
-	secrets := make([]string, 0, len(m.connections))
-	for secret := range m.connections {
-		secrets = append(secrets, secret)
-	}
-	m.mu.RUnlock()
-
 	// 在持有锁之外进行实际的消息发送
-	for _, secret := range secrets {
+	for _, secret := range m.connectedSecrets() {
 		go func(s string) {
-			if err := m.SendTextMessage(s, text); err != nil {
-				log.Printf("广播文本消息失败 [%s]: %v", s, err)
+			if err := m.SendMessage(s, models.WebSocketMessage{Data: text, Format: models.MessageFormatText}); err != nil {
+				log.Printf("广播文本消息失败 [%s]: %v", utils.MaskSecret(s), err)
 			}
 		}(secret)
 	}
 }
 
-// GetConnectionCount 获取连接数
+// GetConnectionCount 获取连接数（所有密钥下的客户端总数）
 func (m *Manager) GetConnectionCount() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return len(m.connections)
+	return m.countLocked()
+}
+
+// GetClientCount 获取指定密钥下的客户端数
+func (m *Manager) GetClientCount(secret string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.clients[secret])
 }
 
 // GetTotalConnections 获取累计连接总数
@@ -369,23 +799,72 @@ func (m *Manager) GetTotalConnections() int {
 	return int(m.totalConnections)
 }
 
-// KickConnection 踢出连接
+// SecretConnections 获取每个密钥的客户端数、发送队列长度和离线队列长度
+func (m *Manager) SecretConnections() map[string]metrics.SecretConnections {
+	m.mu.RLock()
+	stats := make(map[string]metrics.SecretConnections, len(m.clients))
+	for secret, clients := range m.clients {
+		entry := metrics.SecretConnections{Clients: len(clients)}
+		for _, client := range clients {
+			entry.SendQueueDepth += len(client.send)
+		}
+		stats[secret] = entry
+	}
+	m.mu.RUnlock()
+
+	counts, err := m.queue.CountBySecret()
+	if err != nil {
+		log.Printf("统计离线队列长度失败: %v", err)
+		return stats
+	}
+	for secret, count := range counts {
+		entry := stats[secret]
+		entry.OfflineQueueDepth = count
+		stats[secret] = entry
+	}
+	return stats
+}
+
+// KickConnection 踢出密钥下的所有连接
 func (m *Manager) KickConnection(secret string) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	clients := m.clients[secret]
+	delete(m.clients, secret)
+	delete(m.rrIndex, secret)
+	m.mu.Unlock()
 
-	conn, exists := m.connections[secret]
-	if !exists {
+	if len(clients) == 0 {
 		return ErrConnectionNotFound
 	}
 
 	// 发送关闭消息
-	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "管理员主动断开连接")
-	conn.WriteMessage(websocket.CloseMessage, closeMessage)
-	conn.Close()
+	for _, client := range clients {
+		client.close(websocket.CloseNormalClosure, "管理员主动断开连接")
+	}
+	log.Printf("连接已被踢出: %s (%d 个客户端)", utils.MaskSecret(secret), len(clients))
 
-	delete(m.connections, secret)
-	log.Printf("连接已被踢出: %s", secret)
+	return nil
+}
+
+// KickClient 踢出密钥下的指定客户端
+func (m *Manager) KickClient(secret, clientID string) error {
+	m.mu.Lock()
+	var target *Client
+	for _, client := range m.clients[secret] {
+		if client.ID == clientID {
+			target = client
+			break
+		}
+	}
+	if target == nil {
+		m.mu.Unlock()
+		return ErrConnectionNotFound
+	}
+	m.detachLocked(target)
+	m.mu.Unlock()
+
+	target.close(websocket.CloseNormalClosure, "管理员主动断开连接")
+	log.Printf("连接已被踢出: %s/%s", utils.MaskSecret(secret), clientID)
 
 	return nil
 }
@@ -395,68 +874,66 @@ func (m *Manager) IsConnected(secret string) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	conn, exists := m.connections[secret]
-	return exists && conn != nil
+	return len(m.clients[secret]) > 0
 }
 
-// StartHeartbeat 启动心跳检测
+// allClients 复制所有客户端列表以避免长时间持有读锁
+func (m *Manager) allClients() []*Client {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all := make([]*Client, 0, len(m.clients))
+	for _, clients := range m.clients {
+		all = append(all, clients...)
+	}
+	return all
+}
+
+// StartHeartbeat 按当前配置启动心跳检测，已在运行的心跳循环先停止
 func (m *Manager) StartHeartbeat() {
-	if m.config == nil || !m.config.WebSocket.EnableHeartbeat {
-		log.Println("WebSocket 心跳检测已禁用")
-		return
+	m.heartbeatMu.Lock()
+	defer m.heartbeatMu.Unlock()
+
+	if m.heartbeatStop != nil {
+		close(m.heartbeatStop)
+		m.heartbeatStop = nil
 	}
 
-	interval := time.Duration(m.config.WebSocket.HeartbeatInterval) * time.Millisecond
-	if interval <= 0 {
-		interval = 30 * time.Second
+	settings := m.Settings(config.ProtocolRaw)
+	m.heartbeat = settings.heartbeatSettings()
+	if !settings.Heartbeat {
+		log.Println("WebSocket 心跳检测已禁用")
+		return
 	}
 
+	interval := settings.HeartbeatInterval
 	// 心跳超时（收不到 Pong 响应后的等待时间）
-	heartbeatTimeout := time.Duration(m.config.WebSocket.HeartbeatTimeout) * time.Millisecond
-	if heartbeatTimeout <= 0 {
-		heartbeatTimeout = 5 * time.Second
-	}
+	heartbeatTimeout := settings.HeartbeatTimeout
 
 	log.Printf("启动 WebSocket 心跳检测 (间隔: %v, 超时: %v)", interval, heartbeatTimeout)
 
+	stop := make(chan struct{})
+	m.heartbeatStop = stop
 	ticker := time.NewTicker(interval)
 	go func() {
 		defer ticker.Stop()
-		for range ticker.C {
-			m.mu.RLock()
-			// 复制连接列表以避免长时间持有读锁
-			type connInfo struct {
-				secret  string
-				conn    *websocket.Conn
-				writeMu *sync.Mutex
-			}
-			var conns []connInfo
-			for secret, conn := range m.connections {
-				conns = append(conns, connInfo{
-					secret:  secret,
-					conn:    conn,
-					writeMu: m.writeMus[secret],
-				})
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
 			}
-			m.mu.RUnlock()
-
-			// 对每个连接发送心跳
-			for _, ci := range conns {
-				go func(info connInfo) {
-					info.writeMu.Lock()
-					defer info.writeMu.Unlock()
 
+			// 对每个客户端发送心跳
+			for _, client := range m.allClients() {
+				go func(c *Client) {
 					// 设置写入超时，确保心跳不会阻塞
-					info.conn.SetWriteDeadline(time.Now().Add(heartbeatTimeout))
-					if err := info.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-						log.Printf("心跳发送失败 [%s]: %v，移除连接", info.secret, err)
-						// 异步移除，避免死锁
-						go m.RemoveConnection(info.secret)
-					} else {
-						// 清除写超时，恢复正常操作
-						info.conn.SetWriteDeadline(time.Time{})
+					if err := c.ping(heartbeatTimeout); err != nil {
+						metrics.ObserveHeartbeatFailure(c.Secret)
+						log.Printf("心跳发送失败 [%s/%s]: %v，移除连接", utils.MaskSecret(c.Secret), c.ID, err)
+						m.RemoveClient(c)
 					}
-				}(ci)
+				}(client)
 			}
 		}
 	}()
@@ -464,14 +941,10 @@ func (m *Manager) StartHeartbeat() {
 
 // CleanupDeadConnections 清理死连接
 func (m *Manager) CleanupDeadConnections() {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	for secret, conn := range m.connections {
-		if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-			log.Printf("清理死连接: %s", secret)
-			conn.Close()
-			delete(m.connections, secret)
+	for _, client := range m.allClients() {
+		if err := client.ping(time.Second); err != nil {
+			log.Printf("清理死连接: %s/%s", utils.MaskSecret(client.Secret), client.ID)
+			m.RemoveClient(client)
 		}
 	}
 }
@@ -0,0 +1,317 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/database"
+
+	"github.com/gorilla/websocket"
+)
+
+const testSecret = "test-secret-0123456789"
+
+// openTestQueue 在临时目录中初始化 SQLite 数据库，供离线队列使用
+func openTestQueue(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 数据库位于工作目录下的 data 目录
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	if err := database.InitDatabase(); err != nil {
+		t.Fatalf("初始化数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := database.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+// newTestManager 创建只包含 testSecret 的管理器
+func newTestManager(t *testing.T, queue config.QueueConfig) *Manager {
+	t.Helper()
+	cfg := &config.Config{Queue: queue}
+	cfg.AddSecret(testSecret, config.SecretConfig{Enabled: true})
+	m := NewManager()
+	m.SetConfig(cfg)
+	return m
+}
+
+// dial 建立一条测试连接，服务端由 accept 注册到管理器，返回客户端一侧的连接
+func dial(t *testing.T, accept func(conn *websocket.Conn) (*Client, error)) *websocket.Conn {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	accepted := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			accepted <- err
+			return
+		}
+		_, err = accept(conn)
+		accepted <- err
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("建立连接失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := <-accepted; err != nil {
+		t.Fatalf("注册连接失败: %v", err)
+	}
+	return conn
+}
+
+// readText 读取一条文本消息
+func readText(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("读取消息失败: %v", err)
+	}
+	return string(data)
+}
+
+// waitQueueEmpty 等待后台补发清空离线队列
+func waitQueueEmpty(t *testing.T, secret string) {
+	t.Helper()
+	queue := &database.QueueService{}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		count, err := queue.CountMessages(secret)
+		if err != nil {
+			t.Fatalf("统计离线消息失败: %v", err)
+		}
+		if count == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("离线队列中仍有 %d 条消息", count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitReplayed 等待连接建立后的补发结束，之后的实时消息不再进入离线队列
+func waitReplayed(t *testing.T, m *Manager, secret string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m.mu.RLock()
+		pending := m.backlog[secret]
+		m.mu.RUnlock()
+		if !pending {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("离线消息补发未结束")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOfflineQueueReplay(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   config.QueueConfig
+		offline []string
+		wantErr error
+		want    []string // 连接后按顺序收到的消息
+	}{
+		{
+			name:    "按入队顺序补发",
+			queue:   config.QueueConfig{Enabled: true},
+			offline: []string{"m1", "m2", "m3"},
+			want:    []string{"m1", "m2", "m3"},
+		},
+		{
+			name:    "超过上限时丢弃最旧的消息",
+			queue:   config.QueueConfig{Enabled: true, MaxMessages: 2},
+			offline: []string{"m1", "m2", "m3"},
+			want:    []string{"m2", "m3"},
+		},
+		{
+			name:    "离线队列关闭",
+			queue:   config.QueueConfig{Enabled: false},
+			offline: []string{"m1"},
+			wantErr: ErrQueueDisabled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestQueue(t)
+			m := newTestManager(t, tt.queue)
+
+			for _, text := range tt.offline {
+				queued, err := m.DeliverText(testSecret, text)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("DeliverText() 错误 = %v，应为 %v", err, tt.wantErr)
+				}
+				if queued != (tt.wantErr == nil) {
+					t.Errorf("DeliverText() queued = %v", queued)
+				}
+			}
+
+			conn := dial(t, func(conn *websocket.Conn) (*Client, error) {
+				return m.AddConnection(testSecret, conn)
+			})
+			if welcome := readText(t, conn); !strings.Contains(welcome, `"connected"`) {
+				t.Fatalf("第一条消息应为连接确认，收到 %s", welcome)
+			}
+			for _, want := range tt.want {
+				if got := readText(t, conn); got != want {
+					t.Errorf("补发的消息 = %s，应为 %s", got, want)
+				}
+			}
+			waitReplayed(t, m, testSecret)
+
+			// 补发完成后实时消息直接下发
+			queued, err := m.DeliverText(testSecret, "live")
+			if err != nil || queued {
+				t.Fatalf("在线时 DeliverText() = (%v, %v)，应直接下发", queued, err)
+			}
+			if got := readText(t, conn); got != "live" {
+				t.Errorf("实时消息 = %s，应为 live", got)
+			}
+		})
+	}
+}
+
+func TestRequeueUndelivered(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       string
+		other      bool // 是否还有其他在线客户端
+		removed    bool // 密钥是否已被删除
+		wantQueued int
+		wantOther  []string // 其他客户端收到的消息
+	}{
+		{name: "没有其他客户端", mode: config.DeliveryModeBroadcast, wantQueued: 2},
+		{name: "广播模式下其他客户端已收到", mode: config.DeliveryModeBroadcast, other: true},
+		{name: "故障转移到其他客户端", mode: config.DeliveryModeFailover, other: true, wantOther: []string{"m1", "m2"}},
+		{name: "密钥已删除", mode: config.DeliveryModeBroadcast, removed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestQueue(t)
+			m := newTestManager(t, config.QueueConfig{Enabled: true})
+			m.config.AddSecret(testSecret, config.SecretConfig{Enabled: true, DeliveryMode: tt.mode})
+
+			var closing *Client
+			dial(t, func(conn *websocket.Conn) (*Client, error) {
+				client, err := m.AddConnection(testSecret, conn)
+				closing = client
+				return client, err
+			})
+			var other *websocket.Conn
+			if tt.other {
+				other = dial(t, func(conn *websocket.Conn) (*Client, error) {
+					return m.AddConnection(testSecret, conn)
+				})
+				readText(t, other)
+			}
+			waitReplayed(t, m, testSecret)
+			if tt.removed {
+				m.config.RemoveSecret(testSecret)
+			}
+
+			// 模拟连接关闭时发送队列中还有两条未写入的消息
+			m.RemoveClient(closing)
+			m.requeueUndelivered(closing, [][]byte{[]byte("m1"), []byte("m2")})
+
+			for _, want := range tt.wantOther {
+				if got := readText(t, other); got != want {
+					t.Errorf("其他客户端收到 %s，应为 %s", got, want)
+				}
+			}
+			if len(tt.wantOther) > 0 {
+				waitQueueEmpty(t, testSecret)
+				return
+			}
+			count, err := (&database.QueueService{}).CountMessages(testSecret)
+			if err != nil {
+				t.Fatalf("统计离线消息失败: %v", err)
+			}
+			if int(count) != tt.wantQueued {
+				t.Errorf("离线队列中的消息数 = %d，应为 %d", count, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestRequeueUndeliveredKeepsOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxMessages int
+		want        []string
+	}{
+		{name: "插入到已有消息之前", want: []string{"m1", "m2", "m3", "m4"}},
+		{name: "队列已满时丢弃最旧的消息", maxMessages: 3, want: []string{"m2", "m3", "m4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestQueue(t)
+			m := newTestManager(t, config.QueueConfig{Enabled: true, MaxMessages: tt.maxMessages})
+			m.config.AddSecret(testSecret, config.SecretConfig{Enabled: true, DeliveryMode: config.DeliveryModeRoundRobin})
+
+			var closing *Client
+			dial(t, func(conn *websocket.Conn) (*Client, error) {
+				client, err := m.AddConnection(testSecret, conn)
+				closing = client
+				return client, err
+			})
+			waitReplayed(t, m, testSecret)
+
+			// 连接关闭前 m1、m2 还在发送队列中，之后的 m3、m4 已写入离线队列
+			m.RemoveClient(closing)
+			for _, text := range []string{"m3", "m4"} {
+				if err := m.enqueue(testSecret, text); err != nil {
+					t.Fatalf("写入离线队列失败: %v", err)
+				}
+			}
+			m.requeueUndelivered(closing, [][]byte{[]byte("m1"), []byte("m2")})
+
+			pending, err := (&database.QueueService{}).GetPending(testSecret, 0)
+			if err != nil {
+				t.Fatalf("读取离线消息失败: %v", err)
+			}
+			got := make([]string, len(pending))
+			for i, msg := range pending {
+				got[i] = msg.Payload
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("离线队列顺序 = %v，应为 %v", got, tt.want)
+			}
+
+			// 重新连接后按原有顺序补发
+			conn := dial(t, func(conn *websocket.Conn) (*Client, error) {
+				return m.AddConnection(testSecret, conn)
+			})
+			if welcome := readText(t, conn); !strings.Contains(welcome, `"connected"`) {
+				t.Fatalf("第一条消息应为连接确认，收到 %s", welcome)
+			}
+			for _, want := range tt.want {
+				if got := readText(t, conn); got != want {
+					t.Errorf("补发的消息为 %s，应为 %s", got, want)
+				}
+			}
+			waitQueueEmpty(t, testSecret)
+		})
+	}
+}
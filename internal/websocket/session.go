@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"nekobridge/internal/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// clientSession 可在断线后恢复的客户端会话（QQ 网关协议、bridge 协议）
+type clientSession interface {
+	SessionID() string
+	owner() string
+	attach(c *Client) *Client
+	detach(c *Client)
+	expired(timeout time.Duration) bool
+	deliver(c *Client, d *delivery) error
+}
+
+// sessionState 会话与连接的绑定状态
+type sessionState struct {
+	mu             sync.Mutex
+	client         *Client
+	disconnectedAt time.Time
+}
+
+// attach 将会话绑定到客户端，返回之前绑定的客户端
+func (s *sessionState) attach(c *Client) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.client
+	s.client = c
+	s.disconnectedAt = time.Time{}
+	return previous
+}
+
+// detach 客户端断开时解除绑定，开始计算恢复超时
+func (s *sessionState) detach(c *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == c {
+		s.client = nil
+		s.disconnectedAt = time.Now()
+	}
+}
+
+// expired 检查断开的会话是否已超过恢复时间
+func (s *sessionState) expired(timeout time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 尚未绑定过连接的新会话不会过期
+	return s.client == nil && !s.disconnectedAt.IsZero() && time.Since(s.disconnectedAt) > timeout
+}
+
+// sessionTimeout 获取会话恢复超时时间
+func (m *Manager) sessionTimeout() time.Duration {
+	if m.config != nil {
+		if timeout := m.config.GetWebSocketConfig().SessionTimeout; timeout > 0 {
+			return time.Duration(timeout) * time.Second
+		}
+	}
+	return 5 * time.Minute
+}
+
+// sessionBufferSize 获取会话保留用于恢复的事件数
+func (m *Manager) sessionBufferSize() int {
+	if m.config != nil {
+		if size := m.config.GetWebSocketConfig().SessionBufferSize; size > 0 {
+			return size
+		}
+	}
+	return 500
+}
+
+// registerSession 登记新会话，同时清理已过期的会话
+func (m *Manager) registerSession(session clientSession) {
+	m.purgeSessions()
+
+	m.mu.Lock()
+	m.sessions[session.SessionID()] = session
+	m.mu.Unlock()
+}
+
+// findSession 查找密钥下未过期的会话
+func (m *Manager) findSession(secret, sessionID string) clientSession {
+	m.purgeSessions()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists || session.owner() != secret {
+		return nil
+	}
+	return session
+}
+
+// addSessionClient 添加绑定会话的连接，同一会话只能绑定一个连接，恢复会话时关闭旧连接
+func (m *Manager) addSessionClient(secret string, conn *websocket.Conn, session clientSession, welcome func(*Client) error) (*Client, error) {
+	client := m.newClient(secret, conn, session)
+
+	previous := session.attach(client)
+	if err := m.addClient(client, welcome); err != nil {
+		session.detach(client)
+		if previous != nil {
+			session.attach(previous)
+		}
+		return nil, err
+	}
+
+	if previous != nil {
+		log.Printf("会话 [%s/%s] 已在新连接上恢复，关闭旧连接 %s", utils.MaskSecret(secret), session.SessionID(), previous.ID)
+		go previous.close(websocket.CloseServiceRestart, "会话已在新连接上恢复")
+	}
+	return client, nil
+}
+
+// purgeSessions 清理超过恢复时间的会话
+func (m *Manager) purgeSessions() {
+	timeout := m.sessionTimeout()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, session := range m.sessions {
+		if session.expired(timeout) {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+// removeSessionsLocked 删除密钥下的所有会话，调用方必须持有管理器写锁
+func (m *Manager) removeSessionsLocked(secret string) {
+	for id, session := range m.sessions {
+		if session.owner() == secret {
+			delete(m.sessions, id)
+		}
+	}
+	delete(m.streams, secret)
+}
+
+// generateSessionID 生成会话ID
+func generateSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return generateClientID() + generateClientID()
+	}
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"nekobridge/internal/config"
+	"nekobridge/internal/models"
+)
+
+// Settings 连接实际生效的读写设置，由 WebSocket 配置和连接协议计算得出
+type Settings struct {
+	ReadTimeout       time.Duration // 读超时，收到任何消息或 Pong 后重新计时
+	WriteTimeout      time.Duration // 每次写入的超时，0 表示不限制
+	MaxMessageSize    int64         // 单条消息的最大字节数，0 表示不限制
+	Heartbeat         bool          // 是否由服务端发送心跳
+	HeartbeatInterval time.Duration
+	HeartbeatTimeout  time.Duration
+	AppliedAt         time.Time // 设置生效的时间
+}
+
+// sameAs 比较两组设置是否相同（忽略生效时间）
+func (s Settings) sameAs(other Settings) bool {
+	s.AppliedAt = other.AppliedAt
+	return s == other
+}
+
+// heartbeatSettings 只保留心跳相关的设置，用于判断心跳循环是否需要重启
+func (s Settings) heartbeatSettings() Settings {
+	if !s.Heartbeat {
+		return Settings{}
+	}
+	return Settings{
+		Heartbeat:         s.Heartbeat,
+		HeartbeatInterval: s.HeartbeatInterval,
+		HeartbeatTimeout:  s.HeartbeatTimeout,
+	}
+}
+
+// Model 转换为 API 返回的连接设置（时间以毫秒表示）
+func (s Settings) Model() *models.ConnectionSettings {
+	return &models.ConnectionSettings{
+		ReadTimeout:       s.ReadTimeout.Milliseconds(),
+		WriteTimeout:      s.WriteTimeout.Milliseconds(),
+		MaxMessageSize:    s.MaxMessageSize,
+		Heartbeat:         s.Heartbeat,
+		HeartbeatInterval: s.HeartbeatInterval.Milliseconds(),
+		HeartbeatTimeout:  s.HeartbeatTimeout.Milliseconds(),
+		AppliedAt:         s.AppliedAt,
+	}
+}
+
+// Settings 按当前配置计算指定协议连接的设置
+// 读超时至少为两个心跳间隔，避免心跳到达之前超时；QQ 网关协议由客户端按 gateway_heartbeat 发送心跳，同样适用
+func (m *Manager) Settings(protocol string) Settings {
+	var ws config.WebSocketConfig
+	if m.config != nil {
+		ws = m.config.GetWebSocketConfig()
+	}
+
+	settings := Settings{
+		ReadTimeout:       time.Duration(ws.ReadTimeout) * time.Millisecond,
+		WriteTimeout:      time.Duration(ws.WriteTimeout) * time.Millisecond,
+		MaxMessageSize:    int64(ws.MaxMessageSize),
+		Heartbeat:         ws.EnableHeartbeat,
+		HeartbeatInterval: time.Duration(ws.HeartbeatInterval) * time.Millisecond,
+		HeartbeatTimeout:  time.Duration(ws.HeartbeatTimeout) * time.Millisecond,
+		AppliedAt:         time.Now(),
+	}
+	if settings.ReadTimeout <= 0 {
+		settings.ReadTimeout = 60 * time.Second // 默认 60s
+	}
+	if settings.WriteTimeout < 0 {
+		settings.WriteTimeout = 0
+	}
+	if settings.MaxMessageSize < 0 {
+		settings.MaxMessageSize = 0
+	}
+	if settings.HeartbeatInterval <= 0 {
+		settings.HeartbeatInterval = 30 * time.Second
+	}
+	if settings.HeartbeatTimeout <= 0 {
+		settings.HeartbeatTimeout = 5 * time.Second
+	}
+
+	if settings.Heartbeat && settings.ReadTimeout < 2*settings.HeartbeatInterval {
+		settings.ReadTimeout = 2 * settings.HeartbeatInterval
+	}
+	if protocol == config.ProtocolQQ {
+		gatewayHeartbeat := time.Duration(ws.GatewayHeartbeat) * time.Millisecond
+		if gatewayHeartbeat <= 0 {
+			gatewayHeartbeat = 41250 * time.Millisecond
+		}
+		if settings.ReadTimeout < 2*gatewayHeartbeat {
+			settings.ReadTimeout = 2 * gatewayHeartbeat
+		}
+	}
+	return settings
+}
+
+// ApplyConfig 将修改后的 WebSocket 配置应用到心跳循环和所有现有连接
+// 心跳设置变化时重启（或停止）心跳循环；连接的读写超时立即生效，消息大小限制从下一条消息开始生效
+func (m *Manager) ApplyConfig() {
+	m.heartbeatMu.Lock()
+	restart := !m.Settings(config.ProtocolRaw).heartbeatSettings().sameAs(m.heartbeat)
+	m.heartbeatMu.Unlock()
+	if restart {
+		m.StartHeartbeat()
+	}
+
+	updated := 0
+	for _, client := range m.allClients() {
+		if client.applySettings(m.Settings(client.Protocol())) {
+			updated++
+		}
+	}
+	if updated > 0 {
+		log.Printf("WebSocket 配置已应用到 %d 个现有连接", updated)
+	}
+}
@@ -8,11 +8,17 @@ import (
 	"nekobridge/internal/config"
 	"nekobridge/internal/database"
 	"nekobridge/internal/handlers"
+	"nekobridge/internal/rbac"
+	"nekobridge/internal/traffic"
+	"nekobridge/internal/utils"
 	"nekobridge/internal/websocket"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -24,17 +30,32 @@ import (
 var staticFiles embed.FS
 
 func main() {
+	os.Exit(runCommand(os.Args[1:]))
+}
+
+// runServe 启动服务，收到中断信号后优雅退出
+func runServe(args []string) error {
+	flags := newCommandFlags("serve", "")
+	if _, err := flags.parse(args, 0, 0); err != nil {
+		return err
+	}
+	opts := flags.options
+
 	// 打印启动横幅
 	printStartupBanner()
 
 	// 检查并初始化数据库
-	initializeDatabase()
+	initializeDatabase(opts)
 
 	// 检查并初始化系统配置
-	initializeSystemConfig()
-
-	// 加载配置
-	cfg, err := config.Load()
+	initializeSystemConfig(opts.configPath)
+
+	// 加载配置：内置默认值 < 数据库 < 配置文件 < 环境变量 < 命令行参数
+	configService := &database.ConfigService{}
+	store := config.NewStore(opts.configPath)
+	store.SetDatabaseLayer(configService.GetAllConfigs)
+	store.SetOverrides(opts.overrides)
+	cfg, err := store.Load()
 	if err != nil {
 		log.Fatalf("❌ 配置加载失败: %v", err)
 	}
@@ -44,6 +65,11 @@ func main() {
 		log.Printf("⚠️  密钥同步失败: %v", err)
 	}
 
+	// 将配置文件中的账号迁移为首个管理员
+	if err := migrateConfigAccount(cfg); err != nil {
+		log.Fatalf("❌ 管理员账号迁移失败: %v", err)
+	}
+
 	// 设置Gin模式 - 默认使用发布模式以隐藏调试信息
 	gin.SetMode(gin.ReleaseMode)
 
@@ -56,33 +82,28 @@ func main() {
 	// 添加自定义日志中间件（只记录重要请求）
 	r.Use(customLogger())
 
-	// 配置CORS
-	corsConfig := cors.DefaultConfig()
-	
-	// 如果配置了 * 且启用了 Credentials，需要特殊处理
-	hasWildcard := false
-	for _, origin := range cfg.Server.CORS.Origins {
-		if origin == "*" {
-			hasWildcard = true
-			break
-		}
-	}
-
-	if hasWildcard && cfg.Server.CORS.AllowCredentials {
-		// 当 AllowCredentials 为 true 时，AllowOrigins 不能为 *
-		// 我们可以允许所有来源，但需要通过函数动态返回
-		corsConfig.AllowAllOrigins = true
-	} else {
-		corsConfig.AllowOrigins = cfg.Server.CORS.Origins
+	// 配置CORS，跨域配置变化后重新生成中间件，无需重启
+	corsHandler, err := newCORSHandler(cfg.Server.CORS)
+	if err != nil {
+		log.Fatalf("❌ CORS 配置无效: %v", err)
 	}
-
-	corsConfig.AllowCredentials = cfg.Server.CORS.AllowCredentials
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Accept", "X-Requested-With"}
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
-	corsConfig.ExposeHeaders = []string{"Content-Length"}
-	corsConfig.MaxAge = 12 * time.Hour
-	
-	r.Use(cors.New(corsConfig))
+	var currentCORS atomic.Value
+	currentCORS.Store(corsHandler)
+	r.Use(func(c *gin.Context) {
+		currentCORS.Load().(gin.HandlerFunc)(c)
+	})
+	store.Subscribe(func(old, current *config.Config) {
+		if reflect.DeepEqual(old.Server.CORS, current.Server.CORS) {
+			return
+		}
+		handler, err := newCORSHandler(current.Server.CORS)
+		if err != nil {
+			log.Printf("⚠️  CORS 配置无效，继续使用之前的配置: %v", err)
+			return
+		}
+		currentCORS.Store(handler)
+		log.Printf("🔄 CORS 配置已更新: %v", current.Server.CORS.Origins)
+	})
 
 	// 设置受信任的代理（解决GIN警告并支持获取真实IP）
 	if len(cfg.Server.TrustedProxies) > 0 {
@@ -95,27 +116,50 @@ func main() {
 	wsManager := websocket.NewManager()
 	wsManager.SetConfig(cfg)
 	wsManager.StartHeartbeat()
+	store.Subscribe(func(old, current *config.Config) {
+		if !reflect.DeepEqual(old.WebSocket, current.WebSocket) {
+			wsManager.ApplyConfig()
+		}
+	})
+
+	// 数据库连接在启动时建立，修改数据库配置后需要重启
+	store.Subscribe(func(old, current *config.Config) {
+		if old.Database != current.Database {
+			log.Printf("⚠️  数据库配置已修改，重启服务后生效")
+		}
+	})
+
+	// 启动流量历史统计
+	traffic.Start(cfg)
 
 	// 初始化处理器
-	handlers.Init(r, cfg, wsManager, staticFiles)
+	handlers.Init(r, store, wsManager, staticFiles)
+
+	// 监听配置文件，修改后自动重新加载
+	if stopWatch, err := store.Watch(); err != nil {
+		log.Printf("⚠️  无法监听配置文件，修改配置文件后需要重启: %v", err)
+	} else {
+		defer stopWatch()
+	}
 
-	// 打印服务信息
-	printServiceInfo(cfg)
+	// 打印服务信息（配置文件监听已启动，使用副本避免与重新加载并发读写）
+	printServiceInfo(cfg.Clone())
 
 	// 配置 HTTP 服务器
+	server := cfg.GetServerConfig()
 	srv := &http.Server{
-		Addr:    ":" + cfg.Server.Port,
+		Addr:    ":" + server.Port,
 		Handler: r,
 	}
 
 	// 在 goroutine 中启动服务器
 	go func() {
-		if cfg.Server.SSL.Enabled {
-			if cfg.Server.SSL.Cert == "" || cfg.Server.SSL.Key == "" {
+		if server.SSL.Enabled {
+			if server.SSL.Cert == "" || server.SSL.Key == "" {
 				log.Fatalf("❌ SSL 已启用，但未配置证书文件路径 (cert/key)")
 			}
 			fmt.Printf("🔒 SSL 已启用，正在通过 HTTPS 启动服务...\n")
-			if err := srv.ListenAndServeTLS(cfg.Server.SSL.Cert, cfg.Server.SSL.Key); err != nil && err != http.ErrServerClosed {
+			if err := srv.ListenAndServeTLS(server.SSL.Cert, server.SSL.Key); err != nil && err != http.ErrServerClosed {
 				log.Fatalf("❌ 服务器 (HTTPS) 启动失败: %v", err)
 			}
 		} else {
@@ -140,7 +184,13 @@ func main() {
 		log.Fatal("❌ 服务器强制关闭: ", err)
 	}
 
+	// 写入尚未落库的流量统计
+	if err := traffic.Flush(); err != nil {
+		log.Printf("⚠️  写入流量统计失败: %v", err)
+	}
+
 	log.Println("✅ 服务器已成功退出")
+	return nil
 }
 
 // syncSecretsFromDatabase 从数据库同步密钥到配置
@@ -154,11 +204,18 @@ func syncSecretsFromDatabase(cfg *config.Config) error {
 	// 将数据库中的密钥同步到配置
 	for _, dbSecret := range dbSecrets {
 		secretConfig := config.SecretConfig{
-			Description:    dbSecret.Description,
-			Enabled:        dbSecret.Enabled,
-			MaxConnections: dbSecret.MaxConnections,
-			CreatedAt:      dbSecret.CreatedAt,
-			LastUsed:       nil, // 如果需要，可以从数据库加载
+			Description:      dbSecret.Description,
+			AppID:            dbSecret.AppID,
+			Enabled:          dbSecret.Enabled,
+			MaxConnections:   dbSecret.MaxConnections,
+			DeliveryMode:     dbSecret.DeliveryMode,
+			Protocol:         dbSecret.Protocol,
+			UpstreamURL:      dbSecret.UpstreamURL,
+			UpstreamTypes:    dbSecret.UpstreamTypes,
+			QueueMaxAge:      dbSecret.QueueMaxAge,
+			QueueMaxMessages: dbSecret.QueueMaxMessages,
+			CreatedAt:        dbSecret.CreatedAt,
+			LastUsed:         nil, // 如果需要，可以从数据库加载
 		}
 		cfg.AddSecret(dbSecret.Secret, secretConfig)
 	}
@@ -167,21 +224,92 @@ func syncSecretsFromDatabase(cfg *config.Config) error {
 	return nil
 }
 
-// initializeDatabase 检查并初始化数据库
-func initializeDatabase() {
-	// 检查数据库文件是否存在
-	dbPath := "data/webhook_pro.db"
-	dbExists := false
-
-	if _, err := os.Stat(dbPath); err == nil {
-		dbExists = true
-		fmt.Printf("📁 发现数据库文件: %s\n", dbPath)
+// migrateConfigAccount 用户表为空时，将配置文件中的 auth.username 和 auth.password 迁移为首个管理员
+func migrateConfigAccount(cfg *config.Config) error {
+	userService := &database.UserService{}
+	count, err := userService.CountUsers()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	passwordHash := cfg.Auth.Password
+	if !strings.HasPrefix(passwordHash, "$2") {
+		passwordHash, err = utils.HashPassword(cfg.Auth.Password)
+		if err != nil {
+			return err
+		}
+	}
+
+	admin := &database.User{
+		Username:     cfg.Auth.Username,
+		PasswordHash: passwordHash,
+		Role:         rbac.RoleAdmin,
+		Enabled:      true,
+		CreatedBy:    "system",
+	}
+	if err := userService.CreateUser(admin); err != nil {
+		return err
+	}
+
+	log.Printf("✅ 已将配置文件中的账号 %s 迁移为管理员", admin.Username)
+	return nil
+}
+
+// newCORSHandler 根据跨域配置生成 CORS 中间件
+func newCORSHandler(cfg config.CORSConfig) (gin.HandlerFunc, error) {
+	corsConfig := cors.DefaultConfig()
+
+	// 如果配置了 * 且启用了 Credentials，需要特殊处理
+	hasWildcard := false
+	for _, origin := range cfg.Origins {
+		if origin == "*" {
+			hasWildcard = true
+			break
+		}
+	}
+
+	if hasWildcard && cfg.AllowCredentials {
+		// 当 AllowCredentials 为 true 时，AllowOrigins 不能为 *
+		// 我们可以允许所有来源，但需要通过函数动态返回
+		corsConfig.AllowAllOrigins = true
 	} else {
-		fmt.Printf("🔄 数据库文件不存在，开始创建: %s\n", dbPath)
-		// 确保数据目录存在
-		if err := os.MkdirAll("data", 0755); err != nil {
-			log.Fatalf("❌ 创建数据目录失败: %v", err)
+		corsConfig.AllowOrigins = cfg.Origins
+	}
+
+	corsConfig.AllowCredentials = cfg.AllowCredentials
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Accept", "X-Requested-With", "X-API-Key"}
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"}
+	corsConfig.ExposeHeaders = []string{"Content-Length"}
+	corsConfig.MaxAge = 12 * time.Hour
+
+	if err := corsConfig.Validate(); err != nil {
+		return nil, err
+	}
+	return cors.New(corsConfig), nil
+}
+
+// initializeDatabase 检查并初始化数据库
+func initializeDatabase(opts options) {
+	// 数据库连接配置来自配置文件、环境变量和命令行参数
+	if err := configureDatabase(opts); err != nil {
+		log.Fatalf("❌ 数据库配置无效: %v", err)
+	}
+
+	// 检查数据库文件是否存在，PostgreSQL 和 MySQL 直接连接
+	dbExists := true
+	if database.Driver() == config.DatabaseSQLite {
+		dbPath := database.Path()
+		if _, err := os.Stat(dbPath); err == nil {
+			fmt.Printf("📁 发现数据库文件: %s\n", dbPath)
+		} else {
+			dbExists = false
+			fmt.Printf("🔄 数据库文件不存在，开始创建: %s\n", dbPath)
 		}
+	} else {
+		fmt.Printf("🔗 连接数据库: %s\n", database.Describe())
 	}
 
 	// 初始化数据库（这将创建表结构，如果已存在则跳过）
@@ -197,9 +325,8 @@ func initializeDatabase() {
 }
 
 // initializeSystemConfig 检查并初始化系统配置
-func initializeSystemConfig() {
+func initializeSystemConfig(configPath string) {
 	// 检查配置文件是否存在
-	configPath := "configs/config.yaml"
 	configExists := false
 
 	if _, err := os.Stat(configPath); err == nil {
@@ -208,7 +335,7 @@ func initializeSystemConfig() {
 	} else {
 		fmt.Printf("🔄 配置文件不存在，将创建默认配置: %s\n", configPath)
 		// 确保配置目录存在
-		if err := os.MkdirAll("configs", 0755); err != nil {
+		if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 			log.Fatalf("❌ 创建配置目录失败: %v", err)
 		}
 	}
@@ -254,7 +381,7 @@ func printServiceInfo(cfg *config.Config) {
 	fmt.Println()
 	fmt.Println("📋 服务信息:")
 	fmt.Printf("   🌐 Web管理界面: %s://%s:%s\n", protocol, host, cfg.Server.Port)
-	fmt.Printf("   🪝 Webhook接口: %s://%s:%s/api/webhook?secret=YOUR_SECRET\n", protocol, host, cfg.Server.Port)
+	fmt.Printf("   🪝 Webhook接口: %s://%s:%s/api/webhook/YOUR_APPID\n", protocol, host, cfg.Server.Port)
 	fmt.Printf("   📡 WebSocket地址: %s://%s:%s/ws/YOUR_SECRET\n", wsProtocol, host, cfg.Server.Port)
 	fmt.Println()
 	fmt.Println("🔧 配置信息:")
@@ -291,9 +418,12 @@ func customLogger() gin.HandlerFunc {
 
 		start := time.Now()
 
+		// 路径中携带的密钥只输出首尾几个字符
+		logPath := utils.MaskSecretPath(urlPath, "/ws/", "/api/openapi/")
+
 		// 如果是 WebSocket 请求，先打印一条开始日志
 		if strings.HasPrefix(urlPath, "/ws/") {
-			fmt.Printf("[🆕] 🔗 WebSocket 握手请求: %s %s\n", c.Request.Method, urlPath)
+			fmt.Printf("[🆕] 🔗 WebSocket 握手请求: %s %s\n", c.Request.Method, logPath)
 		}
 
 		c.Next()
@@ -308,7 +438,7 @@ func customLogger() gin.HandlerFunc {
 			fmt.Printf("[%s] %s %s %v %s\n",
 				statusColor,
 				methodColor,
-				urlPath,
+				logPath,
 				latency,
 				c.ClientIP(),
 			)
@@ -206,6 +206,10 @@ const Dashboard: React.FC<DashboardProps> = ({
                   <div>运行时间: {Math.floor(stats.system.uptime / 3600)} 小时</div>
                   <div>CPU 核心: {stats.system.cpu_cores} 核</div>
                   <div>CPU 型号: {stats.system.cpu_model}</div>
+                  <div>进程 CPU: {stats.system.cpu_process}% / 常驻内存: {stats.system.rss} MB</div>
+                  {stats.system.load_average.length > 0 && (
+                    <div>平均负载: {stats.system.load_average.map((load) => load.toFixed(2)).join(' / ')}</div>
+                  )}
                 </div>
               </Space>
             </Card>
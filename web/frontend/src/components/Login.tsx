@@ -27,6 +27,7 @@ interface LoginProps {
 const Login: React.FC<LoginProps> = ({ onLogin }) => {
   const [loading, setLoading] = useState(false);
   const [showPassword, setShowPassword] = useState(false);
+  const [mfaToken, setMfaToken] = useState<string | null>(null);
   const [form] = Form.useForm();
   const { isDark, toggleTheme } = useTheme();
 
@@ -43,9 +44,15 @@ const Login: React.FC<LoginProps> = ({ onLogin }) => {
       
       console.log('发送登录请求:', loginData);
       
-      const response = await apiService.login(loginData);
+      const response = mfaToken
+        ? await apiService.verifyMfa(mfaToken, values.code?.trim())
+        : await apiService.login(loginData);
       
-      if (response.success && response.data?.token) {
+      if (response.success && response.data?.mfa_required && response.data.mfa_token) {
+        // 账号已启用两步验证，需要再输入验证器应用中的验证码
+        setMfaToken(response.data.mfa_token);
+        MessagePlugin.info(response.data.message || '请输入两步验证码');
+      } else if (response.success && response.data?.token) {
         MessagePlugin.success('登录成功');
         onLogin(response.data.token);
       } else {
@@ -55,13 +62,20 @@ const Login: React.FC<LoginProps> = ({ onLogin }) => {
       console.error('登录失败:', error);
       let errorMessage = '登录失败';
       
-      if (error.response?.data?.message) {
+      if (error.response?.data?.error) {
+        errorMessage = error.response.data.error;
+      } else if (error.response?.data?.message) {
         errorMessage = error.response.data.message;
       } else if (error.message) {
         errorMessage = error.message;
       }
       
       MessagePlugin.error(errorMessage);
+      // 两步验证质询过期或错误次数过多时回到密码输入
+      if (mfaToken && error.response?.status === 401 && errorMessage.includes('过期')) {
+        setMfaToken(null);
+        form.setFieldsValue({ code: '' });
+      }
     } finally {
       setLoading(false);
     }
@@ -198,6 +212,7 @@ const Login: React.FC<LoginProps> = ({ onLogin }) => {
           colon={false}
           requiredMark={false}
         >
+          {!mfaToken && (
           <FormItem
             name="username"
             label={
@@ -254,6 +269,35 @@ const Login: React.FC<LoginProps> = ({ onLogin }) => {
               }}
             />
           </FormItem>
+          )}
+
+          {mfaToken && (
+          <FormItem
+            name="code"
+            label={
+              <Text style={{ color: isDark ? '#C9CDD4' : '#4E5969', fontSize: '13px', fontWeight: '500' }}>
+                两步验证码
+              </Text>
+            }
+            help="输入验证器应用中的 6 位验证码，或使用一个恢复码"
+            rules={[{ required: true, message: '请输入验证码' }]}
+          >
+            <Input
+              prefixIcon={<KeyIcon style={{ color: '#86909C' }} />}
+              placeholder="6 位验证码或恢复码"
+              size="large"
+              autofocus
+              style={{ 
+                height: '52px',
+                background: isDark ? 'rgba(255, 255, 255, 0.03)' : '#FFFFFF',
+                borderColor: isDark ? 'rgba(255, 255, 255, 0.1)' : '#E5E6EB',
+                color: isDark ? '#FFFFFF' : '#1D2129',
+                borderRadius: '12px',
+                transition: 'all 0.2s',
+              }}
+            />
+          </FormItem>
+          )}
 
           <FormItem style={{ marginTop: '40px' }}>
             <Button
@@ -272,8 +316,13 @@ const Login: React.FC<LoginProps> = ({ onLogin }) => {
                 boxShadow: '0 4px 12px rgba(22, 93, 255, 0.25)',
               }}
             >
-              {loading ? '身份验证中...' : '立即登录'}
+              {loading ? '身份验证中...' : mfaToken ? '验证' : '立即登录'}
             </Button>
+            {mfaToken && (
+              <Button variant="text" block onClick={() => setMfaToken(null)} style={{ marginTop: '8px' }}>
+                返回重新登录
+              </Button>
+            )}
           </FormItem>
         </Form>
 
@@ -8,6 +8,17 @@ import type {
   Secret,
   BanInfo,
   DashboardStats,
+  TrafficHistory,
+  TrafficHistoryQuery,
+  User,
+  UserRole,
+  Session,
+  LockoutStatus,
+  TOTPStatus,
+  TOTPSetup,
+  APIKey,
+  AuditLog,
+  AuditFilter,
   SecretStats,
   BatchOperationRequest,
   BatchOperationResult,
@@ -34,23 +45,35 @@ const apiClient: AxiosInstance = axios.create({
 // 认证管理器
 class AuthManager {
   private token: string | null = null;
+  private refreshToken: string | null = null;
 
   constructor() {
     this.token = localStorage.getItem('auth_token');
+    this.refreshToken = localStorage.getItem('refresh_token');
   }
 
-  setToken(token: string): void {
+  setToken(token: string, refreshToken?: string): void {
     this.token = token;
     localStorage.setItem('auth_token', token);
+    if (refreshToken) {
+      this.refreshToken = refreshToken;
+      localStorage.setItem('refresh_token', refreshToken);
+    }
   }
 
   getToken(): string | null {
     return this.token;
   }
 
+  getRefreshToken(): string | null {
+    return this.refreshToken;
+  }
+
   clearToken(): void {
     this.token = null;
+    this.refreshToken = null;
     localStorage.removeItem('auth_token');
+    localStorage.removeItem('refresh_token');
   }
 
   isAuthenticated(): boolean {
@@ -64,6 +87,34 @@ class AuthManager {
 
 export const authManager = new AuthManager();
 
+// 正在进行的令牌刷新，多个请求同时收到 401 时共用一次刷新（刷新令牌只能使用一次）
+let refreshPromise: Promise<boolean> | null = null;
+
+// 使用刷新令牌换取新的访问令牌
+const refreshAccessToken = (): Promise<boolean> => {
+  const refreshToken = authManager.getRefreshToken();
+  if (!refreshToken) {
+    return Promise.resolve(false);
+  }
+  if (!refreshPromise) {
+    refreshPromise = axios
+      .post<ApiResponse<LoginResponse>>(`${API_BASE_URL}/auth/refresh`, { refresh_token: refreshToken })
+      .then((response) => {
+        const data = response.data.data;
+        if (response.data.success && data?.token) {
+          authManager.setToken(data.token, data.refresh_token);
+          return true;
+        }
+        return false;
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+};
+
 // 请求拦截器
 apiClient.interceptors.request.use(
   (config) => {
@@ -83,7 +134,15 @@ apiClient.interceptors.response.use(
   (response: AxiosResponse) => {
     return response;
   },
-  (error) => {
+  async (error) => {
+    const original = error.config;
+    if (error.response?.status === 401 && original && !original._retried && !original.url?.startsWith('/auth/login') && !original.url?.startsWith('/auth/mfa')) {
+      // 访问令牌过期时先尝试刷新，成功后重发原请求
+      original._retried = true;
+      if (await refreshAccessToken()) {
+        return apiClient(original);
+      }
+    }
     if (error.response?.status === 401) {
       authManager.clearToken();
       // 改进：只在非登录页且非已经重定向的情况下跳转
@@ -101,7 +160,16 @@ export class ApiService {
   async login(credentials: LoginRequest): Promise<ApiResponse<LoginResponse>> {
     const response = await apiClient.post<ApiResponse<LoginResponse>>('/auth/login', credentials);
     if (response.data.success && response.data.data?.token) {
-      authManager.setToken(response.data.data.token);
+      authManager.setToken(response.data.data.token, response.data.data.refresh_token);
+    }
+    return response.data;
+  }
+
+  // 提交两步验证码（动态验证码或恢复码）完成登录
+  async verifyMfa(mfaToken: string, code: string): Promise<ApiResponse<LoginResponse>> {
+    const response = await apiClient.post<ApiResponse<LoginResponse>>('/auth/mfa', { mfa_token: mfaToken, code });
+    if (response.data.success && response.data.data?.token) {
+      authManager.setToken(response.data.data.token, response.data.data.refresh_token);
     }
     return response.data;
   }
@@ -321,6 +389,159 @@ export class ApiService {
     const response = await apiClient.get<ApiResponse<DashboardStats>>('/dashboard/stats');
     return response.data;
   }
+
+  // 流量历史
+  async getTrafficHistory(query: TrafficHistoryQuery = {}): Promise<ApiResponse<TrafficHistory>> {
+    const response = await apiClient.get<ApiResponse<TrafficHistory>>('/traffic/history', {
+      params: {
+        granularity: query.granularity,
+        from: query.from,
+        to: query.to,
+        secret: query.secrets?.join(','),
+        app_id: query.appIds?.join(','),
+      },
+    });
+    return response.data;
+  }
+
+  // 用户管理
+  async getUsers(): Promise<ApiResponse<{ users: User[]; roles: UserRole[] }>> {
+    const response = await apiClient.get<ApiResponse<{ users: User[]; roles: UserRole[] }>>('/users');
+    return response.data;
+  }
+
+  async createUser(user: { username: string; password: string; role: UserRole; enabled?: boolean }): Promise<ApiResponse<User>> {
+    const response = await apiClient.post<ApiResponse<User>>('/users', user);
+    return response.data;
+  }
+
+  async updateUser(id: number, updates: { password?: string; role?: UserRole; enabled?: boolean }): Promise<ApiResponse<User>> {
+    const response = await apiClient.put<ApiResponse<User>>(`/users/${id}`, updates);
+    return response.data;
+  }
+
+  async deleteUser(id: number): Promise<ApiResponse> {
+    const response = await apiClient.delete<ApiResponse>(`/users/${id}`);
+    return response.data;
+  }
+
+  // 会话管理
+  async getMySessions(): Promise<ApiResponse<Session[]>> {
+    const response = await apiClient.get<ApiResponse<Session[]>>('/auth/sessions');
+    return response.data;
+  }
+
+  async revokeMySession(id: string): Promise<ApiResponse> {
+    const response = await apiClient.delete<ApiResponse>(`/auth/sessions/${id}`);
+    return response.data;
+  }
+
+  async revokeOtherSessions(): Promise<ApiResponse<{ revoked: number }>> {
+    const response = await apiClient.delete<ApiResponse<{ revoked: number }>>('/auth/sessions');
+    return response.data;
+  }
+
+  async getSessions(username?: string): Promise<ApiResponse<Session[]>> {
+    const response = await apiClient.get<ApiResponse<Session[]>>('/sessions', { params: { username } });
+    return response.data;
+  }
+
+  async revokeSession(id: string): Promise<ApiResponse> {
+    const response = await apiClient.delete<ApiResponse>(`/sessions/${id}`);
+    return response.data;
+  }
+
+  async revokeUserSessions(userId: number): Promise<ApiResponse<{ revoked: number }>> {
+    const response = await apiClient.delete<ApiResponse<{ revoked: number }>>(`/users/${userId}/sessions`);
+    return response.data;
+  }
+
+  // 登录锁定
+  async getLockouts(): Promise<ApiResponse<LockoutStatus[]>> {
+    const response = await apiClient.get<ApiResponse<LockoutStatus[]>>('/lockouts');
+    return response.data;
+  }
+
+  async clearLockout(target: { ip?: string; username?: string }): Promise<ApiResponse> {
+    const response = await apiClient.delete<ApiResponse>('/lockouts', { params: target });
+    return response.data;
+  }
+
+  // API Key
+  async getApiKeys(): Promise<ApiResponse<{ api_keys: APIKey[]; scopes: string[] }>> {
+    const response = await apiClient.get<ApiResponse<{ api_keys: APIKey[]; scopes: string[] }>>('/apikeys');
+    return response.data;
+  }
+
+  async createApiKey(data: {
+    name: string;
+    scopes: string[];
+    allowed_ips?: string[];
+    expires_at?: string;
+  }): Promise<ApiResponse<{ key: string; api_key: APIKey }>> {
+    const response = await apiClient.post<ApiResponse<{ key: string; api_key: APIKey }>>('/apikeys', data);
+    return response.data;
+  }
+
+  async revokeApiKey(id: number): Promise<ApiResponse> {
+    const response = await apiClient.delete<ApiResponse>(`/apikeys/${id}`);
+    return response.data;
+  }
+
+  // 审计记录
+  async getAuditLogs(filter: AuditFilter = {}, limit = 100, offset = 0): Promise<ApiResponse<{ entries: AuditLog[]; total: number }>> {
+    const response = await apiClient.get<ApiResponse<{ entries: AuditLog[]; total: number }>>('/audit', {
+      params: { ...filter, limit, offset },
+    });
+    return response.data;
+  }
+
+  async exportAuditLogs(filter: AuditFilter = {}, format: 'csv' | 'ndjson' = 'csv'): Promise<Blob> {
+    const response = await apiClient.get('/audit/export', {
+      params: { ...filter, format },
+      responseType: 'blob',
+    });
+    return response.data;
+  }
+
+  // 两步验证
+  async getTotpStatus(): Promise<ApiResponse<TOTPStatus>> {
+    const response = await apiClient.get<ApiResponse<TOTPStatus>>('/auth/totp');
+    return response.data;
+  }
+
+  async setupTotp(password: string): Promise<ApiResponse<TOTPSetup>> {
+    const response = await apiClient.post<ApiResponse<TOTPSetup>>('/auth/totp/setup', { password });
+    return response.data;
+  }
+
+  async enableTotp(code: string): Promise<ApiResponse<{ recovery_codes: string[] }>> {
+    const response = await apiClient.post<ApiResponse<{ recovery_codes: string[] }>>('/auth/totp/enable', { code });
+    return response.data;
+  }
+
+  async disableTotp(password: string, code: string): Promise<ApiResponse> {
+    const response = await apiClient.post<ApiResponse>('/auth/totp/disable', { password, code });
+    return response.data;
+  }
+
+  async regenerateRecoveryCodes(code: string): Promise<ApiResponse<{ recovery_codes: string[] }>> {
+    const response = await apiClient.post<ApiResponse<{ recovery_codes: string[] }>>('/auth/totp/recovery-codes', { code });
+    return response.data;
+  }
+
+  async resetUserTotp(userId: number): Promise<ApiResponse> {
+    const response = await apiClient.delete<ApiResponse>(`/users/${userId}/totp`);
+    return response.data;
+  }
+
+  async changePassword(oldPassword: string, newPassword: string): Promise<ApiResponse> {
+    const response = await apiClient.put<ApiResponse>('/auth/password', {
+      old_password: oldPassword,
+      new_password: newPassword,
+    });
+    return response.data;
+  }
 }
 
 // 创建API服务实例
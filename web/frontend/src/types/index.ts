@@ -68,7 +68,110 @@ export interface LoginRequest {
 export interface LoginResponse {
   success: boolean;
   token?: string;
+  refresh_token?: string;
+  expires_in?: number;
+  user?: UserInfo;
   message?: string;
+  mfa_required?: boolean; // 需要提交两步验证码才能完成登录
+  mfa_token?: string;
+}
+
+// 用户角色
+export type UserRole = 'viewer' | 'operator' | 'admin';
+
+// 当前登录用户
+export interface UserInfo {
+  username: string;
+  role: UserRole;
+  permissions: string[];
+}
+
+// 登录会话
+export interface Session {
+  id: string;
+  username: string;
+  ip: string;
+  user_agent: string;
+  last_active_at: string;
+  expires_at: string;
+  created_at: string;
+  current: boolean;
+}
+
+// 登录失败退避或锁定状态
+export interface LockoutStatus {
+  scope: 'ip' | 'username';
+  value: string;
+  failures: number;
+  last_failure: string;
+  blocked_until: string;
+  locked: boolean;
+}
+
+// 管理后台用户
+export interface User {
+  id: number;
+  username: string;
+  role: UserRole;
+  enabled: boolean;
+  totpEnabled: boolean;
+  lastLoginAt?: string;
+  createdBy: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+// 自动化脚本使用的 API Key，通过 X-API-Key 请求头认证
+export interface APIKey {
+  id: number;
+  name: string;
+  prefix: string;
+  scopes: string[];
+  allowedIps: string[];
+  expiresAt?: string;
+  lastUsedAt?: string;
+  lastUsedIp: string;
+  createdBy: string;
+  revokedAt?: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+// 管理操作审计记录，before/after 为发生变化的字段（JSON）
+export interface AuditLog {
+  id: number;
+  actor: string;
+  ip: string;
+  action: string;
+  target: string;
+  before?: string;
+  after?: string;
+  result: 'success' | 'failure';
+  detail?: string;
+  createdAt: string;
+}
+
+// 审计记录筛选条件，action 支持前缀（例如 secret）
+export interface AuditFilter {
+  actor?: string;
+  action?: string;
+  target?: string;
+  result?: 'success' | 'failure';
+  from?: string;
+  to?: string;
+}
+
+// 两步验证状态
+export interface TOTPStatus {
+  enabled: boolean;
+  pending: boolean;
+  recovery_codes_remaining: number;
+}
+
+// 两步验证密钥，uri 可生成二维码供验证器应用扫描
+export interface TOTPSetup {
+  secret: string;
+  uri: string;
 }
 
 // 认证状态
@@ -96,12 +199,54 @@ export interface DashboardStats {
     uptime: number;
     memory: number;
     cpu: number;
+    cpu_process: number;
     cpu_cores: number;
     cpu_model: string;
+    cpu_speed: number;
+    rss: number;
     load_average: number[];
   };
 }
 
+// 流量统计粒度
+export type TrafficGranularity = 'minute' | 'hour' | 'day';
+
+// 流量计数
+export interface TrafficCounts {
+  received: number;
+  forwarded: number;
+  queued: number;
+  dropped: number;
+  bytes: number;
+  connects: number;
+  disconnects: number;
+  errors: number;
+}
+
+// 流量历史中的一个时间段
+export interface TrafficPoint extends TrafficCounts {
+  time: string;
+}
+
+// 流量历史
+export interface TrafficHistory {
+  granularity: TrafficGranularity;
+  from: string;
+  to: string;
+  secrets?: string[];
+  totals: TrafficCounts;
+  points: TrafficPoint[];
+}
+
+// 流量历史查询参数
+export interface TrafficHistoryQuery {
+  granularity?: TrafficGranularity;
+  from?: string | number;
+  to?: string | number;
+  secrets?: string[];
+  appIds?: string[];
+}
+
 // 密钥统计
 export interface SecretStats {
   total: number;
@@ -160,9 +305,11 @@ export interface HealthResponse {
     heap_inuse: number;
     heap_released: number;
     heap_objects: number;
+    rss: number;
   };
   cpu: {
     usage: number;
+    process_usage: number;
     cores: number;
     model: string;
     speed: number;